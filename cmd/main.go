@@ -1,23 +1,52 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"gitlab.com/shingeki-no-kyojin/ymir/config"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/apitoken"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
 	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/backup"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/health"
 	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/ledger"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/lockout"
 	"gitlab.com/shingeki-no-kyojin/ymir/internal/middleware"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/migrate"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/oidc"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/outbox"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/passwordpolicy"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/totp"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
 	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/vault"
 	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+	"golang.org/x/sync/errgroup"
 )
 
 const version = "1.0.0"
 
 func main() {
+	os.Exit(run())
+}
+
+// run starts the service and returns the exit code of the process. It returns
+// instead of exiting itself, so the deferred cleanup runs first.
+func run() (code int) {
 	var cfg *config.Config
 
 	cfg, err := config.LoadConfig()
@@ -25,20 +54,124 @@ func main() {
 		panic(fmt.Sprintf("failed to load config: %v", err))
 	}
 	logger := logger.New()
+	// runs last, after every deferred call that still logs
+	defer logger.Sync()
 
 	flag.IntVar(&cfg.Port, "port", 4000, "Application port")
-	flag.StringVar(&cfg.Env, "env", "dev", "Environment (dev|staging|prod)")
+	flag.StringVar(&cfg.Env, "env", cmp.Or(cfg.Env, envDev), "Environment (dev|staging|prod)")
+	migrateOnly := flag.Bool("migrate", false, "Apply the database migrations and exit")
+	rebuildOnly := flag.Bool("rebuild-projections", false, "Rebuild the account balances and bookings from the ledger events and exit")
 	flag.Parse()
 
+	tokenService, err := newTokenService(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load signing keys: %v", err))
+	}
+
+	// database
+	storage := storageBackend(cfg)
+	db, vaultFile, err := openDatabase(storage, cfg, logger)
+	if err != nil {
+		panic(fmt.Sprintf("failed to open database: %v", err))
+	}
+	if vaultFile != nil {
+		// the deferred close saves the changes of every command and of the
+		// requests that completed after the last save of Run
+		defer func() {
+			if err := vaultFile.Close(); err != nil {
+				logger.Error(fmt.Sprintf("failed to save vault: %v", err))
+				code = 1
+			}
+		}()
+	}
+
+	// PostgreSQL only holds the users, the other stores keep their data in the
+	// SQLite file of SQLITE_PATH
+	storeDB, err := openStoreDatabase(storage, cfg, db)
+	if err != nil {
+		panic(fmt.Sprintf("failed to open database: %v", err))
+	}
+
+	// backup and restore
+	if command := flag.Arg(0); command != "" {
+		if err := runCommand(context.Background(), command, flag.Args()[1:], storage, db, logger); err != nil {
+			panic(fmt.Sprintf("failed to %s: %v", command, err))
+		}
+		return 0
+	}
+
 	// migration
-	// removed from showcase
+	if *migrateOnly || (db != nil && cfg.DatabaseAutoMigrate) {
+		if db == nil {
+			panic("STORAGE postgres, sqlite or vault is required to migrate")
+		}
+		if err := migrateDatabase(context.Background(), storage, db, logger); err != nil {
+			panic(fmt.Sprintf("failed to migrate database: %v", err))
+		}
+		if storeDB != db {
+			if err := migrateDatabase(context.Background(), storageSQLite, storeDB, logger); err != nil {
+				panic(fmt.Sprintf("failed to migrate database: %v", err))
+			}
+		}
+	}
+	if *migrateOnly {
+		return 0
+	}
+
+	// stores
+	userRepo, apiTokenRepo, exportRepo, auditRepo, outboxRepo, ledgerRepo, transactor := newStores(storage, db, storeDB)
+	auditUsecases := audit.NewUseCase(auditRepo, id.UUIDGeneratorFunc(id.GenerateUUID))
+	ledgerUsecases := ledger.NewUseCase(ledgerRepo, transactor, id.UUIDGeneratorFunc(id.GenerateUUID), auditUsecases, time.Duration(cfg.TrashRetention)*time.Second)
+
+	// projections
+	if *rebuildOnly {
+		rebuilt, err := ledgerUsecases.Rebuild(context.Background())
+		if err != nil {
+			panic(fmt.Sprintf("failed to rebuild projections: %v", err))
+		}
+		logger.Info(fmt.Sprintf("replayed %d events into %d accounts and %d bookings", rebuilt.Events, rebuilt.Accounts, rebuilt.Bookings))
+		return 0
+	}
+
+	// workers run in the errgroup of serve and stop together with the server
+	workers := make([]worker, 0)
+	if vaultFile != nil {
+		workers = append(workers, vaultFile)
+	}
+
+	// backup
+	if (storage == storageSQLite || storage == storagePostgres) && cfg.SQLiteBackupInterval > 0 {
+		backupWorker := sqlite.NewBackupWorker(storeDB, cfg.SQLiteBackupDir, cfg.SQLiteBackupKeep, logger, time.Duration(cfg.SQLiteBackupInterval)*time.Second)
+		workers = append(workers, backupWorker)
+	}
 
 	// cleaner
-	// removed from showcase
+	purger := user.NewPurger(userRepo, transactor, logger, time.Duration(cfg.PurgeInterval)*time.Second,
+		apitoken.NewUseCase(apiTokenRepo, id.UUIDGeneratorFunc(id.GenerateUUID)),
+		export.NewUseCase(exportRepo, id.UUIDGeneratorFunc(id.GenerateUUID), tokenService, time.Duration(cfg.ExportExpire)*time.Second),
+		ledgerUsecases,
+	)
+	trashCleaner := ledger.NewCleaner(ledgerUsecases, logger, time.Duration(cfg.PurgeInterval)*time.Second)
+	workers = append(workers, purger, trashCleaner)
+
+	// outbox
+	mailService := user.NewMailer(cfg.SMTPServer, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword)
+	outboxWorker := outbox.NewWorker(outboxRepo, mailService, logger, time.Duration(cfg.OutboxInterval)*time.Second, time.Duration(cfg.OutboxRetryDelay)*time.Second, cfg.OutboxMaxAttempts)
+	workers = append(workers, outboxWorker)
+
+	// readiness
+	readiness := health.NewReadiness()
+	switch {
+	case storeDB != db:
+		readiness = health.NewReadiness(db.PingContext, storeDB.PingContext)
+	case db != nil:
+		readiness = health.NewReadiness(db.PingContext)
+	}
 
 	rootMux := http.NewServeMux()
 
-	handler := setupRoutes(rootMux, logger, cfg)
+	handler, routeWorkers := setupRoutes(rootMux, logger, cfg, outboxRepo, userRepo, apiTokenRepo, exportRepo, auditUsecases, ledgerUsecases, transactor, tokenService, readiness)
+	workers = append(workers, routeWorkers...)
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
@@ -48,49 +181,348 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 	}
 
-	// TODO: Graceful shutdown
 	logger.Info(fmt.Sprintf("starting %s server on %s", cfg.Env, srv.Addr))
-	err = srv.ListenAndServe()
-	logger.Error(err.Error())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, srv, readiness, workers, logger, time.Duration(cfg.ShutdownDrainDelay)*time.Second, time.Duration(cfg.ShutdownTimeout)*time.Second)
 }
 
-func setupRoutes(rootMux *http.ServeMux, logger logger.Logger, config *config.Config) http.Handler {
-	repo := user.NewInMemoryUserRepository()
-	idService := id.UUIDGeneratorFunc(id.GenerateUUID)
-	hashService := user.PasswordHasherFunc{
-		Generate: user.GeneratePassword,
-		Validate: user.ValidatePassword,
+// serve runs the server and the workers until the context is cancelled by a
+// signal or one of them fails. The readiness probe reports the drain for
+// drainDelay before the server stops accepting connections, then the requests in
+// flight get the rest of timeout to complete. The drain never outlasts timeout. The workers stop through the shared
+// context. It returns 0 after a clean shutdown and 1 after a failure.
+func serve(ctx context.Context, srv *http.Server, readiness *health.Readiness, workers []worker, logger logger.Logger, drainDelay, timeout time.Duration) int {
+	g, ctx := errgroup.WithContext(ctx)
+	for _, w := range workers {
+		g.Go(func() error {
+			return w.Run(ctx)
+		})
 	}
-	tokenService := auth.NewJWT(config.AccessSecret, config.RefreshSecret)
-	mailService := user.NewMailer(config.SMTPServer, config.SMTPPort, config.SMTPUsername, config.SMTPPassword)
+	g.Go(func() error {
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		readiness.Drain()
+		logger.Info(fmt.Sprintf("draining server, stopping in %s", drainDelay))
 
-	userUsecases := user.NewUseCase(repo, idService, hashService, mailService, tokenService, time.Duration(config.AccessTokenExpire), time.Duration(config.RefreshTokenExpire), time.Duration(config.VerificationTokenExpire))
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		drain := time.NewTimer(drainDelay)
+		defer drain.Stop()
+		select {
+		case <-drain.C:
+		case <-shutdownCtx.Done():
+		}
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("failed to drain requests: %w", err)
+		}
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		logger.Error(fmt.Sprintf("server stopped: %v", err))
+		return 1
+	}
+	logger.Info("server stopped")
+	return 0
+}
+
+// worker is a background job that runs until the context is cancelled.
+type worker interface {
+	Run(ctx context.Context) error
+}
+
+// setupRoutes wires the use cases and registers their routes. The audit and the
+// ledger use case are shared with the workers of run. It returns the background workers that
+// depend on the use cases.
+func setupRoutes(rootMux *http.ServeMux, logger logger.Logger, config *config.Config, outboxRepo outbox.Store, repo user.Store, apiTokenRepo apitoken.Store, exportRepo export.Store, auditUsecases *audit.UseCase, ledgerUsecases *ledger.UseCase, transactor *transaction.Transactor, tokenService *auth.JWT, readiness *health.Readiness) (http.Handler, []worker) {
+	idService := id.UUIDGeneratorFunc(id.GenerateUUID)
+	hashService := user.NewArgon2Hasher(user.Argon2Params{
+		Memory:      config.Argon2Memory,
+		Iterations:  config.Argon2Iterations,
+		Parallelism: config.Argon2Parallelism,
+	})
+	passwordPolicy := passwordpolicy.NewPolicy(config.PasswordMinLength, config.PasswordMaxLength, config.PasswordMinScore, passwordpolicy.NewHIBPDirectory(config.BreachedPasswordsDir))
+	loginGuard := lockout.NewGuard(lockout.NewInMemoryStore(), config.LoginMaxFailures, time.Duration(config.LoginBaseDelay)*time.Second, time.Duration(config.LoginLockoutDuration)*time.Second)
+	outboxUsecases := outbox.NewUseCase(outboxRepo, idService)
+	outboxController := outbox.NewController(logger, outboxUsecases)
+	auditController := audit.NewController(logger, auditUsecases)
+
+	oidcClient := oidc.NewClient(config.OIDCIssuer, config.OIDCClientID, config.OIDCClientSecret, config.OIDCRedirectURL, config.OIDCScopes)
+	userUsecases := user.NewUseCase(repo, transactor, idService, hashService, passwordPolicy, outboxUsecases, tokenService, totp.NewTOTP(config.TOTPIssuer), oidcClient, loginGuard, auditUsecases, time.Duration(config.AccessTokenExpire), time.Duration(config.RefreshTokenExpire), time.Duration(config.VerificationTokenExpire), time.Duration(config.DeletionGracePeriod), config.AdminEmails)
 	userController := user.NewController(logger, config, userUsecases)
+	apiTokenUsecases := apitoken.NewUseCase(apiTokenRepo, idService)
+	apiTokenController := apitoken.NewController(logger, apiTokenUsecases)
+	exportUsecases := export.NewUseCase(exportRepo, idService, tokenService, time.Duration(config.ExportExpire)*time.Second)
+	exportController := export.NewController(logger, exportUsecases)
+	ledgerController := ledger.NewController(logger, ledgerUsecases)
+	exportWorker := export.NewWorker(exportRepo, logger, time.Duration(config.ExportInterval)*time.Second, userUsecases, apiTokenUsecases, auditUsecases, ledgerUsecases)
 
 	// public routes
 	rootMux.Handle("GET /debug/vars", expvar.Handler())
+	rootMux.Handle("GET /health/ready", readiness)
+	rootMux.Handle("GET /.well-known/jwks.json", tokenService.Keys())
 
 	rootMux.HandleFunc("POST /user/registrieren", userController.CreateUser)
+	rootMux.HandleFunc("PUT /user/email/verifizieren", userController.VerifyEmail)
 	rootMux.HandleFunc("POST /user/anmelden", userController.LoginUser)
+	rootMux.HandleFunc("POST /user/anmelden/2fa", userController.VerifyTwoFactor)
+	rootMux.HandleFunc("GET /user/anmelden/oidc", userController.StartOIDCLogin)
+	rootMux.HandleFunc("GET /user/anmelden/oidc/callback", userController.OIDCCallback)
+	rootMux.HandleFunc("POST /token/refresh", userController.RefreshToken)
+	rootMux.HandleFunc("PUT /user/passwort/reset", userController.ResetPassword)
+	rootMux.HandleFunc("PUT /user/passwort/reset/bestaetigen", userController.ConfirmPasswordReset)
+	rootMux.HandleFunc("PUT /user/email/bestaetigen", userController.ConfirmEmailChange)
+	rootMux.HandleFunc("PUT /user/email/rueckgaengig", userController.UndoEmailChange)
+	rootMux.HandleFunc("GET "+export.DownloadPath, exportController.Download)
+
+	// ledger routes also accept personal access tokens with the scope of the route
+	authMiddleware := auth.NewAuthorization(tokenService, repo, apiTokenUsecases)
+	api := func(scope string, handler http.HandlerFunc) http.Handler {
+		return authMiddleware.AuthorizeAPI(auth.RequireScope(scope)(handler))
+	}
+	rootMux.Handle("POST /konten", api(apitoken.ScopeWriteBookings, ledgerController.OpenAccount))
+	rootMux.Handle("GET /konten", api(apitoken.ScopeReadBookings, ledgerController.ListAccounts))
+	rootMux.Handle("GET /konten/{id}/saldo", api(apitoken.ScopeReadBookings, ledgerController.Balance))
+	rootMux.Handle("GET /konten/{id}/bericht", api(apitoken.ScopeReadBookings, ledgerController.Report))
+	rootMux.Handle("GET /konten/{id}/buchungen", api(apitoken.ScopeReadBookings, ledgerController.ListBookings))
+	rootMux.Handle("POST /konten/{id}/buchungen", api(apitoken.ScopeWriteBookings, ledgerController.CreateBooking))
+	rootMux.Handle("GET /buchungen/{id}", api(apitoken.ScopeReadBookings, ledgerController.GetBooking))
+	rootMux.Handle("PUT /buchungen/{id}", api(apitoken.ScopeWriteBookings, ledgerController.AmendBooking))
+	rootMux.Handle("POST /buchungen/{id}/stornieren", api(apitoken.ScopeWriteBookings, ledgerController.VoidBooking))
+	rootMux.Handle("DELETE /konten/{id}", api(apitoken.ScopeWriteBookings, ledgerController.DeleteAccount))
+	rootMux.Handle("POST /konten/{id}/wiederherstellen", api(apitoken.ScopeWriteBookings, ledgerController.RestoreAccount))
+	rootMux.Handle("DELETE /buchungen/{id}", api(apitoken.ScopeWriteBookings, ledgerController.DeleteBooking))
+	rootMux.Handle("POST /buchungen/{id}/wiederherstellen", api(apitoken.ScopeWriteBookings, ledgerController.RestoreBooking))
+	rootMux.Handle("GET /papierkorb", api(apitoken.ScopeReadBookings, ledgerController.Trash))
 
 	// private routes
 	authMux := http.NewServeMux()
+	authMux.HandleFunc("GET /user/profil", userController.GetProfile)
 	authMux.HandleFunc("PUT /user/bearbeiten", userController.UpdateUser)
 	authMux.HandleFunc("POST /user/ausloggen", userController.LogoutUser)
 	authMux.HandleFunc("DELETE /user/entfernen", userController.DeleteUser)
+	authMux.HandleFunc("POST /user/export", exportController.StartExport)
+	authMux.HandleFunc("GET /user/export/{id}", exportController.ExportStatus)
+	authMux.HandleFunc("GET /user/protokoll", auditController.ListOwnEntries)
 	authMux.HandleFunc("PUT /user/passwort/aktualisieren", userController.ChangePassword)
-	authMux.HandleFunc("PUT /user/passwort/reset", userController.ResetPassword)
 	authMux.HandleFunc("PUT /user/email/aktualisieren", userController.ChangeEmail)
+	authMux.HandleFunc("POST /user/2fa/einrichten", userController.EnrollTwoFactor)
+	authMux.HandleFunc("POST /user/2fa/bestaetigen", userController.ConfirmTwoFactor)
+	authMux.HandleFunc("GET /user/sitzungen", userController.ListSessions)
+	authMux.HandleFunc("DELETE /user/sitzungen", userController.RevokeOtherSessions)
+	authMux.HandleFunc("DELETE /user/sitzungen/{id}", userController.RevokeSession)
+	authMux.HandleFunc("POST /user/zugangstoken", apiTokenController.CreateToken)
+	authMux.HandleFunc("GET /user/zugangstoken", apiTokenController.ListTokens)
+	authMux.HandleFunc("DELETE /user/zugangstoken/{id}", apiTokenController.RevokeToken)
+
+	// admin routes
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("GET /admin/outbox", outboxController.ListMessages)
+	adminMux.HandleFunc("POST /admin/outbox/{id}/wiederholen", outboxController.RetryMessage)
+	adminMux.HandleFunc("POST /admin/user/{id}/entsperren", userController.UnlockUser)
+	adminMux.HandleFunc("GET /admin/protokoll", auditController.ListEntries)
+	adminMux.HandleFunc("GET /admin/protokoll/pruefen", auditController.VerifyChain)
+	authMux.Handle("/admin/", auth.RequireRole(user.RolleAdmin)(adminMux))
 
-	authMiddleware := auth.NewAuthorization(tokenService)
 	rootMux.Handle("/", authMiddleware.Authorize(authMux))
 
 	// middleware
 	handler := middleware.Chain(
 		middleware.RecoverPanic,
 		middleware.NewLogger(logger).Log,
+		audit.CaptureIP,
 		middleware.EnableCORS,
 	)(rootMux)
 
-	return handler
+	return handler, []worker{exportWorker}
+}
+
+// envDev is the environment of local development.
+const envDev = "dev"
+
+const (
+	storageMemory   = "memory"
+	storagePostgres = "postgres"
+	storageSQLite   = "sqlite"
+	storageVault    = "vault"
+)
+
+// storageBackend returns the storage of STORAGE. Without it a DATABASE_URL
+// selects PostgreSQL and everything else is kept in memory.
+func storageBackend(cfg *config.Config) string {
+	if cfg.Storage != "" {
+		return cfg.Storage
+	}
+	if cfg.DatabaseURL != "" {
+		return storagePostgres
+	}
+	return storageMemory
+}
+
+// openDatabase connects to the PostgreSQL database of DATABASE_URL, opens the
+// SQLite file of SQLITE_PATH or loads the encrypted vault of VAULT_PATH. The vault
+// storage also returns the vault that saves its database. The memory storage has
+// no database and returns nil.
+func openDatabase(storage string, cfg *config.Config, logger logger.Logger) (*sql.DB, *vault.Vault, error) {
+	switch storage {
+	case storageMemory:
+		return nil, nil, nil
+	case storageSQLite:
+		db, err := sqlite.Open(cfg.SQLitePath)
+		return db, nil, err
+	case storageVault:
+		vaultFile, err := vault.Open(cfg.VaultPath, cfg.VaultPassphrase, vault.DefaultParams, logger, time.Duration(cfg.VaultSaveInterval)*time.Second)
+		if err != nil {
+			return nil, nil, err
+		}
+		return vaultFile.DB(), vaultFile, nil
+	case storagePostgres:
+		if cfg.DatabaseURL == "" {
+			return nil, nil, fmt.Errorf("DATABASE_URL is required for storage %s", storage)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown storage %q", storage)
+	}
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return db, nil, nil
+}
+
+// openStoreDatabase opens the database of the stores other than the users. It is
+// the SQLite file of SQLITE_PATH for the postgres storage and db for every other.
+func openStoreDatabase(storage string, cfg *config.Config, db *sql.DB) (*sql.DB, error) {
+	if storage != storagePostgres {
+		return db, nil
+	}
+	return sqlite.Open(cfg.SQLitePath)
+}
+
+// migrateDatabase applies the pending migrations of the storage. PostgreSQL only
+// holds the user store, SQLite and the vault hold every store. The SQLite file of
+// the other stores of PostgreSQL is migrated as storage sqlite.
+func migrateDatabase(ctx context.Context, storage string, db *sql.DB, logger logger.Logger) error {
+	migrator, err := migrate.New(db, user.PostgresMigrations, user.PostgresMigrationsDir)
+	if storage == storageSQLite || storage == storageVault {
+		migrator, err = sqlite.NewMigrator(db)
+	}
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("applied %d migrations, schema at version %d", applied, migrator.Latest()))
+	return nil
+}
+
+// runCommand runs the backup or restore subcommand with the path of the
+// snapshot as argument. A snapshot is restored into an empty database only and
+// migrated to the schema of this release afterwards.
+func runCommand(ctx context.Context, command string, args []string, storage string, db *sql.DB, logger logger.Logger) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s FILE", command)
+	}
+	if storage != storageSQLite && storage != storageVault {
+		return fmt.Errorf("storage %s has no snapshots, STORAGE sqlite or vault is required", storage)
+	}
+
+	switch command {
+	case "backup":
+		manifest, err := backup.WriteFile(ctx, db, args[0], version)
+		if err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("wrote snapshot %s at schema version %d", args[0], manifest.SchemaVersion))
+		return nil
+	case "restore":
+		migrator, err := sqlite.NewMigrator(db)
+		if err != nil {
+			return err
+		}
+		manifest, err := backup.RestoreFile(ctx, db, args[0], migrator.Latest())
+		if err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("restored snapshot %s of %s at schema version %d", args[0], manifest.CreatedAt.Format(time.RFC3339), manifest.SchemaVersion))
+		return migrateDatabase(ctx, storage, db, logger)
+	default:
+		return fmt.Errorf("unknown command %q, expected backup or restore", command)
+	}
+}
+
+// newStores creates the repositories of the storage. The memory storage keeps
+// every store in memory. The postgres storage keeps the users in db and the other
+// stores in storeDB, its units of work span both databases.
+func newStores(storage string, db, storeDB *sql.DB) (user.Store, apitoken.Store, export.Store, audit.Store, outbox.Store, ledger.Store, *transaction.Transactor) {
+	switch storage {
+	case storagePostgres:
+		return user.NewPostgresUserRepository(db), apitoken.NewSQLiteRepository(storeDB), export.NewSQLiteRepository(storeDB),
+			audit.NewSQLiteRepository(storeDB), outbox.NewSQLiteRepository(storeDB), ledger.NewSQLiteRepository(storeDB),
+			transaction.NewAcross([]*sql.DB{db, storeDB})
+	case storageSQLite, storageVault:
+		return user.NewSQLiteUserRepository(db), apitoken.NewSQLiteRepository(db), export.NewSQLiteRepository(db),
+			audit.NewSQLiteRepository(db), outbox.NewSQLiteRepository(db), ledger.NewSQLiteRepository(db), transaction.New(db)
+	default:
+		users, apiTokens, exports, audits, messages, ledgers := user.NewInMemoryUserRepository(), apitoken.NewInMemoryRepository(), export.NewInMemoryRepository(), audit.NewInMemoryRepository(), outbox.NewInMemoryRepository(), ledger.NewInMemoryRepository()
+		return users, apiTokens, exports, audits, messages, ledgers,
+			transaction.New(nil, users, apiTokens, exports, audits, messages, ledgers)
+	}
+}
+
+// newTokenService creates the token service that pins issuer, audience and leeway
+// of every token.
+func newTokenService(cfg *config.Config) (*auth.JWT, error) {
+	tokenService, err := newSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tokenService.Issuer = cfg.JWTIssuer
+	tokenService.Audience = cfg.JWTAudience
+	tokenService.Leeway = time.Duration(cfg.JWTLeeway) * time.Second
+	return tokenService, nil
+}
+
+// newSigner signs access tokens with the PEM key of JWT_SIGNING_KEY and accepts
+// the retired keys of JWT_VERIFICATION_KEYS. Without a signing key it falls back to
+// the HS256 ACCESS_SECRET, which is only allowed in the dev environment.
+func newSigner(cfg *config.Config) (*auth.JWT, error) {
+	if cfg.JWTSigningKey == "" {
+		if cfg.Env != envDev {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY is required in environment %s", cfg.Env)
+		}
+		return auth.NewJWT(cfg.AccessSecret, cfg.RefreshSecret), nil
+	}
+	signing, err := auth.LoadKey(cfg.JWTSigningKeyID, cfg.JWTSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	verification := make([]auth.Key, 0, len(cfg.JWTVerificationKeys))
+	for id, path := range cfg.JWTVerificationKeys {
+		key, err := auth.LoadKey(id, path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+	keys, err := auth.NewKeySet(signing, verification...)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewJWTWithKeys(keys, cfg.RefreshSecret), nil
 }
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/config"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/apitoken"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/health"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/ledger"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Error(string)   {}
+func (nopLogger) Warning(string) {}
+func (nopLogger) Info(string)    {}
+func (nopLogger) Debug(string)   {}
+func (nopLogger) Fatal(string)   {}
+
+// newServer wires the routes on in-memory stores with one activated user and one
+// user who has not verified the email yet.
+func newServer(t *testing.T) http.Handler {
+	t.Helper()
+	cfg := &config.Config{
+		AccessTokenExpire:  60,
+		RefreshTokenExpire: 60,
+		LoginMaxFailures:   5,
+		Argon2Memory:       64,
+		Argon2Iterations:   1,
+		Argon2Parallelism:  1,
+		PasswordMinLength:  8,
+		PasswordMaxLength:  72,
+		TrashRetention:     60,
+		ExportInterval:     60,
+		ExportExpire:       60,
+	}
+	userRepo, apiTokenRepo, exportRepo, auditRepo, outboxRepo, ledgerRepo, transactor := newStores(storageMemory, nil, nil)
+	auditUsecases := audit.NewUseCase(auditRepo, id.UUIDGeneratorFunc(id.GenerateUUID))
+	ledgerUsecases := ledger.NewUseCase(ledgerRepo, transactor, id.UUIDGeneratorFunc(id.GenerateUUID), auditUsecases, time.Minute)
+
+	hash, err := user.NewArgon2Hasher(user.Argon2Params{Memory: cfg.Argon2Memory, Iterations: cfg.Argon2Iterations, Parallelism: cfg.Argon2Parallelism}).GeneratePassword("Geheim123!")
+	require.NoError(t, err)
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", hash, time.Now(), time.Now())
+	u.Aktiviert()
+	_, err = userRepo.CreateUser(context.Background(), u)
+	require.NoError(t, err)
+	_, err = userRepo.CreateUser(context.Background(), user.NewUser("456", "Moritz", "Mustermann", "moritz.mustermann@gmail.de", hash, time.Now(), time.Now()))
+	require.NoError(t, err)
+
+	handler, _ := setupRoutes(http.NewServeMux(), nopLogger{}, cfg, outboxRepo, userRepo, apiTokenRepo, exportRepo, auditUsecases, ledgerUsecases, transactor, auth.NewJWT("access", "refresh"), health.NewReadiness())
+	return handler
+}
+
+// send serves a request with the token and decodes the data of the response into out.
+func send(t *testing.T, handler http.Handler, method, path, token string, body, out any) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	r := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if out != nil && w.Code < http.StatusBadRequest {
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&struct{ Data any }{Data: out}))
+	}
+	return w.Code
+}
+
+func TestLedgerRoutesScopes(t *testing.T) {
+	handler := newServer(t)
+
+	var login user.LoginUserResponse
+	require.Equal(t, http.StatusOK, send(t, handler, http.MethodPost, "/user/anmelden", "", user.LoginUserRequest{Email: "max.mustermann@gmail.de", Password: "Geheim123!"}, &login))
+	session := login.AccessToken
+
+	token := func(scopes ...string) string {
+		var created apitoken.TokenResponse
+		require.Equal(t, http.StatusCreated, send(t, handler, http.MethodPost, "/user/zugangstoken", session, apitoken.CreateTokenRequest{Name: "Skript", Scopes: scopes}, &created))
+		return created.Token
+	}
+	reader, writer := token(apitoken.ScopeReadBookings), token(apitoken.ScopeWriteBookings)
+	account := ledger.OpenAccountRequest{Name: "Girokonto", Currency: "EUR"}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		expect int
+	}{
+		{name: "ohne Token", method: http.MethodGet, path: "/konten", expect: http.StatusUnauthorized},
+		{name: "Sitzung liest", method: http.MethodGet, path: "/konten", token: session, expect: http.StatusOK},
+		{name: "Sitzung schreibt", method: http.MethodPost, path: "/konten", token: session, body: account, expect: http.StatusCreated},
+		{name: "Lesetoken liest", method: http.MethodGet, path: "/konten", token: reader, expect: http.StatusOK},
+		{name: "Lesetoken liest Papierkorb", method: http.MethodGet, path: "/papierkorb", token: reader, expect: http.StatusOK},
+		{name: "Lesetoken schreibt", method: http.MethodPost, path: "/konten", token: reader, body: account, expect: http.StatusForbidden},
+		{name: "Schreibtoken schreibt", method: http.MethodPost, path: "/konten", token: writer, body: account, expect: http.StatusCreated},
+		{name: "Schreibtoken liest", method: http.MethodGet, path: "/konten", token: writer, expect: http.StatusForbidden},
+		{name: "Token verwaltet kein Konto", method: http.MethodGet, path: "/user/profil", token: reader, expect: http.StatusUnauthorized},
+		{name: "ungültiger Token", method: http.MethodGet, path: "/konten", token: auth.APITokenPrefix + "falsch", expect: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, send(t, handler, tt.method, tt.path, tt.token, tt.body, nil))
+		})
+	}
+}
+
+func TestUpdateUserStatus(t *testing.T) {
+	handler := newServer(t)
+
+	var login user.LoginUserResponse
+	require.Equal(t, http.StatusOK, send(t, handler, http.MethodPost, "/user/anmelden", "", user.LoginUserRequest{Email: "max.mustermann@gmail.de", Password: "Geheim123!"}, &login))
+	require.Equal(t, http.StatusCreated, send(t, handler, http.MethodPost, "/user/registrieren", "", user.CreateUserRequest{FirstName: "Erika", LastName: "Musterfrau", Email: "erika@gmail.de", Password: "kaffee tisch regen lampe"}, nil))
+
+	tests := []struct {
+		name   string
+		body   user.UpdateUserRequest
+		expect int
+	}{
+		{name: "Email vergeben", body: user.UpdateUserRequest{FirstName: "Max", LastName: "Mustermann", Email: "erika@gmail.de"}, expect: http.StatusConflict},
+		{name: "Falsches Passwort", body: user.UpdateUserRequest{FirstName: "Max", LastName: "Mustermann", CurrentPassword: "falsch", NewPassword: "kaffee tisch regen lampe"}, expect: http.StatusUnauthorized},
+		{name: "Schwaches Passwort", body: user.UpdateUserRequest{FirstName: "Max", LastName: "Mustermann", CurrentPassword: "Geheim123!", NewPassword: "kurz"}, expect: http.StatusUnprocessableEntity},
+		{name: "Gültig", body: user.UpdateUserRequest{FirstName: "Moritz", LastName: "Mustermann", CurrentPassword: "Geheim123!", NewPassword: "kaffee tisch regen lampe"}, expect: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/user/profil", nil)
+			r.Header.Set("Authorization", "Bearer "+login.AccessToken)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var buf bytes.Buffer
+			require.NoError(t, json.NewEncoder(&buf).Encode(tt.body))
+			r = httptest.NewRequest(http.MethodPut, "/user/bearbeiten", &buf)
+			r.Header.Set("Authorization", "Bearer "+login.AccessToken)
+			r.Header.Set("If-Match", w.Header().Get("ETag"))
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.expect, w.Code)
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	handler := newServer(t)
+	tokens := auth.NewJWT("access", "refresh")
+	verify, err := tokens.GenerateVerificationToken("456", time.Minute)
+	require.NoError(t, err)
+	wrongType, err := tokens.GenerateChallengeToken("456", time.Minute)
+	require.NoError(t, err)
+	login := user.LoginUserRequest{Email: "moritz.mustermann@gmail.de", Password: "Geheim123!"}
+
+	require.Equal(t, http.StatusForbidden, send(t, handler, http.MethodPost, "/user/anmelden", "", login, nil))
+
+	tests := []struct {
+		name   string
+		token  string
+		expect int
+	}{
+		{name: "Ungültiger Token", token: "falsch", expect: http.StatusUnauthorized},
+		{name: "Falscher Tokentyp", token: wrongType, expect: http.StatusUnauthorized},
+		{name: "Gültig", token: verify, expect: http.StatusOK},
+		{name: "Bereits verifiziert", token: verify, expect: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, send(t, handler, http.MethodPut, "/user/email/verifizieren", "", user.EmailTokenRequest{Token: tt.token}, nil))
+		})
+	}
+
+	assert.Equal(t, http.StatusOK, send(t, handler, http.MethodPost, "/user/anmelden", "", login, nil))
+}
+
+func TestNewSigner(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	key := filepath.Join(t.TempDir(), "jwt-signing-key.pem")
+	require.NoError(t, os.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	tests := []struct {
+		name      string
+		env       string
+		key       string
+		expectErr bool
+	}{
+		{name: "Entwicklung ohne Schlüssel", env: envDev},
+		{name: "Produktion ohne Schlüssel", env: "prod", expectErr: true},
+		{name: "Produktion mit Schlüssel", env: "prod", key: key},
+		{name: "Produktion mit fehlender Schlüsseldatei", env: "prod", key: "fehlt.pem", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSigner(&config.Config{Env: tt.env, JWTSigningKey: tt.key, AccessSecret: "access", RefreshSecret: "refresh"})
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBootFromExampleEnv(t *testing.T) {
+	example, err := os.ReadFile(filepath.Join("..", "example.env"))
+	require.NoError(t, err)
+	env, err := godotenv.Unmarshal(string(example))
+	require.NoError(t, err)
+	// restores the environment after the test, LoadConfig keeps the values set here
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), example, 0o600))
+	t.Chdir(dir)
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+	tokenService, err := newTokenService(cfg)
+	require.NoError(t, err)
+	storage := storageBackend(cfg)
+	db, vaultFile, err := openDatabase(storage, cfg, nopLogger{})
+	require.NoError(t, err)
+	require.Nil(t, vaultFile)
+	storeDB, err := openStoreDatabase(storage, cfg, db)
+	require.NoError(t, err)
+
+	userRepo, apiTokenRepo, exportRepo, auditRepo, outboxRepo, ledgerRepo, transactor := newStores(storage, db, storeDB)
+	auditUsecases := audit.NewUseCase(auditRepo, id.UUIDGeneratorFunc(id.GenerateUUID))
+	ledgerUsecases := ledger.NewUseCase(ledgerRepo, transactor, id.UUIDGeneratorFunc(id.GenerateUUID), auditUsecases, time.Duration(cfg.TrashRetention)*time.Second)
+	handler, _ := setupRoutes(http.NewServeMux(), nopLogger{}, cfg, outboxRepo, userRepo, apiTokenRepo, exportRepo, auditUsecases, ledgerUsecases, transactor, tokenService, health.NewReadiness())
+	assert.Equal(t, http.StatusUnauthorized, send(t, handler, http.MethodGet, "/user/profil", "", nil, nil))
+}
+
+func TestServeDrainEndsWithTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	srv := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	readiness := health.NewReadiness()
+
+	start := time.Now()
+	code := serve(ctx, srv, readiness, nil, nopLogger{}, time.Hour, 50*time.Millisecond)
+	assert.Equal(t, 0, code)
+	assert.Less(t, time.Since(start), 5*time.Second, "the drain delay must not outlast the shutdown timeout")
+}
@@ -7,17 +7,60 @@ import (
 
 // Config sets up the configurations.
 type Config struct {
-	Port                    int    `envconfig:"PORT"`
-	Env                     string `envconfig:"ENV"`
-	AccessSecret            string `envconfig:"ACCESS_SECRET"`
-	RefreshSecret           string `envconfig:"REFRESH_SECRET"`
-	AccessTokenExpire       int    `envconfig:"ACCESS_TOKEN_EXPIRE"`
-	RefreshTokenExpire      int    `envconfig:"REFRESH_TOKEN_EXPIRE"`
-	VerificationTokenExpire int    `envconfig:"VERIFY_TOKEN_EXPIRE"`
-	SMTPServer              string `envconfig:"SMTP_SERVER"`
-	SMTPPort                int    `envconfig:"SMTP_PORT"`
-	SMTPUsername            string `envconfig:"SMTP_USERNAME"`
-	SMTPPassword            string `envconfig:"SMTP_PASSWORD"`
+	Port                    int               `envconfig:"PORT"`
+	Env                     string            `envconfig:"ENV"`
+	AccessSecret            string            `envconfig:"ACCESS_SECRET"`
+	RefreshSecret           string            `envconfig:"REFRESH_SECRET"`
+	JWTSigningKey           string            `envconfig:"JWT_SIGNING_KEY" default:""`
+	JWTSigningKeyID         string            `envconfig:"JWT_SIGNING_KEY_ID" default:"1"`
+	JWTVerificationKeys     map[string]string `envconfig:"JWT_VERIFICATION_KEYS"`
+	JWTIssuer               string            `envconfig:"JWT_ISSUER" default:"haushaltsbuch"`
+	JWTAudience             string            `envconfig:"JWT_AUDIENCE" default:"haushaltsbuch"`
+	JWTLeeway               int               `envconfig:"JWT_LEEWAY" default:"30"`
+	AccessTokenExpire       int               `envconfig:"ACCESS_TOKEN_EXPIRE"`
+	RefreshTokenExpire      int               `envconfig:"REFRESH_TOKEN_EXPIRE"`
+	VerificationTokenExpire int               `envconfig:"VERIFY_TOKEN_EXPIRE"`
+	SMTPServer              string            `envconfig:"SMTP_SERVER"`
+	SMTPPort                int               `envconfig:"SMTP_PORT"`
+	SMTPUsername            string            `envconfig:"SMTP_USERNAME"`
+	SMTPPassword            string            `envconfig:"SMTP_PASSWORD"`
+	AdminEmails             []string          `envconfig:"ADMIN_EMAILS"`
+	OutboxInterval          int               `envconfig:"OUTBOX_INTERVAL" default:"10"`
+	OutboxRetryDelay        int               `envconfig:"OUTBOX_RETRY_DELAY" default:"30"`
+	OutboxMaxAttempts       int               `envconfig:"OUTBOX_MAX_ATTEMPTS" default:"8"`
+	TOTPIssuer              string            `envconfig:"TOTP_ISSUER" default:"Haushaltsbuch"`
+	LoginMaxFailures        int               `envconfig:"LOGIN_MAX_FAILURES" default:"5"`
+	LoginBaseDelay          int               `envconfig:"LOGIN_BASE_DELAY" default:"1"`
+	LoginLockoutDuration    int               `envconfig:"LOGIN_LOCKOUT_DURATION" default:"900"`
+	Argon2Memory            uint32            `envconfig:"ARGON2_MEMORY" default:"65536"`
+	Argon2Iterations        uint32            `envconfig:"ARGON2_ITERATIONS" default:"3"`
+	Argon2Parallelism       uint8             `envconfig:"ARGON2_PARALLELISM" default:"2"`
+	PasswordMinLength       int               `envconfig:"PASSWORD_MIN_LENGTH" default:"8"`
+	PasswordMaxLength       int               `envconfig:"PASSWORD_MAX_LENGTH" default:"72"`
+	PasswordMinScore        int               `envconfig:"PASSWORD_MIN_SCORE" default:"2"`
+	BreachedPasswordsDir    string            `envconfig:"BREACHED_PASSWORDS_DIR" default:""`
+	OIDCIssuer              string            `envconfig:"OIDC_ISSUER" default:""`
+	OIDCClientID            string            `envconfig:"OIDC_CLIENT_ID" default:""`
+	OIDCClientSecret        string            `envconfig:"OIDC_CLIENT_SECRET" default:""`
+	OIDCRedirectURL         string            `envconfig:"OIDC_REDIRECT_URL" default:""`
+	OIDCScopes              []string          `envconfig:"OIDC_SCOPES" default:"openid,email,profile"`
+	DeletionGracePeriod     int               `envconfig:"DELETION_GRACE_PERIOD" default:"2592000"`
+	PurgeInterval           int               `envconfig:"PURGE_INTERVAL" default:"3600"`
+	TrashRetention          int               `envconfig:"TRASH_RETENTION" default:"2592000"`
+	ExportInterval          int               `envconfig:"EXPORT_INTERVAL" default:"5"`
+	ExportExpire            int               `envconfig:"EXPORT_EXPIRE" default:"86400"`
+	DatabaseURL             string            `envconfig:"DATABASE_URL" default:""`
+	DatabaseAutoMigrate     bool              `envconfig:"DATABASE_AUTO_MIGRATE" default:"true"`
+	Storage                 string            `envconfig:"STORAGE" default:""`
+	SQLitePath              string            `envconfig:"SQLITE_PATH" default:"haushaltsbuch.db"`
+	SQLiteBackupDir         string            `envconfig:"SQLITE_BACKUP_DIR" default:"backups"`
+	SQLiteBackupInterval    int               `envconfig:"SQLITE_BACKUP_INTERVAL" default:"86400"`
+	SQLiteBackupKeep        int               `envconfig:"SQLITE_BACKUP_KEEP" default:"7"`
+	VaultPath               string            `envconfig:"VAULT_PATH" default:"haushaltsbuch.vault"`
+	VaultPassphrase         string            `envconfig:"VAULT_PASSPHRASE" default:""`
+	VaultSaveInterval       int               `envconfig:"VAULT_SAVE_INTERVAL" default:"1"`
+	ShutdownDrainDelay      int               `envconfig:"SHUTDOWN_DRAIN_DELAY" default:"5"`
+	ShutdownTimeout         int               `envconfig:"SHUTDOWN_TIMEOUT" default:"15"`
 }
 
 // LoadConfig loads the configuration from .env file in the root directory and environment variables.
@@ -1,6 +1,6 @@
 module gitlab.com/shingeki-no-kyojin/ymir
 
-go 1.24
+go 1.24.0
 
 require golang.org/x/crypto v0.33.0 // direct
 
@@ -15,9 +15,23 @@ require (
 
 require github.com/stretchr/testify v1.10.0 // direct
 
+require github.com/lib/pq v1.10.9 // direct
+
+require modernc.org/sqlite v1.34.5 // direct
+
+require golang.org/x/sync v0.17.0 // direct
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
 )
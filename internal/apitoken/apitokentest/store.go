@@ -0,0 +1,125 @@
+// Package apitokentest provides the contract every apitoken.Store backend has to
+// fulfil.
+package apitokentest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/apitoken"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+// TestStore runs the contract against the stores of newStore. Every call has to
+// return a new, empty store.
+func TestStore(t *testing.T, newStore func(t *testing.T) apitoken.Store) {
+	storetest.Run(t, newStore,
+		storetest.Case[apitoken.Store]{Name: "Lebenszyklus", Test: testLifecycle},
+		storetest.Case[apitoken.Store]{Name: "Eindeutigkeit", Test: testUniqueness},
+		storetest.Case[apitoken.Store]{Name: "Nicht gefunden", Test: testNotFound},
+		storetest.Case[apitoken.Store]{Name: "Abgebrochener Kontext", Test: testCancelledContext},
+		storetest.Case[apitoken.Store]{Name: "Gleichzeitige Änderungen", Test: testConcurrentUpdates},
+	)
+}
+
+func newToken(id, userID, hash string, erstelltAm time.Time) *apitoken.Token {
+	return apitoken.NewToken(id, userID, "CLI", hash, []apitoken.Scope{apitoken.ScopeReadBookings, apitoken.ScopeImport}, erstelltAm, time.Time{})
+}
+
+func testLifecycle(t *testing.T, repo apitoken.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	expiring := apitoken.NewToken("t1", "123", "Import", "h1", []apitoken.Scope{apitoken.ScopeImport}, now, now.Add(time.Hour))
+	require.NoError(t, repo.SaveToken(ctx, expiring))
+	require.NoError(t, repo.SaveToken(ctx, newToken("t2", "123", "h2", now.Add(time.Minute))))
+	require.NoError(t, repo.SaveToken(ctx, newToken("t3", "456", "h3", now)))
+
+	found, err := repo.FindTokenByHash(ctx, "h1")
+	require.NoError(t, err)
+	assert.Equal(t, "t1", found.ID())
+	assert.Equal(t, "Import", found.Name())
+	assert.Equal(t, []apitoken.Scope{apitoken.ScopeImport}, found.Scopes())
+	assert.Equal(t, now, found.ErstelltAm())
+	assert.Equal(t, now.Add(time.Hour), found.LaeuftAbAm())
+	assert.True(t, found.ZuletztGenutztAm().IsZero())
+
+	require.NoError(t, repo.TouchToken(ctx, "t2", now.Add(2*time.Minute)))
+	found, err = repo.FindTokenByHash(ctx, "h2")
+	require.NoError(t, err)
+	assert.True(t, found.LaeuftAbAm().IsZero(), "a token without expiry keeps none")
+	assert.Equal(t, now.Add(2*time.Minute), found.ZuletztGenutztAm())
+
+	tokens, err := repo.FindTokensByUserID(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "t2", tokens[0].ID(), "newest first")
+
+	require.NoError(t, repo.DeleteToken(ctx, "123", "t1"))
+	_, err = repo.FindTokenByHash(ctx, "h1")
+	assert.ErrorIs(t, err, apitoken.ErrTokenNotFound)
+	require.NoError(t, repo.DeleteTokensByUserID(ctx, "123"))
+	tokens, err = repo.FindTokensByUserID(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+	_, err = repo.FindTokenByHash(ctx, "h3")
+	require.NoError(t, err, "tokens of other users are kept")
+}
+
+func testUniqueness(t *testing.T, repo apitoken.Store) {
+	ctx := context.Background()
+	require.NoError(t, repo.SaveToken(ctx, newToken("t1", "123", "h1", storetest.Now())))
+
+	assert.ErrorIs(t, repo.SaveToken(ctx, newToken("t1", "123", "h2", storetest.Now())), apitoken.ErrTokenAlreadyExists)
+	assert.ErrorIs(t, repo.SaveToken(ctx, newToken("t2", "456", "h1", storetest.Now())), apitoken.ErrTokenAlreadyExists)
+	tokens, err := repo.FindTokensByUserID(ctx, "456")
+	require.NoError(t, err)
+	assert.Empty(t, tokens, "a rejected token is not stored")
+}
+
+func testNotFound(t *testing.T, repo apitoken.Store) {
+	ctx := context.Background()
+	require.NoError(t, repo.SaveToken(ctx, newToken("t1", "123", "h1", storetest.Now())))
+
+	_, err := repo.FindTokenByHash(ctx, "unbekannt")
+	assert.ErrorIs(t, err, apitoken.ErrTokenNotFound)
+	assert.ErrorIs(t, repo.TouchToken(ctx, "unbekannt", storetest.Now()), apitoken.ErrTokenNotFound)
+	assert.ErrorIs(t, repo.DeleteToken(ctx, "123", "unbekannt"), apitoken.ErrTokenNotFound)
+	assert.ErrorIs(t, repo.DeleteToken(ctx, "456", "t1"), apitoken.ErrTokenNotFound, "token of another user")
+	tokens, err := repo.FindTokensByUserID(ctx, "unbekannt")
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+	require.NoError(t, repo.DeleteTokensByUserID(ctx, "unbekannt"))
+}
+
+func testCancelledContext(t *testing.T, repo apitoken.Store) {
+	require.NoError(t, repo.SaveToken(context.Background(), newToken("t1", "123", "h1", storetest.Now())))
+
+	storetest.Cancelled(t,
+		storetest.Call{Name: "SaveToken", Run: func(ctx context.Context) error {
+			return repo.SaveToken(ctx, newToken("t2", "123", "h2", storetest.Now()))
+		}},
+		storetest.Call{Name: "FindTokenByHash", Run: func(ctx context.Context) error { _, err := repo.FindTokenByHash(ctx, "h1"); return err }},
+		storetest.Call{Name: "FindTokensByUserID", Run: func(ctx context.Context) error { _, err := repo.FindTokensByUserID(ctx, "123"); return err }},
+		storetest.Call{Name: "TouchToken", Run: func(ctx context.Context) error { return repo.TouchToken(ctx, "t1", storetest.Now()) }},
+		storetest.Call{Name: "DeleteToken", Run: func(ctx context.Context) error { return repo.DeleteToken(ctx, "123", "t1") }},
+		storetest.Call{Name: "DeleteTokensByUserID", Run: func(ctx context.Context) error { return repo.DeleteTokensByUserID(ctx, "123") }},
+	)
+
+	tokens, err := repo.FindTokensByUserID(context.Background(), "123")
+	require.NoError(t, err, "a cancelled call must not change the store")
+	assert.Len(t, tokens, 1)
+}
+
+func testConcurrentUpdates(t *testing.T, repo apitoken.Store) {
+	ctx := context.Background()
+	errs := storetest.Race(func(i int) error {
+		return repo.SaveToken(ctx, newToken(fmt.Sprint(i), "123", "gleich", storetest.Now()))
+	})
+
+	assert.Equal(t, 1, storetest.Count(errs, nil), "a hash belongs to exactly one token")
+	assert.Equal(t, storetest.Concurrency-1, storetest.Count(errs, apitoken.ErrTokenAlreadyExists))
+}
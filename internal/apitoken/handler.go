@@ -0,0 +1,155 @@
+package apitoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/presenter"
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+type usecase interface {
+	CreateToken(context.Context, *CreateInput) (*CreateOutput, error)
+	Tokens(context.Context, string) ([]*Token, error)
+	RevokeToken(context.Context, string, string) error
+}
+
+// Controller is the controller for the access token endpoints.
+type Controller struct {
+	log     logger.Logger
+	usecase usecase
+}
+
+// NewController creates a new controller for the access token usecase.
+func NewController(log logger.Logger, usecase usecase) *Controller {
+	return &Controller{
+		log:     log,
+		usecase: usecase,
+	}
+}
+
+// CreateTokenRequest is a serializable struct for the create token request body.
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// TokenResponse is a serializable struct for an access token. Token is only set
+// once, in the response of the creation.
+type TokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreateToken handles the request to issue a personal access token.
+func (c *Controller) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	var body CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	input := &CreateInput{
+		UserID:    userID,
+		Name:      body.Name,
+		Scopes:    body.Scopes,
+		ExpiresAt: body.ExpiresAt,
+	}
+	output, err := c.usecase.CreateToken(r.Context(), input)
+	if err != nil {
+		switch err {
+		case ErrInvalidName, ErrInvalidScope, ErrInvalidExpiry:
+			c.log.Error(fmt.Sprintf("invalid access token request. %v", err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			c.log.Error(fmt.Sprintf("failed to create access token. %v", err))
+			http.Error(w, "failed to create access token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := toResponse(output.Token)
+	response.Token = output.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// ListTokens handles the request to list the access tokens of the user.
+func (c *Controller) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	tokens, err := c.usecase.Tokens(r.Context(), userID)
+	if err != nil {
+		c.log.Error(fmt.Sprintf("failed to list access tokens. %v", err))
+		http.Error(w, "failed to list access tokens", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]TokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		response = append(response, toResponse(token))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// RevokeToken handles the request to revoke an access token.
+func (c *Controller) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	if err := c.usecase.RevokeToken(r.Context(), userID, r.PathValue("id")); err != nil {
+		switch err {
+		case ErrTokenNotFound:
+			c.log.Error("access token not found")
+			http.Error(w, "access token not found", http.StatusNotFound)
+		default:
+			c.log.Error(fmt.Sprintf("failed to revoke access token. %v", err))
+			http.Error(w, "failed to revoke access token", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toResponse(token *Token) TokenResponse {
+	response := TokenResponse{
+		ID:        token.ID(),
+		Name:      token.Name(),
+		Scopes:    token.Scopes(),
+		CreatedAt: token.ErstelltAm(),
+	}
+	if expiresAt := token.LaeuftAbAm(); !expiresAt.IsZero() {
+		response.ExpiresAt = &expiresAt
+	}
+	if lastUsedAt := token.ZuletztGenutztAm(); !lastUsedAt.IsZero() {
+		response.LastUsedAt = &lastUsedAt
+	}
+	return response
+}
@@ -0,0 +1,175 @@
+package apitoken
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+// Store is the access token storage. Every backend, e.g. InMemoryRepository or
+// SQLiteRepository, implements it.
+type Store interface {
+	repository
+}
+
+// InMemoryRepository implements the access token repository with an in-memory store.
+type InMemoryRepository struct {
+	tokens   map[string]Token
+	hashToID map[string]string
+	gate     transaction.Gate
+	mutex    sync.RWMutex
+}
+
+// NewInMemoryRepository creates a new InMemoryRepository.
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		tokens:   make(map[string]Token),
+		hashToID: make(map[string]string),
+	}
+}
+
+// SaveToken adds a new access token.
+func (r *InMemoryRepository) SaveToken(ctx context.Context, token *Token) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, exists := r.tokens[token.ID()]; exists {
+			return ErrTokenAlreadyExists
+		}
+		if _, exists := r.hashToID[token.Hash()]; exists {
+			return ErrTokenAlreadyExists
+		}
+		r.tokens[token.ID()] = *token
+		r.hashToID[token.Hash()] = token.ID()
+		return nil
+	}
+}
+
+// FindTokenByHash retrieves an access token by the hash of its secret.
+func (r *InMemoryRepository) FindTokenByHash(ctx context.Context, hash string) (*Token, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		id, exists := r.hashToID[hash]
+		if !exists {
+			return nil, ErrTokenNotFound
+		}
+		token := r.tokens[id]
+		return &token, nil
+	}
+}
+
+// FindTokensByUserID returns all access tokens of the user, newest first.
+func (r *InMemoryRepository) FindTokensByUserID(ctx context.Context, userID string) ([]*Token, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		tokens := make([]*Token, 0)
+		for _, token := range r.tokens {
+			if token.UserID() == userID {
+				token := token
+				tokens = append(tokens, &token)
+			}
+		}
+		sort.Slice(tokens, func(i, j int) bool {
+			return tokens[i].ErstelltAm().After(tokens[j].ErstelltAm())
+		})
+		return tokens, nil
+	}
+}
+
+// TouchToken records the last use of an access token.
+func (r *InMemoryRepository) TouchToken(ctx context.Context, id string, at time.Time) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		token, exists := r.tokens[id]
+		if !exists {
+			return ErrTokenNotFound
+		}
+		token.Genutzt(at)
+		r.tokens[id] = token
+		return nil
+	}
+}
+
+// DeleteToken removes an access token of the user.
+func (r *InMemoryRepository) DeleteToken(ctx context.Context, userID, id string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		token, exists := r.tokens[id]
+		if !exists || token.UserID() != userID {
+			return ErrTokenNotFound
+		}
+		delete(r.hashToID, token.Hash())
+		delete(r.tokens, id)
+		return nil
+	}
+}
+
+// DeleteTokensByUserID removes every access token of the user.
+func (r *InMemoryRepository) DeleteTokensByUserID(ctx context.Context, userID string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		for id, token := range r.tokens {
+			if token.UserID() == userID {
+				delete(r.hashToID, token.Hash())
+				delete(r.tokens, id)
+			}
+		}
+		return nil
+	}
+}
+
+// Snapshot copies the stored tokens and returns a function that restores the copy.
+func (r *InMemoryRepository) Snapshot() func() {
+	r.mutex.RLock()
+	tokens, hashToID := maps.Clone(r.tokens), maps.Clone(r.hashToID)
+	r.mutex.RUnlock()
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.tokens, r.hashToID = tokens, hashToID
+	}
+}
+
+// Gate returns the gate the writes of the repository pass.
+func (r *InMemoryRepository) Gate() *transaction.Gate {
+	return &r.gate
+}
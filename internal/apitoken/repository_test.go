@@ -0,0 +1,17 @@
+package apitoken_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/apitoken"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/apitoken/apitokentest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+func TestRepository(t *testing.T) {
+	storetest.Backends(t, apitokentest.TestStore,
+		func() apitoken.Store { return apitoken.NewInMemoryRepository() },
+		func(db *sql.DB) apitoken.Store { return apitoken.NewSQLiteRepository(db) },
+	)
+}
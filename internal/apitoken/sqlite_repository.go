@@ -0,0 +1,123 @@
+package apitoken
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+const tokenColumns = `id, user_id, name, hash, scopes, created_at, expires_at, last_used_at`
+
+// SQLiteRepository implements the access token repository with a SQLite database.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteRepository creates a new SQLiteRepository.
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db}
+}
+
+// conn returns the transaction of the context or the database.
+func (r *SQLiteRepository) conn(ctx context.Context) transaction.Querier {
+	return transaction.Conn(ctx, r.db)
+}
+
+// SaveToken adds a new access token.
+func (r *SQLiteRepository) SaveToken(ctx context.Context, token *Token) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO access_tokens (`+tokenColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		token.ID(), token.UserID(), token.Name(), token.Hash(), strings.Join(token.Scopes(), " "),
+		token.ErstelltAm().UTC(), sqlite.NullTime(token.LaeuftAbAm()), sqlite.NullTime(token.ZuletztGenutztAm()))
+	if sqlite.IsUniqueViolation(err) {
+		return ErrTokenAlreadyExists
+	}
+	return err
+}
+
+// FindTokenByHash retrieves an access token by the hash of its secret.
+func (r *SQLiteRepository) FindTokenByHash(ctx context.Context, hash string) (*Token, error) {
+	return scanToken(r.conn(ctx).QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM access_tokens WHERE hash = $1`, hash))
+}
+
+// FindTokensByUserID returns all access tokens of the user, newest first.
+func (r *SQLiteRepository) FindTokensByUserID(ctx context.Context, userID string) ([]*Token, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT `+tokenColumns+` FROM access_tokens WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]*Token, 0)
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// TouchToken records the last use of an access token.
+func (r *SQLiteRepository) TouchToken(ctx context.Context, id string, at time.Time) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `UPDATE access_tokens SET last_used_at = $2 WHERE id = $1`, id, at.UTC())
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// DeleteToken removes an access token of the user.
+func (r *SQLiteRepository) DeleteToken(ctx context.Context, userID, id string) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM access_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// DeleteTokensByUserID removes every access token of the user.
+func (r *SQLiteRepository) DeleteTokensByUserID(ctx context.Context, userID string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM access_tokens WHERE user_id = $1`, userID)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(row rowScanner) (*Token, error) {
+	var (
+		token              Token
+		scopes             string
+		expires, lastUsage sql.NullTime
+	)
+	err := row.Scan(&token.iD, &token.userID, &token.name, &token.hash, &scopes, &token.erstelltAm, &expires, &lastUsage)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.scopes = strings.Fields(scopes)
+	token.erstelltAm = token.erstelltAm.UTC()
+	token.laeuftAbAm = sqlite.Time(expires)
+	token.zuletztGenutztAm = sqlite.Time(lastUsage)
+	return &token, nil
+}
+
+func expectRow(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package apitoken
+
+import (
+	"slices"
+	"time"
+)
+
+// Scope repräsentiert eine Berechtigung eines Zugangstokens.
+type Scope = string
+
+const (
+	// ScopeReadBookings erlaubt das Lesen von Buchungen.
+	ScopeReadBookings Scope = "read:bookings"
+	// ScopeWriteBookings erlaubt das Anlegen und Ändern von Buchungen.
+	ScopeWriteBookings Scope = "write:bookings"
+	// ScopeImport erlaubt den Import von Kontoauszügen.
+	ScopeImport Scope = "import"
+)
+
+// Scopes enthält alle gültigen Berechtigungen.
+var Scopes = []Scope{ScopeReadBookings, ScopeWriteBookings, ScopeImport}
+
+// Token repräsentiert ein persönliches Zugangstoken für Skripte. Gespeichert wird
+// nur der Hash des Tokens.
+type Token struct {
+	iD               string
+	userID           string
+	name             string
+	hash             string
+	scopes           []Scope
+	laeuftAbAm       time.Time
+	erstelltAm       time.Time
+	zuletztGenutztAm time.Time
+}
+
+// NewToken erzeugt ein neues Zugangstoken. Ein leeres laeuftAbAm bedeutet, dass das
+// Token nicht abläuft.
+func NewToken(id, userID, name, hash string, scopes []Scope, erstelltAm, laeuftAbAm time.Time) *Token {
+	return &Token{
+		iD:         id,
+		userID:     userID,
+		name:       name,
+		hash:       hash,
+		scopes:     slices.Clone(scopes),
+		laeuftAbAm: laeuftAbAm,
+		erstelltAm: erstelltAm,
+	}
+}
+
+// ID gibt die ID des Tokens zurück.
+func (t *Token) ID() string {
+	return t.iD
+}
+
+// UserID gibt die ID des Besitzers zurück.
+func (t *Token) UserID() string {
+	return t.userID
+}
+
+// Name gibt den Namen des Tokens zurück.
+func (t *Token) Name() string {
+	return t.name
+}
+
+// Hash gibt den Hash des Tokens zurück.
+func (t *Token) Hash() string {
+	return t.hash
+}
+
+// Scopes gibt die Berechtigungen des Tokens zurück.
+func (t *Token) Scopes() []Scope {
+	return slices.Clone(t.scopes)
+}
+
+// LaeuftAbAm gibt den Ablaufzeitpunkt zurück.
+func (t *Token) LaeuftAbAm() time.Time {
+	return t.laeuftAbAm
+}
+
+// ErstelltAm gibt den Erstellungszeitpunkt zurück.
+func (t *Token) ErstelltAm() time.Time {
+	return t.erstelltAm
+}
+
+// ZuletztGenutztAm gibt den Zeitpunkt der letzten Nutzung zurück.
+func (t *Token) ZuletztGenutztAm() time.Time {
+	return t.zuletztGenutztAm
+}
+
+// IstAbgelaufen prüft, ob das Token zum Zeitpunkt now abgelaufen ist.
+func (t *Token) IstAbgelaufen(now time.Time) bool {
+	return !t.laeuftAbAm.IsZero() && !now.Before(t.laeuftAbAm)
+}
+
+// Genutzt vermerkt die Nutzung des Tokens.
+func (t *Token) Genutzt(at time.Time) {
+	t.zuletztGenutztAm = at
+}
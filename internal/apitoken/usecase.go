@@ -0,0 +1,199 @@
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export"
+)
+
+var (
+	// ErrTokenNotFound is returned when an access token is not found
+	ErrTokenNotFound = errors.New("Access token not found")
+	// ErrTokenAlreadyExists is returned when an access token ID or hash is already taken
+	ErrTokenAlreadyExists = errors.New("Access token already exists")
+	// ErrTokenExpired is returned when an expired access token is used
+	ErrTokenExpired = errors.New("Access token expired")
+	// ErrInvalidName is returned when the token name is empty or too long
+	ErrInvalidName = errors.New("Invalid token name")
+	// ErrInvalidScope is returned when no scope or an unknown scope is requested
+	ErrInvalidScope = errors.New("Invalid scope")
+	// ErrInvalidExpiry is returned when the expiry is not in the future
+	ErrInvalidExpiry = errors.New("Invalid expiry")
+)
+
+const (
+	maxNameLength = 100
+	secretLength  = 32
+)
+
+type repository interface {
+	SaveToken(ctx context.Context, token *Token) error
+	FindTokenByHash(ctx context.Context, hash string) (*Token, error)
+	FindTokensByUserID(ctx context.Context, userID string) ([]*Token, error)
+	TouchToken(ctx context.Context, id string, at time.Time) error
+	DeleteToken(ctx context.Context, userID, id string) error
+	DeleteTokensByUserID(ctx context.Context, userID string) error
+}
+
+type uuidGenerator interface {
+	GenerateUUID() (string, error)
+}
+
+// UseCase is the use case for personal access tokens
+type UseCase struct {
+	repo    repository
+	uuidGen uuidGenerator
+}
+
+// NewUseCase creates a new access token UseCase
+func NewUseCase(repo repository, uuidGen uuidGenerator) *UseCase {
+	return &UseCase{
+		repo:    repo,
+		uuidGen: uuidGen,
+	}
+}
+
+// CreateInput is the input for the create token use case. A nil ExpiresAt creates
+// a token that does not expire.
+type CreateInput struct {
+	UserID    string
+	Name      string
+	Scopes    []Scope
+	ExpiresAt *time.Time
+}
+
+func (i *CreateInput) validate(now time.Time) error {
+	name := strings.TrimSpace(i.Name)
+	if name == "" || len(name) > maxNameLength {
+		return ErrInvalidName
+	}
+	if len(i.Scopes) == 0 {
+		return ErrInvalidScope
+	}
+	for _, scope := range i.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return ErrInvalidScope
+		}
+	}
+	if i.ExpiresAt != nil && !i.ExpiresAt.After(now) {
+		return ErrInvalidExpiry
+	}
+	return nil
+}
+
+// CreateOutput is the output for the create token use case. Secret is the only
+// time the token is readable.
+type CreateOutput struct {
+	Token  *Token
+	Secret string
+}
+
+// CreateToken is the interactor for issuing a new personal access token.
+func (c *UseCase) CreateToken(ctx context.Context, input *CreateInput) (*CreateOutput, error) {
+	now := time.Now().UTC()
+	if err := input.validate(now); err != nil {
+		return nil, err
+	}
+
+	id, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt time.Time
+	if input.ExpiresAt != nil {
+		expiresAt = input.ExpiresAt.UTC()
+	}
+	scopes := slices.Compact(slices.Sorted(slices.Values(input.Scopes)))
+	token := NewToken(id, input.UserID, strings.TrimSpace(input.Name), hashSecret(secret), scopes, now, expiresAt)
+	if err := c.repo.SaveToken(ctx, token); err != nil {
+		return nil, err
+	}
+	return &CreateOutput{Token: token, Secret: secret}, nil
+}
+
+// Tokens returns the access tokens of the user without their secrets.
+func (c *UseCase) Tokens(ctx context.Context, userID string) ([]*Token, error) {
+	return c.repo.FindTokensByUserID(ctx, userID)
+}
+
+// RevokeToken deletes an access token of the user.
+func (c *UseCase) RevokeToken(ctx context.Context, userID, id string) error {
+	return c.repo.DeleteToken(ctx, userID, id)
+}
+
+// DeleteUserData deletes every access token of the user when the account is purged.
+func (c *UseCase) DeleteUserData(ctx context.Context, userID string) error {
+	return c.repo.DeleteTokensByUserID(ctx, userID)
+}
+
+// ExportTables is the export source for the access tokens of the user. Secrets
+// are not stored and their hashes are left out.
+func (c *UseCase) ExportTables(ctx context.Context, userID string) ([]export.Table, error) {
+	tokens, err := c.repo.FindTokensByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	table := export.Table{
+		Name:    "access_tokens",
+		Columns: []string{"id", "name", "scopes", "created_at", "expires_at", "last_used_at"},
+		Rows:    make([][]any, 0, len(tokens)),
+	}
+	for _, token := range tokens {
+		table.Rows = append(table.Rows, []any{token.ID(), token.Name(), token.Scopes(), token.ErstelltAm(), token.LaeuftAbAm(), token.ZuletztGenutztAm()})
+	}
+	return []export.Table{table}, nil
+}
+
+// Verify checks a personal access token for the Authorization middleware. The
+// scopes are returned as permissions.
+func (c *UseCase) Verify(ctx context.Context, secret string) (*auth.Claims, error) {
+	token, err := c.repo.FindTokenByHash(ctx, hashSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if token.IstAbgelaufen(now) {
+		return nil, ErrTokenExpired
+	}
+	if err := c.repo.TouchToken(ctx, token.ID(), now); err != nil {
+		return nil, err
+	}
+	return &auth.Claims{
+		Sub:         token.UserID(),
+		Jit:         token.ID(),
+		Exp:         token.LaeuftAbAm(),
+		Permissions: token.Scopes(),
+		Type:        auth.TypeAPIToken,
+	}, nil
+}
+
+// generateSecret creates a random token. The prefix lets the middleware and secret
+// scanners recognise it.
+func generateSecret() (string, error) {
+	b := make([]byte, secretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return auth.APITokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret hashes the token. The secret has 256 bits of entropy, so a fast hash
+// is sufficient and allows the lookup by hash.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package apitoken_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/apitoken"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+)
+
+func TestCreateToken(t *testing.T) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		input     *apitoken.CreateInput
+		expectErr error
+	}{
+		{name: "Gültiges Token", input: &apitoken.CreateInput{UserID: "123", Name: "Import", Scopes: []string{apitoken.ScopeImport}, ExpiresAt: &future}},
+		{name: "Ohne Ablauf", input: &apitoken.CreateInput{UserID: "123", Name: "Import", Scopes: []string{apitoken.ScopeReadBookings}}},
+		{name: "Leerer Name", input: &apitoken.CreateInput{UserID: "123", Name: " ", Scopes: []string{apitoken.ScopeImport}}, expectErr: apitoken.ErrInvalidName},
+		{name: "Ohne Scope", input: &apitoken.CreateInput{UserID: "123", Name: "Import"}, expectErr: apitoken.ErrInvalidScope},
+		{name: "Unbekannter Scope", input: &apitoken.CreateInput{UserID: "123", Name: "Import", Scopes: []string{"admin"}}, expectErr: apitoken.ErrInvalidScope},
+		{name: "Abgelaufen", input: &apitoken.CreateInput{UserID: "123", Name: "Import", Scopes: []string{apitoken.ScopeImport}, ExpiresAt: &past}, expectErr: apitoken.ErrInvalidExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := apitoken.NewUseCase(apitoken.NewInMemoryRepository(), id.UUIDGeneratorFunc(id.GenerateUUID))
+			output, err := uc.CreateToken(ctx, tt.input)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(output.Secret, auth.APITokenPrefix))
+			assert.NotContains(t, output.Token.Hash(), output.Secret, "only the hash is stored")
+
+			claims, err := uc.Verify(ctx, output.Secret)
+			require.NoError(t, err)
+			assert.Equal(t, "123", claims.Sub)
+			assert.Equal(t, tt.input.Scopes, claims.Permissions)
+		})
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	ctx := context.Background()
+	repo := apitoken.NewInMemoryRepository()
+	uc := apitoken.NewUseCase(repo, id.UUIDGeneratorFunc(id.GenerateUUID))
+	output, err := uc.CreateToken(ctx, &apitoken.CreateInput{UserID: "123", Name: "Import", Scopes: []string{apitoken.ScopeImport}})
+	require.NoError(t, err)
+
+	_, err = uc.Verify(ctx, output.Secret+"x")
+	assert.ErrorIs(t, err, apitoken.ErrTokenNotFound)
+
+	_, err = uc.Verify(ctx, output.Secret)
+	require.NoError(t, err)
+	tokens, err := uc.Tokens(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.False(t, tokens[0].ZuletztGenutztAm().IsZero())
+
+	assert.ErrorIs(t, uc.RevokeToken(ctx, "456", output.Token.ID()), apitoken.ErrTokenNotFound, "only the owner can revoke")
+	assert.NoError(t, uc.RevokeToken(ctx, "123", output.Token.ID()))
+	_, err = uc.Verify(ctx, output.Secret)
+	assert.ErrorIs(t, err, apitoken.ErrTokenNotFound)
+
+	expired := apitoken.NewToken("t2", "123", "Alt", "hash", []string{apitoken.ScopeImport}, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	assert.True(t, expired.IstAbgelaufen(time.Now()))
+}
+
+func TestAuthorizeAPI(t *testing.T) {
+	ctx := context.Background()
+	uc := apitoken.NewUseCase(apitoken.NewInMemoryRepository(), id.UUIDGeneratorFunc(id.GenerateUUID))
+	readOnly, err := uc.CreateToken(ctx, &apitoken.CreateInput{UserID: "123", Name: "Lesen", Scopes: []string{apitoken.ScopeReadBookings}})
+	require.NoError(t, err)
+
+	authorization := auth.NewAuthorization(auth.NewJWT("access", "refresh"), nil, uc)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name         string
+		handler      http.Handler
+		token        string
+		expectStatus int
+	}{
+		{name: "Scope vorhanden", handler: authorization.AuthorizeAPI(auth.RequireScope(apitoken.ScopeReadBookings)(ok)), token: readOnly.Secret, expectStatus: http.StatusOK},
+		{name: "Scope fehlt", handler: authorization.AuthorizeAPI(auth.RequireScope(apitoken.ScopeWriteBookings)(ok)), token: readOnly.Secret, expectStatus: http.StatusForbidden},
+		{name: "Unbekanntes Token", handler: authorization.AuthorizeAPI(ok), token: auth.APITokenPrefix + "unbekannt", expectStatus: http.StatusUnauthorized},
+		{name: "Kontoverwaltung", handler: authorization.Authorize(ok), token: readOnly.Secret, expectStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectStatus, rec.Code)
+		})
+	}
+}
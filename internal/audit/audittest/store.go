@@ -0,0 +1,122 @@
+// Package audittest provides the contract every audit.Store backend has to fulfil.
+package audittest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+// TestStore runs the contract against the stores of newStore. Every call has to
+// return a new, empty store.
+func TestStore(t *testing.T, newStore func(t *testing.T) audit.Store) {
+	storetest.Run(t, newStore,
+		storetest.Case[audit.Store]{Name: "Lebenszyklus", Test: testLifecycle},
+		storetest.Case[audit.Store]{Name: "Leeres Protokoll", Test: testEmpty},
+		storetest.Case[audit.Store]{Name: "Abgebrochener Kontext", Test: testCancelledContext},
+		storetest.Case[audit.Store]{Name: "Gleichzeitige Änderungen", Test: testConcurrentAppends},
+	)
+}
+
+func newEntry(id string, action audit.Action, actorID, targetID string, at time.Time) *audit.Entry {
+	return audit.NewEntry(id, action, actorID, "h1", audit.TargetUser, targetID, "127.0.0.1", nil, []byte(`{"email":"max@gmail.de"}`), at)
+}
+
+func testLifecycle(t *testing.T, repo audit.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	require.NoError(t, repo.AppendEntry(ctx, newEntry("e1", audit.ActionLoginSucceeded, "123", "123", now)))
+	require.NoError(t, repo.AppendEntry(ctx, newEntry("e2", audit.ActionLoginFailed, "", "123", now.Add(time.Second))))
+	require.NoError(t, repo.AppendEntry(ctx, newEntry("e3", audit.ActionPasswordChanged, "456", "456", now.Add(2*time.Second))))
+
+	entries, err := repo.FindAllEntries(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	previousHash := ""
+	for i, entry := range entries {
+		assert.Equal(t, uint64(i)+1, entry.Sequenz(), "sequence order")
+		assert.Equal(t, previousHash, entry.VorherigerHash())
+		assert.Equal(t, entry.BerechneHash(), entry.Hash(), "the stored entry matches its hash")
+		previousHash = entry.Hash()
+	}
+	assert.Equal(t, now, entries[0].Zeitpunkt())
+	assert.Equal(t, "127.0.0.1", entries[0].IP())
+	assert.Nil(t, entries[0].Vorher())
+	assert.JSONEq(t, `{"email":"max@gmail.de"}`, string(entries[0].Nachher()))
+
+	tests := []struct {
+		name      string
+		filter    audit.Filter
+		expectIDs []string
+	}{
+		{name: "Alle, neueste zuerst", filter: audit.Filter{Limit: 10}, expectIDs: []string{"e3", "e2", "e1"}},
+		{name: "Begrenzt", filter: audit.Filter{Limit: 1}, expectIDs: []string{"e3"}},
+		{name: "User als Akteur oder Ziel", filter: audit.Filter{UserID: "123", Limit: 10}, expectIDs: []string{"e2", "e1"}},
+		{name: "Akteur", filter: audit.Filter{ActorID: "123", Limit: 10}, expectIDs: []string{"e1"}},
+		{name: "Aktion", filter: audit.Filter{Action: audit.ActionLoginFailed, Limit: 10}, expectIDs: []string{"e2"}},
+		{name: "Haushalt", filter: audit.Filter{HouseholdID: "h2", Limit: 10}, expectIDs: []string{}},
+		{name: "Zeitraum", filter: audit.Filter{From: now.Add(time.Second), To: now.Add(2 * time.Second), Limit: 10}, expectIDs: []string{"e2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := repo.FindEntries(ctx, tt.filter)
+			require.NoError(t, err)
+			ids := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				ids = append(ids, entry.ID())
+			}
+			assert.Equal(t, tt.expectIDs, ids)
+		})
+	}
+}
+
+func testEmpty(t *testing.T, repo audit.Store) {
+	ctx := context.Background()
+
+	entries, err := repo.FindAllEntries(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	entries, err = repo.FindEntries(ctx, audit.Filter{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func testCancelledContext(t *testing.T, repo audit.Store) {
+	require.NoError(t, repo.AppendEntry(context.Background(), newEntry("e1", audit.ActionLoginSucceeded, "123", "123", storetest.Now())))
+
+	storetest.Cancelled(t,
+		storetest.Call{Name: "AppendEntry", Run: func(ctx context.Context) error {
+			return repo.AppendEntry(ctx, newEntry("e2", audit.ActionLoginSucceeded, "123", "123", storetest.Now()))
+		}},
+		storetest.Call{Name: "FindEntries", Run: func(ctx context.Context) error { _, err := repo.FindEntries(ctx, audit.Filter{Limit: 10}); return err }},
+		storetest.Call{Name: "FindAllEntries", Run: func(ctx context.Context) error { _, err := repo.FindAllEntries(ctx); return err }},
+	)
+
+	entries, err := repo.FindAllEntries(context.Background())
+	require.NoError(t, err, "a cancelled call must not change the store")
+	assert.Len(t, entries, 1)
+}
+
+func testConcurrentAppends(t *testing.T, repo audit.Store) {
+	ctx := context.Background()
+	errs := storetest.Race(func(i int) error {
+		return repo.AppendEntry(ctx, newEntry(fmt.Sprint(i), audit.ActionLoginSucceeded, "123", "123", storetest.Now()))
+	})
+	assert.Equal(t, storetest.Concurrency, storetest.Count(errs, nil))
+
+	entries, err := repo.FindAllEntries(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, storetest.Concurrency)
+	previousHash := ""
+	for i, entry := range entries {
+		assert.Equal(t, uint64(i)+1, entry.Sequenz())
+		assert.Equal(t, previousHash, entry.VorherigerHash(), "concurrent appends form a single chain")
+		previousHash = entry.Hash()
+	}
+}
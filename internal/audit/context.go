@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type contextkey string
+
+const clientIP contextkey = "clientIP"
+
+// WithIP returns a context carrying the IP address of the client.
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIP, ip)
+}
+
+// IPFromContext returns the IP address of the client stored by CaptureIP.
+func IPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIP).(string)
+	return ip
+}
+
+// CaptureIP stores the IP address of the client in the request context, so use
+// cases can record it without passing it through every input.
+func CaptureIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithIP(r.Context(), ClientIP(r))))
+	})
+}
+
+// ClientIP returns the IP address of the client without the port. The login guard
+// and the audit log both read the address through it.
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
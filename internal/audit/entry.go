@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Action repräsentiert die protokollierte Aktion.
+type Action = string
+
+const (
+	// ActionLoginSucceeded protokolliert eine erfolgreiche Anmeldung.
+	ActionLoginSucceeded Action = "login.succeeded"
+	// ActionLoginFailed protokolliert eine fehlgeschlagene Anmeldung.
+	ActionLoginFailed Action = "login.failed"
+	// ActionPasswordChanged protokolliert eine Passwortänderung.
+	ActionPasswordChanged Action = "password.changed"
+	// ActionPasswordReset protokolliert ein über den Reset-Link gesetztes Passwort.
+	ActionPasswordReset Action = "password.reset"
+	// ActionEmailChanged protokolliert eine Änderung der Email.
+	ActionEmailChanged Action = "email.changed"
+	// ActionSessionRevoked protokolliert das Beenden einer oder mehrerer Sitzungen.
+	ActionSessionRevoked Action = "session.revoked"
+	// ActionUserUpdated protokolliert eine Änderung des Profils.
+	ActionUserUpdated Action = "user.updated"
+	// ActionUserDeletionScheduled protokolliert eine beantragte Löschung des Users.
+	ActionUserDeletionScheduled Action = "user.deletion_scheduled"
+	// ActionUserRestored protokolliert eine durch Anmeldung zurückgenommene Löschung.
+	ActionUserRestored Action = "user.restored"
+	// ActionAccountCreated protokolliert das Anlegen eines Kontos.
+	ActionAccountCreated Action = "account.created"
+	// ActionAccountUpdated protokolliert eine Änderung eines Kontos.
+	ActionAccountUpdated Action = "account.updated"
+	// ActionAccountDeleted protokolliert das Löschen eines Kontos.
+	ActionAccountDeleted Action = "account.deleted"
+	// ActionBookingCreated protokolliert das Anlegen einer Buchung.
+	ActionBookingCreated Action = "booking.created"
+	// ActionBookingUpdated protokolliert eine Änderung einer Buchung.
+	ActionBookingUpdated Action = "booking.updated"
+	// ActionBookingDeleted protokolliert das Löschen einer Buchung.
+	ActionBookingDeleted Action = "booking.deleted"
+)
+
+const (
+	// TargetUser ist der Zieltyp für Änderungen am Benutzerkonto.
+	TargetUser = "user"
+	// TargetSession ist der Zieltyp für Sitzungen.
+	TargetSession = "session"
+	// TargetAccount ist der Zieltyp für Konten.
+	TargetAccount = "account"
+	// TargetBooking ist der Zieltyp für Buchungen.
+	TargetBooking = "booking"
+)
+
+// Entry repräsentiert einen unveränderlichen Eintrag im Audit-Log. Jeder Eintrag
+// enthält den Hash seines Vorgängers, so dass jede nachträgliche Änderung die
+// Kette bricht.
+type Entry struct {
+	iD             string
+	sequenz        uint64
+	zeitpunkt      time.Time
+	aktion         Action
+	akteurID       string
+	haushaltID     string
+	zielTyp        string
+	zielID         string
+	ip             string
+	vorher         []byte
+	nachher        []byte
+	vorherigerHash string
+	hash           string
+}
+
+// NewEntry erzeugt einen neuen, noch nicht verketteten Eintrag. Vorher und nachher
+// sind die JSON-Zustände des Ziels, soweit vorhanden.
+func NewEntry(id string, aktion Action, akteurID, haushaltID, zielTyp, zielID, ip string, vorher, nachher []byte, zeitpunkt time.Time) *Entry {
+	return &Entry{
+		iD:         id,
+		zeitpunkt:  zeitpunkt,
+		aktion:     aktion,
+		akteurID:   akteurID,
+		haushaltID: haushaltID,
+		zielTyp:    zielTyp,
+		zielID:     zielID,
+		ip:         ip,
+		vorher:     vorher,
+		nachher:    nachher,
+	}
+}
+
+// ID gibt die ID des Eintrags zurück.
+func (e *Entry) ID() string {
+	return e.iD
+}
+
+// Sequenz gibt die fortlaufende Nummer des Eintrags in der Kette zurück.
+func (e *Entry) Sequenz() uint64 {
+	return e.sequenz
+}
+
+// Zeitpunkt gibt den Zeitpunkt der Aktion zurück.
+func (e *Entry) Zeitpunkt() time.Time {
+	return e.zeitpunkt
+}
+
+// Aktion gibt die protokollierte Aktion zurück.
+func (e *Entry) Aktion() Action {
+	return e.aktion
+}
+
+// AkteurID gibt die ID des handelnden Users zurück.
+func (e *Entry) AkteurID() string {
+	return e.akteurID
+}
+
+// HaushaltID gibt die ID des betroffenen Haushaltsbuchs zurück.
+func (e *Entry) HaushaltID() string {
+	return e.haushaltID
+}
+
+// ZielTyp gibt den Typ des geänderten Objekts zurück, z.B. user oder booking.
+func (e *Entry) ZielTyp() string {
+	return e.zielTyp
+}
+
+// ZielID gibt die ID des geänderten Objekts zurück.
+func (e *Entry) ZielID() string {
+	return e.zielID
+}
+
+// IP gibt die IP-Adresse des Clients zurück.
+func (e *Entry) IP() string {
+	return e.ip
+}
+
+// Vorher gibt den JSON-Zustand des Ziels vor der Aktion zurück.
+func (e *Entry) Vorher() []byte {
+	return e.vorher
+}
+
+// Nachher gibt den JSON-Zustand des Ziels nach der Aktion zurück.
+func (e *Entry) Nachher() []byte {
+	return e.nachher
+}
+
+// VorherigerHash gibt den Hash des Vorgängers zurück.
+func (e *Entry) VorherigerHash() string {
+	return e.vorherigerHash
+}
+
+// Hash gibt den Hash des Eintrags zurück.
+func (e *Entry) Hash() string {
+	return e.hash
+}
+
+// Verkettet hängt den Eintrag mit der Sequenz an den Vorgänger an und berechnet
+// seinen Hash.
+func (e *Entry) Verkettet(sequenz uint64, vorherigerHash string) {
+	e.sequenz = sequenz
+	e.vorherigerHash = vorherigerHash
+	e.hash = e.BerechneHash()
+}
+
+// BerechneHash berechnet den Hash über den Inhalt des Eintrags und den Hash des
+// Vorgängers.
+func (e *Entry) BerechneHash() string {
+	content, _ := json.Marshal(struct {
+		ID             string          `json:"id"`
+		Sequenz        uint64          `json:"seq"`
+		Zeitpunkt      time.Time       `json:"time"`
+		Aktion         string          `json:"action"`
+		AkteurID       string          `json:"actor"`
+		HaushaltID     string          `json:"household"`
+		ZielTyp        string          `json:"target_type"`
+		ZielID         string          `json:"target_id"`
+		IP             string          `json:"ip"`
+		Vorher         json.RawMessage `json:"before"`
+		Nachher        json.RawMessage `json:"after"`
+		VorherigerHash string          `json:"prev"`
+	}{e.iD, e.sequenz, e.zeitpunkt.UTC(), e.aktion, e.akteurID, e.haushaltID, e.zielTyp, e.zielID, e.ip, rawJSON(e.vorher), rawJSON(e.nachher), e.vorherigerHash})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// rawJSON returns null for an empty state, so it can be embedded in the hashed document.
+func rawJSON(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return json.RawMessage("null")
+	}
+	return b
+}
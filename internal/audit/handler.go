@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/presenter"
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+type usecase interface {
+	Entries(context.Context, Filter) ([]*Entry, error)
+	VerifyChain(context.Context) (*VerifyOutput, error)
+}
+
+// Controller is the controller for the audit log endpoints.
+type Controller struct {
+	log     logger.Logger
+	usecase usecase
+}
+
+// NewController creates a new controller for the audit usecase.
+func NewController(log logger.Logger, usecase usecase) *Controller {
+	return &Controller{
+		log:     log,
+		usecase: usecase,
+	}
+}
+
+// EntryResponse is a serializable struct for an audit entry.
+type EntryResponse struct {
+	ID           string          `json:"id"`
+	Sequence     uint64          `json:"sequence"`
+	Time         time.Time       `json:"time"`
+	Action       string          `json:"action"`
+	ActorID      string          `json:"actor_id,omitempty"`
+	HouseholdID  string          `json:"household_id,omitempty"`
+	TargetType   string          `json:"target_type,omitempty"`
+	TargetID     string          `json:"target_id,omitempty"`
+	IP           string          `json:"ip,omitempty"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	PreviousHash string          `json:"previous_hash"`
+	Hash         string          `json:"hash"`
+}
+
+// VerifyResponse is a serializable struct for the result of a chain verification.
+type VerifyResponse struct {
+	Valid    bool   `json:"valid"`
+	Entries  int    `json:"entries"`
+	LastHash string `json:"last_hash,omitempty"`
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+}
+
+// ListEntries handles the admin request to query the audit log. The query
+// parameters actor, household, action, from, to (RFC 3339) and limit filter the entries.
+func (c *Controller) ListEntries(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		c.log.Error(fmt.Sprintf("invalid audit filter. %v", err))
+		http.Error(w, "invalid filter", http.StatusBadRequest)
+		return
+	}
+	c.writeEntries(w, r, filter)
+}
+
+// ListOwnEntries handles the request of a user for the entries they caused or
+// that target their account.
+func (c *Controller) ListOwnEntries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		c.log.Error(fmt.Sprintf("invalid audit filter. %v", err))
+		http.Error(w, "invalid filter", http.StatusBadRequest)
+		return
+	}
+	filter.UserID = userID
+	c.writeEntries(w, r, filter)
+}
+
+func (c *Controller) writeEntries(w http.ResponseWriter, r *http.Request, filter Filter) {
+	entries, err := c.usecase.Entries(r.Context(), filter)
+	if err != nil {
+		switch err {
+		case ErrInvalidFilter:
+			c.log.Error(fmt.Sprintf("invalid audit filter. %v", err))
+			http.Error(w, "invalid filter", http.StatusBadRequest)
+		default:
+			c.log.Error(fmt.Sprintf("failed to list audit entries. %v", err))
+			http.Error(w, "failed to list audit entries", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := make([]EntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, EntryResponse{
+			ID:           entry.ID(),
+			Sequence:     entry.Sequenz(),
+			Time:         entry.Zeitpunkt(),
+			Action:       entry.Aktion(),
+			ActorID:      entry.AkteurID(),
+			HouseholdID:  entry.HaushaltID(),
+			TargetType:   entry.ZielTyp(),
+			TargetID:     entry.ZielID(),
+			IP:           entry.IP(),
+			Before:       entry.Vorher(),
+			After:        entry.Nachher(),
+			PreviousHash: entry.VorherigerHash(),
+			Hash:         entry.Hash(),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// VerifyChain handles the admin request to check the hash chain of the audit log.
+// A broken chain is answered with 409 and the sequence of the first bad entry.
+func (c *Controller) VerifyChain(w http.ResponseWriter, r *http.Request) {
+	output, err := c.usecase.VerifyChain(r.Context())
+	if err != nil && err != ErrChainBroken {
+		c.log.Error(fmt.Sprintf("failed to verify audit chain. %v", err))
+		http.Error(w, "failed to verify audit chain", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if err == ErrChainBroken {
+		c.log.Error(fmt.Sprintf("audit chain broken at entry %d", output.BrokenAt))
+		status = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	presenter.NewJSONPresenter(w).Successful(VerifyResponse{
+		Valid:    err == nil,
+		Entries:  output.Entries,
+		LastHash: output.LastHash,
+		BrokenAt: output.BrokenAt,
+	})
+}
+
+func parseFilter(query url.Values) (Filter, error) {
+	filter := Filter{
+		ActorID:     query.Get("actor"),
+		HouseholdID: query.Get("household"),
+		Action:      query.Get("action"),
+	}
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, err
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, err
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+// Store is the audit log storage. Every backend, e.g. InMemoryRepository or
+// SQLiteRepository, implements it.
+type Store interface {
+	repository
+}
+
+// InMemoryRepository implements the audit repository with an append-only in-memory store.
+type InMemoryRepository struct {
+	entries []Entry
+	gate    transaction.Gate
+	mutex   sync.RWMutex
+}
+
+// NewInMemoryRepository creates a new InMemoryRepository.
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		entries: make([]Entry, 0),
+	}
+}
+
+// AppendEntry chains the entry to the last one and appends it. Sequence and hash
+// are assigned under the lock, so concurrent appends form a single chain.
+func (r *InMemoryRepository) AppendEntry(ctx context.Context, entry *Entry) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		previousHash := ""
+		if len(r.entries) > 0 {
+			previousHash = r.entries[len(r.entries)-1].Hash()
+		}
+		entry.Verkettet(uint64(len(r.entries))+1, previousHash)
+		r.entries = append(r.entries, *entry)
+		return nil
+	}
+}
+
+// FindEntries returns the entries matching the filter, newest first.
+func (r *InMemoryRepository) FindEntries(ctx context.Context, filter Filter) ([]*Entry, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		entries := make([]*Entry, 0)
+		for i := len(r.entries) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+			entry := r.entries[i]
+			if filter.matches(&entry) {
+				entries = append(entries, &entry)
+			}
+		}
+		return entries, nil
+	}
+}
+
+// FindAllEntries returns the whole chain in sequence order.
+func (r *InMemoryRepository) FindAllEntries(ctx context.Context) ([]*Entry, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		entries := make([]*Entry, len(r.entries))
+		for i := range r.entries {
+			entry := r.entries[i]
+			entries[i] = &entry
+		}
+		return entries, nil
+	}
+}
+
+// Snapshot remembers the length of the chain and returns a function that drops
+// the entries appended since. Entries are never changed, so the length suffices.
+func (r *InMemoryRepository) Snapshot() func() {
+	r.mutex.RLock()
+	length := len(r.entries)
+	r.mutex.RUnlock()
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.entries = r.entries[:length:length]
+	}
+}
+
+// Gate returns the gate the writes of the repository pass.
+func (r *InMemoryRepository) Gate() *transaction.Gate {
+	return &r.gate
+}
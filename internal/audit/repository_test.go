@@ -0,0 +1,17 @@
+package audit_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit/audittest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+func TestRepository(t *testing.T) {
+	storetest.Backends(t, audittest.TestStore,
+		func() audit.Store { return audit.NewInMemoryRepository() },
+		func(db *sql.DB) audit.Store { return audit.NewSQLiteRepository(db) },
+	)
+}
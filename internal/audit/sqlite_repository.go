@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+const entryColumns = `sequence, id, time, action, actor_id, household_id, target_type, target_id, ip, before, after, previous_hash, hash`
+
+// SQLiteRepository implements the audit repository with a SQLite database. A
+// trigger rejects updates of the entries, so the table is append-only.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteRepository creates a new SQLiteRepository.
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db}
+}
+
+// conn returns the transaction of the context or the database.
+func (r *SQLiteRepository) conn(ctx context.Context) transaction.Querier {
+	return transaction.Conn(ctx, r.db)
+}
+
+// AppendEntry chains the entry to the last one and appends it. The transaction
+// takes the write lock when it begins, so concurrent appends form a single chain.
+func (r *SQLiteRepository) AppendEntry(ctx context.Context, entry *Entry) error {
+	return transaction.InTx(ctx, r.db, func(tx transaction.Querier) error {
+		var (
+			sequence     uint64
+			previousHash string
+		)
+		err := tx.QueryRowContext(ctx, `SELECT sequence, hash FROM audit_entries ORDER BY sequence DESC LIMIT 1`).Scan(&sequence, &previousHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		entry.Verkettet(sequence+1, previousHash)
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO audit_entries (`+entryColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			entry.Sequenz(), entry.ID(), entry.Zeitpunkt().UTC(), entry.Aktion(), entry.AkteurID(), entry.HaushaltID(),
+			entry.ZielTyp(), entry.ZielID(), entry.IP(), entry.Vorher(), entry.Nachher(), entry.VorherigerHash(), entry.Hash())
+		return err
+	})
+}
+
+// FindEntries returns the entries matching the filter, newest first.
+func (r *SQLiteRepository) FindEntries(ctx context.Context, filter Filter) ([]*Entry, error) {
+	conditions := make([]string, 0, 6)
+	args := make([]any, 0, 7)
+	// where binds the argument to every ? of the condition.
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.UserID != "" {
+		where(`(actor_id = ? OR (target_type = '`+TargetUser+`' AND target_id = ?))`, filter.UserID)
+	}
+	if filter.ActorID != "" {
+		where(`actor_id = ?`, filter.ActorID)
+	}
+	if filter.HouseholdID != "" {
+		where(`household_id = ?`, filter.HouseholdID)
+	}
+	if filter.Action != "" {
+		where(`action = ?`, filter.Action)
+	}
+	if !filter.From.IsZero() {
+		where(`time >= ?`, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where(`time < ?`, filter.To.UTC())
+	}
+
+	query := `SELECT ` + entryColumns + ` FROM audit_entries`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	args = append(args, filter.Limit)
+	query += ` ORDER BY sequence DESC LIMIT $` + strconv.Itoa(len(args))
+	return r.queryEntries(ctx, query, args...)
+}
+
+// FindAllEntries returns the whole chain in sequence order.
+func (r *SQLiteRepository) FindAllEntries(ctx context.Context) ([]*Entry, error) {
+	return r.queryEntries(ctx, `SELECT `+entryColumns+` FROM audit_entries ORDER BY sequence`)
+}
+
+func (r *SQLiteRepository) queryEntries(ctx context.Context, query string, args ...any) ([]*Entry, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*Entry, 0)
+	for rows.Next() {
+		var entry Entry
+		if err := rows.Scan(&entry.sequenz, &entry.iD, &entry.zeitpunkt, &entry.aktion, &entry.akteurID, &entry.haushaltID,
+			&entry.zielTyp, &entry.zielID, &entry.ip, &entry.vorher, &entry.nachher, &entry.vorherigerHash, &entry.hash); err != nil {
+			return nil, err
+		}
+		entry.zeitpunkt = entry.zeitpunkt.UTC()
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,24 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite/sqlitetest"
+)
+
+func TestSQLiteRepositoryAppendOnly(t *testing.T) {
+	db := sqlitetest.Open(t)
+	ctx := context.Background()
+	uc := audit.NewUseCase(audit.NewSQLiteRepository(db), id.UUIDGeneratorFunc(id.GenerateUUID))
+	require.NoError(t, uc.Record(ctx, &audit.Event{Action: audit.ActionLoginSucceeded, ActorID: "123", TargetType: audit.TargetUser, TargetID: "123"}))
+
+	_, err := db.Exec(`UPDATE audit_entries SET ip = '10.0.0.1' WHERE sequence = 1`)
+	assert.Error(t, err, "entries are append-only")
+	_, err = uc.VerifyChain(ctx)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export"
+)
+
+var (
+	// ErrChainBroken is returned when an entry was changed, removed or inserted afterwards
+	ErrChainBroken = errors.New("Audit chain broken")
+	// ErrInvalidFilter is returned when a query filter is malformed
+	ErrInvalidFilter = errors.New("Invalid filter")
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type repository interface {
+	AppendEntry(ctx context.Context, entry *Entry) error
+	FindEntries(ctx context.Context, filter Filter) ([]*Entry, error)
+	FindAllEntries(ctx context.Context) ([]*Entry, error)
+}
+
+type uuidGenerator interface {
+	GenerateUUID() (string, error)
+}
+
+// UseCase is the use case for recording and querying the audit log
+type UseCase struct {
+	repo    repository
+	uuidGen uuidGenerator
+}
+
+// NewUseCase creates a new audit UseCase
+func NewUseCase(repo repository, uuidGen uuidGenerator) *UseCase {
+	return &UseCase{
+		repo:    repo,
+		uuidGen: uuidGen,
+	}
+}
+
+// Event is an action to record. ActorID and IP default to the authenticated user
+// and the client of the request in the context. Before and After are marshalled
+// to JSON and should only contain the changed fields, never secrets.
+type Event struct {
+	Action      Action
+	ActorID     string
+	HouseholdID string
+	TargetType  string
+	TargetID    string
+	IP          string
+	Before      any
+	After       any
+}
+
+// Record appends the event to the audit log.
+func (c *UseCase) Record(ctx context.Context, event *Event) error {
+	if event.ActorID == "" {
+		event.ActorID, _ = ctx.Value(auth.UserID).(string)
+	}
+	if event.IP == "" {
+		event.IP = IPFromContext(ctx)
+	}
+	before, err := marshalState(event.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalState(event.After)
+	if err != nil {
+		return err
+	}
+
+	id, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	entry := NewEntry(id, event.Action, event.ActorID, event.HouseholdID, event.TargetType, event.TargetID, event.IP, before, after, time.Now().UTC().Truncate(time.Microsecond))
+	return c.repo.AppendEntry(ctx, entry)
+}
+
+func marshalState(state any) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+// Filter restricts the queried entries. Empty fields match every entry, Limit
+// defaults to 100 and is capped at 1000. UserID matches the entries a user caused
+// or that target their account, e.g. failed logins.
+type Filter struct {
+	UserID      string
+	ActorID     string
+	HouseholdID string
+	Action      Action
+	From        time.Time
+	To          time.Time
+	Limit       int
+}
+
+func (f *Filter) validate() error {
+	if f.Limit < 0 || (!f.From.IsZero() && !f.To.IsZero() && f.To.Before(f.From)) {
+		return ErrInvalidFilter
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultLimit
+	}
+	f.Limit = min(f.Limit, maxLimit)
+	return nil
+}
+
+func (f *Filter) matches(entry *Entry) bool {
+	return (f.UserID == "" || entry.AkteurID() == f.UserID || (entry.ZielTyp() == TargetUser && entry.ZielID() == f.UserID)) &&
+		(f.ActorID == "" || entry.AkteurID() == f.ActorID) &&
+		(f.HouseholdID == "" || entry.HaushaltID() == f.HouseholdID) &&
+		(f.Action == "" || entry.Aktion() == f.Action) &&
+		(f.From.IsZero() || !entry.Zeitpunkt().Before(f.From)) &&
+		(f.To.IsZero() || entry.Zeitpunkt().Before(f.To))
+}
+
+// Entries returns the entries matching the filter, newest first.
+func (c *UseCase) Entries(ctx context.Context, filter Filter) ([]*Entry, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	return c.repo.FindEntries(ctx, filter)
+}
+
+// VerifyOutput is the output for the verify chain use case. BrokenAt is the
+// sequence of the first entry that does not match its predecessor.
+type VerifyOutput struct {
+	Entries  int
+	LastHash string
+	BrokenAt uint64
+}
+
+// VerifyChain recomputes every hash of the log. It returns ErrChainBroken
+// together with the output if an entry was tampered with.
+func (c *UseCase) VerifyChain(ctx context.Context) (*VerifyOutput, error) {
+	entries, err := c.repo.FindAllEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &VerifyOutput{Entries: len(entries)}
+	previousHash := ""
+	for i, entry := range entries {
+		if entry.Sequenz() != uint64(i)+1 || entry.VorherigerHash() != previousHash || entry.BerechneHash() != entry.Hash() {
+			output.BrokenAt = uint64(i) + 1
+			return output, ErrChainBroken
+		}
+		previousHash = entry.Hash()
+	}
+	output.LastHash = previousHash
+	return output, nil
+}
+
+// ExportTables is the export source for the audit entries of the user.
+func (c *UseCase) ExportTables(ctx context.Context, userID string) ([]export.Table, error) {
+	entries, err := c.repo.FindEntries(ctx, Filter{UserID: userID, Limit: math.MaxInt})
+	if err != nil {
+		return nil, err
+	}
+	table := export.Table{
+		Name:    "audit_entries",
+		Columns: []string{"sequence", "time", "action", "actor_id", "household_id", "target_type", "target_id", "ip", "before", "after", "hash"},
+		Rows:    make([][]any, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		table.Rows = append(table.Rows, []any{
+			entry.Sequenz(), entry.Zeitpunkt(), entry.Aktion(), entry.AkteurID(), entry.HaushaltID(), entry.ZielTyp(), entry.ZielID(),
+			entry.IP(), string(entry.Vorher()), string(entry.Nachher()), entry.Hash(),
+		})
+	}
+	return []export.Table{table}, nil
+}
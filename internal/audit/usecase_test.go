@@ -0,0 +1,145 @@
+package audit_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+)
+
+// stubRepository serves a fixed chain to test the verification.
+type stubRepository struct {
+	*audit.InMemoryRepository
+	entries []*audit.Entry
+}
+
+func (r stubRepository) FindAllEntries(ctx context.Context) ([]*audit.Entry, error) {
+	return r.entries, nil
+}
+
+func chain(entries ...*audit.Entry) []*audit.Entry {
+	previousHash := ""
+	for i, entry := range entries {
+		entry.Verkettet(uint64(i)+1, previousHash)
+		previousHash = entry.Hash()
+	}
+	return entries
+}
+
+func newEntry(id string, action audit.Action) *audit.Entry {
+	return audit.NewEntry(id, action, "123", "", audit.TargetUser, "123", "127.0.0.1", nil, []byte(`{"email":"max@gmail.de"}`), time.Now())
+}
+
+func TestRecord(t *testing.T) {
+	ctx := audit.WithIP(context.WithValue(context.Background(), auth.UserID, "123"), "192.0.2.1")
+	uc := audit.NewUseCase(audit.NewInMemoryRepository(), id.UUIDGeneratorFunc(id.GenerateUUID))
+
+	require.NoError(t, uc.Record(ctx, &audit.Event{Action: audit.ActionPasswordChanged, TargetType: audit.TargetUser, TargetID: "123"}))
+	require.NoError(t, uc.Record(ctx, &audit.Event{
+		Action:     audit.ActionEmailChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   "123",
+		Before:     map[string]string{"email": "alt@gmail.de"},
+		After:      map[string]string{"email": "neu@gmail.de"},
+	}))
+	require.NoError(t, uc.Record(context.Background(), &audit.Event{Action: audit.ActionLoginFailed, TargetType: audit.TargetUser, TargetID: "123", IP: "198.51.100.7"}))
+	require.NoError(t, uc.Record(ctx, &audit.Event{Action: audit.ActionBookingCreated, HouseholdID: "h1", TargetType: audit.TargetBooking, TargetID: "b1"}))
+
+	entries, err := uc.Entries(ctx, audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, audit.ActionBookingCreated, entries[0].Aktion(), "newest first")
+	assert.Equal(t, "", entries[1].AkteurID())
+	assert.Equal(t, "198.51.100.7", entries[1].IP())
+	assert.Equal(t, "123", entries[2].AkteurID(), "actor from context")
+	assert.Equal(t, "192.0.2.1", entries[2].IP(), "IP from context")
+	assert.JSONEq(t, `{"email":"alt@gmail.de"}`, string(entries[2].Vorher()))
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		expect int
+	}{
+		{name: "Akteur", filter: audit.Filter{ActorID: "123"}, expect: 3},
+		{name: "Eigene Einträge", filter: audit.Filter{UserID: "123"}, expect: 4},
+		{name: "Haushalt", filter: audit.Filter{HouseholdID: "h1"}, expect: 1},
+		{name: "Aktion", filter: audit.Filter{Action: audit.ActionLoginFailed}, expect: 1},
+		{name: "Limit", filter: audit.Filter{Limit: 2}, expect: 2},
+		{name: "Zeitraum in der Zukunft", filter: audit.Filter{From: time.Now().Add(time.Hour)}, expect: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := uc.Entries(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Len(t, entries, tt.expect)
+		})
+	}
+
+	_, err = uc.Entries(ctx, audit.Filter{From: time.Now(), To: time.Now().Add(-time.Hour)})
+	assert.ErrorIs(t, err, audit.ErrInvalidFilter)
+
+	output, err := uc.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, output.Entries)
+	assert.Equal(t, entries[0].Hash(), output.LastHash)
+}
+
+func TestVerifyChain(t *testing.T) {
+	ctx := context.Background()
+	tampered := func() []*audit.Entry {
+		entries := chain(newEntry("1", audit.ActionLoginSucceeded), newEntry("2", audit.ActionEmailChanged), newEntry("3", audit.ActionLoginSucceeded))
+		forged := newEntry("2", audit.ActionLoginSucceeded)
+		forged.Verkettet(2, entries[0].Hash())
+		entries[1] = forged
+		return entries
+	}
+	removed := func() []*audit.Entry {
+		entries := chain(newEntry("1", audit.ActionLoginSucceeded), newEntry("2", audit.ActionEmailChanged), newEntry("3", audit.ActionLoginSucceeded))
+		return []*audit.Entry{entries[0], entries[2]}
+	}
+
+	tests := []struct {
+		name           string
+		entries        []*audit.Entry
+		expectErr      error
+		expectBrokenAt uint64
+	}{
+		{name: "Leeres Protokoll", entries: nil},
+		{name: "Intakte Kette", entries: chain(newEntry("1", audit.ActionLoginSucceeded), newEntry("2", audit.ActionEmailChanged))},
+		{name: "Geänderter Eintrag", entries: tampered(), expectErr: audit.ErrChainBroken, expectBrokenAt: 3},
+		{name: "Gelöschter Eintrag", entries: removed(), expectErr: audit.ErrChainBroken, expectBrokenAt: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := audit.NewUseCase(stubRepository{InMemoryRepository: audit.NewInMemoryRepository(), entries: tt.entries}, id.UUIDGeneratorFunc(id.GenerateUUID))
+			output, err := uc.VerifyChain(ctx)
+			assert.ErrorIs(t, err, tt.expectErr)
+			assert.Equal(t, tt.expectBrokenAt, output.BrokenAt)
+		})
+	}
+}
+
+func TestConcurrentRecord(t *testing.T) {
+	ctx := context.Background()
+	uc := audit.NewUseCase(audit.NewInMemoryRepository(), id.UUIDGeneratorFunc(id.GenerateUUID))
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, uc.Record(ctx, &audit.Event{Action: audit.ActionLoginSucceeded}))
+		}()
+	}
+	wg.Wait()
+
+	output, err := uc.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 50, output.Entries)
+}
@@ -2,92 +2,243 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// JWT is a struct that holds the JWT secret keys.
+const (
+	// TypeAccess is the type claim of access tokens
+	TypeAccess = "access"
+	// TypeRefresh is the type claim of refresh tokens
+	TypeRefresh = "refresh"
+	// TypeVerify is the type claim of email verification tokens
+	TypeVerify = "verify"
+	// TypeReset is the type claim of password reset tokens
+	TypeReset = "reset"
+	// TypeChallenge is the type claim of two-factor challenge tokens
+	TypeChallenge = "2fa"
+	// TypeDownload is the type claim of signed download links
+	TypeDownload = "download"
+	// TypeEmailChange is the type claim of tokens confirming a new email address
+	TypeEmailChange = "email_change"
+	// TypeEmailUndo is the type claim of tokens reverting an email change
+	TypeEmailUndo = "email_undo"
+)
+
+var (
+	// ErrTokenInvalid is returned when a token is malformed, badly signed or has wrong claims
+	ErrTokenInvalid = errors.New("Token invalid")
+	// ErrTokenExpired is returned when a token is expired or not valid yet
+	ErrTokenExpired = errors.New("Token expired")
+	// ErrWrongTokenType is returned when a valid token is used for another purpose, e.g. a refresh token as access token
+	ErrWrongTokenType = errors.New("Wrong token type")
+)
+
+// JWT is a struct that holds the JWT keys. Access, challenge, verify and reset tokens
+// are signed with the access keys. Refresh tokens are only verified by this service, so
+// they can stay HMAC.
+// Issuer and Audience are set in every token and required when parsing, if not empty.
+// Leeway tolerates clock skew between services for exp, nbf and iat.
 type JWT struct {
-	AccessSecret  []byte
-	RefreshSecret []byte
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+	access   *KeySet
+	refresh  *KeySet
 }
 
-// NewJWT creates a new Token.
+// NewJWT creates a new Token signed with HS256 shared secrets.
 func NewJWT(accessSecret, refreshSecret string) *JWT {
-	return &JWT{
-		AccessSecret:  []byte(accessSecret),
-		RefreshSecret: []byte(refreshSecret),
-	}
+	access, _ := NewKeySet(NewHMACKey("", []byte(accessSecret)))
+	refresh, _ := NewKeySet(NewHMACKey("", []byte(refreshSecret)))
+	return &JWT{access: access, refresh: refresh}
 }
 
-// GenerateAccessToken Signatur
-func (t *JWT) GenerateAccessToken(userID string, ttl time.Duration) (string, error) {
-	secret := t.AccessSecret
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"sub": userID,
-			"iat": time.Now().Unix(),
-			"exp": time.Now().Add(ttl).Unix(),
-		},
-	)
-	jwt, err := token.SignedString(secret)
-	if err != nil {
-		return "", err
+// NewJWTWithKeys creates a new Token that signs access tokens with the key set,
+// e.g. an EdDSA key whose public part is published as JWKS.
+func NewJWTWithKeys(access *KeySet, refreshSecret string) *JWT {
+	refresh, _ := NewKeySet(NewHMACKey("", []byte(refreshSecret)))
+	return &JWT{access: access, refresh: refresh}
+}
+
+// Keys returns the access key set.
+func (t *JWT) Keys() *KeySet {
+	return t.access
+}
+
+// GenerateAccessToken Signatur. The sessionID is stored as jti claim, so revoked
+// sessions can be rejected before the token expires.
+func (t *JWT) GenerateAccessToken(userID, role, sessionID string, ttl time.Duration) (string, error) {
+	claims := t.claims(TypeAccess, userID, ttl)
+	claims["jti"] = sessionID
+	claims["role"] = role
+	return t.access.sign(claims)
+}
+
+// GenerateRefreshToken Signatur. The tokenID is stored as jti claim and identifies
+// the token for rotation and revocation.
+func (t *JWT) GenerateRefreshToken(userID, tokenID string, ttl time.Duration) (string, error) {
+	claims := t.claims(TypeRefresh, userID, ttl)
+	claims["jti"] = tokenID
+	return t.refresh.sign(claims)
+}
+
+// GenerateVerificationToken Signatur. A verification token confirms the email address
+// of a new user.
+func (t *JWT) GenerateVerificationToken(userID string, ttl time.Duration) (string, error) {
+	return t.access.sign(t.claims(TypeVerify, userID, ttl))
+}
+
+// GenerateChallengeToken Signatur. A challenge token proves a successful password
+// check while the second factor is still outstanding.
+func (t *JWT) GenerateChallengeToken(userID string, ttl time.Duration) (string, error) {
+	return t.access.sign(t.claims(TypeChallenge, userID, ttl))
+}
+
+// GenerateResetToken Signatur. The fingerprint of the current password is stored as
+// jti claim, so the token expires as soon as the password changed.
+func (t *JWT) GenerateResetToken(userID, fingerprint string, ttl time.Duration) (string, error) {
+	claims := t.claims(TypeReset, userID, ttl)
+	claims["jti"] = fingerprint
+	return t.access.sign(claims)
+}
+
+// GenerateDownloadToken Signatur. A download token signs a time-limited link to a
+// file of the user, the fileID is stored as jti claim.
+func (t *JWT) GenerateDownloadToken(userID, fileID string, ttl time.Duration) (string, error) {
+	claims := t.claims(TypeDownload, userID, ttl)
+	claims["jti"] = fileID
+	return t.access.sign(claims)
+}
+
+// GenerateEmailChangeToken Signatur. The token is mailed to the new address, the
+// changeID is stored as jti claim, so only the latest requested change can be confirmed.
+func (t *JWT) GenerateEmailChangeToken(userID, changeID string, ttl time.Duration) (string, error) {
+	claims := t.claims(TypeEmailChange, userID, ttl)
+	claims["jti"] = changeID
+	return t.access.sign(claims)
+}
+
+// GenerateEmailUndoToken Signatur. The token is mailed to the old address and
+// reverts the change with the changeID stored as jti claim.
+func (t *JWT) GenerateEmailUndoToken(userID, changeID string, ttl time.Duration) (string, error) {
+	claims := t.claims(TypeEmailUndo, userID, ttl)
+	claims["jti"] = changeID
+	return t.access.sign(claims)
+}
+
+// Parse Signatur parse JWT to extract the claims and validate the access token.
+func (t *JWT) Parse(tokenString string) (*Claims, error) {
+	return t.parse(t.access, tokenString, TypeAccess)
+}
+
+// ParseRefreshToken validates a refresh token against the refresh key and extracts its claims.
+func (t *JWT) ParseRefreshToken(tokenString string) (*Claims, error) {
+	return t.parse(t.refresh, tokenString, TypeRefresh)
+}
+
+// ParseVerificationToken validates an email verification token and extracts its claims.
+func (t *JWT) ParseVerificationToken(tokenString string) (*Claims, error) {
+	return t.parse(t.access, tokenString, TypeVerify)
+}
+
+// ParseChallengeToken validates a two-factor challenge token and extracts its claims.
+func (t *JWT) ParseChallengeToken(tokenString string) (*Claims, error) {
+	return t.parse(t.access, tokenString, TypeChallenge)
+}
+
+// ParseResetToken validates a password reset token and extracts its claims.
+func (t *JWT) ParseResetToken(tokenString string) (*Claims, error) {
+	return t.parse(t.access, tokenString, TypeReset)
+}
+
+// ParseDownloadToken validates a download token and extracts its claims.
+func (t *JWT) ParseDownloadToken(tokenString string) (*Claims, error) {
+	return t.parse(t.access, tokenString, TypeDownload)
+}
+
+// ParseEmailChangeToken validates an email change token and extracts its claims.
+func (t *JWT) ParseEmailChangeToken(tokenString string) (*Claims, error) {
+	return t.parse(t.access, tokenString, TypeEmailChange)
+}
+
+// ParseEmailUndoToken validates an email undo token and extracts its claims.
+func (t *JWT) ParseEmailUndoToken(tokenString string) (*Claims, error) {
+	return t.parse(t.access, tokenString, TypeEmailUndo)
+}
+
+func (t *JWT) claims(tokenType, userID string, ttl time.Duration) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":  userID,
+		"iat":  now.Unix(),
+		"exp":  now.Add(ttl).Unix(),
+		"type": tokenType,
 	}
-	return jwt, nil
-}
-
-// GenerateRefreshToken Signatur
-func (t *JWT) GenerateRefreshToken(userID string, ttl time.Duration) (string, error) {
-	secret := t.RefreshSecret
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"sub":  userID,
-			"iat":  time.Now().Unix(),
-			"exp":  time.Now().Add(ttl).Unix(),
-			"type": "refresh",
-		},
-	)
-	jwt, err := token.SignedString(secret)
-	if err != nil {
-		return "", err
+	if t.Issuer != "" {
+		claims["iss"] = t.Issuer
+	}
+	if t.Audience != "" {
+		claims["aud"] = t.Audience
 	}
-	return jwt, nil
+	return claims
 }
 
-// Parse Signatur parse JWT to extract the claims and validate the token.
-func (t *JWT) Parse(tokenString string) (*Claims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		return t.AccessSecret, nil
-	})
+// parse only accepts the algorithms of the key set, requires exp and checks iss
+// and aud before the type claim.
+func (t *JWT) parse(keys *KeySet, tokenString, tokenType string) (*Claims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(keys.methods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(t.Leeway),
+	}
+	if t.Issuer != "" {
+		options = append(options, jwt.WithIssuer(t.Issuer))
+	}
+	if t.Audience != "" {
+		options = append(options, jwt.WithAudience(t.Audience))
+	}
 
+	token, err := jwt.NewParser(options...).Parse(tokenString, keys.keyFunc)
 	if err != nil {
-		return nil, err
+		if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
+			return nil, fmt.Errorf("%w: %w", ErrTokenExpired, err)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrTokenInvalid, err)
 	}
 
-	if !token.Valid {
-		return nil, errors.New("Token Invalid")
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%w: can not parse claims", ErrTokenInvalid)
+	}
+	if actual, _ := claims["type"].(string); actual != tokenType {
+		return nil, fmt.Errorf("%w: expected %s, got %q", ErrWrongTokenType, tokenType, actual)
 	}
+	return toClaims(claims), nil
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		sub, _ := claims["sub"].(string)
-		iat, _ := claims["iat"].(time.Time)
-		exp, _ := claims["exp"].(time.Time)
-		role, _ := claims["role"].(string)
-		// permissions, _ := claims["permissions"].([]string)
-		// jit, _ := claims["jit"].(string)
-
-		return &Claims{
-			Sub:  sub,
-			Iat:  iat,
-			Exp:  exp,
-			Role: role,
-			// Permissions: permissions,
-			// Jit:         jit,
-		}, nil
+func toClaims(claims jwt.MapClaims) *Claims {
+	sub, _ := claims.GetSubject()
+	role, _ := claims["role"].(string)
+	// permissions, _ := claims["permissions"].([]string)
+	jit, _ := claims["jti"].(string)
+	tokenType, _ := claims["type"].(string)
+
+	result := &Claims{
+		Sub:  sub,
+		Role: role,
+		// Permissions: permissions,
+		Jit:  jit,
+		Type: tokenType,
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		result.Iat = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		result.Exp = exp.Time
 	}
-	return nil, errors.New("Can not parse claims")
+	return result
 }
@@ -0,0 +1,154 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+)
+
+func newTokenService() *auth.JWT {
+	tokenService := auth.NewJWT("access", "refresh")
+	tokenService.Issuer = "haushaltsbuch"
+	tokenService.Audience = "haushaltsbuch"
+	tokenService.Leeway = 30 * time.Second
+	return tokenService
+}
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("access"))
+	require.NoError(t, err)
+	return token
+}
+
+func TestParse(t *testing.T) {
+	tokenService := newTokenService()
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":  "123",
+			"jti":  "s1",
+			"iss":  "haushaltsbuch",
+			"aud":  "haushaltsbuch",
+			"iat":  now.Unix(),
+			"exp":  now.Add(time.Minute).Unix(),
+			"type": auth.TypeAccess,
+		}
+	}
+	with := func(key string, value any) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		token     string
+		expectErr error
+	}{
+		{name: "Gültiges Token", token: signHS256(t, valid())},
+		{name: "Abgelaufen innerhalb der Toleranz", token: signHS256(t, with("exp", now.Add(-10*time.Second).Unix()))},
+		{name: "Abgelaufen", token: signHS256(t, with("exp", now.Add(-time.Minute).Unix())), expectErr: auth.ErrTokenExpired},
+		{name: "Ohne Ablauf", token: signHS256(t, with("exp", nil)), expectErr: auth.ErrTokenInvalid},
+		{name: "Ausgestellt in der Zukunft", token: signHS256(t, with("iat", now.Add(time.Hour).Unix())), expectErr: auth.ErrTokenInvalid},
+		{name: "Falscher Aussteller", token: signHS256(t, with("iss", "fremd")), expectErr: auth.ErrTokenInvalid},
+		{name: "Falsche Zielgruppe", token: signHS256(t, with("aud", "fremd")), expectErr: auth.ErrTokenInvalid},
+		{name: "Falscher Typ", token: signHS256(t, with("type", auth.TypeReset)), expectErr: auth.ErrWrongTokenType},
+		{name: "Ohne Typ", token: signHS256(t, with("type", nil)), expectErr: auth.ErrWrongTokenType},
+		{name: "Algorithmus none", token: noneToken, expectErr: auth.ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tokenService.Parse(tt.token)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "123", claims.Sub)
+			assert.Equal(t, now.Unix(), claims.Iat.Unix())
+			assert.False(t, claims.Exp.IsZero())
+		})
+	}
+}
+
+func TestTokenTypes(t *testing.T) {
+	tokenService := newTokenService()
+	reset, err := tokenService.GenerateResetToken("123", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	verify, err := tokenService.GenerateVerificationToken("123", time.Minute)
+	require.NoError(t, err)
+
+	_, err = tokenService.Parse(reset)
+	assert.ErrorIs(t, err, auth.ErrWrongTokenType)
+	_, err = tokenService.ParseResetToken(verify)
+	assert.ErrorIs(t, err, auth.ErrWrongTokenType)
+
+	claims, err := tokenService.ParseVerificationToken(verify)
+	require.NoError(t, err)
+	assert.Equal(t, auth.TypeVerify, claims.Type)
+
+	other := auth.NewJWT("access", "refresh")
+	other.Issuer = "anderer-dienst"
+	_, err = other.ParseVerificationToken(verify)
+	assert.ErrorIs(t, err, auth.ErrTokenInvalid)
+}
+
+type sessionsFunc func(ctx context.Context, sessionID string, at time.Time) error
+
+func (f sessionsFunc) TouchSession(ctx context.Context, sessionID string, at time.Time) error {
+	return f(ctx, sessionID, at)
+}
+
+func TestAuthorize(t *testing.T) {
+	tokenService := newTokenService()
+	access, err := tokenService.GenerateAccessToken("123", "user", "s1", time.Minute)
+	require.NoError(t, err)
+	refresh, err := tokenService.GenerateRefreshToken("123", "r1", time.Minute)
+	require.NoError(t, err)
+	reset, err := tokenService.GenerateResetToken("123", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	expired := signHS256(t, jwt.MapClaims{"sub": "123", "jti": "s1", "iss": "haushaltsbuch", "aud": "haushaltsbuch", "exp": time.Now().Add(-time.Hour).Unix(), "type": auth.TypeAccess})
+
+	sessions := sessionsFunc(func(ctx context.Context, sessionID string, at time.Time) error { return nil })
+	handler := auth.NewAuthorization(tokenService, sessions, nil).Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "123", r.Context().Value(auth.UserID))
+	}))
+
+	tests := []struct {
+		name           string
+		header         string
+		expectStatus   int
+		expectAuthHead string
+	}{
+		{name: "Gültiges Token", header: "Bearer " + access, expectStatus: http.StatusOK},
+		{name: "Ohne Token", header: "", expectStatus: http.StatusUnauthorized, expectAuthHead: "Bearer"},
+		{name: "Abgelaufen", header: "Bearer " + expired, expectStatus: http.StatusUnauthorized, expectAuthHead: `Bearer error="invalid_token", error_description="The access token expired"`},
+		{name: "Reset Token", header: "Bearer " + reset, expectStatus: http.StatusUnauthorized, expectAuthHead: `Bearer error="invalid_token", error_description="The token is no access token"`},
+		{name: "Refresh Token", header: "Bearer " + refresh, expectStatus: http.StatusUnauthorized, expectAuthHead: `Bearer error="invalid_token", error_description="The access token is invalid"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectStatus, rec.Code)
+			assert.Equal(t, tt.expectAuthHead, rec.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
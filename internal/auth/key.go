@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSABits = 2048
+
+var (
+	// ErrUnsupportedKey is returned when a PEM file holds no Ed25519, RSA or P-256 key
+	ErrUnsupportedKey = errors.New("Unsupported key type")
+	// ErrUnknownKey is returned when a token references a key ID that is not in the key set
+	ErrUnknownKey = errors.New("Unknown signing key")
+	// ErrNoSigningKey is returned when the key set has no private key to sign with
+	ErrNoSigningKey = errors.New("Key can not sign")
+)
+
+// Key is a signing or verification key of a KeySet. The ID is sent as kid header,
+// so verifiers pick the matching key after a rotation.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// NewHMACKey creates a symmetric HS256 key. HMAC keys are never published.
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// LoadKey reads a PEM encoded key from path, see ParseKey.
+func LoadKey(id, path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	return ParseKey(id, data)
+}
+
+// ParseKey parses a PEM encoded private or public key. The algorithm follows from
+// the key type: Ed25519 signs with EdDSA, RSA with RS256 and P-256 with ES256.
+// Public keys can only verify and serve old keys during a rotation.
+func ParseKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %s: no PEM data", id)
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("key %s: %w %q", id, ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("key %s: %w", id, err)
+	}
+	return newKey(id, parsed)
+}
+
+func newKey(id string, parsed any) (Key, error) {
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	case ed25519.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, verify: k}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return Key{}, fmt.Errorf("key %s: RSA key shorter than %d bits", id, minRSABits)
+		}
+		return Key{ID: id, Method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return Key{}, fmt.Errorf("key %s: RSA key shorter than %d bits", id, minRSABits)
+		}
+		return Key{ID: id, Method: jwt.SigningMethodRS256, verify: k}, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("key %s: %w: only P-256 curves", id, ErrUnsupportedKey)
+		}
+		return Key{ID: id, Method: jwt.SigningMethodES256, sign: k, verify: &k.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("key %s: %w: only P-256 curves", id, ErrUnsupportedKey)
+		}
+		return Key{ID: id, Method: jwt.SigningMethodES256, verify: k}, nil
+	default:
+		return Key{}, fmt.Errorf("key %s: %w %T", id, ErrUnsupportedKey, parsed)
+	}
+}
+
+// CanSign reports whether the key holds a private key.
+func (k Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// KeySet holds the key that signs new tokens and every key that is still accepted
+// for verification.
+type KeySet struct {
+	signing Key
+	keys    map[string]Key
+}
+
+// NewKeySet creates a new KeySet. The signing key is always accepted for
+// verification, further keys keep tokens of retired keys valid until they expire.
+func NewKeySet(signing Key, verification ...Key) (*KeySet, error) {
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("key %s: %w", signing.ID, ErrNoSigningKey)
+	}
+	keys := map[string]Key{signing.ID: signing}
+	for _, key := range verification {
+		if _, exists := keys[key.ID]; exists {
+			return nil, fmt.Errorf("key %s: duplicate key ID", key.ID)
+		}
+		keys[key.ID] = key
+	}
+	return &KeySet{signing: signing, keys: keys}, nil
+}
+
+// sign signs the claims with the signing key and sets the kid header.
+func (s *KeySet) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	if s.signing.ID != "" {
+		token.Header["kid"] = s.signing.ID
+	}
+	return token.SignedString(s.signing.sign)
+}
+
+// methods returns the algorithms of all keys, every other algorithm is rejected
+// before the signature is checked.
+func (s *KeySet) methods() []string {
+	seen := make(map[string]bool, len(s.keys))
+	methods := make([]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// keyFunc selects the verification key by the kid header. The algorithm of the
+// token must match the key, so a public key is never used as HMAC secret.
+func (s *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.verify, nil
+}
@@ -0,0 +1,137 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func pkcs8(t *testing.T, key any) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return der
+}
+
+func TestLoadKey(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+	weakRSA, _ := rsa.GenerateKey(rand.Reader, 1024)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	tests := []struct {
+		name      string
+		blockType string
+		der       []byte
+		expectAlg string
+		expectErr bool
+	}{
+		{name: "Ed25519", blockType: "PRIVATE KEY", der: pkcs8(t, edKey), expectAlg: "EdDSA"},
+		{name: "RSA PKCS1", blockType: "RSA PRIVATE KEY", der: x509.MarshalPKCS1PrivateKey(rsaKey), expectAlg: "RS256"},
+		{name: "EC SEC1", blockType: "EC PRIVATE KEY", der: ecDER, expectAlg: "ES256"},
+		{name: "RSA zu kurz", blockType: "PRIVATE KEY", der: pkcs8(t, weakRSA), expectErr: true},
+		{name: "Falsche Kurve", blockType: "PRIVATE KEY", der: pkcs8(t, p384), expectErr: true},
+		{name: "Zertifikat", blockType: "CERTIFICATE", der: []byte("x"), expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := auth.LoadKey("k1", writePEM(t, tt.blockType, tt.der))
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, key.CanSign())
+			assert.Equal(t, tt.expectAlg, key.Method.Alg())
+
+			keys, err := auth.NewKeySet(key)
+			require.NoError(t, err)
+			tokenService := auth.NewJWTWithKeys(keys, "refresh")
+			token, err := tokenService.GenerateAccessToken("123", "user", "s1", time.Minute)
+			require.NoError(t, err)
+			claims, err := tokenService.Parse(token)
+			require.NoError(t, err)
+			assert.Equal(t, "123", claims.Sub)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	_, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	newPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	oldKey, err := auth.ParseKey("old", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(t, oldPriv)}))
+	require.NoError(t, err)
+	newKey, err := auth.ParseKey("new", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(t, newPriv)}))
+	require.NoError(t, err)
+	pubDER, _ := x509.MarshalPKIXPublicKey(oldPriv.Public())
+	oldPublic, err := auth.ParseKey("old", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	require.NoError(t, err)
+	assert.False(t, oldPublic.CanSign())
+
+	oldKeys, _ := auth.NewKeySet(oldKey)
+	oldToken, err := auth.NewJWTWithKeys(oldKeys, "refresh").GenerateAccessToken("123", "user", "s1", time.Minute)
+	require.NoError(t, err)
+
+	rotated, err := auth.NewKeySet(newKey, oldPublic)
+	require.NoError(t, err)
+	tokenService := auth.NewJWTWithKeys(rotated, "refresh")
+
+	_, err = tokenService.Parse(oldToken)
+	assert.NoError(t, err, "tokens of the retired key stay valid")
+
+	_, err = auth.NewJWTWithKeys(mustKeySet(t, newKey), "refresh").Parse(oldToken)
+	assert.ErrorIs(t, err, auth.ErrTokenInvalid, "tokens of removed keys are rejected")
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "123", "jti": "s1"})
+	forged.Header["kid"] = "old"
+	forgedToken, err := forged.SignedString([]byte(oldPriv.Public().(ed25519.PublicKey)))
+	require.NoError(t, err)
+	_, err = tokenService.Parse(forgedToken)
+	assert.Error(t, err, "the algorithm must match the key")
+
+	_, err = auth.NewKeySet(oldPublic)
+	assert.ErrorIs(t, err, auth.ErrNoSigningKey)
+
+	rec := httptest.NewRecorder()
+	rotated.ServeHTTP(rec, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	var jwks auth.JWKS
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&jwks))
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "EC", jwks.Keys[0].KeyType)
+	assert.Equal(t, "new", jwks.Keys[0].KeyID)
+	assert.Equal(t, "OKP", jwks.Keys[1].KeyType)
+	assert.Equal(t, "Ed25519", jwks.Keys[1].Curve)
+}
+
+func TestJWKSWithoutHMAC(t *testing.T) {
+	jwks := auth.NewJWT("access", "refresh").Keys().JWKS()
+	assert.Empty(t, jwks.Keys, "shared secrets must never be published")
+}
+
+func mustKeySet(t *testing.T, key auth.Key) *auth.KeySet {
+	keys, err := auth.NewKeySet(key)
+	require.NoError(t, err)
+	return keys
+}
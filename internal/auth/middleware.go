@@ -2,7 +2,10 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 )
@@ -14,6 +17,19 @@ var (
 	UserID contextkey = "userID"
 	// Token is the key for the token in the context
 	Token contextkey = "token"
+	// Role is the key for the user role in the context
+	Role contextkey = "role"
+	// SessionID is the key for the session ID in the context
+	SessionID contextkey = "sessionID"
+	// Scopes is the key for the scopes of a personal access token in the context
+	Scopes contextkey = "scopes"
+)
+
+const (
+	// APITokenPrefix starts every personal access token, so it is never parsed as JWT
+	APITokenPrefix = "hhb_"
+	// TypeAPIToken is the claims type of personal access tokens
+	TypeAPIToken = "pat"
 )
 
 // Claims ...
@@ -24,36 +40,137 @@ type Claims struct {
 	Role        string
 	Permissions []string
 	Jit         string
+	Type        string
 }
 
 type tokenParser interface {
 	Parse(tokenString string) (*Claims, error)
 }
 
+type sessionTracker interface {
+	TouchSession(ctx context.Context, sessionID string, at time.Time) error
+}
+
+type apiTokenVerifier interface {
+	Verify(ctx context.Context, token string) (*Claims, error)
+}
+
 // Authorization is a middleware that checks the authorization token
 type Authorization struct {
 	tokenAuth tokenParser
+	sessions  sessionTracker
+	apiTokens apiTokenVerifier
 }
 
 // NewAuthorization creates a new Authorization middleware
-func NewAuthorization(tokenAuth tokenParser) *Authorization {
-	return &Authorization{tokenAuth: tokenAuth}
+func NewAuthorization(tokenAuth tokenParser, sessions sessionTracker, apiTokens apiTokenVerifier) *Authorization {
+	return &Authorization{tokenAuth: tokenAuth, sessions: sessions, apiTokens: apiTokens}
 }
 
-// Authorize verifies the token and extracts the user ID from it
+// Authorize verifies the token and extracts the user ID from it. Only access tokens
+// of a session are accepted, personal access tokens can not manage the account.
+// Rejected requests get a WWW-Authenticate header as described in RFC 6750.
 func (a *Authorization) Authorize(next http.Handler) http.Handler {
+	return a.authorize(next, false)
+}
+
+// AuthorizeAPI works like Authorize, but also accepts personal access tokens. Routes
+// behind it have to declare their scope with RequireScope.
+func (a *Authorization) AuthorizeAPI(next http.Handler) http.Handler {
+	return a.authorize(next, true)
+}
+
+func (a *Authorization) authorize(next http.Handler, acceptAPITokens bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		reqToken := r.Header.Get("Authorization")
-		token := strings.TrimPrefix(reqToken, "Bearer ")
+		token, ok := strings.CutPrefix(reqToken, "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if strings.HasPrefix(token, APITokenPrefix) {
+			if !acceptAPITokens {
+				rejectToken(w, "Personal access tokens are not accepted here")
+				return
+			}
+			claim, err := a.apiTokens.Verify(r.Context(), token)
+			if err != nil {
+				rejectToken(w, "The personal access token is invalid or expired")
+				return
+			}
+			ctx := context.WithValue(r.Context(), UserID, claim.Sub)
+			ctx = context.WithValue(ctx, Token, token)
+			ctx = context.WithValue(ctx, Scopes, claim.Permissions)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		claim, err := a.tokenAuth.Parse(token)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			switch {
+			case errors.Is(err, ErrTokenExpired):
+				rejectToken(w, "The access token expired")
+			case errors.Is(err, ErrWrongTokenType):
+				rejectToken(w, "The token is no access token")
+			default:
+				rejectToken(w, "The access token is invalid")
+			}
+			return
+		}
+
+		// the jti of an access token references its session, tokens of revoked
+		// sessions are rejected before they expire
+		if claim.Jit == "" {
+			rejectToken(w, "The access token has no session")
+			return
+		}
+		if err := a.sessions.TouchSession(r.Context(), claim.Jit, time.Now().UTC()); err != nil {
+			rejectToken(w, "The session was revoked")
 			return
 		}
 
 		userID := claim.Sub
 		ctx := context.WithValue(r.Context(), UserID, userID)
 		ctx = context.WithValue(ctx, Token, token)
+		ctx = context.WithValue(ctx, Role, claim.Role)
+		ctx = context.WithValue(ctx, SessionID, claim.Jit)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// rejectToken answers with 401 and the invalid_token error code.
+func rejectToken(w http.ResponseWriter, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, description))
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// RequireRole only lets requests pass whose authorized user has the given role.
+// It has to run after Authorize.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userRole, _ := r.Context().Value(Role).(string); userRole != role {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope only lets personal access tokens with the given scope pass. Access
+// tokens of a session have every scope. It has to run after AuthorizeAPI.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scopes, ok := r.Context().Value(Scopes).([]string); ok && !slices.Contains(scopes, scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+// Package backup writes point-in-time snapshots of the SQLite database of every
+// store into a compressed archive and restores them. The archive holds a manifest
+// with the schema version and the SHA-256 checksum of every file, so a damaged
+// snapshot or one of a newer release is refused before anything is restored.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+)
+
+const (
+	// Format is the version of the archive layout written by this release.
+	Format = 1
+
+	manifestFile = "manifest.json"
+	databaseFile = "database.sql"
+	// maxFileSize limits the files read from an archive
+	maxFileSize = 1 << 30
+)
+
+var (
+	// ErrInvalid is returned when a file is no backup archive
+	ErrInvalid = errors.New("File is no backup")
+	// ErrChecksum is returned when a file of a backup does not match its checksum
+	ErrChecksum = errors.New("Backup checksum mismatch")
+	// ErrIncompatible is returned when a backup was written by a newer release
+	ErrIncompatible = errors.New("Backup is incompatible with this release")
+	// ErrNotEmpty is returned when a backup is restored into a database with tables
+	ErrNotEmpty = errors.New("Target database is not empty")
+)
+
+// Manifest describes a snapshot.
+type Manifest struct {
+	Format        int       `json:"format"`
+	CreatedAt     time.Time `json:"created_at"`
+	AppVersion    string    `json:"app_version"`
+	SchemaVersion int       `json:"schema_version"`
+	Files         []File    `json:"files"`
+}
+
+// File is a file of the archive with its size and SHA-256 checksum.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Write writes a snapshot of the database to w. The dump and the schema version
+// are read in one transaction, so the snapshot is consistent while the service
+// keeps running.
+func Write(ctx context.Context, db *sql.DB, w io.Writer, appVersion string) (*Manifest, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var version sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	script, err := sqlite.Dump(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(script)
+	manifest := &Manifest{
+		Format:        Format,
+		CreatedAt:     time.Now().UTC(),
+		AppVersion:    appVersion,
+		SchemaVersion: int(version.Int64),
+		Files: []File{
+			{Name: databaseFile, Size: int64(len(script)), SHA256: hex.EncodeToString(sum[:])},
+		},
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	// the manifest comes first, so it can be inspected without unpacking the dump
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{{manifestFile, data}, {databaseFile, script}} {
+		header := &tar.Header{
+			Name:    file.name,
+			Mode:    0o600,
+			Size:    int64(len(file.data)),
+			ModTime: manifest.CreatedAt,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := archive.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// WriteFile writes a snapshot of the database to a new file at path. An existing
+// file is never overwritten and a failed snapshot leaves no file behind.
+func WriteFile(ctx context.Context, db *sql.DB, path, appVersion string) (manifest *Manifest, err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%w: %s", sqlite.ErrBackupExists, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+		}
+	}()
+
+	if manifest, err = Write(ctx, db, f, appVersion); err != nil {
+		return nil, err
+	}
+	if err = f.Sync(); err != nil {
+		return nil, err
+	}
+	return manifest, f.Close()
+}
+
+// Read reads a snapshot and verifies the checksum of every file. It returns the
+// manifest and the SQL script of the database.
+func Read(r io.Reader) (*Manifest, []byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if header.Typeflag != tar.TypeReg || header.Size > maxFileSize {
+			return nil, nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalid, header.Name)
+		}
+		if files[header.Name], err = io.ReadAll(archive); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+
+	data, exists := files[manifestFile]
+	if !exists {
+		return nil, nil, fmt.Errorf("%w: %s is missing", ErrInvalid, manifestFile)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if manifest.Format != Format {
+		return nil, nil, fmt.Errorf("%w: archive format %d, supported %d", ErrIncompatible, manifest.Format, Format)
+	}
+	for _, file := range manifest.Files {
+		content, exists := files[file.Name]
+		if !exists {
+			return nil, nil, fmt.Errorf("%w: %s is missing", ErrInvalid, file.Name)
+		}
+		sum := sha256.Sum256(content)
+		if int64(len(content)) != file.Size || hex.EncodeToString(sum[:]) != file.SHA256 {
+			return nil, nil, fmt.Errorf("%w: %s", ErrChecksum, file.Name)
+		}
+	}
+	script, exists := files[databaseFile]
+	if !exists || !listed(manifest.Files, databaseFile) {
+		return nil, nil, fmt.Errorf("%w: %s is missing", ErrInvalid, databaseFile)
+	}
+	return &manifest, script, nil
+}
+
+// Restore restores a snapshot into an empty database. Snapshots of a newer
+// schema than latest are refused, older ones are restored as they are and must
+// be migrated afterwards.
+func Restore(ctx context.Context, db *sql.DB, r io.Reader, latest int) (*Manifest, error) {
+	manifest, script, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion < 1 || manifest.SchemaVersion > latest {
+		return nil, fmt.Errorf("%w: schema version %d, supported up to %d", ErrIncompatible, manifest.SchemaVersion, latest)
+	}
+
+	var tables int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_schema WHERE name NOT LIKE 'sqlite_%'`).Scan(&tables); err != nil {
+		return nil, err
+	}
+	if tables > 0 {
+		return nil, ErrNotEmpty
+	}
+	if err := sqlite.Restore(ctx, db, script); err != nil {
+		return nil, err
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if int(version.Int64) != manifest.SchemaVersion {
+		return nil, fmt.Errorf("%w: manifest schema version %d, database at %d", ErrInvalid, manifest.SchemaVersion, version.Int64)
+	}
+	return manifest, nil
+}
+
+// RestoreFile restores the snapshot at path into an empty database.
+func RestoreFile(ctx context.Context, db *sql.DB, path string, latest int) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Restore(ctx, db, f, latest)
+}
+
+func listed(files []File, name string) bool {
+	for _, file := range files {
+		if file.Name == name {
+			return true
+		}
+	}
+	return false
+}
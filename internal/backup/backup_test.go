@@ -0,0 +1,221 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/backup"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite/sqlitetest"
+)
+
+func openEmpty(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "restore.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func latest(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	migrator, err := sqlite.NewMigrator(db)
+	require.NoError(t, err)
+	return migrator.Latest()
+}
+
+func snapshot(t *testing.T) []byte {
+	t.Helper()
+	db := sqlitetest.Open(t)
+	_, err := db.Exec(`INSERT INTO outbox_messages (id, recipient, subject, body, status, attempts, last_error, next_attempt_at, created_at, updated_at)
+		VALUES ('m1', 'max@gmail.de', 'Hallo', 'Grüße', 'pending', 0, '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = backup.Write(context.Background(), db, &buf, "1.0.0")
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+// rewrite unpacks an archive, lets fn change its files and packs it again.
+func rewrite(t *testing.T, archive []byte, fn func(files map[string][]byte)) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	files := make(map[string][]byte)
+	names := make([]string, 0)
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		files[header.Name], err = io.ReadAll(r)
+		require.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	fn(files)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gw)
+	for _, name := range names {
+		data, exists := files[name]
+		if !exists {
+			continue
+		}
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data))}))
+		_, err := w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func changeManifest(t *testing.T, fn func(manifest map[string]any)) func(files map[string][]byte) {
+	return func(files map[string][]byte) {
+		var manifest map[string]any
+		require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+		fn(manifest)
+		data, err := json.Marshal(manifest)
+		require.NoError(t, err)
+		files["manifest.json"] = data
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db := sqlitetest.Open(t)
+	_, err := db.Exec(`INSERT INTO outbox_messages (id, recipient, subject, body, status, attempts, last_error, next_attempt_at, created_at, updated_at)
+		VALUES ('m1', 'max@gmail.de', 'Hallo', 'Grüße', 'pending', 0, '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "backup.tar.gz")
+	written, err := backup.WriteFile(ctx, db, path, "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, backup.Format, written.Format)
+	assert.Equal(t, "1.0.0", written.AppVersion)
+	assert.Equal(t, latest(t, db), written.SchemaVersion)
+	require.Len(t, written.Files, 1)
+	assert.Equal(t, "database.sql", written.Files[0].Name)
+
+	_, err = backup.WriteFile(ctx, db, path, "1.0.0")
+	assert.ErrorIs(t, err, sqlite.ErrBackupExists, "vorhandene Datei wird nicht überschrieben")
+
+	target := openEmpty(t)
+	restored, err := backup.RestoreFile(ctx, target, path, latest(t, target))
+	require.NoError(t, err)
+	assert.Equal(t, written.SchemaVersion, restored.SchemaVersion)
+	assert.Equal(t, written.Files, restored.Files)
+	assert.True(t, written.CreatedAt.Equal(restored.CreatedAt))
+
+	var recipient, body string
+	require.NoError(t, target.QueryRow(`SELECT recipient, body FROM outbox_messages WHERE id = 'm1'`).Scan(&recipient, &body))
+	assert.Equal(t, "max@gmail.de", recipient)
+	assert.Equal(t, "Grüße", body)
+	migrator, err := sqlite.NewMigrator(target)
+	require.NoError(t, err)
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, applied, "Schema ist bereits aktuell")
+}
+
+func TestRestoreOlderSchema(t *testing.T) {
+	ctx := context.Background()
+	target := openEmpty(t)
+
+	// a release with newer migrations restores the snapshot and migrates it afterwards
+	manifest, err := backup.Restore(ctx, target, bytes.NewReader(snapshot(t)), latest(t, target)+1)
+	require.NoError(t, err)
+	assert.Equal(t, latest(t, target), manifest.SchemaVersion)
+}
+
+func TestRestoreFails(t *testing.T) {
+	archive := snapshot(t)
+
+	tests := []struct {
+		name    string
+		archive []byte
+		prepare func(t *testing.T, db *sql.DB)
+		latest  int
+		err     error
+	}{
+		{
+			name:    "keine Sicherung",
+			archive: []byte("kein Archiv"),
+			err:     backup.ErrInvalid,
+		},
+		{
+			name: "Manifest fehlt",
+			archive: rewrite(t, archive, func(files map[string][]byte) {
+				delete(files, "manifest.json")
+			}),
+			err: backup.ErrInvalid,
+		},
+		{
+			name: "Datenbank fehlt",
+			archive: rewrite(t, archive, func(files map[string][]byte) {
+				delete(files, "database.sql")
+			}),
+			err: backup.ErrInvalid,
+		},
+		{
+			name: "Datenbank verändert",
+			archive: rewrite(t, archive, func(files map[string][]byte) {
+				files["database.sql"] = bytes.Replace(files["database.sql"], []byte("max@gmail.de"), []byte("eve@gmail.de"), 1)
+			}),
+			err: backup.ErrChecksum,
+		},
+		{
+			name: "unbekanntes Format",
+			archive: rewrite(t, archive, changeManifest(t, func(manifest map[string]any) {
+				manifest["format"] = backup.Format + 1
+			})),
+			err: backup.ErrIncompatible,
+		},
+		{
+			name:    "neueres Schema",
+			archive: archive,
+			latest:  -1,
+			err:     backup.ErrIncompatible,
+		},
+		{
+			name: "Schema passt nicht zum Manifest",
+			archive: rewrite(t, archive, changeManifest(t, func(manifest map[string]any) {
+				manifest["schema_version"] = manifest["schema_version"].(float64) - 1
+			})),
+			err: backup.ErrInvalid,
+		},
+		{
+			name:    "Ziel nicht leer",
+			archive: archive,
+			prepare: func(t *testing.T, db *sql.DB) {
+				_, err := db.Exec(`CREATE TABLE notizen (id TEXT PRIMARY KEY)`)
+				require.NoError(t, err)
+			},
+			err: backup.ErrNotEmpty,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := openEmpty(t)
+			if tt.prepare != nil {
+				tt.prepare(t, target)
+			}
+			_, err := backup.Restore(context.Background(), target, bytes.NewReader(tt.archive), latest(t, target)+tt.latest)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
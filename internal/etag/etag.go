@@ -0,0 +1,81 @@
+// Package etag maps the versions of stored objects to entity tags, so clients can
+// make their writes conditional with If-Match and no change is lost.
+package etag
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+var (
+	// ErrMissing is returned when a write has no If-Match header
+	ErrMissing = errors.New("If-Match header required")
+	// ErrMismatch is returned when the If-Match header names no version, e.g. a weak tag
+	ErrMismatch = errors.New("If-Match header matches no version")
+)
+
+// Format returns the strong entity tag of a version.
+func Format(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// IfMatch returns the version the If-Match header of a write expects, or zero for
+// "*". A weak tag never matches, as If-Match compares strongly.
+func IfMatch(r *http.Request) (int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, ErrMissing
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	tag, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, ErrMismatch
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, ErrMismatch
+	}
+	return version, nil
+}
+
+// NoneMatch reports whether the If-None-Match header of a read names the version,
+// so the client's copy is still current.
+func NoneMatch(r *http.Request, version int64) bool {
+	tag := Format(version)
+	for candidate := range strings.SplitSeq(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == tag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the status code of a failed precondition: 428 for ErrMissing,
+// 412 otherwise.
+func Status(err error) int {
+	if errors.Is(err, ErrMissing) {
+		return http.StatusPreconditionRequired
+	}
+	return http.StatusPreconditionFailed
+}
+
+// Require returns the version the If-Match header of a write expects, or zero for
+// "*". It answers a missing header with 428 and a mismatch with 412 and reports
+// whether the handler can go on.
+func Require(w http.ResponseWriter, r *http.Request, log logger.Logger) (int64, bool) {
+	version, err := IfMatch(r)
+	if err != nil {
+		log.Error(fmt.Sprintf("precondition failed. %v", err))
+		http.Error(w, err.Error(), Status(err))
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,101 @@
+package etag_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/etag"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Error(string)   {}
+func (nopLogger) Warning(string) {}
+func (nopLogger) Info(string)    {}
+func (nopLogger) Debug(string)   {}
+func (nopLogger) Fatal(string)   {}
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		expectVersion int64
+		expectErr     error
+		expectStatus  int
+	}{
+		{name: "Version", header: `"3"`, expectVersion: 3},
+		{name: "Beliebige Version", header: "*", expectVersion: 0},
+		{name: "Fehlender Header", header: "", expectErr: etag.ErrMissing, expectStatus: http.StatusPreconditionRequired},
+		{name: "Schwacher Tag", header: `W/"3"`, expectErr: etag.ErrMismatch, expectStatus: http.StatusPreconditionFailed},
+		{name: "Ohne Anführungszeichen", header: "3", expectErr: etag.ErrMismatch, expectStatus: http.StatusPreconditionFailed},
+		{name: "Keine Zahl", header: `"abc"`, expectErr: etag.ErrMismatch, expectStatus: http.StatusPreconditionFailed},
+		{name: "Version null", header: `"0"`, expectErr: etag.ErrMismatch, expectStatus: http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			version, err := etag.IfMatch(r)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				assert.Equal(t, tt.expectStatus, etag.Status(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectVersion, version)
+		})
+	}
+}
+
+func TestNoneMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		expect bool
+	}{
+		{name: "Aktuelle Version", header: `"3"`, expect: true},
+		{name: "Schwacher Tag", header: `W/"3"`, expect: true},
+		{name: "Liste", header: `"1", "3"`, expect: true},
+		{name: "Alte Version", header: `"2"`, expect: false},
+		{name: "Fehlender Header", header: "", expect: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("If-None-Match", tt.header)
+			assert.Equal(t, tt.expect, etag.NoneMatch(r, 3))
+			assert.Equal(t, `"3"`, etag.Format(3))
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		expectVersion int64
+		expectOK      bool
+		expectStatus  int
+	}{
+		{name: "Version", header: `"3"`, expectVersion: 3, expectOK: true, expectStatus: http.StatusOK},
+		{name: "Fehlender Header", header: "", expectStatus: http.StatusPreconditionRequired},
+		{name: "Schwacher Tag", header: `W/"3"`, expectStatus: http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			w := httptest.NewRecorder()
+			version, ok := etag.Require(w, r, nopLogger{})
+			assert.Equal(t, tt.expectOK, ok)
+			assert.Equal(t, tt.expectVersion, version)
+			assert.Equal(t, tt.expectStatus, w.Code)
+		})
+	}
+}
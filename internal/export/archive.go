@@ -0,0 +1,150 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// formatVersion is increased whenever files or columns of the archive change incompatibly.
+const formatVersion = 1
+
+// Table is a part of the export, e.g. the sessions of the user. Every table is
+// written as <Name>.json and <Name>.csv.
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    [][]any
+}
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	FormatVersion int            `json:"format_version"`
+	UserID        string         `json:"user_id"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Files         []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file of the archive with its checksum.
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Table  string `json:"table"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeArchive builds the ZIP archive with the JSON and CSV files of every table
+// and a manifest.json listing them.
+func writeArchive(userID string, tables []Table, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	manifest := Manifest{FormatVersion: formatVersion, UserID: userID, CreatedAt: now, Files: make([]ManifestFile, 0, 2*len(tables))}
+
+	for _, table := range tables {
+		for _, file := range []struct {
+			name  string
+			write func(io.Writer, Table) error
+		}{
+			{name: table.Name + ".json", write: writeJSON},
+			{name: table.Name + ".csv", write: writeCSV},
+		} {
+			var content bytes.Buffer
+			if err := file.write(&content, table); err != nil {
+				return nil, fmt.Errorf("%s: %w", file.name, err)
+			}
+			if err := addFile(archive, file.name, content.Bytes(), now); err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(content.Bytes())
+			manifest.Files = append(manifest.Files, ManifestFile{
+				Name:   file.name,
+				Table:  table.Name,
+				Rows:   len(table.Rows),
+				SHA256: hex.EncodeToString(sum[:]),
+			})
+		}
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := addFile(archive, "manifest.json", content, now); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func addFile(archive *zip.Writer, name string, content []byte, now time.Time) error {
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// writeJSON writes the rows as array of objects keyed by column.
+func writeJSON(w io.Writer, table Table) error {
+	records := make([]map[string]any, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		record := make(map[string]any, len(table.Columns))
+		for i, column := range table.Columns {
+			record[column] = row[i]
+		}
+		records = append(records, record)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+// writeCSV writes the columns as header followed by the rows.
+func writeCSV(w io.Writer, table Table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(table.Columns); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = formatValue(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return formatValue(*v)
+	case []string:
+		return strings.Join(v, " ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,139 @@
+// Package exporttest provides the contract every export.Store backend has to fulfil.
+package exporttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+// TestStore runs the contract against the stores of newStore. Every call has to
+// return a new, empty store.
+func TestStore(t *testing.T, newStore func(t *testing.T) export.Store) {
+	storetest.Run(t, newStore,
+		storetest.Case[export.Store]{Name: "Lebenszyklus", Test: testLifecycle},
+		storetest.Case[export.Store]{Name: "Eindeutigkeit", Test: testUniqueness},
+		storetest.Case[export.Store]{Name: "Nicht gefunden", Test: testNotFound},
+		storetest.Case[export.Store]{Name: "Abgebrochener Kontext", Test: testCancelledContext},
+		storetest.Case[export.Store]{Name: "Gleichzeitige Änderungen", Test: testConcurrentUpdates},
+	)
+}
+
+func testLifecycle(t *testing.T, repo export.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	first := export.NewJob("j1", "123", now, now.Add(time.Hour))
+	second := export.NewJob("j2", "123", now.Add(time.Second), now.Add(2*time.Hour))
+	other := export.NewJob("j3", "456", now.Add(2*time.Second), now.Add(time.Hour))
+	for _, job := range []*export.Job{other, second, first} {
+		require.NoError(t, repo.SaveJob(ctx, job))
+	}
+
+	pending, err := repo.FindPendingJobs(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, pending, 2, "limited")
+	assert.Equal(t, "j1", pending[0].ID(), "oldest first")
+
+	first.Fertiggestellt([]byte("zip"), now.Add(time.Minute))
+	require.NoError(t, repo.UpdateJob(ctx, first))
+	second.Fehlgeschlagen(errors.New("source failed"), now.Add(time.Minute))
+	require.NoError(t, repo.UpdateJob(ctx, second))
+	found, err := repo.FindJobByID(ctx, "j1")
+	require.NoError(t, err)
+	assert.Equal(t, export.StatusReady, found.Status())
+	assert.Equal(t, []byte("zip"), found.Archiv())
+	assert.Equal(t, now, found.ErstelltAm())
+	assert.Equal(t, now.Add(time.Minute), found.FertigAm())
+	assert.Equal(t, now.Add(time.Hour), found.LaeuftAbAm())
+	found, err = repo.FindJobByID(ctx, "j2")
+	require.NoError(t, err)
+	assert.Equal(t, "source failed", found.Fehler())
+	pending, err = repo.FindPendingJobs(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "j3", pending[0].ID())
+
+	jobs, err := repo.FindJobsByUserID(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "j2", jobs[0].ID(), "newest first")
+
+	require.NoError(t, repo.DeleteExpiredJobs(ctx, now.Add(time.Hour)))
+	_, err = repo.FindJobByID(ctx, "j1")
+	assert.ErrorIs(t, err, export.ErrJobNotFound, "expired at now")
+	_, err = repo.FindJobByID(ctx, "j2")
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteJobsByUserID(ctx, "123"))
+	jobs, err = repo.FindJobsByUserID(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	jobs, err = repo.FindJobsByUserID(ctx, "456")
+	require.NoError(t, err)
+	assert.Empty(t, jobs, "j3 expired as well")
+}
+
+func testUniqueness(t *testing.T, repo export.Store) {
+	ctx := context.Background()
+	require.NoError(t, repo.SaveJob(ctx, export.NewJob("j1", "123", storetest.Now(), storetest.Now().Add(time.Hour))))
+
+	assert.ErrorIs(t, repo.SaveJob(ctx, export.NewJob("j1", "456", storetest.Now(), storetest.Now().Add(time.Hour))), export.ErrJobAlreadyExists)
+	found, err := repo.FindJobByID(ctx, "j1")
+	require.NoError(t, err)
+	assert.Equal(t, "123", found.UserID(), "the stored job is kept")
+}
+
+func testNotFound(t *testing.T, repo export.Store) {
+	ctx := context.Background()
+
+	_, err := repo.FindJobByID(ctx, "unbekannt")
+	assert.ErrorIs(t, err, export.ErrJobNotFound)
+	assert.ErrorIs(t, repo.UpdateJob(ctx, export.NewJob("unbekannt", "123", storetest.Now(), storetest.Now())), export.ErrJobNotFound)
+	jobs, err := repo.FindJobsByUserID(ctx, "unbekannt")
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	pending, err := repo.FindPendingJobs(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func testCancelledContext(t *testing.T, repo export.Store) {
+	job := export.NewJob("j1", "123", storetest.Now(), storetest.Now().Add(time.Hour))
+	require.NoError(t, repo.SaveJob(context.Background(), job))
+
+	storetest.Cancelled(t,
+		storetest.Call{Name: "SaveJob", Run: func(ctx context.Context) error {
+			return repo.SaveJob(ctx, export.NewJob("j2", "123", storetest.Now(), storetest.Now()))
+		}},
+		storetest.Call{Name: "UpdateJob", Run: func(ctx context.Context) error {
+			job.Fertiggestellt([]byte("zip"), storetest.Now())
+			return repo.UpdateJob(ctx, job)
+		}},
+		storetest.Call{Name: "FindJobByID", Run: func(ctx context.Context) error { _, err := repo.FindJobByID(ctx, "j1"); return err }},
+		storetest.Call{Name: "FindJobsByUserID", Run: func(ctx context.Context) error { _, err := repo.FindJobsByUserID(ctx, "123"); return err }},
+		storetest.Call{Name: "FindPendingJobs", Run: func(ctx context.Context) error { _, err := repo.FindPendingJobs(ctx, 10); return err }},
+		storetest.Call{Name: "DeleteExpiredJobs", Run: func(ctx context.Context) error { return repo.DeleteExpiredJobs(ctx, storetest.Now().Add(time.Hour)) }},
+		storetest.Call{Name: "DeleteJobsByUserID", Run: func(ctx context.Context) error { return repo.DeleteJobsByUserID(ctx, "123") }},
+	)
+
+	pending, err := repo.FindPendingJobs(context.Background(), 10)
+	require.NoError(t, err, "a cancelled call must not change the store")
+	assert.Len(t, pending, 1)
+}
+
+func testConcurrentUpdates(t *testing.T, repo export.Store) {
+	ctx := context.Background()
+	errs := storetest.Race(func(i int) error {
+		return repo.SaveJob(ctx, export.NewJob("gleich", fmt.Sprint(i), storetest.Now(), storetest.Now().Add(time.Hour)))
+	})
+
+	assert.Equal(t, 1, storetest.Count(errs, nil), "an ID belongs to exactly one job")
+	assert.Equal(t, storetest.Concurrency-1, storetest.Count(errs, export.ErrJobAlreadyExists))
+}
@@ -0,0 +1,139 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/presenter"
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+// DownloadPath is the public route of the signed download links.
+const DownloadPath = "/user/export/herunterladen"
+
+type usecase interface {
+	StartExport(context.Context, string) (*JobOutput, error)
+	Job(context.Context, string, string) (*JobOutput, error)
+	Download(context.Context, string) (*Job, error)
+}
+
+// Controller is the controller for the data export endpoints.
+type Controller struct {
+	log     logger.Logger
+	usecase usecase
+}
+
+// NewController creates a new controller for the export usecase.
+func NewController(log logger.Logger, usecase usecase) *Controller {
+	return &Controller{
+		log:     log,
+		usecase: usecase,
+	}
+}
+
+// JobResponse is a serializable struct for an export job.
+type JobResponse struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+// StartExport handles the request to export all data of the user. The archive is
+// built in the background, its state is polled at the Location.
+func (c *Controller) StartExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	output, err := c.usecase.StartExport(r.Context(), userID)
+	if err != nil {
+		c.log.Error(fmt.Sprintf("failed to start export. %v", err))
+		http.Error(w, "failed to start export", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/user/export/"+output.Job.ID())
+	w.WriteHeader(http.StatusAccepted)
+	presenter.NewJSONPresenter(w).Successful(toResponse(output))
+}
+
+// ExportStatus handles the request for the state of an export. Ready exports
+// contain a signed, time-limited download URL.
+func (c *Controller) ExportStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	output, err := c.usecase.Job(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		switch err {
+		case ErrJobNotFound:
+			c.log.Error("export not found")
+			http.Error(w, "export not found", http.StatusNotFound)
+		default:
+			c.log.Error(fmt.Sprintf("failed to get export. %v", err))
+			http.Error(w, "failed to get export", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(toResponse(output))
+}
+
+// Download handles the signed download link of an export archive.
+func (c *Controller) Download(w http.ResponseWriter, r *http.Request) {
+	job, err := c.usecase.Download(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		switch err {
+		case ErrInvalidDownloadToken:
+			c.log.Error("invalid download token")
+			http.Error(w, "invalid download token", http.StatusForbidden)
+		case ErrJobNotReady:
+			c.log.Error("export not ready")
+			http.Error(w, "export not ready", http.StatusConflict)
+		default:
+			c.log.Error(fmt.Sprintf("failed to download export. %v", err))
+			http.Error(w, "failed to download export", http.StatusInternalServerError)
+		}
+		return
+	}
+	filename := fmt.Sprintf("haushaltsbuch-export-%s.zip", job.FertigAm().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(job.Archiv())))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(job.Archiv())
+}
+
+func toResponse(output *JobOutput) JobResponse {
+	job := output.Job
+	response := JobResponse{
+		ID:        job.ID(),
+		Status:    job.Status(),
+		CreatedAt: job.ErstelltAm(),
+		ExpiresAt: job.LaeuftAbAm(),
+	}
+	if !job.FertigAm().IsZero() {
+		completedAt := job.FertigAm()
+		response.CompletedAt = &completedAt
+	}
+	if output.DownloadToken != "" {
+		response.DownloadURL = DownloadPath + "?token=" + url.QueryEscape(output.DownloadToken)
+	}
+	return response
+}
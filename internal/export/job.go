@@ -0,0 +1,99 @@
+package export
+
+import (
+	"time"
+)
+
+// Status repräsentiert den Bearbeitungsstatus eines Exports.
+type Status = string
+
+const (
+	// StatusPending markiert einen Export, der noch erstellt werden muss.
+	StatusPending Status = "pending"
+	// StatusReady markiert einen Export, dessen Archiv heruntergeladen werden kann.
+	StatusReady Status = "ready"
+	// StatusFailed markiert einen Export, dessen Erstellung fehlgeschlagen ist.
+	StatusFailed Status = "failed"
+)
+
+// Job repräsentiert einen Datenexport eines Users.
+type Job struct {
+	iD         string
+	userID     string
+	status     Status
+	archiv     []byte
+	fehler     string
+	erstelltAm time.Time
+	fertigAm   time.Time
+	laeuftAbAm time.Time
+}
+
+// NewJob erzeugt einen neuen, noch zu erstellenden Export.
+func NewJob(id, userID string, erstelltAm, laeuftAbAm time.Time) *Job {
+	return &Job{
+		iD:         id,
+		userID:     userID,
+		status:     StatusPending,
+		erstelltAm: erstelltAm,
+		laeuftAbAm: laeuftAbAm,
+	}
+}
+
+// ID gibt die ID des Exports zurück.
+func (j *Job) ID() string {
+	return j.iD
+}
+
+// UserID gibt die ID des exportierten Users zurück.
+func (j *Job) UserID() string {
+	return j.userID
+}
+
+// Status gibt den Bearbeitungsstatus des Exports zurück.
+func (j *Job) Status() Status {
+	return j.status
+}
+
+// Archiv gibt das ZIP-Archiv des Exports zurück.
+func (j *Job) Archiv() []byte {
+	return j.archiv
+}
+
+// Fehler gibt den Fehler einer fehlgeschlagenen Erstellung zurück.
+func (j *Job) Fehler() string {
+	return j.fehler
+}
+
+// ErstelltAm gibt den Zeitpunkt der Anforderung zurück.
+func (j *Job) ErstelltAm() time.Time {
+	return j.erstelltAm
+}
+
+// FertigAm gibt den Zeitpunkt zurück, an dem der Export erstellt wurde.
+func (j *Job) FertigAm() time.Time {
+	return j.fertigAm
+}
+
+// LaeuftAbAm gibt den Zeitpunkt zurück, ab dem der Export gelöscht wird.
+func (j *Job) LaeuftAbAm() time.Time {
+	return j.laeuftAbAm
+}
+
+// IstAbgelaufen gibt zurück, ob der Export zum Zeitpunkt now abgelaufen ist.
+func (j *Job) IstAbgelaufen(now time.Time) bool {
+	return !now.Before(j.laeuftAbAm)
+}
+
+// Fertiggestellt hinterlegt das erstellte Archiv.
+func (j *Job) Fertiggestellt(archiv []byte, am time.Time) {
+	j.status = StatusReady
+	j.archiv = archiv
+	j.fertigAm = am
+}
+
+// Fehlgeschlagen markiert den Export als fehlgeschlagen.
+func (j *Job) Fehlgeschlagen(err error, am time.Time) {
+	j.status = StatusFailed
+	j.fehler = err.Error()
+	j.fertigAm = am
+}
@@ -0,0 +1,188 @@
+package export
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+// Store is the export job storage. Every backend, e.g. InMemoryRepository or
+// SQLiteRepository, implements it.
+type Store interface {
+	repository
+}
+
+// InMemoryRepository implements the export repository with an in-memory store.
+type InMemoryRepository struct {
+	jobs  map[string]Job
+	gate  transaction.Gate
+	mutex sync.RWMutex
+}
+
+// NewInMemoryRepository creates a new InMemoryRepository.
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		jobs: make(map[string]Job),
+	}
+}
+
+// SaveJob adds a new export job.
+func (r *InMemoryRepository) SaveJob(ctx context.Context, job *Job) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, exists := r.jobs[job.ID()]; exists {
+			return ErrJobAlreadyExists
+		}
+		r.jobs[job.ID()] = *job
+		return nil
+	}
+}
+
+// UpdateJob stores the changed state of an export job.
+func (r *InMemoryRepository) UpdateJob(ctx context.Context, job *Job) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, exists := r.jobs[job.ID()]; !exists {
+			return ErrJobNotFound
+		}
+		r.jobs[job.ID()] = *job
+		return nil
+	}
+}
+
+// FindJobByID retrieves an export job by its ID.
+func (r *InMemoryRepository) FindJobByID(ctx context.Context, id string) (*Job, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		job, exists := r.jobs[id]
+		if !exists {
+			return nil, ErrJobNotFound
+		}
+		return &job, nil
+	}
+}
+
+// FindJobsByUserID returns the export jobs of a user, newest first.
+func (r *InMemoryRepository) FindJobsByUserID(ctx context.Context, userID string) ([]*Job, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		jobs := make([]*Job, 0)
+		for _, job := range r.jobs {
+			if job.UserID() == userID {
+				jobs = append(jobs, &job)
+			}
+		}
+		sort.Slice(jobs, func(i, j int) bool {
+			return jobs[i].ErstelltAm().After(jobs[j].ErstelltAm())
+		})
+		return jobs, nil
+	}
+}
+
+// FindPendingJobs returns up to limit jobs that still have to be built, oldest first.
+func (r *InMemoryRepository) FindPendingJobs(ctx context.Context, limit int) ([]*Job, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		jobs := make([]*Job, 0)
+		for _, job := range r.jobs {
+			if job.Status() == StatusPending {
+				jobs = append(jobs, &job)
+			}
+		}
+		sort.Slice(jobs, func(i, j int) bool {
+			return jobs[i].ErstelltAm().Before(jobs[j].ErstelltAm())
+		})
+		if len(jobs) > limit {
+			jobs = jobs[:limit]
+		}
+		return jobs, nil
+	}
+}
+
+// DeleteExpiredJobs removes every job that expired before now together with its archive.
+func (r *InMemoryRepository) DeleteExpiredJobs(ctx context.Context, now time.Time) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		for id, job := range r.jobs {
+			if job.IstAbgelaufen(now) {
+				delete(r.jobs, id)
+			}
+		}
+		return nil
+	}
+}
+
+// DeleteJobsByUserID removes every export job of the user.
+func (r *InMemoryRepository) DeleteJobsByUserID(ctx context.Context, userID string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		for id, job := range r.jobs {
+			if job.UserID() == userID {
+				delete(r.jobs, id)
+			}
+		}
+		return nil
+	}
+}
+
+// Snapshot copies the stored jobs and returns a function that restores the copy.
+func (r *InMemoryRepository) Snapshot() func() {
+	r.mutex.RLock()
+	jobs := maps.Clone(r.jobs)
+	r.mutex.RUnlock()
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.jobs = jobs
+	}
+}
+
+// Gate returns the gate the writes of the repository pass.
+func (r *InMemoryRepository) Gate() *transaction.Gate {
+	return &r.gate
+}
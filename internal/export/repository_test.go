@@ -0,0 +1,17 @@
+package export_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export/exporttest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+func TestRepository(t *testing.T) {
+	storetest.Backends(t, exporttest.TestStore,
+		func() export.Store { return export.NewInMemoryRepository() },
+		func(db *sql.DB) export.Store { return export.NewSQLiteRepository(db) },
+	)
+}
@@ -0,0 +1,114 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+const jobColumns = `id, user_id, status, archive, error, created_at, finished_at, expires_at`
+
+// SQLiteRepository implements the export repository with a SQLite database.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteRepository creates a new SQLiteRepository.
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db}
+}
+
+// conn returns the transaction of the context or the database.
+func (r *SQLiteRepository) conn(ctx context.Context) transaction.Querier {
+	return transaction.Conn(ctx, r.db)
+}
+
+// SaveJob adds a new export job.
+func (r *SQLiteRepository) SaveJob(ctx context.Context, job *Job) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO export_jobs (`+jobColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		job.ID(), job.UserID(), job.Status(), job.Archiv(), job.Fehler(),
+		job.ErstelltAm().UTC(), sqlite.NullTime(job.FertigAm()), job.LaeuftAbAm().UTC())
+	if sqlite.IsUniqueViolation(err) {
+		return ErrJobAlreadyExists
+	}
+	return err
+}
+
+// UpdateJob replaces the stored state of an existing export job.
+func (r *SQLiteRepository) UpdateJob(ctx context.Context, job *Job) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `UPDATE export_jobs SET status = $2, archive = $3, error = $4, finished_at = $5 WHERE id = $1`,
+		job.ID(), job.Status(), job.Archiv(), job.Fehler(), sqlite.NullTime(job.FertigAm()))
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// FindJobByID retrieves an export job by its ID.
+func (r *SQLiteRepository) FindJobByID(ctx context.Context, id string) (*Job, error) {
+	jobs, err := r.queryJobs(ctx, `SELECT `+jobColumns+` FROM export_jobs WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, ErrJobNotFound
+	}
+	return jobs[0], nil
+}
+
+// FindJobsByUserID returns the export jobs of a user, newest first.
+func (r *SQLiteRepository) FindJobsByUserID(ctx context.Context, userID string) ([]*Job, error) {
+	return r.queryJobs(ctx, `SELECT `+jobColumns+` FROM export_jobs WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+}
+
+// FindPendingJobs returns up to limit jobs that still have to be built, oldest first.
+func (r *SQLiteRepository) FindPendingJobs(ctx context.Context, limit int) ([]*Job, error) {
+	return r.queryJobs(ctx, `SELECT `+jobColumns+` FROM export_jobs WHERE status = $1 ORDER BY created_at LIMIT $2`, StatusPending, limit)
+}
+
+// DeleteExpiredJobs removes every job that expired before now together with its archive.
+func (r *SQLiteRepository) DeleteExpiredJobs(ctx context.Context, now time.Time) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM export_jobs WHERE expires_at <= $1`, now.UTC())
+	return err
+}
+
+// DeleteJobsByUserID removes every export job of the user.
+func (r *SQLiteRepository) DeleteJobsByUserID(ctx context.Context, userID string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM export_jobs WHERE user_id = $1`, userID)
+	return err
+}
+
+func (r *SQLiteRepository) queryJobs(ctx context.Context, query string, args ...any) ([]*Job, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*Job, 0)
+	for rows.Next() {
+		var (
+			job      Job
+			finished sql.NullTime
+		)
+		if err := rows.Scan(&job.iD, &job.userID, &job.status, &job.archiv, &job.fehler,
+			&job.erstelltAm, &finished, &job.laeuftAbAm); err != nil {
+			return nil, err
+		}
+		job.erstelltAm = job.erstelltAm.UTC()
+		job.fertigAm = sqlite.Time(finished)
+		job.laeuftAbAm = job.laeuftAbAm.UTC()
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
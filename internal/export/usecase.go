@@ -0,0 +1,137 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+)
+
+var (
+	// ErrJobNotFound is returned when an export job does not exist or belongs to another user
+	ErrJobNotFound = errors.New("Export not found")
+	// ErrJobAlreadyExists is returned when an export job ID is already taken
+	ErrJobAlreadyExists = errors.New("Export already exists")
+	// ErrJobNotReady is returned when an archive is downloaded before it was built
+	ErrJobNotReady = errors.New("Export not ready")
+	// ErrInvalidDownloadToken is returned when a download link is invalid or expired
+	ErrInvalidDownloadToken = errors.New("Invalid download token")
+)
+
+type repository interface {
+	SaveJob(ctx context.Context, job *Job) error
+	UpdateJob(ctx context.Context, job *Job) error
+	FindJobByID(ctx context.Context, id string) (*Job, error)
+	FindJobsByUserID(ctx context.Context, userID string) ([]*Job, error)
+	FindPendingJobs(ctx context.Context, limit int) ([]*Job, error)
+	DeleteExpiredJobs(ctx context.Context, now time.Time) error
+	DeleteJobsByUserID(ctx context.Context, userID string) error
+}
+
+type uuidGenerator interface {
+	GenerateUUID() (string, error)
+}
+
+type linkSigner interface {
+	GenerateDownloadToken(userID, fileID string, ttl time.Duration) (string, error)
+	ParseDownloadToken(tokenString string) (*auth.Claims, error)
+}
+
+// UseCase is the use case for the data export of a user (GDPR Art. 20)
+type UseCase struct {
+	repo       repository
+	uuidGen    uuidGenerator
+	signer     linkSigner
+	linkExpire time.Duration
+}
+
+// NewUseCase creates a new export UseCase. Archives and their download links
+// expire after linkExpire.
+func NewUseCase(repo repository, uuidGen uuidGenerator, signer linkSigner, linkExpire time.Duration) *UseCase {
+	return &UseCase{
+		repo:       repo,
+		uuidGen:    uuidGen,
+		signer:     signer,
+		linkExpire: linkExpire,
+	}
+}
+
+// JobOutput is the output for the export status use case. DownloadToken is only
+// set once the archive is ready.
+type JobOutput struct {
+	Job           *Job
+	DownloadToken string
+}
+
+// StartExport queues a new export of the user. The Worker builds the archive in
+// the background. A pending export is returned instead of queueing another one.
+func (c *UseCase) StartExport(ctx context.Context, userID string) (*JobOutput, error) {
+	jobs, err := c.repo.FindJobsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.Status() == StatusPending {
+			return &JobOutput{Job: job}, nil
+		}
+	}
+
+	id, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	job := NewJob(id, userID, now, now.Add(c.linkExpire))
+	if err := c.repo.SaveJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return &JobOutput{Job: job}, nil
+}
+
+// Job returns the state of an export of the user with a signed download token
+// if the archive is ready.
+func (c *UseCase) Job(ctx context.Context, userID, id string) (*JobOutput, error) {
+	job, err := c.repo.FindJobByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if job.UserID() != userID || job.IstAbgelaufen(now) {
+		return nil, ErrJobNotFound
+	}
+	if job.Status() != StatusReady {
+		return &JobOutput{Job: job}, nil
+	}
+
+	token, err := c.signer.GenerateDownloadToken(userID, job.ID(), job.LaeuftAbAm().Sub(now))
+	if err != nil {
+		return nil, err
+	}
+	return &JobOutput{Job: job, DownloadToken: token}, nil
+}
+
+// Download returns the archive the signed token points to. The token is the only
+// credential, so the link can be opened in a browser.
+func (c *UseCase) Download(ctx context.Context, token string) (*Job, error) {
+	claims, err := c.signer.ParseDownloadToken(token)
+	if err != nil {
+		return nil, ErrInvalidDownloadToken
+	}
+	job, err := c.repo.FindJobByID(ctx, claims.Jit)
+	if err != nil {
+		return nil, ErrInvalidDownloadToken
+	}
+	if job.UserID() != claims.Sub || job.IstAbgelaufen(time.Now().UTC()) {
+		return nil, ErrInvalidDownloadToken
+	}
+	if job.Status() != StatusReady {
+		return nil, ErrJobNotReady
+	}
+	return job, nil
+}
+
+// DeleteUserData deletes the exports of the user when the account is purged.
+func (c *UseCase) DeleteUserData(ctx context.Context, userID string) error {
+	return c.repo.DeleteJobsByUserID(ctx, userID)
+}
@@ -0,0 +1,139 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+)
+
+type stubSource struct {
+	err error
+}
+
+func (s stubSource) ExportTables(ctx context.Context, userID string) ([]export.Table, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []export.Table{{
+		Name:    "sessions",
+		Columns: []string{"id", "user_agent", "created_at"},
+		Rows:    [][]any{{"s1", "Firefox, Linux", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}},
+	}}, nil
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Error(string)   {}
+func (nopLogger) Warning(string) {}
+func (nopLogger) Info(string)    {}
+func (nopLogger) Debug(string)   {}
+func (nopLogger) Fatal(string)   {}
+
+func readArchive(t *testing.T, archive []byte) map[string][]byte {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	files := make(map[string][]byte)
+	for _, f := range reader.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[f.Name] = content
+	}
+	return files
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	repo := export.NewInMemoryRepository()
+	jwt := auth.NewJWT("access", "refresh")
+	uc := export.NewUseCase(repo, id.UUIDGeneratorFunc(id.GenerateUUID), jwt, time.Hour)
+	worker := export.NewWorker(repo, nopLogger{}, time.Minute, stubSource{})
+
+	started, err := uc.StartExport(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, export.StatusPending, started.Job.Status())
+	again, err := uc.StartExport(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, started.Job.ID(), again.Job.ID(), "pending export is reused")
+
+	_, err = uc.Job(ctx, "456", started.Job.ID())
+	assert.ErrorIs(t, err, export.ErrJobNotFound, "export of another user")
+
+	require.NoError(t, worker.BuildPending(ctx))
+	output, err := uc.Job(ctx, "123", started.Job.ID())
+	require.NoError(t, err)
+	assert.Equal(t, export.StatusReady, output.Job.Status())
+	require.NotEmpty(t, output.DownloadToken)
+
+	job, err := uc.Download(ctx, output.DownloadToken)
+	require.NoError(t, err)
+	files := readArchive(t, job.Archiv())
+	assert.Equal(t, "id,user_agent,created_at\ns1,\"Firefox, Linux\",2024-03-01T12:00:00Z\n", string(files["sessions.csv"]))
+	var records []map[string]any
+	require.NoError(t, json.Unmarshal(files["sessions.json"], &records))
+	assert.Equal(t, "Firefox, Linux", records[0]["user_agent"])
+
+	var manifest export.Manifest
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	assert.Equal(t, "123", manifest.UserID)
+	require.Len(t, manifest.Files, 2)
+	for _, file := range manifest.Files {
+		sum := sha256.Sum256(files[file.Name])
+		assert.Equal(t, hex.EncodeToString(sum[:]), file.SHA256, file.Name)
+		assert.Equal(t, 1, file.Rows)
+	}
+
+	t.Run("Ungültige Links", func(t *testing.T) {
+		accessToken, err := jwt.GenerateAccessToken("123", "user", started.Job.ID(), time.Minute)
+		require.NoError(t, err)
+		otherUser, err := jwt.GenerateDownloadToken("456", started.Job.ID(), time.Minute)
+		require.NoError(t, err)
+		expired, err := jwt.GenerateDownloadToken("123", started.Job.ID(), -time.Minute)
+		require.NoError(t, err)
+
+		for _, token := range []string{"", output.DownloadToken + "x", accessToken, otherUser, expired} {
+			_, err := uc.Download(ctx, token)
+			assert.ErrorIs(t, err, export.ErrInvalidDownloadToken)
+		}
+	})
+
+	t.Run("Abgelaufener Export wird gelöscht", func(t *testing.T) {
+		expiring := export.NewUseCase(repo, id.UUIDGeneratorFunc(id.GenerateUUID), jwt, 0)
+		started, err := expiring.StartExport(ctx, "789")
+		require.NoError(t, err)
+		require.NoError(t, worker.BuildPending(ctx))
+		_, err = repo.FindJobByID(ctx, started.Job.ID())
+		assert.ErrorIs(t, err, export.ErrJobNotFound)
+	})
+}
+
+func TestExportFailed(t *testing.T) {
+	ctx := context.Background()
+	repo := export.NewInMemoryRepository()
+	uc := export.NewUseCase(repo, id.UUIDGeneratorFunc(id.GenerateUUID), auth.NewJWT("access", "refresh"), time.Hour)
+	worker := export.NewWorker(repo, nopLogger{}, time.Minute, stubSource{err: errors.New("store unavailable")})
+
+	started, err := uc.StartExport(ctx, "123")
+	require.NoError(t, err)
+	require.NoError(t, worker.BuildPending(ctx))
+
+	output, err := uc.Job(ctx, "123", started.Job.ID())
+	require.NoError(t, err)
+	assert.Equal(t, export.StatusFailed, output.Job.Status())
+	assert.Empty(t, output.DownloadToken)
+}
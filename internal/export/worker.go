@@ -0,0 +1,91 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+const batchSize = 10
+
+// source provides the tables another module stores for a user, e.g. the profile,
+// access tokens or bookings.
+type source interface {
+	ExportTables(ctx context.Context, userID string) ([]Table, error)
+}
+
+// Worker builds pending exports and removes expired archives in the background.
+type Worker struct {
+	repo     repository
+	sources  []source
+	log      logger.Logger
+	interval time.Duration
+}
+
+// NewWorker creates a new Worker. Every archive contains the tables of all sources.
+func NewWorker(repo repository, log logger.Logger, interval time.Duration, sources ...source) *Worker {
+	return &Worker{
+		repo:     repo,
+		sources:  sources,
+		log:      log,
+		interval: interval,
+	}
+}
+
+// Run polls for pending exports until the context is cancelled.
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.BuildPending(ctx); err != nil {
+				w.log.Error(fmt.Sprintf("failed to build exports. %v", err))
+			}
+		}
+	}
+}
+
+// BuildPending builds the archive of every pending export and deletes expired ones.
+func (w *Worker) BuildPending(ctx context.Context) error {
+	if err := w.repo.DeleteExpiredJobs(ctx, time.Now().UTC()); err != nil {
+		return err
+	}
+	jobs, err := w.repo.FindPendingJobs(ctx, batchSize)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		archive, err := w.build(ctx, job.UserID())
+		if err != nil {
+			w.log.Error(fmt.Sprintf("export %s failed. %v", job.ID(), err))
+			job.Fehlgeschlagen(err, time.Now().UTC())
+		} else {
+			job.Fertiggestellt(archive, time.Now().UTC())
+		}
+		if err := w.repo.UpdateJob(ctx, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Worker) build(ctx context.Context, userID string) ([]byte, error) {
+	tables := make([]Table, 0)
+	for _, source := range w.sources {
+		t, err := source.ExportTables(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t...)
+	}
+	return writeArchive(userID, tables, time.Now().UTC())
+}
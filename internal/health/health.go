@@ -0,0 +1,60 @@
+// Package health reports whether the service accepts traffic.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/presenter"
+)
+
+// checkTimeout bounds every check of a readiness probe
+const checkTimeout = 2 * time.Second
+
+// Readiness answers the readiness probe of the load balancer. It is ready until
+// the service starts to drain, so no new traffic is routed to an instance that
+// shuts down while the requests in flight are completed.
+type Readiness struct {
+	ready  atomic.Bool
+	checks []func(ctx context.Context) error
+}
+
+// NewReadiness creates a ready Readiness that also requires every check to pass,
+// e.g. a ping of the database.
+func NewReadiness(checks ...func(ctx context.Context) error) *Readiness {
+	r := &Readiness{checks: checks}
+	r.ready.Store(true)
+	return r
+}
+
+// Drain marks the service as not ready.
+func (r *Readiness) Drain() {
+	r.ready.Store(false)
+}
+
+// ServeHTTP responds 200 while the service is ready and 503 while it drains or a
+// check fails.
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	p := presenter.NewJSONPresenter(w)
+
+	if !r.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		p.Failed("shutting down")
+		return
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), checkTimeout)
+	defer cancel()
+	for _, check := range r.checks {
+		if err := check(ctx); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			p.Failed("not ready")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	p.Successful(map[string]string{"status": "ready"})
+}
@@ -0,0 +1,41 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/health"
+)
+
+func TestReadiness(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("database is down") }
+
+	tests := []struct {
+		name         string
+		checks       []func(ctx context.Context) error
+		drain        bool
+		expectStatus int
+	}{
+		{name: "Bereit", expectStatus: http.StatusOK},
+		{name: "Prüfungen bestanden", checks: []func(ctx context.Context) error{ok, ok}, expectStatus: http.StatusOK},
+		{name: "Prüfung fehlgeschlagen", checks: []func(ctx context.Context) error{ok, down}, expectStatus: http.StatusServiceUnavailable},
+		{name: "Herunterfahren", checks: []func(ctx context.Context) error{ok}, drain: true, expectStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readiness := health.NewReadiness(tt.checks...)
+			if tt.drain {
+				readiness.Drain()
+			}
+			w := httptest.NewRecorder()
+			readiness.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+			assert.Equal(t, tt.expectStatus, w.Code)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		})
+	}
+}
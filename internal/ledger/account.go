@@ -0,0 +1,156 @@
+package ledger
+
+import (
+	"math/big"
+	"time"
+)
+
+// Account repräsentiert die Projektion eines Kontos mit dem Saldo aller nicht
+// stornierten und nicht gelöschten Buchungen.
+type Account struct {
+	iD          string
+	userID      string
+	name        string
+	waehrung    string
+	saldo       *big.Int
+	version     int64
+	eroeffnetAm time.Time
+	geloeschtAm time.Time
+}
+
+// ID gibt die ID des Kontos zurück.
+func (a *Account) ID() string {
+	return a.iD
+}
+
+// UserID gibt die ID des Users zurück, dem das Konto gehört.
+func (a *Account) UserID() string {
+	return a.userID
+}
+
+// Name gibt den Namen des Kontos zurück.
+func (a *Account) Name() string {
+	return a.name
+}
+
+// Waehrung gibt den ISO-4217-Code der Währung des Kontos zurück.
+func (a *Account) Waehrung() string {
+	return a.waehrung
+}
+
+// Saldo gibt den Saldo in der kleinsten Einheit der Währung zurück.
+func (a *Account) Saldo() string {
+	return a.saldo.String()
+}
+
+// Version gibt die Version des Kontos im Journal zurück.
+func (a *Account) Version() int64 {
+	return a.version
+}
+
+// EroeffnetAm gibt zurück, wann das Konto eröffnet wurde.
+func (a *Account) EroeffnetAm() time.Time {
+	return a.eroeffnetAm
+}
+
+// GeloeschtAm gibt zurück, wann das Konto in den Papierkorb verschoben wurde.
+// Die Nullzeit bedeutet, dass es nicht gelöscht ist.
+func (a *Account) GeloeschtAm() time.Time {
+	return a.geloeschtAm
+}
+
+// IstGeloescht gibt zurück, ob das Konto im Papierkorb liegt.
+func (a *Account) IstGeloescht() bool {
+	return !a.geloeschtAm.IsZero()
+}
+
+// Booking repräsentiert die Projektion einer Buchung im aktuellen Stand.
+type Booking struct {
+	iD            string
+	kontoID       string
+	userID        string
+	betrag        *big.Int
+	text          string
+	buchungsdatum time.Time
+	storniert     bool
+	stornoGrund   string
+	version       int64
+	erstelltAm    time.Time
+	geaendertAm   time.Time
+	geloeschtAm   time.Time
+}
+
+// ID gibt die ID der Buchung zurück.
+func (b *Booking) ID() string {
+	return b.iD
+}
+
+// KontoID gibt die ID des Kontos der Buchung zurück.
+func (b *Booking) KontoID() string {
+	return b.kontoID
+}
+
+// UserID gibt die ID des Users zurück, dem die Buchung gehört.
+func (b *Booking) UserID() string {
+	return b.userID
+}
+
+// Betrag gibt den Betrag in der kleinsten Einheit der Währung zurück.
+func (b *Booking) Betrag() string {
+	return b.betrag.String()
+}
+
+// Text gibt den Buchungstext zurück.
+func (b *Booking) Text() string {
+	return b.text
+}
+
+// Buchungsdatum gibt den Tag zurück, an dem die Buchung wirksam ist.
+func (b *Booking) Buchungsdatum() time.Time {
+	return b.buchungsdatum
+}
+
+// IstStorniert gibt zurück, ob die Buchung storniert wurde.
+func (b *Booking) IstStorniert() bool {
+	return b.storniert
+}
+
+// StornoGrund gibt den Grund der Stornierung zurück.
+func (b *Booking) StornoGrund() string {
+	return b.stornoGrund
+}
+
+// Version gibt die Version der Buchung im Journal zurück.
+func (b *Booking) Version() int64 {
+	return b.version
+}
+
+// ErstelltAm gibt zurück, wann die Buchung erfasst wurde.
+func (b *Booking) ErstelltAm() time.Time {
+	return b.erstelltAm
+}
+
+// GeaendertAm gibt zurück, wann die Buchung zuletzt geändert oder storniert wurde.
+func (b *Booking) GeaendertAm() time.Time {
+	return b.geaendertAm
+}
+
+// GeloeschtAm gibt zurück, wann die Buchung in den Papierkorb verschoben wurde.
+// Die Nullzeit bedeutet, dass sie nicht gelöscht ist.
+func (b *Booking) GeloeschtAm() time.Time {
+	return b.geloeschtAm
+}
+
+// IstGeloescht gibt zurück, ob die Buchung im Papierkorb liegt.
+func (b *Booking) IstGeloescht() bool {
+	return !b.geloeschtAm.IsZero()
+}
+
+// wirksam gibt den Betrag zurück, mit dem die Buchung in den Saldo eingeht.
+// Stornierte und gelöschte Buchungen gehen nicht ein.
+func (b *Booking) wirksam() *big.Int {
+	if b.storniert || b.IstGeloescht() {
+		return new(big.Int)
+	}
+	return b.betrag
+}
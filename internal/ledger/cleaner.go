@@ -0,0 +1,52 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+type trashPurger interface {
+	PurgeTrash(ctx context.Context) (int, error)
+}
+
+// Cleaner empties the trash in the background: accounts and bookings whose
+// retention period has ended are removed for good.
+type Cleaner struct {
+	trash    trashPurger
+	log      logger.Logger
+	interval time.Duration
+}
+
+// NewCleaner creates a new Cleaner that purges the trash every interval.
+func NewCleaner(trash trashPurger, log logger.Logger, interval time.Duration) *Cleaner {
+	return &Cleaner{
+		trash:    trash,
+		log:      log,
+		interval: interval,
+	}
+}
+
+// Run purges the trash until the context is cancelled.
+func (c *Cleaner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			purged, err := c.trash.PurgeTrash(ctx)
+			if err != nil {
+				c.log.Error(fmt.Sprintf("failed to purge the trash. %v", err))
+				continue
+			}
+			if purged > 0 {
+				c.log.Info(fmt.Sprintf("purged %d accounts and bookings from the trash", purged))
+			}
+		}
+	}
+}
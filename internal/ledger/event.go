@@ -0,0 +1,123 @@
+package ledger
+
+import (
+	"time"
+)
+
+// EventType repräsentiert die Art eines Ereignisses im Journal.
+type EventType = string
+
+const (
+	// EventAccountOpened eröffnet ein Konto.
+	EventAccountOpened EventType = "account.opened"
+	// EventBookingCreated legt eine Buchung auf einem Konto an.
+	EventBookingCreated EventType = "booking.created"
+	// EventBookingAmended ändert Betrag, Text oder Buchungsdatum einer Buchung.
+	EventBookingAmended EventType = "booking.amended"
+	// EventBookingVoided storniert eine Buchung.
+	EventBookingVoided EventType = "booking.voided"
+	// EventAccountDeleted verschiebt ein Konto mit seinen Buchungen in den Papierkorb.
+	EventAccountDeleted EventType = "account.deleted"
+	// EventAccountRestored holt ein Konto aus dem Papierkorb zurück.
+	EventAccountRestored EventType = "account.restored"
+	// EventBookingDeleted verschiebt eine Buchung in den Papierkorb.
+	EventBookingDeleted EventType = "booking.deleted"
+	// EventBookingRestored holt eine Buchung aus dem Papierkorb zurück.
+	EventBookingRestored EventType = "booking.restored"
+)
+
+// Event repräsentiert ein unveränderliches Ereignis im Journal. Konten und
+// Buchungen werden nie überschrieben, ihr Zustand ergibt sich aus ihren Ereignissen.
+// Jedes Konto und jede Buchung hat einen eigenen Stream, in dem die Version
+// fortlaufend hochgezählt wird.
+type Event struct {
+	sequenz   uint64
+	streamID  string
+	version   int64
+	typ       EventType
+	userID    string
+	zeitpunkt time.Time
+	daten     []byte
+}
+
+// NewEvent erzeugt ein neues, noch nicht angehängtes Ereignis. Daten ist der
+// JSON-Inhalt passend zum Typ, z.B. BookingCreated.
+func NewEvent(streamID string, version int64, typ EventType, userID string, daten []byte, zeitpunkt time.Time) *Event {
+	return &Event{
+		streamID:  streamID,
+		version:   version,
+		typ:       typ,
+		userID:    userID,
+		zeitpunkt: zeitpunkt,
+		daten:     daten,
+	}
+}
+
+// Sequenz gibt die fortlaufende Nummer des Ereignisses im Journal zurück.
+func (e *Event) Sequenz() uint64 {
+	return e.sequenz
+}
+
+// StreamID gibt die ID des Kontos oder der Buchung zurück, zu der das Ereignis gehört.
+func (e *Event) StreamID() string {
+	return e.streamID
+}
+
+// Version gibt die Version des Streams nach dem Ereignis zurück.
+func (e *Event) Version() int64 {
+	return e.version
+}
+
+// Typ gibt die Art des Ereignisses zurück.
+func (e *Event) Typ() EventType {
+	return e.typ
+}
+
+// UserID gibt die ID des Users zurück, dem das Konto gehört.
+func (e *Event) UserID() string {
+	return e.userID
+}
+
+// Zeitpunkt gibt zurück, wann das Ereignis erfasst wurde. Er bestimmt, was zu
+// einem Zeitpunkt über die Konten bekannt war.
+func (e *Event) Zeitpunkt() time.Time {
+	return e.zeitpunkt
+}
+
+// Daten gibt den JSON-Inhalt des Ereignisses zurück.
+func (e *Event) Daten() []byte {
+	return e.daten
+}
+
+// Angehaengt setzt die Sequenz, unter der das Ereignis im Journal steht.
+func (e *Event) Angehaengt(sequenz uint64) {
+	e.sequenz = sequenz
+}
+
+// AccountOpened ist der Inhalt von EventAccountOpened.
+type AccountOpened struct {
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+}
+
+// BookingCreated ist der Inhalt von EventBookingCreated. Der Betrag ist in der
+// kleinsten Einheit der Währung angegeben, z.B. Cent, Ausgaben sind negativ.
+type BookingCreated struct {
+	AccountID string    `json:"account_id"`
+	Amount    string    `json:"amount"`
+	Text      string    `json:"text"`
+	BookedOn  time.Time `json:"booked_on"`
+}
+
+// BookingAmended ist der Inhalt von EventBookingAmended. Er ersetzt Betrag, Text
+// und Buchungsdatum der Buchung.
+type BookingAmended struct {
+	Amount   string    `json:"amount"`
+	Text     string    `json:"text"`
+	BookedOn time.Time `json:"booked_on"`
+}
+
+// BookingVoided ist der Inhalt von EventBookingVoided.
+type BookingVoided struct {
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,566 @@
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/etag"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/presenter"
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+type usecase interface {
+	OpenAccount(context.Context, *OpenAccountInput) (*Account, error)
+	Accounts(context.Context, string) ([]*Account, error)
+	CreateBooking(context.Context, *CreateBookingInput) (*Booking, error)
+	Booking(context.Context, string, string) (*Booking, error)
+	Bookings(context.Context, string, string) ([]*Booking, error)
+	AmendBooking(context.Context, *AmendBookingInput) (*Booking, error)
+	VoidBooking(context.Context, *VoidBookingInput) (*Booking, error)
+	Balance(context.Context, *BalanceInput) (*BalanceOutput, error)
+	Report(context.Context, *ReportInput) (*ReportOutput, error)
+	DeleteAccount(context.Context, *DeleteAccountInput) (*Account, error)
+	RestoreAccount(context.Context, string, string) (*Account, error)
+	DeleteBooking(context.Context, *DeleteBookingInput) (*Booking, error)
+	RestoreBooking(context.Context, string, string) (*Booking, error)
+	Trash(context.Context, string) (*TrashOutput, error)
+}
+
+// Controller is the controller for the account and booking endpoints.
+type Controller struct {
+	log     logger.Logger
+	usecase usecase
+}
+
+// NewController creates a new controller for the ledger usecase.
+func NewController(log logger.Logger, usecase usecase) *Controller {
+	return &Controller{
+		log:     log,
+		usecase: usecase,
+	}
+}
+
+// OpenAccountRequest is a serializable struct for the open account request body.
+type OpenAccountRequest struct {
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+}
+
+// AccountResponse is a serializable struct for an account with its balance.
+// Version is the entity tag a delete has to send in If-Match. DeletedAt and
+// PurgeAt are only set for an account in the trash.
+type AccountResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Currency  string     `json:"currency"`
+	Balance   string     `json:"balance"`
+	Version   int64      `json:"version"`
+	OpenedAt  time.Time  `json:"opened_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+// BookingRequest is a serializable struct for the create and amend booking
+// request bodies. The amount is given in the smallest unit of the currency, e.g.
+// "-1250" for an expense of 12.50 EUR, the booking date as YYYY-MM-DD.
+type BookingRequest struct {
+	Amount   string `json:"amount"`
+	Text     string `json:"text"`
+	BookedOn string `json:"booked_on"`
+}
+
+// VoidBookingRequest is a serializable struct for the void booking request body.
+type VoidBookingRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BookingResponse is a serializable struct for a booking. DeletedAt and PurgeAt
+// are only set for a booking in the trash.
+type BookingResponse struct {
+	ID         string     `json:"id"`
+	AccountID  string     `json:"account_id"`
+	Amount     string     `json:"amount"`
+	Text       string     `json:"text"`
+	BookedOn   string     `json:"booked_on"`
+	Voided     bool       `json:"voided"`
+	VoidReason string     `json:"void_reason,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ChangedAt  time.Time  `json:"changed_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt    *time.Time `json:"purge_at,omitempty"`
+}
+
+// TrashResponse is a serializable struct for the deleted accounts and bookings.
+type TrashResponse struct {
+	Accounts []AccountResponse `json:"accounts"`
+	Bookings []BookingResponse `json:"bookings"`
+}
+
+// BalanceResponse is a serializable struct for the balance of an account.
+type BalanceResponse struct {
+	AccountID string     `json:"account_id"`
+	Currency  string     `json:"currency"`
+	Balance   string     `json:"balance"`
+	AsOf      string     `json:"as_of,omitempty"`
+	KnownAt   *time.Time `json:"known_at,omitempty"`
+}
+
+// ReportResponse is a serializable struct for the income and expenses of an account.
+type ReportResponse struct {
+	AccountID string `json:"account_id"`
+	Currency  string `json:"currency"`
+	Income    string `json:"income"`
+	Expenses  string `json:"expenses"`
+	Net       string `json:"net"`
+	Bookings  int    `json:"bookings"`
+}
+
+// OpenAccount handles the request to open an account.
+func (c *Controller) OpenAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	var body OpenAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	account, err := c.usecase.OpenAccount(r.Context(), &OpenAccountInput{UserID: userID, Name: body.Name, Currency: body.Currency})
+	if err != nil {
+		c.fail(w, "failed to open account", err)
+		return
+	}
+	c.writeAccount(w, http.StatusCreated, account)
+}
+
+// ListAccounts handles the request to list the accounts of the user with their balances.
+func (c *Controller) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	accounts, err := c.usecase.Accounts(r.Context(), userID)
+	if err != nil {
+		c.fail(w, "failed to list accounts", err)
+		return
+	}
+	response := make([]AccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		response = append(response, accountResponse(account))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// Balance handles the request for the balance of an account. The query parameter
+// stichtag (YYYY-MM-DD) limits the bookings by booking date, kenntnisstand
+// (RFC 3339) answers with what was known at that time.
+func (c *Controller) Balance(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	input := &BalanceInput{UserID: userID, AccountID: r.PathValue("id")}
+	var err error
+	if input.AsOf, err = parseDate(r.URL.Query(), "stichtag"); err == nil {
+		input.KnownAt, err = parseTime(r.URL.Query(), "kenntnisstand")
+	}
+	if err != nil {
+		c.log.Error(fmt.Sprintf("invalid balance query. %v", err))
+		http.Error(w, "invalid query", http.StatusBadRequest)
+		return
+	}
+	output, err := c.usecase.Balance(r.Context(), input)
+	if err != nil {
+		c.fail(w, "failed to calculate balance", err)
+		return
+	}
+	response := BalanceResponse{AccountID: output.AccountID, Currency: output.Currency, Balance: output.Balance}
+	if !output.AsOf.IsZero() {
+		response.AsOf = output.AsOf.Format(time.DateOnly)
+	}
+	if !output.KnownAt.IsZero() {
+		response.KnownAt = &output.KnownAt
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// Report handles the request for the income and expenses of an account. The query
+// parameters von and bis (YYYY-MM-DD) limit the booking dates, kenntnisstand
+// (RFC 3339) answers with what was known at that time.
+func (c *Controller) Report(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	input := &ReportInput{UserID: userID, AccountID: r.PathValue("id")}
+	var err error
+	if input.From, err = parseDate(r.URL.Query(), "von"); err == nil {
+		if input.To, err = parseDate(r.URL.Query(), "bis"); err == nil {
+			input.KnownAt, err = parseTime(r.URL.Query(), "kenntnisstand")
+		}
+	}
+	if err != nil {
+		c.log.Error(fmt.Sprintf("invalid report query. %v", err))
+		http.Error(w, "invalid query", http.StatusBadRequest)
+		return
+	}
+	output, err := c.usecase.Report(r.Context(), input)
+	if err != nil {
+		c.fail(w, "failed to create report", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(ReportResponse{
+		AccountID: output.AccountID,
+		Currency:  output.Currency,
+		Income:    output.Income,
+		Expenses:  output.Expenses,
+		Net:       output.Net,
+		Bookings:  output.Bookings,
+	})
+}
+
+// ListBookings handles the request to list the bookings of an account.
+func (c *Controller) ListBookings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	bookings, err := c.usecase.Bookings(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		c.fail(w, "failed to list bookings", err)
+		return
+	}
+	response := make([]BookingResponse, 0, len(bookings))
+	for _, booking := range bookings {
+		response = append(response, bookingResponse(booking))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// CreateBooking handles the request to book an amount on an account.
+func (c *Controller) CreateBooking(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	body, bookedOn, ok := c.decodeBooking(w, r)
+	if !ok {
+		return
+	}
+	booking, err := c.usecase.CreateBooking(r.Context(), &CreateBookingInput{
+		UserID:    userID,
+		AccountID: r.PathValue("id"),
+		Amount:    body.Amount,
+		Text:      body.Text,
+		BookedOn:  bookedOn,
+	})
+	if err != nil {
+		c.fail(w, "failed to create booking", err)
+		return
+	}
+	c.writeBooking(w, http.StatusCreated, booking)
+}
+
+// GetBooking handles the request for a booking. The ETag header carries the
+// version that PUT /buchungen/{id} and POST /buchungen/{id}/stornieren expect in If-Match.
+func (c *Controller) GetBooking(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	booking, err := c.usecase.Booking(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		c.fail(w, "failed to read booking", err)
+		return
+	}
+	if etag.NoneMatch(r, booking.Version()) {
+		w.Header().Set("ETag", etag.Format(booking.Version()))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.writeBooking(w, http.StatusOK, booking)
+}
+
+// AmendBooking handles the request to correct a booking.
+func (c *Controller) AmendBooking(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := etag.Require(w, r, c.log)
+	if !ok {
+		return
+	}
+	body, bookedOn, ok := c.decodeBooking(w, r)
+	if !ok {
+		return
+	}
+	booking, err := c.usecase.AmendBooking(r.Context(), &AmendBookingInput{
+		UserID:    userID,
+		BookingID: r.PathValue("id"),
+		Version:   version,
+		Amount:    body.Amount,
+		Text:      body.Text,
+		BookedOn:  bookedOn,
+	})
+	if err != nil {
+		c.fail(w, "failed to amend booking", err)
+		return
+	}
+	c.writeBooking(w, http.StatusOK, booking)
+}
+
+// VoidBooking handles the request to cancel a booking.
+func (c *Controller) VoidBooking(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := etag.Require(w, r, c.log)
+	if !ok {
+		return
+	}
+	var body VoidBookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	booking, err := c.usecase.VoidBooking(r.Context(), &VoidBookingInput{
+		UserID:    userID,
+		BookingID: r.PathValue("id"),
+		Version:   version,
+		Reason:    body.Reason,
+	})
+	if err != nil {
+		c.fail(w, "failed to void booking", err)
+		return
+	}
+	c.writeBooking(w, http.StatusOK, booking)
+}
+
+// DeleteAccount handles the request to move an account with its bookings to the
+// trash. The If-Match header has to name the current version of the account.
+func (c *Controller) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := etag.Require(w, r, c.log)
+	if !ok {
+		return
+	}
+	account, err := c.usecase.DeleteAccount(r.Context(), &DeleteAccountInput{UserID: userID, AccountID: r.PathValue("id"), Version: version})
+	if err != nil {
+		c.fail(w, "failed to delete account", err)
+		return
+	}
+	c.writeAccount(w, http.StatusOK, account)
+}
+
+// RestoreAccount handles the request to restore an account from the trash.
+func (c *Controller) RestoreAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	account, err := c.usecase.RestoreAccount(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		c.fail(w, "failed to restore account", err)
+		return
+	}
+	c.writeAccount(w, http.StatusOK, account)
+}
+
+// DeleteBooking handles the request to move a booking to the trash.
+func (c *Controller) DeleteBooking(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := etag.Require(w, r, c.log)
+	if !ok {
+		return
+	}
+	booking, err := c.usecase.DeleteBooking(r.Context(), &DeleteBookingInput{UserID: userID, BookingID: r.PathValue("id"), Version: version})
+	if err != nil {
+		c.fail(w, "failed to delete booking", err)
+		return
+	}
+	c.writeBooking(w, http.StatusOK, booking)
+}
+
+// RestoreBooking handles the request to restore a booking from the trash.
+func (c *Controller) RestoreBooking(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	booking, err := c.usecase.RestoreBooking(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		c.fail(w, "failed to restore booking", err)
+		return
+	}
+	c.writeBooking(w, http.StatusOK, booking)
+}
+
+// Trash handles the request to list the deleted accounts and bookings with the
+// time they are purged.
+func (c *Controller) Trash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := c.userID(w, r)
+	if !ok {
+		return
+	}
+	output, err := c.usecase.Trash(r.Context(), userID)
+	if err != nil {
+		c.fail(w, "failed to list trash", err)
+		return
+	}
+	response := TrashResponse{
+		Accounts: make([]AccountResponse, 0, len(output.Accounts)),
+		Bookings: make([]BookingResponse, 0, len(output.Bookings)),
+	}
+	for _, account := range output.Accounts {
+		item := accountResponse(account)
+		purgeAt := account.GeloeschtAm().Add(output.Retention)
+		item.PurgeAt = &purgeAt
+		response.Accounts = append(response.Accounts, item)
+	}
+	for _, booking := range output.Bookings {
+		item := bookingResponse(booking)
+		purgeAt := booking.GeloeschtAm().Add(output.Retention)
+		item.PurgeAt = &purgeAt
+		response.Bookings = append(response.Bookings, item)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+func (c *Controller) decodeBooking(w http.ResponseWriter, r *http.Request) (*BookingRequest, time.Time, bool) {
+	var body BookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return nil, time.Time{}, false
+	}
+	var bookedOn time.Time
+	if body.BookedOn != "" {
+		var err error
+		if bookedOn, err = time.Parse(time.DateOnly, body.BookedOn); err != nil {
+			c.log.Error(fmt.Sprintf("invalid booking date. %v", err))
+			http.Error(w, "invalid booking date. Expected YYYY-MM-DD", http.StatusBadRequest)
+			return nil, time.Time{}, false
+		}
+	}
+	return &body, bookedOn, true
+}
+
+func (c *Controller) writeAccount(w http.ResponseWriter, status int, account *Account) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag.Format(account.Version()))
+	w.WriteHeader(status)
+	presenter.NewJSONPresenter(w).Successful(accountResponse(account))
+}
+
+func (c *Controller) writeBooking(w http.ResponseWriter, status int, booking *Booking) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag.Format(booking.Version()))
+	w.WriteHeader(status)
+	presenter.NewJSONPresenter(w).Successful(bookingResponse(booking))
+}
+
+func (c *Controller) userID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+	}
+	return userID, ok
+}
+
+// fail answers the error of a use case with its status code.
+func (c *Controller) fail(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, ErrAccountNotFound), errors.Is(err, ErrBookingNotFound):
+		c.log.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidName), errors.Is(err, ErrInvalidCurrency), errors.Is(err, ErrInvalidAmount), errors.Is(err, ErrInvalidPeriod):
+		c.log.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrBookingVoided):
+		c.log.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrConflict):
+		c.log.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	default:
+		c.log.Error(fmt.Sprintf("%s. %v", msg, err))
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
+
+func accountResponse(account *Account) AccountResponse {
+	response := AccountResponse{
+		ID:       account.ID(),
+		Name:     account.Name(),
+		Currency: account.Waehrung(),
+		Balance:  account.Saldo(),
+		Version:  account.Version(),
+		OpenedAt: account.EroeffnetAm(),
+	}
+	if account.IstGeloescht() {
+		deletedAt := account.GeloeschtAm()
+		response.DeletedAt = &deletedAt
+	}
+	return response
+}
+
+func bookingResponse(booking *Booking) BookingResponse {
+	response := BookingResponse{
+		ID:         booking.ID(),
+		AccountID:  booking.KontoID(),
+		Amount:     booking.Betrag(),
+		Text:       booking.Text(),
+		BookedOn:   booking.Buchungsdatum().Format(time.DateOnly),
+		Voided:     booking.IstStorniert(),
+		VoidReason: booking.StornoGrund(),
+		CreatedAt:  booking.ErstelltAm(),
+		ChangedAt:  booking.GeaendertAm(),
+	}
+	if booking.IstGeloescht() {
+		deletedAt := booking.GeloeschtAm()
+		response.DeletedAt = &deletedAt
+	}
+	return response
+}
+
+func parseDate(query url.Values, key string) (time.Time, error) {
+	if value := query.Get(key); value != "" {
+		return time.Parse(time.DateOnly, value)
+	}
+	return time.Time{}, nil
+}
+
+func parseTime(query url.Values, key string) (time.Time, error) {
+	if value := query.Get(key); value != "" {
+		return time.Parse(time.RFC3339, value)
+	}
+	return time.Time{}, nil
+}
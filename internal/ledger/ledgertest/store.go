@@ -0,0 +1,347 @@
+// Package ledgertest provides the contract every ledger.Store backend has to
+// fulfil.
+package ledgertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/ledger"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+// TestStore runs the contract against the stores of newStore. Every call has to
+// return a new, empty store.
+func TestStore(t *testing.T, newStore func(t *testing.T) ledger.Store) {
+	storetest.Run(t, newStore,
+		storetest.Case[ledger.Store]{Name: "Journal", Test: testJournal},
+		storetest.Case[ledger.Store]{Name: "Versionskonflikt", Test: testVersionConflict},
+		storetest.Case[ledger.Store]{Name: "Projektionen", Test: testProjections},
+		storetest.Case[ledger.Store]{Name: "Projektionen ersetzen", Test: testReplaceProjections},
+		storetest.Case[ledger.Store]{Name: "Papierkorb leeren", Test: testPurgeDeleted},
+		storetest.Case[ledger.Store]{Name: "Nutzerdaten löschen", Test: testDeleteUserData},
+		storetest.Case[ledger.Store]{Name: "Nicht gefunden", Test: testNotFound},
+		storetest.Case[ledger.Store]{Name: "Abgebrochener Kontext", Test: testCancelledContext},
+		storetest.Case[ledger.Store]{Name: "Gleichzeitige Ereignisse", Test: testConcurrentEvents},
+	)
+}
+
+func newEvent(t *testing.T, streamID string, version int64, typ ledger.EventType, userID string, data any, at time.Time) *ledger.Event {
+	t.Helper()
+	content, err := json.Marshal(data)
+	require.NoError(t, err)
+	return ledger.NewEvent(streamID, version, typ, userID, content, at)
+}
+
+func opened(t *testing.T, accountID, userID string, at time.Time) *ledger.Event {
+	return newEvent(t, accountID, 1, ledger.EventAccountOpened, userID, ledger.AccountOpened{Name: "Girokonto", Currency: "EUR"}, at)
+}
+
+func created(t *testing.T, bookingID, accountID, userID, amount string, bookedOn, at time.Time) *ledger.Event {
+	return newEvent(t, bookingID, 1, ledger.EventBookingCreated, userID, ledger.BookingCreated{AccountID: accountID, Amount: amount, Text: "Miete", BookedOn: bookedOn}, at)
+}
+
+// project folds the events into accounts and bookings the way the use case does.
+func project(t *testing.T, events ...*ledger.Event) *ledger.Projection {
+	t.Helper()
+	projection := ledger.NewProjection(nil, nil)
+	for _, event := range events {
+		require.NoError(t, projection.Apply(event))
+	}
+	return projection
+}
+
+// save stores every account and booking of the projection.
+func save(t *testing.T, repo ledger.Store, projection *ledger.Projection) {
+	t.Helper()
+	ctx := context.Background()
+	for _, account := range projection.Accounts() {
+		require.NoError(t, repo.SaveAccount(ctx, account))
+	}
+	for _, booking := range projection.Bookings("") {
+		require.NoError(t, repo.SaveBooking(ctx, booking))
+	}
+}
+
+func testJournal(t *testing.T, repo ledger.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	events := []*ledger.Event{
+		opened(t, "k1", "123", now),
+		opened(t, "k2", "456", now.Add(time.Second)),
+		created(t, "b1", "k1", "123", "-1250", now.Truncate(24*time.Hour), now.Add(2*time.Second)),
+	}
+	for _, event := range events {
+		require.NoError(t, repo.AppendEvent(ctx, event))
+	}
+	assert.Less(t, events[0].Sequenz(), events[1].Sequenz(), "the journal assigns increasing sequences")
+	assert.Less(t, events[1].Sequenz(), events[2].Sequenz())
+
+	found, err := repo.FindEvents(ctx, "123", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, events[0].Sequenz(), found[0].Sequenz())
+	assert.Equal(t, "b1", found[1].StreamID())
+	assert.Equal(t, int64(1), found[1].Version())
+	assert.Equal(t, ledger.EventBookingCreated, found[1].Typ())
+	assert.Equal(t, "123", found[1].UserID())
+	assert.Equal(t, now.Add(2*time.Second), found[1].Zeitpunkt())
+	assert.JSONEq(t, string(events[2].Daten()), string(found[1].Daten()))
+
+	found, err = repo.FindEvents(ctx, "123", now.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, found, 1, "events recorded after knownAt are left out")
+	assert.Equal(t, "k1", found[0].StreamID())
+	found, err = repo.FindEvents(ctx, "123", now)
+	require.NoError(t, err)
+	assert.Len(t, found, 1, "an event recorded at knownAt is known")
+
+	all, err := repo.FindAllEvents(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	for i, event := range all {
+		assert.Equal(t, events[i].Sequenz(), event.Sequenz(), "in sequence order")
+	}
+}
+
+func testVersionConflict(t *testing.T, repo ledger.Store) {
+	ctx := context.Background()
+	require.NoError(t, repo.AppendEvent(ctx, opened(t, "k1", "123", storetest.Now())))
+
+	assert.ErrorIs(t, repo.AppendEvent(ctx, opened(t, "k1", "123", storetest.Now())), ledger.ErrConflict)
+	require.NoError(t, repo.AppendEvent(ctx, newEvent(t, "k1", 2, ledger.EventAccountOpened, "123", ledger.AccountOpened{}, storetest.Now())),
+		"the next version of the stream is free")
+	events, err := repo.FindAllEvents(ctx)
+	require.NoError(t, err)
+	assert.Len(t, events, 2, "a rejected event is not stored")
+}
+
+func testProjections(t *testing.T, repo ledger.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	today := now.Truncate(24 * time.Hour)
+	projection := project(t,
+		opened(t, "k1", "123", now),
+		opened(t, "k2", "123", now.Add(time.Second)),
+		created(t, "b1", "k1", "123", "-99999999999999999999", today, now),
+		created(t, "b2", "k1", "123", "250000", today.AddDate(0, 0, -1), now.Add(time.Second)),
+	)
+	save(t, repo, projection)
+
+	account, err := repo.FindAccount(ctx, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, "123", account.UserID())
+	assert.Equal(t, "Girokonto", account.Name())
+	assert.Equal(t, "EUR", account.Waehrung())
+	assert.Equal(t, "-99999999999999749999", account.Saldo(), "amounts keep their precision")
+	assert.Equal(t, int64(1), account.Version())
+	assert.Equal(t, now, account.EroeffnetAm())
+
+	booking, err := repo.FindBooking(ctx, "b1")
+	require.NoError(t, err)
+	assert.Equal(t, "k1", booking.KontoID())
+	assert.Equal(t, "123", booking.UserID())
+	assert.Equal(t, "-99999999999999999999", booking.Betrag())
+	assert.Equal(t, "Miete", booking.Text())
+	assert.Equal(t, today, booking.Buchungsdatum())
+	assert.False(t, booking.IstStorniert())
+	assert.Equal(t, now, booking.ErstelltAm())
+
+	accounts, err := repo.FindAccounts(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	assert.Equal(t, "k1", accounts[0].ID(), "oldest first")
+	bookings, err := repo.FindBookings(ctx, "k1")
+	require.NoError(t, err)
+	require.Len(t, bookings, 2)
+	assert.Equal(t, "b2", bookings[0].ID(), "ordered by booking date")
+
+	require.NoError(t, projection.Apply(newEvent(t, "b1", 2, ledger.EventBookingVoided, "123", ledger.BookingVoided{Reason: "Doppelt"}, now.Add(time.Minute))))
+	save(t, repo, projection)
+	booking, err = repo.FindBooking(ctx, "b1")
+	require.NoError(t, err)
+	assert.True(t, booking.IstStorniert(), "saving again replaces the projection")
+	assert.Equal(t, "Doppelt", booking.StornoGrund())
+	assert.Equal(t, int64(2), booking.Version())
+	assert.Equal(t, now.Add(time.Minute), booking.GeaendertAm())
+	account, err = repo.FindAccount(ctx, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, "250000", account.Saldo())
+	bookings, err = repo.FindBookings(ctx, "k1")
+	require.NoError(t, err)
+	assert.Len(t, bookings, 2)
+}
+
+func testReplaceProjections(t *testing.T, repo ledger.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	save(t, repo, project(t,
+		opened(t, "k1", "123", now),
+		created(t, "b1", "k1", "123", "100", now.Truncate(24*time.Hour), now),
+	))
+
+	rebuilt := project(t,
+		opened(t, "k2", "123", now),
+		created(t, "b2", "k2", "123", "200", now.Truncate(24*time.Hour), now),
+	)
+	require.NoError(t, repo.ReplaceProjections(ctx, rebuilt.Accounts(), rebuilt.Bookings("")))
+
+	_, err := repo.FindAccount(ctx, "k1")
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound, "the old projections are removed")
+	_, err = repo.FindBooking(ctx, "b1")
+	assert.ErrorIs(t, err, ledger.ErrBookingNotFound)
+	account, err := repo.FindAccount(ctx, "k2")
+	require.NoError(t, err)
+	assert.Equal(t, "200", account.Saldo())
+	bookings, err := repo.FindBookings(ctx, "k2")
+	require.NoError(t, err)
+	assert.Len(t, bookings, 1)
+}
+
+func testPurgeDeleted(t *testing.T, repo ledger.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	today := now.Truncate(24 * time.Hour)
+	events := []*ledger.Event{
+		opened(t, "k1", "123", now),
+		opened(t, "k2", "123", now),
+		created(t, "b1", "k1", "123", "100", today, now),
+		created(t, "b2", "k2", "123", "200", today, now),
+		created(t, "b3", "k2", "123", "300", today, now),
+		newEvent(t, "k1", 2, ledger.EventAccountDeleted, "123", struct{}{}, now.Add(time.Minute)),
+		newEvent(t, "b2", 2, ledger.EventBookingDeleted, "123", struct{}{}, now.Add(time.Minute)),
+	}
+	for _, event := range events {
+		require.NoError(t, repo.AppendEvent(ctx, event))
+	}
+	save(t, repo, project(t, events...))
+
+	account, err := repo.FindAccount(ctx, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), account.GeloeschtAm())
+	booking, err := repo.FindBooking(ctx, "b2")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), booking.GeloeschtAm())
+	booking, err = repo.FindBooking(ctx, "b3")
+	require.NoError(t, err)
+	assert.False(t, booking.IstGeloescht())
+
+	purged, err := repo.PurgeDeleted(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, purged, "entries deleted at the cutoff are kept")
+
+	purged, err = repo.PurgeDeleted(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 3, purged, "the account, its booking and the deleted booking")
+	_, err = repo.FindAccount(ctx, "k1")
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound)
+	for _, id := range []string{"b1", "b2"} {
+		_, err = repo.FindBooking(ctx, id)
+		assert.ErrorIs(t, err, ledger.ErrBookingNotFound)
+	}
+	bookings, err := repo.FindBookings(ctx, "k2")
+	require.NoError(t, err)
+	require.Len(t, bookings, 1)
+	assert.Equal(t, "b3", bookings[0].ID())
+
+	remaining, err := repo.FindAllEvents(ctx)
+	require.NoError(t, err)
+	streams := make([]string, 0, len(remaining))
+	for _, event := range remaining {
+		streams = append(streams, event.StreamID())
+	}
+	assert.Equal(t, []string{"k2", "b3"}, streams, "the events of purged entries are removed")
+	require.NoError(t, repo.AppendEvent(ctx, opened(t, "k1", "123", now)), "a purged stream version is free again")
+}
+
+func testDeleteUserData(t *testing.T, repo ledger.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	events := []*ledger.Event{
+		opened(t, "k1", "123", now),
+		created(t, "b1", "k1", "123", "100", now.Truncate(24*time.Hour), now),
+		opened(t, "k2", "456", now),
+	}
+	for _, event := range events {
+		require.NoError(t, repo.AppendEvent(ctx, event))
+	}
+	save(t, repo, project(t, events...))
+
+	require.NoError(t, repo.DeleteUserData(ctx, "123"))
+	found, err := repo.FindEvents(ctx, "123", time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	accounts, err := repo.FindAccounts(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, accounts)
+	_, err = repo.FindBooking(ctx, "b1")
+	assert.ErrorIs(t, err, ledger.ErrBookingNotFound)
+
+	all, err := repo.FindAllEvents(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 1, "events of other users are kept")
+	_, err = repo.FindAccount(ctx, "k2")
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteUserData(ctx, "123"), "deleting twice is fine")
+}
+
+func testNotFound(t *testing.T, repo ledger.Store) {
+	ctx := context.Background()
+
+	_, err := repo.FindAccount(ctx, "unbekannt")
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound)
+	_, err = repo.FindBooking(ctx, "unbekannt")
+	assert.ErrorIs(t, err, ledger.ErrBookingNotFound)
+	accounts, err := repo.FindAccounts(ctx, "unbekannt")
+	require.NoError(t, err)
+	assert.Empty(t, accounts)
+	bookings, err := repo.FindBookings(ctx, "unbekannt")
+	require.NoError(t, err)
+	assert.Empty(t, bookings)
+	events, err := repo.FindEvents(ctx, "unbekannt", time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func testCancelledContext(t *testing.T, repo ledger.Store) {
+	event := opened(t, "k1", "123", storetest.Now())
+	require.NoError(t, repo.AppendEvent(context.Background(), event))
+	projection := project(t, event)
+	save(t, repo, projection)
+	account, _ := projection.Account("k1")
+
+	storetest.Cancelled(t,
+		storetest.Call{Name: "AppendEvent", Run: func(ctx context.Context) error { return repo.AppendEvent(ctx, opened(t, "k2", "123", storetest.Now())) }},
+		storetest.Call{Name: "FindEvents", Run: func(ctx context.Context) error { _, err := repo.FindEvents(ctx, "123", time.Time{}); return err }},
+		storetest.Call{Name: "FindAllEvents", Run: func(ctx context.Context) error { _, err := repo.FindAllEvents(ctx); return err }},
+		storetest.Call{Name: "SaveAccount", Run: func(ctx context.Context) error { return repo.SaveAccount(ctx, account) }},
+		storetest.Call{Name: "FindAccount", Run: func(ctx context.Context) error { _, err := repo.FindAccount(ctx, "k1"); return err }},
+		storetest.Call{Name: "FindAccounts", Run: func(ctx context.Context) error { _, err := repo.FindAccounts(ctx, "123"); return err }},
+		storetest.Call{Name: "FindBooking", Run: func(ctx context.Context) error { _, err := repo.FindBooking(ctx, "b1"); return err }},
+		storetest.Call{Name: "FindBookings", Run: func(ctx context.Context) error { _, err := repo.FindBookings(ctx, "k1"); return err }},
+		storetest.Call{Name: "ReplaceProjections", Run: func(ctx context.Context) error { return repo.ReplaceProjections(ctx, nil, nil) }},
+		storetest.Call{Name: "PurgeDeleted", Run: func(ctx context.Context) error { _, err := repo.PurgeDeleted(ctx, storetest.Now()); return err }},
+		storetest.Call{Name: "DeleteUserData", Run: func(ctx context.Context) error { return repo.DeleteUserData(ctx, "123") }},
+	)
+
+	events, err := repo.FindAllEvents(context.Background())
+	require.NoError(t, err, "a cancelled call must not change the store")
+	assert.Len(t, events, 1)
+	_, err = repo.FindAccount(context.Background(), "k1")
+	require.NoError(t, err)
+}
+
+func testConcurrentEvents(t *testing.T, repo ledger.Store) {
+	ctx := context.Background()
+	errs := storetest.Race(func(i int) error {
+		return repo.AppendEvent(ctx, newEvent(t, "k1", 1, ledger.EventAccountOpened, "123", ledger.AccountOpened{Name: fmt.Sprint(i), Currency: "EUR"}, storetest.Now()))
+	})
+
+	assert.Equal(t, 1, storetest.Count(errs, nil), "a version of a stream is appended exactly once")
+	assert.Equal(t, storetest.Concurrency-1, storetest.Count(errs, ledger.ErrConflict))
+}
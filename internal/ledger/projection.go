@@ -0,0 +1,242 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// Projection folds events into the state of accounts and bookings. The use case
+// applies every new event to the stored projection of the affected account and
+// booking, Rebuild and the point-in-time queries replay the journal into an empty one.
+type Projection struct {
+	accounts map[string]*Account
+	bookings map[string]*Booking
+}
+
+// NewProjection creates a projection that continues from the given state.
+func NewProjection(accounts []*Account, bookings []*Booking) *Projection {
+	p := &Projection{
+		accounts: make(map[string]*Account, len(accounts)),
+		bookings: make(map[string]*Booking, len(bookings)),
+	}
+	for _, account := range accounts {
+		p.accounts[account.ID()] = account
+	}
+	for _, booking := range bookings {
+		p.bookings[booking.ID()] = booking
+	}
+	return p
+}
+
+// Apply changes the state by the event. It fails with ErrStreamCorrupt if the
+// event does not follow the state, e.g. a booking on an unknown account.
+func (p *Projection) Apply(event *Event) error {
+	switch event.Typ() {
+	case EventAccountOpened:
+		var data AccountOpened
+		if err := p.decode(event, &data); err != nil {
+			return err
+		}
+		if _, exists := p.accounts[event.StreamID()]; exists || event.Version() != 1 {
+			return p.corrupt(event)
+		}
+		p.accounts[event.StreamID()] = &Account{
+			iD:          event.StreamID(),
+			userID:      event.UserID(),
+			name:        data.Name,
+			waehrung:    data.Currency,
+			saldo:       new(big.Int),
+			version:     event.Version(),
+			eroeffnetAm: event.Zeitpunkt(),
+		}
+
+	case EventBookingCreated:
+		var data BookingCreated
+		if err := p.decode(event, &data); err != nil {
+			return err
+		}
+		account, exists := p.accounts[data.AccountID]
+		amount, ok := parseAmount(data.Amount)
+		if _, booked := p.bookings[event.StreamID()]; !exists || !ok || booked || event.Version() != 1 {
+			return p.corrupt(event)
+		}
+		p.bookings[event.StreamID()] = &Booking{
+			iD:            event.StreamID(),
+			kontoID:       account.ID(),
+			userID:        event.UserID(),
+			betrag:        amount,
+			text:          data.Text,
+			buchungsdatum: data.BookedOn,
+			version:       event.Version(),
+			erstelltAm:    event.Zeitpunkt(),
+			geaendertAm:   event.Zeitpunkt(),
+		}
+		account.saldo = new(big.Int).Add(account.saldo, amount)
+
+	case EventBookingAmended:
+		var data BookingAmended
+		if err := p.decode(event, &data); err != nil {
+			return err
+		}
+		booking, account, err := p.next(event)
+		if err != nil {
+			return err
+		}
+		amount, ok := parseAmount(data.Amount)
+		if !ok || booking.IstStorniert() || booking.IstGeloescht() {
+			return p.corrupt(event)
+		}
+		p.change(event, booking, account, func() {
+			booking.betrag, booking.text, booking.buchungsdatum = amount, data.Text, data.BookedOn
+		})
+
+	case EventBookingVoided:
+		var data BookingVoided
+		if err := p.decode(event, &data); err != nil {
+			return err
+		}
+		booking, account, err := p.next(event)
+		if err != nil {
+			return err
+		}
+		if booking.IstStorniert() || booking.IstGeloescht() {
+			return p.corrupt(event)
+		}
+		p.change(event, booking, account, func() {
+			booking.storniert, booking.stornoGrund = true, data.Reason
+		})
+
+	case EventBookingDeleted, EventBookingRestored:
+		booking, account, err := p.next(event)
+		if err != nil {
+			return err
+		}
+		deleted := event.Typ() == EventBookingDeleted
+		if booking.IstGeloescht() == deleted {
+			return p.corrupt(event)
+		}
+		// the trash is no change of the booking itself, so geaendertAm is kept
+		before := booking.wirksam()
+		booking.geloeschtAm = deletedAt(event, deleted)
+		booking.version = event.Version()
+		account.saldo = new(big.Int).Add(account.saldo, new(big.Int).Sub(booking.wirksam(), before))
+
+	case EventAccountDeleted, EventAccountRestored:
+		account, exists := p.accounts[event.StreamID()]
+		deleted := event.Typ() == EventAccountDeleted
+		if !exists || account.IstGeloescht() == deleted || event.Version() != account.Version()+1 {
+			return p.corrupt(event)
+		}
+		account.geloeschtAm = deletedAt(event, deleted)
+		account.version = event.Version()
+
+	default:
+		return p.corrupt(event)
+	}
+	return nil
+}
+
+// next returns the booking the event continues together with its account.
+func (p *Projection) next(event *Event) (*Booking, *Account, error) {
+	booking, exists := p.bookings[event.StreamID()]
+	if !exists || event.Version() != booking.Version()+1 {
+		return nil, nil, p.corrupt(event)
+	}
+	account, exists := p.accounts[booking.KontoID()]
+	if !exists {
+		return nil, nil, p.corrupt(event)
+	}
+	return booking, account, nil
+}
+
+// change applies fn to the booking and moves the balance of the account by the
+// difference of the effective amount.
+func (p *Projection) change(event *Event, booking *Booking, account *Account, fn func()) {
+	before := booking.wirksam()
+	fn()
+	booking.version, booking.geaendertAm = event.Version(), event.Zeitpunkt()
+	account.saldo = new(big.Int).Add(account.saldo, new(big.Int).Sub(booking.wirksam(), before))
+}
+
+func (p *Projection) decode(event *Event, data any) error {
+	if err := json.Unmarshal(event.Daten(), data); err != nil {
+		return fmt.Errorf("%w: event %d: %v", ErrStreamCorrupt, event.Sequenz(), err)
+	}
+	return nil
+}
+
+func (p *Projection) corrupt(event *Event) error {
+	return fmt.Errorf("%w: event %d %s of %s version %d", ErrStreamCorrupt, event.Sequenz(), event.Typ(), event.StreamID(), event.Version())
+}
+
+// Account returns the account with the ID.
+func (p *Projection) Account(id string) (*Account, bool) {
+	account, exists := p.accounts[id]
+	return account, exists
+}
+
+// Booking returns the booking with the ID.
+func (p *Projection) Booking(id string) (*Booking, bool) {
+	booking, exists := p.bookings[id]
+	return booking, exists
+}
+
+// Accounts returns every account in the order they were opened.
+func (p *Projection) Accounts() []*Account {
+	accounts := make([]*Account, 0, len(p.accounts))
+	for _, account := range p.accounts {
+		accounts = append(accounts, account)
+	}
+	sortAccounts(accounts)
+	return accounts
+}
+
+// Bookings returns the bookings of the account, or of every account for an
+// empty ID, ordered by booking date.
+func (p *Projection) Bookings(accountID string) []*Booking {
+	bookings := make([]*Booking, 0)
+	for _, booking := range p.bookings {
+		if accountID == "" || booking.KontoID() == accountID {
+			bookings = append(bookings, booking)
+		}
+	}
+	sortBookings(bookings)
+	return bookings
+}
+
+func sortAccounts(accounts []*Account) {
+	sort.Slice(accounts, func(i, j int) bool {
+		if !accounts[i].EroeffnetAm().Equal(accounts[j].EroeffnetAm()) {
+			return accounts[i].EroeffnetAm().Before(accounts[j].EroeffnetAm())
+		}
+		return accounts[i].ID() < accounts[j].ID()
+	})
+}
+
+func sortBookings(bookings []*Booking) {
+	sort.Slice(bookings, func(i, j int) bool {
+		if !bookings[i].Buchungsdatum().Equal(bookings[j].Buchungsdatum()) {
+			return bookings[i].Buchungsdatum().Before(bookings[j].Buchungsdatum())
+		}
+		if !bookings[i].ErstelltAm().Equal(bookings[j].ErstelltAm()) {
+			return bookings[i].ErstelltAm().Before(bookings[j].ErstelltAm())
+		}
+		return bookings[i].ID() < bookings[j].ID()
+	})
+}
+
+// deletedAt returns the time of a delete event and the zero time of a restore event.
+func deletedAt(event *Event, deleted bool) time.Time {
+	if deleted {
+		return event.Zeitpunkt()
+	}
+	return time.Time{}
+}
+
+// parseAmount parses an amount in the smallest unit of the currency.
+func parseAmount(amount string) (*big.Int, bool) {
+	return new(big.Int).SetString(amount, 10)
+}
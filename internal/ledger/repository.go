@@ -0,0 +1,346 @@
+package ledger
+
+import (
+	"context"
+	"maps"
+	"math/big"
+	"sync"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+// Store is the journal and projection storage. Every backend, e.g.
+// InMemoryRepository or SQLiteRepository, implements it.
+type Store interface {
+	repository
+}
+
+// streamKey identifies an event by its stream and version.
+type streamKey struct {
+	streamID string
+	version  int64
+}
+
+// InMemoryRepository implements the ledger repository with an append-only
+// in-memory journal and in-memory projections. It keeps copies, so a change only
+// takes effect through the repository.
+type InMemoryRepository struct {
+	events   []Event
+	versions map[streamKey]struct{}
+	accounts map[string]Account
+	bookings map[string]Booking
+	gate     transaction.Gate
+	mutex    sync.RWMutex
+}
+
+// NewInMemoryRepository creates a new InMemoryRepository.
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		events:   make([]Event, 0),
+		versions: make(map[streamKey]struct{}),
+		accounts: make(map[string]Account),
+		bookings: make(map[string]Booking),
+	}
+}
+
+// AppendEvent appends the event to the journal and assigns its sequence. It fails
+// with ErrConflict if the stream already has an event with the version.
+func (r *InMemoryRepository) AppendEvent(ctx context.Context, event *Event) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		key := streamKey{event.StreamID(), event.Version()}
+		if _, exists := r.versions[key]; exists {
+			return ErrConflict
+		}
+		sequence := uint64(1)
+		if len(r.events) > 0 {
+			sequence = r.events[len(r.events)-1].Sequenz() + 1
+		}
+		event.Angehaengt(sequence)
+		r.events = append(r.events, *event)
+		r.versions[key] = struct{}{}
+		return nil
+	}
+}
+
+// FindEvents returns the events of the user recorded up to knownAt in sequence
+// order, every event for a zero knownAt.
+func (r *InMemoryRepository) FindEvents(ctx context.Context, userID string, knownAt time.Time) ([]*Event, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		events := make([]*Event, 0)
+		for _, event := range r.events {
+			if event.UserID() == userID && (knownAt.IsZero() || !event.Zeitpunkt().After(knownAt)) {
+				events = append(events, &event)
+			}
+		}
+		return events, nil
+	}
+}
+
+// FindAllEvents returns the whole journal in sequence order.
+func (r *InMemoryRepository) FindAllEvents(ctx context.Context) ([]*Event, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		events := make([]*Event, len(r.events))
+		for i := range r.events {
+			event := r.events[i]
+			events[i] = &event
+		}
+		return events, nil
+	}
+}
+
+// SaveAccount stores the projection of an account.
+func (r *InMemoryRepository) SaveAccount(ctx context.Context, account *Account) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.accounts[account.ID()] = copyAccount(account)
+		return nil
+	}
+}
+
+// SaveBooking stores the projection of a booking.
+func (r *InMemoryRepository) SaveBooking(ctx context.Context, booking *Booking) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.bookings[booking.ID()] = copyBooking(booking)
+		return nil
+	}
+}
+
+// FindAccount retrieves the projection of an account by its ID.
+func (r *InMemoryRepository) FindAccount(ctx context.Context, id string) (*Account, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		account, exists := r.accounts[id]
+		if !exists {
+			return nil, ErrAccountNotFound
+		}
+		account = copyAccount(&account)
+		return &account, nil
+	}
+}
+
+// FindAccounts returns the accounts of the user in the order they were opened.
+func (r *InMemoryRepository) FindAccounts(ctx context.Context, userID string) ([]*Account, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		accounts := make([]*Account, 0)
+		for _, account := range r.accounts {
+			if account.UserID() == userID {
+				account = copyAccount(&account)
+				accounts = append(accounts, &account)
+			}
+		}
+		sortAccounts(accounts)
+		return accounts, nil
+	}
+}
+
+// FindBooking retrieves the projection of a booking by its ID.
+func (r *InMemoryRepository) FindBooking(ctx context.Context, id string) (*Booking, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		booking, exists := r.bookings[id]
+		if !exists {
+			return nil, ErrBookingNotFound
+		}
+		booking = copyBooking(&booking)
+		return &booking, nil
+	}
+}
+
+// FindBookings returns the bookings of the account ordered by booking date.
+func (r *InMemoryRepository) FindBookings(ctx context.Context, accountID string) ([]*Booking, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		bookings := make([]*Booking, 0)
+		for _, booking := range r.bookings {
+			if booking.KontoID() == accountID {
+				booking = copyBooking(&booking)
+				bookings = append(bookings, &booking)
+			}
+		}
+		sortBookings(bookings)
+		return bookings, nil
+	}
+}
+
+// ReplaceProjections replaces every stored account and booking.
+func (r *InMemoryRepository) ReplaceProjections(ctx context.Context, accounts []*Account, bookings []*Booking) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.accounts = make(map[string]Account, len(accounts))
+		for _, account := range accounts {
+			r.accounts[account.ID()] = copyAccount(account)
+		}
+		r.bookings = make(map[string]Booking, len(bookings))
+		for _, booking := range bookings {
+			r.bookings[booking.ID()] = copyBooking(booking)
+		}
+		return nil
+	}
+}
+
+// PurgeDeleted removes the accounts and bookings deleted before deletedBefore,
+// together with their events and the bookings of the removed accounts. It
+// returns the number of removed accounts and bookings.
+func (r *InMemoryRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		streams := make(map[string]struct{})
+		for id, account := range r.accounts {
+			if account.IstGeloescht() && account.GeloeschtAm().Before(deletedBefore) {
+				streams[id] = struct{}{}
+			}
+		}
+		for id, booking := range r.bookings {
+			_, accountPurged := streams[booking.KontoID()]
+			if accountPurged || (booking.IstGeloescht() && booking.GeloeschtAm().Before(deletedBefore)) {
+				streams[id] = struct{}{}
+			}
+		}
+		if len(streams) == 0 {
+			return 0, nil
+		}
+
+		events := make([]Event, 0, len(r.events))
+		for _, event := range r.events {
+			if _, purged := streams[event.StreamID()]; purged {
+				delete(r.versions, streamKey{event.StreamID(), event.Version()})
+				continue
+			}
+			events = append(events, event)
+		}
+		r.events = events
+		for id := range streams {
+			delete(r.accounts, id)
+			delete(r.bookings, id)
+		}
+		return len(streams), nil
+	}
+}
+
+// DeleteUserData removes the events, accounts and bookings of the user.
+func (r *InMemoryRepository) DeleteUserData(ctx context.Context, userID string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		events := make([]Event, 0, len(r.events))
+		for _, event := range r.events {
+			if event.UserID() == userID {
+				delete(r.versions, streamKey{event.StreamID(), event.Version()})
+				continue
+			}
+			events = append(events, event)
+		}
+		r.events = events
+		maps.DeleteFunc(r.accounts, func(_ string, account Account) bool { return account.UserID() == userID })
+		maps.DeleteFunc(r.bookings, func(_ string, booking Booking) bool { return booking.UserID() == userID })
+		return nil
+	}
+}
+
+// Snapshot copies the journal and the projections and returns a function that
+// restores the copy.
+func (r *InMemoryRepository) Snapshot() func() {
+	r.mutex.RLock()
+	events, versions := r.events[:len(r.events):len(r.events)], maps.Clone(r.versions)
+	accounts, bookings := maps.Clone(r.accounts), maps.Clone(r.bookings)
+	r.mutex.RUnlock()
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.events, r.versions = events, versions
+		r.accounts, r.bookings = accounts, bookings
+	}
+}
+
+// Gate returns the gate the writes of the repository pass.
+func (r *InMemoryRepository) Gate() *transaction.Gate {
+	return &r.gate
+}
+
+// copyAccount copies the account together with its balance, so no big.Int is
+// shared with the caller.
+func copyAccount(account *Account) Account {
+	copied := *account
+	copied.saldo = new(big.Int).Set(account.saldo)
+	return copied
+}
+
+// copyBooking copies the booking together with its amount.
+func copyBooking(booking *Booking) Booking {
+	copied := *booking
+	copied.betrag = new(big.Int).Set(booking.betrag)
+	return copied
+}
@@ -0,0 +1,17 @@
+package ledger_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/ledger"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/ledger/ledgertest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+func TestRepository(t *testing.T) {
+	storetest.Backends(t, ledgertest.TestStore,
+		func() ledger.Store { return ledger.NewInMemoryRepository() },
+		func(db *sql.DB) ledger.Store { return ledger.NewSQLiteRepository(db) },
+	)
+}
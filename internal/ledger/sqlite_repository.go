@@ -0,0 +1,284 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/big"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+const (
+	eventColumns   = `sequence, stream_id, version, type, user_id, time, data`
+	accountColumns = `id, user_id, name, currency, balance, version, opened_at, deleted_at`
+	bookingColumns = `id, account_id, user_id, amount, text, booked_on, voided, void_reason, version, created_at, changed_at, deleted_at`
+)
+
+// SQLiteRepository implements the ledger repository with a SQLite database. A
+// trigger rejects updates of the events, so the journal is append-only.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteRepository creates a new SQLiteRepository.
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db}
+}
+
+// conn returns the transaction of the context or the database.
+func (r *SQLiteRepository) conn(ctx context.Context) transaction.Querier {
+	return transaction.Conn(ctx, r.db)
+}
+
+// AppendEvent appends the event to the journal and assigns its sequence. The
+// unique stream version rejects a concurrent event with ErrConflict.
+func (r *SQLiteRepository) AppendEvent(ctx context.Context, event *Event) error {
+	var sequence uint64
+	err := r.conn(ctx).QueryRowContext(ctx, `INSERT INTO ledger_events (stream_id, version, type, user_id, time, data)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING sequence`,
+		event.StreamID(), event.Version(), event.Typ(), event.UserID(), event.Zeitpunkt().UTC(), event.Daten()).Scan(&sequence)
+	if sqlite.IsUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	event.Angehaengt(sequence)
+	return nil
+}
+
+// FindEvents returns the events of the user recorded up to knownAt in sequence
+// order, every event for a zero knownAt.
+func (r *SQLiteRepository) FindEvents(ctx context.Context, userID string, knownAt time.Time) ([]*Event, error) {
+	if knownAt.IsZero() {
+		return r.queryEvents(ctx, `SELECT `+eventColumns+` FROM ledger_events WHERE user_id = $1 ORDER BY sequence`, userID)
+	}
+	return r.queryEvents(ctx, `SELECT `+eventColumns+` FROM ledger_events WHERE user_id = $1 AND time <= $2 ORDER BY sequence`, userID, knownAt.UTC())
+}
+
+// FindAllEvents returns the whole journal in sequence order.
+func (r *SQLiteRepository) FindAllEvents(ctx context.Context) ([]*Event, error) {
+	return r.queryEvents(ctx, `SELECT `+eventColumns+` FROM ledger_events ORDER BY sequence`)
+}
+
+// SaveAccount stores the projection of an account.
+func (r *SQLiteRepository) SaveAccount(ctx context.Context, account *Account) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO ledger_accounts (`+accountColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, currency = EXCLUDED.currency, balance = EXCLUDED.balance,
+		version = EXCLUDED.version, deleted_at = EXCLUDED.deleted_at`, accountValues(account)...)
+	return err
+}
+
+// SaveBooking stores the projection of a booking.
+func (r *SQLiteRepository) SaveBooking(ctx context.Context, booking *Booking) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO ledger_bookings (`+bookingColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET amount = EXCLUDED.amount, text = EXCLUDED.text, booked_on = EXCLUDED.booked_on,
+		voided = EXCLUDED.voided, void_reason = EXCLUDED.void_reason, version = EXCLUDED.version, changed_at = EXCLUDED.changed_at,
+		deleted_at = EXCLUDED.deleted_at`,
+		bookingValues(booking)...)
+	return err
+}
+
+// FindAccount retrieves the projection of an account by its ID.
+func (r *SQLiteRepository) FindAccount(ctx context.Context, id string) (*Account, error) {
+	return scanAccount(r.conn(ctx).QueryRowContext(ctx, `SELECT `+accountColumns+` FROM ledger_accounts WHERE id = $1`, id))
+}
+
+// FindAccounts returns the accounts of the user in the order they were opened.
+func (r *SQLiteRepository) FindAccounts(ctx context.Context, userID string) ([]*Account, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT `+accountColumns+` FROM ledger_accounts WHERE user_id = $1 ORDER BY opened_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make([]*Account, 0)
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// FindBooking retrieves the projection of a booking by its ID.
+func (r *SQLiteRepository) FindBooking(ctx context.Context, id string) (*Booking, error) {
+	return scanBooking(r.conn(ctx).QueryRowContext(ctx, `SELECT `+bookingColumns+` FROM ledger_bookings WHERE id = $1`, id))
+}
+
+// FindBookings returns the bookings of the account ordered by booking date.
+func (r *SQLiteRepository) FindBookings(ctx context.Context, accountID string) ([]*Booking, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT `+bookingColumns+` FROM ledger_bookings WHERE account_id = $1
+		ORDER BY booked_on, created_at, id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := make([]*Booking, 0)
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, rows.Err()
+}
+
+// ReplaceProjections replaces every stored account and booking in one transaction.
+func (r *SQLiteRepository) ReplaceProjections(ctx context.Context, accounts []*Account, bookings []*Booking) error {
+	return transaction.InTx(ctx, r.db, func(tx transaction.Querier) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM ledger_bookings`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM ledger_accounts`); err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO ledger_accounts (`+accountColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				accountValues(account)...); err != nil {
+				return err
+			}
+		}
+		for _, booking := range bookings {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO ledger_bookings (`+bookingColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+				bookingValues(booking)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PurgeDeleted removes the accounts and bookings deleted before deletedBefore,
+// together with their events and the bookings of the removed accounts, in one
+// transaction. It returns the number of removed accounts and bookings.
+func (r *SQLiteRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int, error) {
+	var purged int64
+	err := transaction.InTx(ctx, r.db, func(tx transaction.Querier) error {
+		// the bookings of a purged account go with it, whether deleted or not
+		statements := []string{
+			`DELETE FROM ledger_events WHERE stream_id IN (SELECT id FROM ledger_bookings WHERE deleted_at < $1
+				OR account_id IN (SELECT id FROM ledger_accounts WHERE deleted_at < $1))`,
+			`DELETE FROM ledger_events WHERE stream_id IN (SELECT id FROM ledger_accounts WHERE deleted_at < $1)`,
+			`DELETE FROM ledger_bookings WHERE deleted_at < $1 OR account_id IN (SELECT id FROM ledger_accounts WHERE deleted_at < $1)`,
+			`DELETE FROM ledger_accounts WHERE deleted_at < $1`,
+		}
+		for i, statement := range statements {
+			result, err := tx.ExecContext(ctx, statement, deletedBefore.UTC())
+			if err != nil {
+				return err
+			}
+			if i < 2 {
+				continue
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			purged += rows
+		}
+		return nil
+	})
+	return int(purged), err
+}
+
+// DeleteUserData removes the events, accounts and bookings of the user.
+func (r *SQLiteRepository) DeleteUserData(ctx context.Context, userID string) error {
+	return transaction.InTx(ctx, r.db, func(tx transaction.Querier) error {
+		for _, table := range []string{"ledger_bookings", "ledger_accounts", "ledger_events"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *SQLiteRepository) queryEvents(ctx context.Context, query string, args ...any) ([]*Event, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*Event, 0)
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.sequenz, &event.streamID, &event.version, &event.typ, &event.userID, &event.zeitpunkt, &event.daten); err != nil {
+			return nil, err
+		}
+		event.zeitpunkt = event.zeitpunkt.UTC()
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func accountValues(account *Account) []any {
+	return []any{
+		account.ID(), account.UserID(), account.Name(), account.Waehrung(), account.Saldo(), account.Version(),
+		account.EroeffnetAm().UTC(), sqlite.NullTime(account.GeloeschtAm()),
+	}
+}
+
+func scanAccount(row rowScanner) (*Account, error) {
+	var (
+		account Account
+		balance string
+		deleted sql.NullTime
+	)
+	err := row.Scan(&account.iD, &account.userID, &account.name, &account.waehrung, &balance, &account.version, &account.eroeffnetAm, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if account.saldo, ok = new(big.Int).SetString(balance, 10); !ok {
+		return nil, ErrStreamCorrupt
+	}
+	account.eroeffnetAm, account.geloeschtAm = account.eroeffnetAm.UTC(), sqlite.Time(deleted)
+	return &account, nil
+}
+
+func bookingValues(booking *Booking) []any {
+	return []any{
+		booking.ID(), booking.KontoID(), booking.UserID(), booking.Betrag(), booking.Text(), booking.Buchungsdatum().UTC(),
+		booking.IstStorniert(), booking.StornoGrund(), booking.Version(), booking.ErstelltAm().UTC(), booking.GeaendertAm().UTC(),
+		sqlite.NullTime(booking.GeloeschtAm()),
+	}
+}
+
+func scanBooking(row rowScanner) (*Booking, error) {
+	var (
+		booking Booking
+		amount  string
+		deleted sql.NullTime
+	)
+	err := row.Scan(&booking.iD, &booking.kontoID, &booking.userID, &amount, &booking.text, &booking.buchungsdatum,
+		&booking.storniert, &booking.stornoGrund, &booking.version, &booking.erstelltAm, &booking.geaendertAm, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBookingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if booking.betrag, ok = new(big.Int).SetString(amount, 10); !ok {
+		return nil, ErrStreamCorrupt
+	}
+	booking.buchungsdatum, booking.erstelltAm, booking.geaendertAm = booking.buchungsdatum.UTC(), booking.erstelltAm.UTC(), booking.geaendertAm.UTC()
+	booking.geloeschtAm = sqlite.Time(deleted)
+	return &booking, nil
+}
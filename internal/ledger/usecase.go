@@ -0,0 +1,787 @@
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export"
+)
+
+var (
+	// ErrAccountNotFound is returned when an account is not found
+	ErrAccountNotFound = errors.New("Account not found")
+	// ErrBookingNotFound is returned when a booking is not found
+	ErrBookingNotFound = errors.New("Booking not found")
+	// ErrBookingVoided is returned when a voided booking is amended or voided again
+	ErrBookingVoided = errors.New("Booking already voided")
+	// ErrConflict is returned when a stream was changed since the given version was read
+	ErrConflict = errors.New("Account or booking was changed in the meantime")
+	// ErrStreamCorrupt is returned when an event does not follow the events before it
+	ErrStreamCorrupt = errors.New("Event stream corrupt")
+	// ErrInvalidName is returned when an account name is empty or too long
+	ErrInvalidName = errors.New("Invalid account name. Maximum 100 characters")
+	// ErrInvalidCurrency is returned when a currency is no ISO 4217 code
+	ErrInvalidCurrency = errors.New("Invalid currency. Expected an ISO 4217 code like EUR")
+	// ErrInvalidAmount is returned when an amount is no integer in the smallest unit of the currency or zero
+	ErrInvalidAmount = errors.New("Invalid amount. Expected a non-zero integer in the smallest unit of the currency")
+	// ErrInvalidPeriod is returned when a report period ends before it starts
+	ErrInvalidPeriod = errors.New("Invalid period")
+)
+
+const maxNameLength = 100
+
+type repository interface {
+	AppendEvent(ctx context.Context, event *Event) error
+	FindEvents(ctx context.Context, userID string, knownAt time.Time) ([]*Event, error)
+	FindAllEvents(ctx context.Context) ([]*Event, error)
+	SaveAccount(ctx context.Context, account *Account) error
+	SaveBooking(ctx context.Context, booking *Booking) error
+	FindAccount(ctx context.Context, id string) (*Account, error)
+	FindAccounts(ctx context.Context, userID string) ([]*Account, error)
+	FindBooking(ctx context.Context, id string) (*Booking, error)
+	FindBookings(ctx context.Context, accountID string) ([]*Booking, error)
+	ReplaceProjections(ctx context.Context, accounts []*Account, bookings []*Booking) error
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int, error)
+	DeleteUserData(ctx context.Context, userID string) error
+}
+
+// transactor runs a unit of work that spans the journal and the projections.
+type transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type uuidGenerator interface {
+	GenerateUUID() (string, error)
+}
+
+type auditLog interface {
+	Record(ctx context.Context, event *audit.Event) error
+}
+
+// UseCase is the use case for the accounts and bookings of the journal
+type UseCase struct {
+	repo      repository
+	tx        transactor
+	uuidGen   uuidGenerator
+	audit     auditLog
+	retention time.Duration
+}
+
+// NewUseCase creates a new ledger UseCase. Every change of an account or a booking
+// is recorded in the audit log. Deleted accounts and bookings stay in the trash for
+// the retention period before the Cleaner purges them.
+func NewUseCase(repo repository, tx transactor, uuidGen uuidGenerator, auditor auditLog, retention time.Duration) *UseCase {
+	return &UseCase{
+		repo:      repo,
+		tx:        tx,
+		uuidGen:   uuidGen,
+		audit:     auditor,
+		retention: retention,
+	}
+}
+
+// OpenAccountInput is the input for the open account use case
+type OpenAccountInput struct {
+	UserID   string
+	Name     string
+	Currency string
+}
+
+// OpenAccount is the interactor for opening an account
+func (c *UseCase) OpenAccount(ctx context.Context, input *OpenAccountInput) (*Account, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > maxNameLength {
+		return nil, ErrInvalidName
+	}
+	if !validCurrency(input.Currency) {
+		return nil, ErrInvalidCurrency
+	}
+	id, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := newEvent(id, 1, EventAccountOpened, input.UserID, AccountOpened{Name: name, Currency: input.Currency})
+	if err != nil {
+		return nil, err
+	}
+	projection, err := c.record(ctx, event, "", "")
+	if err != nil {
+		return nil, err
+	}
+	account, _ := projection.Account(id)
+	return account, nil
+}
+
+// Accounts is the interactor for listing the accounts of a user with their balances
+func (c *UseCase) Accounts(ctx context.Context, userID string) ([]*Account, error) {
+	accounts, err := c.repo.FindAccounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(accounts, (*Account).IstGeloescht), nil
+}
+
+// CreateBookingInput is the input for the create booking use case. The amount is
+// given in the smallest unit of the currency of the account, expenses are negative.
+type CreateBookingInput struct {
+	UserID    string
+	AccountID string
+	Amount    string
+	Text      string
+	BookedOn  time.Time
+}
+
+// CreateBooking is the interactor for booking an amount on an account
+func (c *UseCase) CreateBooking(ctx context.Context, input *CreateBookingInput) (*Booking, error) {
+	if !validAmount(input.Amount) {
+		return nil, ErrInvalidAmount
+	}
+	if _, err := c.account(ctx, input.UserID, input.AccountID); err != nil {
+		return nil, err
+	}
+	id, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	data := BookingCreated{AccountID: input.AccountID, Amount: input.Amount, Text: strings.TrimSpace(input.Text), BookedOn: day(input.BookedOn)}
+	event, err := newEvent(id, 1, EventBookingCreated, input.UserID, data)
+	if err != nil {
+		return nil, err
+	}
+	projection, err := c.record(ctx, event, input.AccountID, "")
+	if err != nil {
+		return nil, err
+	}
+	booking, _ := projection.Booking(id)
+	return booking, nil
+}
+
+// Booking is the interactor for reading a booking of the user. Bookings in the
+// trash are not found.
+func (c *UseCase) Booking(ctx context.Context, userID, bookingID string) (*Booking, error) {
+	booking, err := c.repo.FindBooking(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if booking.UserID() != userID || booking.IstGeloescht() {
+		return nil, ErrBookingNotFound
+	}
+	if _, err := c.account(ctx, userID, booking.KontoID()); errors.Is(err, ErrAccountNotFound) {
+		return nil, ErrBookingNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// Bookings is the interactor for listing the bookings of an account, ordered by booking date
+func (c *UseCase) Bookings(ctx context.Context, userID, accountID string) ([]*Booking, error) {
+	if _, err := c.account(ctx, userID, accountID); err != nil {
+		return nil, err
+	}
+	bookings, err := c.repo.FindBookings(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(bookings, (*Booking).IstGeloescht), nil
+}
+
+// AmendBookingInput is the input for the amend booking use case. Version is the
+// version of the booking the client read, zero skips the check.
+type AmendBookingInput struct {
+	UserID    string
+	BookingID string
+	Version   int64
+	Amount    string
+	Text      string
+	BookedOn  time.Time
+}
+
+// AmendBooking is the interactor for correcting a booking. The former state stays
+// in the journal.
+func (c *UseCase) AmendBooking(ctx context.Context, input *AmendBookingInput) (*Booking, error) {
+	if !validAmount(input.Amount) {
+		return nil, ErrInvalidAmount
+	}
+	booking, err := c.changeableBooking(ctx, input.UserID, input.BookingID, input.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	data := BookingAmended{Amount: input.Amount, Text: strings.TrimSpace(input.Text), BookedOn: day(input.BookedOn)}
+	event, err := newEvent(booking.ID(), booking.Version()+1, EventBookingAmended, input.UserID, data)
+	if err != nil {
+		return nil, err
+	}
+	projection, err := c.record(ctx, event, booking.KontoID(), booking.ID())
+	if err != nil {
+		return nil, err
+	}
+	booking, _ = projection.Booking(booking.ID())
+	return booking, nil
+}
+
+// VoidBookingInput is the input for the void booking use case. Version is the
+// version of the booking the client read, zero skips the check.
+type VoidBookingInput struct {
+	UserID    string
+	BookingID string
+	Version   int64
+	Reason    string
+}
+
+// VoidBooking is the interactor for cancelling a booking. A voided booking no
+// longer counts towards the balance but stays in the journal.
+func (c *UseCase) VoidBooking(ctx context.Context, input *VoidBookingInput) (*Booking, error) {
+	booking, err := c.changeableBooking(ctx, input.UserID, input.BookingID, input.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := newEvent(booking.ID(), booking.Version()+1, EventBookingVoided, input.UserID, BookingVoided{Reason: strings.TrimSpace(input.Reason)})
+	if err != nil {
+		return nil, err
+	}
+	projection, err := c.record(ctx, event, booking.KontoID(), booking.ID())
+	if err != nil {
+		return nil, err
+	}
+	booking, _ = projection.Booking(booking.ID())
+	return booking, nil
+}
+
+// BalanceInput is the input for the balance use case. AsOf limits the bookings by
+// their booking date, KnownAt by the time they were recorded. Zero times mean now.
+type BalanceInput struct {
+	UserID    string
+	AccountID string
+	AsOf      time.Time
+	KnownAt   time.Time
+}
+
+// BalanceOutput is the output for the balance use case
+type BalanceOutput struct {
+	AccountID string
+	Currency  string
+	Balance   string
+	AsOf      time.Time
+	KnownAt   time.Time
+}
+
+// Balance is the interactor for the balance of an account on a day as it was
+// known at a point in time, e.g. the balance as of March 1 as it was known then.
+func (c *UseCase) Balance(ctx context.Context, input *BalanceInput) (*BalanceOutput, error) {
+	account, bookings, err := c.state(ctx, input.UserID, input.AccountID, input.KnownAt)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &BalanceOutput{AccountID: account.ID(), Currency: account.Waehrung(), AsOf: input.AsOf, KnownAt: input.KnownAt}
+	balance := new(big.Int)
+	for _, booking := range bookings {
+		if input.AsOf.IsZero() || !booking.Buchungsdatum().After(input.AsOf) {
+			balance.Add(balance, booking.wirksam())
+		}
+	}
+	output.Balance = balance.String()
+	return output, nil
+}
+
+// ReportInput is the input for the report use case. The period covers the booking
+// dates from From to To, both included. A zero KnownAt means now.
+type ReportInput struct {
+	UserID    string
+	AccountID string
+	From      time.Time
+	To        time.Time
+	KnownAt   time.Time
+}
+
+// ReportOutput is the output for the report use case
+type ReportOutput struct {
+	AccountID string
+	Currency  string
+	Income    string
+	Expenses  string
+	Net       string
+	Bookings  int
+}
+
+// Report is the interactor for the income and expenses of an account in a period
+func (c *UseCase) Report(ctx context.Context, input *ReportInput) (*ReportOutput, error) {
+	if !input.From.IsZero() && !input.To.IsZero() && input.To.Before(input.From) {
+		return nil, ErrInvalidPeriod
+	}
+	account, bookings, err := c.state(ctx, input.UserID, input.AccountID, input.KnownAt)
+	if err != nil {
+		return nil, err
+	}
+
+	income, expenses, count := new(big.Int), new(big.Int), 0
+	for _, booking := range bookings {
+		if booking.IstStorniert() || booking.IstGeloescht() ||
+			(!input.From.IsZero() && booking.Buchungsdatum().Before(input.From)) ||
+			(!input.To.IsZero() && booking.Buchungsdatum().After(input.To)) {
+			continue
+		}
+		if booking.betrag.Sign() > 0 {
+			income.Add(income, booking.betrag)
+		} else {
+			expenses.Add(expenses, booking.betrag)
+		}
+		count++
+	}
+	return &ReportOutput{
+		AccountID: account.ID(),
+		Currency:  account.Waehrung(),
+		Income:    income.String(),
+		Expenses:  expenses.String(),
+		Net:       new(big.Int).Add(income, expenses).String(),
+		Bookings:  count,
+	}, nil
+}
+
+// DeleteAccountInput is the input for the delete account use case. Version is the
+// version of the account the client read, zero skips the check.
+type DeleteAccountInput struct {
+	UserID    string
+	AccountID string
+	Version   int64
+}
+
+// DeleteAccount is the interactor for moving an account together with its
+// bookings to the trash
+func (c *UseCase) DeleteAccount(ctx context.Context, input *DeleteAccountInput) (*Account, error) {
+	account, err := c.account(ctx, input.UserID, input.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Version != 0 && input.Version != account.Version() {
+		return nil, ErrConflict
+	}
+	return c.trashAccount(ctx, account, EventAccountDeleted)
+}
+
+// RestoreAccount is the interactor for restoring an account from the trash
+func (c *UseCase) RestoreAccount(ctx context.Context, userID, accountID string) (*Account, error) {
+	account, err := c.repo.FindAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.UserID() != userID || !account.IstGeloescht() {
+		return nil, ErrAccountNotFound
+	}
+	return c.trashAccount(ctx, account, EventAccountRestored)
+}
+
+// DeleteBookingInput is the input for the delete booking use case. Version is the
+// version of the booking the client read, zero skips the check.
+type DeleteBookingInput struct {
+	UserID    string
+	BookingID string
+	Version   int64
+}
+
+// DeleteBooking is the interactor for moving a booking to the trash. Unlike a
+// voided booking it is purged for good once the retention period has passed.
+func (c *UseCase) DeleteBooking(ctx context.Context, input *DeleteBookingInput) (*Booking, error) {
+	booking, err := c.Booking(ctx, input.UserID, input.BookingID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Version != 0 && input.Version != booking.Version() {
+		return nil, ErrConflict
+	}
+	return c.trashBooking(ctx, booking, EventBookingDeleted)
+}
+
+// RestoreBooking is the interactor for restoring a booking from the trash. A
+// booking of an account in the trash is restored with its account.
+func (c *UseCase) RestoreBooking(ctx context.Context, userID, bookingID string) (*Booking, error) {
+	booking, err := c.repo.FindBooking(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if booking.UserID() != userID || !booking.IstGeloescht() {
+		return nil, ErrBookingNotFound
+	}
+	if _, err := c.account(ctx, userID, booking.KontoID()); err != nil {
+		return nil, err
+	}
+	return c.trashBooking(ctx, booking, EventBookingRestored)
+}
+
+// TrashOutput is the output for the trash use case. Every entry is purged
+// Retention after it was deleted.
+type TrashOutput struct {
+	Accounts  []*Account
+	Bookings  []*Booking
+	Retention time.Duration
+}
+
+// Trash is the interactor for listing the deleted accounts and bookings of a
+// user. The bookings of a deleted account are part of the account, the list only
+// holds bookings deleted on their own.
+func (c *UseCase) Trash(ctx context.Context, userID string) (*TrashOutput, error) {
+	accounts, err := c.repo.FindAccounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	output := &TrashOutput{Accounts: make([]*Account, 0), Bookings: make([]*Booking, 0), Retention: c.retention}
+	for _, account := range accounts {
+		if account.IstGeloescht() {
+			output.Accounts = append(output.Accounts, account)
+			continue
+		}
+		bookings, err := c.repo.FindBookings(ctx, account.ID())
+		if err != nil {
+			return nil, err
+		}
+		for _, booking := range bookings {
+			if booking.IstGeloescht() {
+				output.Bookings = append(output.Bookings, booking)
+			}
+		}
+	}
+	return output, nil
+}
+
+// PurgeTrash removes the accounts and bookings whose retention period has ended
+// from the projections and the journal. It returns how many were removed.
+func (c *UseCase) PurgeTrash(ctx context.Context) (int, error) {
+	var purged int
+	err := c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		purged, err = c.repo.PurgeDeleted(ctx, time.Now().UTC().Add(-c.retention))
+		return err
+	})
+	return purged, err
+}
+
+// RebuildOutput is the output for the rebuild use case
+type RebuildOutput struct {
+	Events   int
+	Accounts int
+	Bookings int
+}
+
+// Rebuild replays the whole journal and replaces the stored projections with the
+// result, e.g. after a projection changed or was damaged.
+func (c *UseCase) Rebuild(ctx context.Context) (*RebuildOutput, error) {
+	var output *RebuildOutput
+	err := c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		events, err := c.repo.FindAllEvents(ctx)
+		if err != nil {
+			return err
+		}
+		projection, err := replay(events)
+		if err != nil {
+			return err
+		}
+		accounts, bookings := projection.Accounts(), projection.Bookings("")
+		if err := c.repo.ReplaceProjections(ctx, accounts, bookings); err != nil {
+			return err
+		}
+		output = &RebuildOutput{Events: len(events), Accounts: len(accounts), Bookings: len(bookings)}
+		return nil
+	})
+	return output, err
+}
+
+// DeleteUserData removes the journal and the projections of the user. Besides
+// PurgeTrash it is the only way events leave the journal.
+func (c *UseCase) DeleteUserData(ctx context.Context, userID string) error {
+	return c.repo.DeleteUserData(ctx, userID)
+}
+
+// ExportTables is the export source for the accounts, bookings and the journal of the user.
+func (c *UseCase) ExportTables(ctx context.Context, userID string) ([]export.Table, error) {
+	events, err := c.repo.FindEvents(ctx, userID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	projection, err := replay(events)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := export.Table{
+		Name:    "accounts",
+		Columns: []string{"id", "name", "currency", "balance", "opened_at", "deleted_at"},
+		Rows:    make([][]any, 0),
+	}
+	for _, account := range projection.Accounts() {
+		accounts.Rows = append(accounts.Rows, []any{account.ID(), account.Name(), account.Waehrung(), account.Saldo(), account.EroeffnetAm(), account.GeloeschtAm()})
+	}
+	bookings := export.Table{
+		Name:    "bookings",
+		Columns: []string{"id", "account_id", "amount", "text", "booked_on", "voided", "void_reason", "created_at", "changed_at", "deleted_at"},
+		Rows:    make([][]any, 0),
+	}
+	for _, booking := range projection.Bookings("") {
+		bookings.Rows = append(bookings.Rows, []any{
+			booking.ID(), booking.KontoID(), booking.Betrag(), booking.Text(), booking.Buchungsdatum().Format(time.DateOnly),
+			booking.IstStorniert(), booking.StornoGrund(), booking.ErstelltAm(), booking.GeaendertAm(), booking.GeloeschtAm(),
+		})
+	}
+	journal := export.Table{
+		Name:    "journal",
+		Columns: []string{"sequence", "time", "stream_id", "version", "type", "data"},
+		Rows:    make([][]any, 0, len(events)),
+	}
+	for _, event := range events {
+		journal.Rows = append(journal.Rows, []any{event.Sequenz(), event.Zeitpunkt(), event.StreamID(), event.Version(), event.Typ(), string(event.Daten())})
+	}
+	return []export.Table{accounts, bookings, journal}, nil
+}
+
+// record appends the event and applies it to the stored projections of the
+// account and the booking in one unit of work together with the audit entry. The
+// projections are read inside it, so concurrent bookings on the same account
+// cannot lose a balance change.
+func (c *UseCase) record(ctx context.Context, event *Event, accountID, bookingID string) (*Projection, error) {
+	var projection *Projection
+	err := c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		accounts, bookings := make([]*Account, 0, 1), make([]*Booking, 0, 1)
+		if accountID != "" {
+			account, err := c.repo.FindAccount(ctx, accountID)
+			if err != nil {
+				return err
+			}
+			accounts = append(accounts, account)
+		}
+		if bookingID != "" {
+			booking, err := c.repo.FindBooking(ctx, bookingID)
+			if err != nil {
+				return err
+			}
+			bookings = append(bookings, booking)
+		}
+
+		if err := c.repo.AppendEvent(ctx, event); err != nil {
+			return err
+		}
+		projection = NewProjection(accounts, bookings)
+		before := auditState(projection, event)
+		if err := projection.Apply(event); err != nil {
+			return err
+		}
+		for _, account := range projection.Accounts() {
+			if err := c.repo.SaveAccount(ctx, account); err != nil {
+				return err
+			}
+		}
+		for _, booking := range projection.Bookings("") {
+			if err := c.repo.SaveBooking(ctx, booking); err != nil {
+				return err
+			}
+		}
+
+		// the ledger of a user is their household book
+		action, target := auditAction(event.Typ())
+		return c.audit.Record(ctx, &audit.Event{
+			Action:      action,
+			ActorID:     event.UserID(),
+			HouseholdID: event.UserID(),
+			TargetType:  target,
+			TargetID:    event.StreamID(),
+			Before:      before,
+			After:       auditState(projection, event),
+		})
+	})
+	return projection, err
+}
+
+// auditState returns the audited fields of the account or booking the event
+// changes, nil if the projection does not hold it yet.
+func auditState(projection *Projection, event *Event) any {
+	if _, target := auditAction(event.Typ()); target == audit.TargetAccount {
+		account, exists := projection.Account(event.StreamID())
+		if !exists {
+			return nil
+		}
+		state := map[string]any{"name": account.Name(), "currency": account.Waehrung()}
+		if account.IstGeloescht() {
+			state["deleted_at"] = account.GeloeschtAm()
+		}
+		return state
+	}
+
+	booking, exists := projection.Booking(event.StreamID())
+	if !exists {
+		return nil
+	}
+	state := map[string]any{
+		"account_id": booking.KontoID(),
+		"amount":     booking.Betrag(),
+		"text":       booking.Text(),
+		"booked_on":  booking.Buchungsdatum().Format(time.DateOnly),
+		"voided":     booking.IstStorniert(),
+	}
+	if booking.IstStorniert() {
+		state["void_reason"] = booking.StornoGrund()
+	}
+	if booking.IstGeloescht() {
+		state["deleted_at"] = booking.GeloeschtAm()
+	}
+	return state
+}
+
+// auditAction returns the audit action and target type of the event type.
+// Restores and corrections of a booking are recorded as updates.
+func auditAction(typ EventType) (audit.Action, string) {
+	switch typ {
+	case EventAccountOpened:
+		return audit.ActionAccountCreated, audit.TargetAccount
+	case EventAccountDeleted:
+		return audit.ActionAccountDeleted, audit.TargetAccount
+	case EventAccountRestored:
+		return audit.ActionAccountUpdated, audit.TargetAccount
+	case EventBookingCreated:
+		return audit.ActionBookingCreated, audit.TargetBooking
+	case EventBookingDeleted:
+		return audit.ActionBookingDeleted, audit.TargetBooking
+	default:
+		return audit.ActionBookingUpdated, audit.TargetBooking
+	}
+}
+
+// state returns the account and its bookings as they were known at knownAt,
+// replayed from the journal, or the stored projections for a zero knownAt.
+func (c *UseCase) state(ctx context.Context, userID, accountID string, knownAt time.Time) (*Account, []*Booking, error) {
+	if knownAt.IsZero() {
+		account, err := c.account(ctx, userID, accountID)
+		if err != nil {
+			return nil, nil, err
+		}
+		bookings, err := c.repo.FindBookings(ctx, accountID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return account, bookings, nil
+	}
+
+	events, err := c.repo.FindEvents(ctx, userID, knownAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	projection, err := replay(events)
+	if err != nil {
+		return nil, nil, err
+	}
+	account, exists := projection.Account(accountID)
+	if !exists || account.IstGeloescht() {
+		return nil, nil, ErrAccountNotFound
+	}
+	return account, projection.Bookings(accountID), nil
+}
+
+// account returns the account if it belongs to the user and is not in the trash.
+func (c *UseCase) account(ctx context.Context, userID, accountID string) (*Account, error) {
+	account, err := c.repo.FindAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.UserID() != userID || account.IstGeloescht() {
+		return nil, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// trashAccount records the delete or restore event of the account.
+func (c *UseCase) trashAccount(ctx context.Context, account *Account, typ EventType) (*Account, error) {
+	event, err := newEvent(account.ID(), account.Version()+1, typ, account.UserID(), struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	projection, err := c.record(ctx, event, account.ID(), "")
+	if err != nil {
+		return nil, err
+	}
+	account, _ = projection.Account(account.ID())
+	return account, nil
+}
+
+// trashBooking records the delete or restore event of the booking.
+func (c *UseCase) trashBooking(ctx context.Context, booking *Booking, typ EventType) (*Booking, error) {
+	event, err := newEvent(booking.ID(), booking.Version()+1, typ, booking.UserID(), struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	projection, err := c.record(ctx, event, booking.KontoID(), booking.ID())
+	if err != nil {
+		return nil, err
+	}
+	booking, _ = projection.Booking(booking.ID())
+	return booking, nil
+}
+
+// changeableBooking returns the booking of the user if it is still in the read
+// version and not voided.
+func (c *UseCase) changeableBooking(ctx context.Context, userID, bookingID string, version int64) (*Booking, error) {
+	booking, err := c.Booking(ctx, userID, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && version != booking.Version() {
+		return nil, ErrConflict
+	}
+	if booking.IstStorniert() {
+		return nil, ErrBookingVoided
+	}
+	return booking, nil
+}
+
+// replay folds the events into an empty projection.
+func replay(events []*Event) (*Projection, error) {
+	projection := NewProjection(nil, nil)
+	for _, event := range events {
+		if err := projection.Apply(event); err != nil {
+			return nil, err
+		}
+	}
+	return projection, nil
+}
+
+func newEvent(streamID string, version int64, typ EventType, userID string, data any) (*Event, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewEvent(streamID, version, typ, userID, content, time.Now().UTC().Truncate(time.Microsecond)), nil
+}
+
+// day returns the date of t at midnight UTC, booking dates have no time. A zero
+// t means today.
+func day(t time.Time) time.Time {
+	if t.IsZero() {
+		t = time.Now().UTC()
+	}
+	year, month, d := t.Date()
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func validCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func validAmount(amount string) bool {
+	value, ok := parseAmount(amount)
+	return ok && value.Sign() != 0
+}
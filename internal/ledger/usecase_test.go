@@ -0,0 +1,457 @@
+package ledger_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/ledger"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite/sqlitetest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+func newAudit() *audit.UseCase {
+	return audit.NewUseCase(audit.NewInMemoryRepository(), id.UUIDGeneratorFunc(id.GenerateUUID))
+}
+
+func newUseCase() (*ledger.UseCase, *ledger.InMemoryRepository) {
+	repo := ledger.NewInMemoryRepository()
+	return ledger.NewUseCase(repo, transaction.New(nil, repo), id.UUIDGeneratorFunc(id.GenerateUUID), newAudit(), 0), repo
+}
+
+func openAccount(t *testing.T, uc *ledger.UseCase, userID string) *ledger.Account {
+	t.Helper()
+	account, err := uc.OpenAccount(context.Background(), &ledger.OpenAccountInput{UserID: userID, Name: "Girokonto", Currency: "EUR"})
+	require.NoError(t, err)
+	return account
+}
+
+func book(t *testing.T, uc *ledger.UseCase, account *ledger.Account, amount string, bookedOn time.Time) *ledger.Booking {
+	t.Helper()
+	booking, err := uc.CreateBooking(context.Background(), &ledger.CreateBookingInput{UserID: account.UserID(), AccountID: account.ID(), Amount: amount, Text: "Miete", BookedOn: bookedOn})
+	require.NoError(t, err)
+	return booking
+}
+
+func balance(t *testing.T, uc *ledger.UseCase, input *ledger.BalanceInput) string {
+	t.Helper()
+	output, err := uc.Balance(context.Background(), input)
+	require.NoError(t, err)
+	return output.Balance
+}
+
+// mark returns a point in time between the events recorded before and after it.
+func mark() time.Time {
+	time.Sleep(time.Millisecond)
+	defer time.Sleep(time.Millisecond)
+	return time.Now().UTC()
+}
+
+func TestOpenAccount(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     *ledger.OpenAccountInput
+		expectErr error
+	}{
+		{name: "Gültiges Konto", input: &ledger.OpenAccountInput{UserID: "123", Name: " Girokonto ", Currency: "EUR"}},
+		{name: "Leerer Name", input: &ledger.OpenAccountInput{UserID: "123", Name: " ", Currency: "EUR"}, expectErr: ledger.ErrInvalidName},
+		{name: "Kleingeschriebene Währung", input: &ledger.OpenAccountInput{UserID: "123", Name: "Girokonto", Currency: "eur"}, expectErr: ledger.ErrInvalidCurrency},
+		{name: "Ungültige Währung", input: &ledger.OpenAccountInput{UserID: "123", Name: "Girokonto", Currency: "EURO"}, expectErr: ledger.ErrInvalidCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, _ := newUseCase()
+			account, err := uc.OpenAccount(context.Background(), tt.input)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "Girokonto", account.Name())
+			assert.Equal(t, "0", account.Saldo())
+
+			accounts, err := uc.Accounts(context.Background(), "123")
+			require.NoError(t, err)
+			require.Len(t, accounts, 1)
+			assert.Equal(t, account.ID(), accounts[0].ID())
+		})
+	}
+}
+
+func TestCreateBooking(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    string
+		amount    string
+		expectErr error
+	}{
+		{name: "Ausgabe", userID: "123", amount: "-1250"},
+		{name: "Einnahme", userID: "123", amount: "+250000"},
+		{name: "Null", userID: "123", amount: "0", expectErr: ledger.ErrInvalidAmount},
+		{name: "Dezimalzahl", userID: "123", amount: "12.50", expectErr: ledger.ErrInvalidAmount},
+		{name: "Fremdes Konto", userID: "456", amount: "-1250", expectErr: ledger.ErrAccountNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, _ := newUseCase()
+			account := openAccount(t, uc, "123")
+
+			booking, err := uc.CreateBooking(context.Background(), &ledger.CreateBookingInput{UserID: tt.userID, AccountID: account.ID(), Amount: tt.amount, Text: "Miete"})
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				assert.Equal(t, "0", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), booking.Version())
+			assert.False(t, booking.Buchungsdatum().IsZero(), "books on today without a date")
+			output, err := uc.Balance(context.Background(), &ledger.BalanceInput{UserID: "123", AccountID: account.ID()})
+			require.NoError(t, err)
+			assert.Equal(t, booking.Betrag(), output.Balance)
+			assert.Equal(t, "EUR", output.Currency)
+		})
+	}
+}
+
+func TestAmendAndVoidBooking(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newUseCase()
+	account := openAccount(t, uc, "123")
+	booking := book(t, uc, account, "-1000", time.Time{})
+	book(t, uc, account, "5000", time.Time{})
+
+	_, err := uc.AmendBooking(ctx, &ledger.AmendBookingInput{UserID: "456", BookingID: booking.ID(), Amount: "-1200"})
+	assert.ErrorIs(t, err, ledger.ErrBookingNotFound, "booking of another user")
+
+	amended, err := uc.AmendBooking(ctx, &ledger.AmendBookingInput{UserID: "123", BookingID: booking.ID(), Version: 1, Amount: "-1200", Text: "Miete März"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), amended.Version())
+	assert.Equal(t, "Miete März", amended.Text())
+	assert.Equal(t, "3800", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}))
+
+	_, err = uc.AmendBooking(ctx, &ledger.AmendBookingInput{UserID: "123", BookingID: booking.ID(), Version: 1, Amount: "-1300"})
+	assert.ErrorIs(t, err, ledger.ErrConflict, "stale version")
+	_, err = uc.VoidBooking(ctx, &ledger.VoidBookingInput{UserID: "123", BookingID: booking.ID(), Version: 1})
+	assert.ErrorIs(t, err, ledger.ErrConflict, "stale version")
+
+	voided, err := uc.VoidBooking(ctx, &ledger.VoidBookingInput{UserID: "123", BookingID: booking.ID(), Version: 2, Reason: "Doppelt"})
+	require.NoError(t, err)
+	assert.True(t, voided.IstStorniert())
+	assert.Equal(t, "Doppelt", voided.StornoGrund())
+	assert.Equal(t, "5000", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}))
+
+	_, err = uc.VoidBooking(ctx, &ledger.VoidBookingInput{UserID: "123", BookingID: booking.ID()})
+	assert.ErrorIs(t, err, ledger.ErrBookingVoided)
+	_, err = uc.AmendBooking(ctx, &ledger.AmendBookingInput{UserID: "123", BookingID: booking.ID(), Amount: "-1000"})
+	assert.ErrorIs(t, err, ledger.ErrBookingVoided)
+
+	bookings, err := uc.Bookings(ctx, "123", account.ID())
+	require.NoError(t, err)
+	assert.Len(t, bookings, 2, "a voided booking stays listed")
+}
+
+func TestBalanceAtPointInTime(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newUseCase()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	beforeOpening := mark()
+	account := openAccount(t, uc, "123")
+	booking := book(t, uc, account, "100", today.AddDate(0, 0, -1))
+	book(t, uc, account, "10", today)
+	afterCreate := mark()
+	_, err := uc.AmendBooking(ctx, &ledger.AmendBookingInput{UserID: "123", BookingID: booking.ID(), Amount: "300", BookedOn: today.AddDate(0, 0, -1)})
+	require.NoError(t, err)
+	afterAmend := mark()
+	_, err = uc.VoidBooking(ctx, &ledger.VoidBookingInput{UserID: "123", BookingID: booking.ID()})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		asOf     time.Time
+		knownAt  time.Time
+		expected string
+	}{
+		{name: "Aktuell", expected: "10"},
+		{name: "Vor der Änderung", knownAt: afterCreate, expected: "110"},
+		{name: "Vor dem Storno", knownAt: afterAmend, expected: "310"},
+		{name: "Stichtag gestern vor dem Storno", asOf: today.AddDate(0, 0, -1), knownAt: afterAmend, expected: "300"},
+		{name: "Stichtag vorgestern", asOf: today.AddDate(0, 0, -2), knownAt: afterAmend, expected: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID(), AsOf: tt.asOf, KnownAt: tt.knownAt}))
+		})
+	}
+
+	_, err = uc.Balance(ctx, &ledger.BalanceInput{UserID: "123", AccountID: account.ID(), KnownAt: beforeOpening})
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound, "the account was not known yet")
+	_, err = uc.Balance(ctx, &ledger.BalanceInput{UserID: "456", AccountID: account.ID(), KnownAt: afterAmend})
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound, "account of another user")
+}
+
+func TestReport(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newUseCase()
+	march := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	account := openAccount(t, uc, "123")
+	book(t, uc, account, "250000", march)
+	book(t, uc, account, "-90000", march.AddDate(0, 0, 2))
+	book(t, uc, account, "-1250", march.AddDate(0, 1, 0))
+	voided := book(t, uc, account, "-5000", march.AddDate(0, 0, 3))
+	_, err := uc.VoidBooking(ctx, &ledger.VoidBookingInput{UserID: "123", BookingID: voided.ID()})
+	require.NoError(t, err)
+
+	output, err := uc.Report(ctx, &ledger.ReportInput{UserID: "123", AccountID: account.ID(), From: march, To: march.AddDate(0, 1, -1)})
+	require.NoError(t, err)
+	assert.Equal(t, "250000", output.Income)
+	assert.Equal(t, "-90000", output.Expenses)
+	assert.Equal(t, "160000", output.Net)
+	assert.Equal(t, 2, output.Bookings, "voided bookings and other months are left out")
+
+	_, err = uc.Report(ctx, &ledger.ReportInput{UserID: "123", AccountID: account.ID(), From: march, To: march.AddDate(0, 0, -1)})
+	assert.ErrorIs(t, err, ledger.ErrInvalidPeriod)
+}
+
+func TestRebuild(t *testing.T) {
+	ctx := context.Background()
+	uc, repo := newUseCase()
+	account := openAccount(t, uc, "123")
+	booking := book(t, uc, account, "-1000", time.Time{})
+	book(t, uc, account, "5000", time.Time{})
+	_, err := uc.AmendBooking(ctx, &ledger.AmendBookingInput{UserID: "123", BookingID: booking.ID(), Amount: "-2000"})
+	require.NoError(t, err)
+	require.NoError(t, repo.ReplaceProjections(ctx, nil, nil))
+
+	_, err = uc.Balance(ctx, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()})
+	require.ErrorIs(t, err, ledger.ErrAccountNotFound)
+	output, err := uc.Rebuild(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &ledger.RebuildOutput{Events: 4, Accounts: 1, Bookings: 2}, output)
+	assert.Equal(t, "3000", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}))
+	rebuilt, err := uc.Booking(ctx, "123", booking.ID())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), rebuilt.Version())
+}
+
+func TestConcurrentBookings(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T) *ledger.UseCase
+	}{
+		{name: "Arbeitsspeicher", setup: func(t *testing.T) *ledger.UseCase {
+			uc, _ := newUseCase()
+			return uc
+		}},
+		{name: "SQLite", setup: func(t *testing.T) *ledger.UseCase {
+			db := sqlitetest.Open(t)
+			return ledger.NewUseCase(ledger.NewSQLiteRepository(db), transaction.New(db), id.UUIDGeneratorFunc(id.GenerateUUID), audit.NewUseCase(audit.NewSQLiteRepository(db), id.UUIDGeneratorFunc(id.GenerateUUID)), 0)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := tt.setup(t)
+			account := openAccount(t, uc, "123")
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := uc.CreateBooking(context.Background(), &ledger.CreateBookingInput{UserID: "123", AccountID: account.ID(), Amount: "1"})
+					assert.NoError(t, err)
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, "10", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}), "no balance change is lost")
+		})
+	}
+}
+
+func TestExportTables(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newUseCase()
+	account := openAccount(t, uc, "123")
+	book(t, uc, account, "-1000", time.Time{})
+	openAccount(t, uc, "456")
+
+	tables, err := uc.ExportTables(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, tables, 3)
+	assert.Equal(t, "accounts", tables[0].Name)
+	assert.Len(t, tables[0].Rows, 1)
+	assert.Equal(t, "bookings", tables[1].Name)
+	assert.Len(t, tables[1].Rows, 1)
+	assert.Equal(t, "journal", tables[2].Name)
+	assert.Len(t, tables[2].Rows, 2)
+
+	require.NoError(t, uc.DeleteUserData(ctx, "123"))
+	tables, err = uc.ExportTables(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, tables[2].Rows)
+}
+
+func TestTrash(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newUseCase()
+	account := openAccount(t, uc, "123")
+	booking := book(t, uc, account, "-1000", time.Time{})
+	book(t, uc, account, "5000", time.Time{})
+
+	_, err := uc.DeleteBooking(ctx, &ledger.DeleteBookingInput{UserID: "123", BookingID: booking.ID(), Version: 2})
+	assert.ErrorIs(t, err, ledger.ErrConflict, "stale version")
+	_, err = uc.DeleteBooking(ctx, &ledger.DeleteBookingInput{UserID: "456", BookingID: booking.ID()})
+	assert.ErrorIs(t, err, ledger.ErrBookingNotFound, "booking of another user")
+
+	deleted, err := uc.DeleteBooking(ctx, &ledger.DeleteBookingInput{UserID: "123", BookingID: booking.ID(), Version: 1})
+	require.NoError(t, err)
+	assert.True(t, deleted.IstGeloescht())
+	assert.Equal(t, "5000", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}))
+	_, err = uc.Booking(ctx, "123", booking.ID())
+	assert.ErrorIs(t, err, ledger.ErrBookingNotFound)
+	bookings, err := uc.Bookings(ctx, "123", account.ID())
+	require.NoError(t, err)
+	assert.Len(t, bookings, 1)
+	trash, err := uc.Trash(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, trash.Accounts)
+	require.Len(t, trash.Bookings, 1)
+	assert.Equal(t, booking.ID(), trash.Bookings[0].ID())
+
+	_, err = uc.DeleteAccount(ctx, &ledger.DeleteAccountInput{UserID: "123", AccountID: account.ID(), Version: 2})
+	assert.ErrorIs(t, err, ledger.ErrConflict, "stale version")
+	_, err = uc.DeleteAccount(ctx, &ledger.DeleteAccountInput{UserID: "123", AccountID: account.ID(), Version: 1})
+	require.NoError(t, err)
+	accounts, err := uc.Accounts(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, accounts)
+	_, err = uc.Balance(ctx, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()})
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound)
+	_, err = uc.RestoreBooking(ctx, "123", booking.ID())
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound, "the account has to be restored first")
+	trash, err = uc.Trash(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, trash.Accounts, 1)
+	assert.Empty(t, trash.Bookings, "the bookings of a deleted account go with it")
+
+	_, err = uc.RestoreAccount(ctx, "456", account.ID())
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound, "account of another user")
+	restored, err := uc.RestoreAccount(ctx, "123", account.ID())
+	require.NoError(t, err)
+	assert.False(t, restored.IstGeloescht())
+	_, err = uc.RestoreAccount(ctx, "123", account.ID())
+	assert.ErrorIs(t, err, ledger.ErrAccountNotFound, "not in the trash")
+	_, err = uc.RestoreBooking(ctx, "123", booking.ID())
+	require.NoError(t, err)
+	assert.Equal(t, "4000", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}))
+
+	output, err := uc.Rebuild(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, output.Accounts)
+	assert.Equal(t, "4000", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}), "the trash events replay")
+}
+
+func TestPurgeTrash(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		purged    int
+		kept      int
+	}{
+		{name: "Aufbewahrungsfrist läuft", retention: time.Hour, purged: 0, kept: 1},
+		{name: "Aufbewahrungsfrist abgelaufen", retention: 0, purged: 2, kept: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := ledger.NewInMemoryRepository()
+			uc := ledger.NewUseCase(repo, transaction.New(nil, repo), id.UUIDGeneratorFunc(id.GenerateUUID), newAudit(), tt.retention)
+			account := openAccount(t, uc, "123")
+			deleted := book(t, uc, account, "-1000", time.Time{})
+			book(t, uc, account, "5000", time.Time{})
+			other := openAccount(t, uc, "123")
+			_, err := uc.DeleteBooking(ctx, &ledger.DeleteBookingInput{UserID: "123", BookingID: deleted.ID()})
+			require.NoError(t, err)
+			_, err = uc.DeleteAccount(ctx, &ledger.DeleteAccountInput{UserID: "123", AccountID: other.ID()})
+			require.NoError(t, err)
+			time.Sleep(time.Millisecond)
+
+			purged, err := uc.PurgeTrash(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.purged, purged)
+			trash, err := uc.Trash(ctx, "123")
+			require.NoError(t, err)
+			assert.Len(t, trash.Accounts, tt.kept)
+			assert.Len(t, trash.Bookings, tt.kept)
+			assert.Equal(t, tt.retention, trash.Retention)
+
+			_, err = uc.Rebuild(ctx)
+			require.NoError(t, err, "the journal stays consistent without the purged streams")
+			assert.Equal(t, "5000", balance(t, uc, &ledger.BalanceInput{UserID: "123", AccountID: account.ID()}))
+		})
+	}
+}
+
+type failingAudit struct{}
+
+func (failingAudit) Record(context.Context, *audit.Event) error {
+	return errors.New("audit log unavailable")
+}
+
+func TestAuditTrail(t *testing.T) {
+	ctx := context.Background()
+	repo, audits := ledger.NewInMemoryRepository(), audit.NewInMemoryRepository()
+	uc := ledger.NewUseCase(repo, transaction.New(nil, repo, audits), id.UUIDGeneratorFunc(id.GenerateUUID), audit.NewUseCase(audits, id.UUIDGeneratorFunc(id.GenerateUUID)), time.Hour)
+
+	account := openAccount(t, uc, "123")
+	booking := book(t, uc, account, "-1000", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	_, err := uc.AmendBooking(ctx, &ledger.AmendBookingInput{UserID: "123", BookingID: booking.ID(), Amount: "-1200", Text: "Miete", BookedOn: booking.Buchungsdatum()})
+	require.NoError(t, err)
+	_, err = uc.DeleteAccount(ctx, &ledger.DeleteAccountInput{UserID: "123", AccountID: account.ID()})
+	require.NoError(t, err)
+
+	entries, err := audits.FindAllEntries(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	tests := []struct {
+		action audit.Action
+		target string
+		id     string
+		before string
+		after  string
+	}{
+		{action: audit.ActionAccountCreated, target: audit.TargetAccount, id: account.ID(), after: `{"currency":"EUR","name":"Girokonto"}`},
+		{action: audit.ActionBookingCreated, target: audit.TargetBooking, id: booking.ID(), after: `{"account_id":"` + account.ID() + `","amount":"-1000","booked_on":"2024-03-01","text":"Miete","voided":false}`},
+		{action: audit.ActionBookingUpdated, target: audit.TargetBooking, id: booking.ID(), before: `{"account_id":"` + account.ID() + `","amount":"-1000","booked_on":"2024-03-01","text":"Miete","voided":false}`, after: `{"account_id":"` + account.ID() + `","amount":"-1200","booked_on":"2024-03-01","text":"Miete","voided":false}`},
+		{action: audit.ActionAccountDeleted, target: audit.TargetAccount, id: account.ID(), before: `{"currency":"EUR","name":"Girokonto"}`},
+	}
+	for i, tt := range tests {
+		entry := entries[i]
+		assert.Equal(t, tt.action, entry.Aktion())
+		assert.Equal(t, "123", entry.AkteurID())
+		assert.Equal(t, "123", entry.HaushaltID())
+		assert.Equal(t, tt.target, entry.ZielTyp())
+		assert.Equal(t, tt.id, entry.ZielID())
+		if tt.before == "" {
+			assert.Nil(t, entry.Vorher())
+		} else {
+			assert.JSONEq(t, tt.before, string(entry.Vorher()))
+		}
+		if tt.after != "" {
+			assert.JSONEq(t, tt.after, string(entry.Nachher()))
+		}
+	}
+	assert.Contains(t, string(entries[3].Nachher()), "deleted_at")
+
+	failing := ledger.NewUseCase(repo, transaction.New(nil, repo, audits), id.UUIDGeneratorFunc(id.GenerateUUID), failingAudit{}, time.Hour)
+	_, err = failing.OpenAccount(ctx, &ledger.OpenAccountInput{UserID: "456", Name: "Sparkonto", Currency: "EUR"})
+	require.Error(t, err)
+	accounts, err := uc.Accounts(ctx, "456")
+	require.NoError(t, err)
+	assert.Empty(t, accounts, "without the audit entry the account must not be opened")
+}
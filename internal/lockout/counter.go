@@ -0,0 +1,52 @@
+package lockout
+
+import (
+	"time"
+)
+
+// Counter zählt die fehlgeschlagenen Anmeldeversuche eines Accounts oder einer IP.
+type Counter struct {
+	fehlversuche  int
+	letzterFehler time.Time
+	gesperrtBis   time.Time
+}
+
+// NewCounter erzeugt einen Zähler mit expliziten Parametern.
+func NewCounter(fehlversuche int, letzterFehler, gesperrtBis time.Time) *Counter {
+	return &Counter{
+		fehlversuche:  fehlversuche,
+		letzterFehler: letzterFehler,
+		gesperrtBis:   gesperrtBis,
+	}
+}
+
+// Fehlversuche gibt die Anzahl der Fehlversuche zurück.
+func (c *Counter) Fehlversuche() int {
+	return c.fehlversuche
+}
+
+// LetzterFehler gibt den Zeitpunkt des letzten Fehlversuchs zurück.
+func (c *Counter) LetzterFehler() time.Time {
+	return c.letzterFehler
+}
+
+// GesperrtBis gibt das Ende der Sperre zurück. Ohne Sperre ist der Zeitpunkt leer.
+func (c *Counter) GesperrtBis() time.Time {
+	return c.gesperrtBis
+}
+
+// IstGesperrt gibt zurück, ob die Sperre zum Zeitpunkt now besteht.
+func (c *Counter) IstGesperrt(now time.Time) bool {
+	return c.gesperrtBis.After(now)
+}
+
+// Fehlgeschlagen zählt einen Fehlversuch zum Zeitpunkt at.
+func (c *Counter) Fehlgeschlagen(at time.Time) {
+	c.fehlversuche++
+	c.letzterFehler = at
+}
+
+// Gesperrt sperrt bis zum Zeitpunkt until.
+func (c *Counter) Gesperrt(until time.Time) {
+	c.gesperrtBis = until
+}
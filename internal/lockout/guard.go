@@ -0,0 +1,151 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ipFailureFactor scales the account limit for IP addresses, which are shared by
+	// every user of a household network
+	ipFailureFactor = 4
+	maxDelay        = time.Minute
+	// resetAfter forgets failures that lie further back
+	resetAfter = 24 * time.Hour
+)
+
+// ErrLocked is returned when an account or IP has to wait before the next attempt
+var ErrLocked = errors.New("Too many failed login attempts")
+
+// LockedError carries the time until the next login attempt is accepted.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v. Retry in %s", ErrLocked, e.RetryAfter.Round(time.Second))
+}
+
+// Is reports whether target is ErrLocked.
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+type store interface {
+	FindCounter(ctx context.Context, key string) (*Counter, error)
+	UpdateCounter(ctx context.Context, key string, update func(*Counter)) (*Counter, error)
+	DeleteCounter(ctx context.Context, key string) error
+}
+
+// Guard throttles login attempts per account and per IP. Every failure doubles the
+// wait before the next attempt, after maxFailures the key is locked for lockoutDuration.
+type Guard struct {
+	store           store
+	maxFailures     int
+	baseDelay       time.Duration
+	lockoutDuration time.Duration
+}
+
+// NewGuard creates a new Guard.
+func NewGuard(store store, maxFailures int, baseDelay, lockoutDuration time.Duration) *Guard {
+	return &Guard{
+		store:           store,
+		maxFailures:     maxFailures,
+		baseDelay:       baseDelay,
+		lockoutDuration: lockoutDuration,
+	}
+}
+
+// Check returns a LockedError if the account or the IP must not try to log in yet.
+func (g *Guard) Check(ctx context.Context, account, ip string) error {
+	now := time.Now().UTC()
+	var wait time.Duration
+	for _, key := range []string{accountKey(account), ipKey(ip)} {
+		counter, err := g.store.FindCounter(ctx, key)
+		if err != nil {
+			return err
+		}
+		wait = max(wait, g.retryAfter(counter, now))
+	}
+	if wait > 0 {
+		return &LockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt for the account and the IP. It reports
+// whether the account got locked by this attempt.
+func (g *Guard) RecordFailure(ctx context.Context, account, ip string) (bool, error) {
+	now := time.Now().UTC()
+	if _, err := g.store.UpdateCounter(ctx, ipKey(ip), g.fail(now, g.maxFailures*ipFailureFactor)); err != nil {
+		return false, err
+	}
+	counter, err := g.store.UpdateCounter(ctx, accountKey(account), g.fail(now, g.maxFailures))
+	if err != nil {
+		return false, err
+	}
+	return counter.Fehlversuche() == g.maxFailures, nil
+}
+
+// RecordSuccess resets the failures of the account. The IP counter is kept, so a
+// valid login does not clear failures against other accounts.
+func (g *Guard) RecordSuccess(ctx context.Context, account string) error {
+	return g.store.DeleteCounter(ctx, accountKey(account))
+}
+
+// Unlock lifts the lock of an account.
+func (g *Guard) Unlock(ctx context.Context, account string) error {
+	return g.store.DeleteCounter(ctx, accountKey(account))
+}
+
+// fail returns the update for a failed attempt. Stale counters and expired locks start over.
+func (g *Guard) fail(now time.Time, limit int) func(*Counter) {
+	return func(counter *Counter) {
+		expired := !counter.GesperrtBis().IsZero() && !counter.IstGesperrt(now)
+		if expired || now.Sub(counter.LetzterFehler()) > resetAfter {
+			*counter = Counter{}
+		}
+		counter.Fehlgeschlagen(now)
+		if counter.Fehlversuche() >= limit {
+			counter.Gesperrt(now.Add(g.lockoutDuration))
+		}
+	}
+}
+
+// retryAfter returns how long the counter blocks further attempts.
+func (g *Guard) retryAfter(counter *Counter, now time.Time) time.Duration {
+	if counter.IstGesperrt(now) {
+		return counter.GesperrtBis().Sub(now)
+	}
+	if counter.Fehlversuche() == 0 || !counter.GesperrtBis().IsZero() {
+		return 0
+	}
+	next := counter.LetzterFehler().Add(g.Delay(counter.Fehlversuche()))
+	if next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// Delay returns the wait after the given number of failures.
+func (g *Guard) Delay(failures int) time.Duration {
+	delay := g.baseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return delay
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
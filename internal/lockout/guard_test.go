@@ -0,0 +1,77 @@
+package lockout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/lockout"
+)
+
+func TestDelay(t *testing.T) {
+	g := lockout.NewGuard(lockout.NewInMemoryStore(), 5, time.Second, time.Minute)
+	tests := []struct {
+		name     string
+		failures int
+		expect   time.Duration
+	}{
+		{name: "Erster Fehlversuch", failures: 1, expect: time.Second},
+		{name: "Dritter Fehlversuch", failures: 3, expect: 4 * time.Second},
+		{name: "Obergrenze", failures: 20, expect: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, g.Delay(tt.failures))
+		})
+	}
+}
+
+func TestProgressiveDelay(t *testing.T) {
+	ctx := context.Background()
+	g := lockout.NewGuard(lockout.NewInMemoryStore(), 5, time.Hour, time.Hour)
+
+	assert.NoError(t, g.Check(ctx, "max@example.com", "10.0.0.1"))
+	_, err := g.RecordFailure(ctx, "max@example.com", "10.0.0.1")
+	assert.NoError(t, err)
+
+	err = g.Check(ctx, "MAX@example.com", "10.0.0.2")
+	assert.ErrorIs(t, err, lockout.ErrLocked, "account is throttled regardless of IP and case")
+	err = g.Check(ctx, "other@example.com", "10.0.0.1")
+	assert.ErrorIs(t, err, lockout.ErrLocked, "IP is throttled regardless of account")
+	assert.NoError(t, g.Check(ctx, "other@example.com", "10.0.0.2"))
+}
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	g := lockout.NewGuard(lockout.NewInMemoryStore(), 3, 0, time.Hour)
+
+	for i := 1; i <= 3; i++ {
+		locked, err := g.RecordFailure(ctx, "max@example.com", "10.0.0.1")
+		assert.NoError(t, err)
+		assert.Equal(t, i == 3, locked, "account is locked with the third failure")
+	}
+
+	err := g.Check(ctx, "max@example.com", "10.0.0.2")
+	var lockedErr *lockout.LockedError
+	assert.ErrorAs(t, err, &lockedErr)
+	assert.Greater(t, lockedErr.RetryAfter, 59*time.Minute)
+
+	assert.NoError(t, g.Unlock(ctx, "max@example.com"))
+	assert.NoError(t, g.Check(ctx, "max@example.com", "10.0.0.2"))
+}
+
+func TestRecordSuccess(t *testing.T) {
+	ctx := context.Background()
+	g := lockout.NewGuard(lockout.NewInMemoryStore(), 3, 0, time.Hour)
+
+	for range 2 {
+		_, err := g.RecordFailure(ctx, "max@example.com", "10.0.0.1")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, g.RecordSuccess(ctx, "max@example.com"))
+
+	locked, err := g.RecordFailure(ctx, "max@example.com", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.False(t, locked, "success resets the account counter")
+}
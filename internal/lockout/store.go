@@ -0,0 +1,88 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// minPruneAt is the number of counters from which UpdateCounter prunes the store
+const minPruneAt = 1024
+
+// InMemoryStore implements the counter store with an in-memory map. Counters that
+// no longer throttle are pruned once the map doubled since the last pruning, so
+// the map does not grow with every key that ever failed.
+type InMemoryStore struct {
+	counters map[string]Counter
+	pruneAt  int
+	mutex    sync.Mutex
+}
+
+// NewInMemoryStore creates a new InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		counters: make(map[string]Counter),
+		pruneAt:  minPruneAt,
+	}
+}
+
+// FindCounter returns the counter for the key. Unknown keys return an empty counter.
+func (s *InMemoryStore) FindCounter(ctx context.Context, key string) (*Counter, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		counter := s.counters[key]
+		return &counter, nil
+	}
+}
+
+// UpdateCounter atomically applies update to the counter of the key and returns the result.
+func (s *InMemoryStore) UpdateCounter(ctx context.Context, key string, update func(*Counter)) (*Counter, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		counter := s.counters[key]
+		update(&counter)
+		s.counters[key] = counter
+		if len(s.counters) >= s.pruneAt {
+			s.prune(time.Now().UTC())
+			s.pruneAt = max(minPruneAt, 2*len(s.counters))
+		}
+		return &counter, nil
+	}
+}
+
+// DeleteCounter removes the counter of the key.
+func (s *InMemoryStore) DeleteCounter(ctx context.Context, key string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		delete(s.counters, key)
+		return nil
+	}
+}
+
+// prune removes the counters whose lock has expired or whose last failure lies
+// further back than resetAfter. The Guard would start them over anyway.
+func (s *InMemoryStore) prune(now time.Time) {
+	for key, counter := range s.counters {
+		if counter.IstGesperrt(now) {
+			continue
+		}
+		if !counter.GesperrtBis().IsZero() || now.Sub(counter.LetzterFehler()) > resetAfter {
+			delete(s.counters, key)
+		}
+	}
+}
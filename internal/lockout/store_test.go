@@ -0,0 +1,34 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryStorePrunesStaleCounters(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	s := NewInMemoryStore()
+	set := func(key string, counter *Counter) {
+		t.Helper()
+		_, err := s.UpdateCounter(ctx, key, func(c *Counter) { *c = *counter })
+		require.NoError(t, err)
+	}
+
+	set("gesperrt", NewCounter(5, now.Add(-2*resetAfter), now.Add(time.Hour)))
+	set("aktuell", NewCounter(1, now, time.Time{}))
+	set("abgelaufen", NewCounter(5, now, now.Add(-time.Minute)))
+	for i := len(s.counters); i < minPruneAt; i++ {
+		set(fmt.Sprintf("veraltet-%d", i), NewCounter(1, now.Add(-2*resetAfter), time.Time{}))
+	}
+
+	assert.Len(t, s.counters, 2)
+	assert.Contains(t, s.counters, "gesperrt")
+	assert.Contains(t, s.counters, "aktuell")
+	assert.Equal(t, minPruneAt, s.pruneAt)
+}
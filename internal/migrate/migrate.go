@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidFileName is returned when a migration file is not named <version>_<name>.sql
+	ErrInvalidFileName = errors.New("Invalid migration file name")
+	// ErrDuplicateVersion is returned when two migration files share a version
+	ErrDuplicateVersion = errors.New("Duplicate migration version")
+	// ErrUnknownVersion is returned when the database was migrated by a newer release
+	ErrUnknownVersion = errors.New("Database schema is newer than the migrations")
+)
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// Migration is a versioned SQL script. The files are named <version>_<name>.sql,
+// e.g. 0001_create_users.sql, and applied in the order of their version.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Load reads the migrations from the directory of the file system, usually an
+// embed.FS, sorted by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	versions := make(map[int]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		version, name, err := parseFileName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if other, exists := versions[version]; exists {
+			return nil, fmt.Errorf("%w: %s and %s", ErrDuplicateVersion, other, entry.Name())
+		}
+		versions[version] = entry.Name()
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(content)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func parseFileName(fileName string) (int, string, error) {
+	prefix, name, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), "_")
+	if !ok || name == "" {
+		return 0, "", fmt.Errorf("%w: %s", ErrInvalidFileName, fileName)
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil || version <= 0 {
+		return 0, "", fmt.Errorf("%w: %s", ErrInvalidFileName, fileName)
+	}
+	return version, name, nil
+}
+
+// Migrator applies migrations to a database and records every applied version
+// in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a new Migrator with the migrations of the directory.
+func New(db *sql.DB, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the version of the newest migration.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the newest version applied to the database, 0 if none.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	if _, err := m.db.ExecContext(ctx, createTable); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Up applies every pending migration in its own transaction and returns how many
+// were applied. A second instance migrating at the same time fails on the primary
+// key of schema_migrations and rolls back instead of applying a script twice.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if current > m.Latest() {
+		return 0, fmt.Errorf("%w: database at %d, latest migration %d", ErrUnknownVersion, current, m.Latest())
+	}
+
+	applied := 0
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err := m.apply(ctx, migration); err != nil {
+			return applied, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		migration.Version, migration.Name, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package migrate_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/migrate"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       fstest.MapFS
+		expectErr   error
+		expectNames []string
+	}{
+		{
+			name: "Sortiert nach Version",
+			files: fstest.MapFS{
+				"sql/0010_add_index.sql":    {Data: []byte("CREATE INDEX")},
+				"sql/0002_create_users.sql": {Data: []byte("CREATE TABLE")},
+				"sql/README.md":             {Data: []byte("ignored")},
+			},
+			expectNames: []string{"create_users", "add_index"},
+		},
+		{
+			name:      "Ohne Version",
+			files:     fstest.MapFS{"sql/create_users.sql": {Data: []byte("CREATE TABLE")}},
+			expectErr: migrate.ErrInvalidFileName,
+		},
+		{
+			name:      "Ohne Namen",
+			files:     fstest.MapFS{"sql/0001.sql": {Data: []byte("CREATE TABLE")}},
+			expectErr: migrate.ErrInvalidFileName,
+		},
+		{
+			name: "Doppelte Version",
+			files: fstest.MapFS{
+				"sql/0001_create_users.sql": {Data: []byte("CREATE TABLE")},
+				"sql/1_create_sessions.sql": {Data: []byte("CREATE TABLE")},
+			},
+			expectErr: migrate.ErrDuplicateVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := migrate.Load(tt.files, "sql")
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			names := make([]string, 0, len(migrations))
+			for _, migration := range migrations {
+				names = append(names, migration.Name)
+			}
+			assert.Equal(t, tt.expectNames, names)
+		})
+	}
+}
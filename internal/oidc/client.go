@@ -0,0 +1,303 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	pendingLoginExpire = 10 * time.Minute
+	httpTimeout        = 10 * time.Second
+)
+
+var (
+	// ErrNotConfigured is returned when no OIDC provider is configured
+	ErrNotConfigured = errors.New("OIDC login is not configured")
+	// ErrInvalidState is returned when the state of a callback is unknown, used or expired
+	ErrInvalidState = errors.New("Invalid OIDC state")
+	// ErrInvalidIDToken is returned when the ID token of the provider can not be verified
+	ErrInvalidIDToken = errors.New("Invalid ID token")
+	// ErrProvider is returned when the provider answers with an error
+	ErrProvider = errors.New("OIDC provider error")
+)
+
+// Identity is the verified identity of the ID token.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type pendingLogin struct {
+	nonce      string
+	verifier   string
+	laeuftAbAm time.Time
+}
+
+// Client signs users in with the authorization code flow and PKCE. The provider
+// metadata is discovered on first use, so a provider outage does not stop the server.
+type Client struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	httpClient   *http.Client
+
+	mutex    sync.Mutex
+	provider *discovery
+	keys     map[string]any
+	pending  map[string]pendingLogin
+}
+
+// NewClient creates a new Client. An empty issuer disables OIDC login.
+func NewClient(issuer, clientID, clientSecret, redirectURL string, scopes []string) *Client {
+	return &Client{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: httpTimeout},
+		pending:      make(map[string]pendingLogin),
+	}
+}
+
+// Issuer returns the issuer of the provider. Together with the subject it
+// identifies an external account.
+func (c *Client) Issuer() string {
+	return c.issuer
+}
+
+// AuthCodeURL starts a login and returns the URL of the provider the browser has
+// to visit. State, nonce and PKCE verifier are kept until the callback.
+func (c *Client) AuthCodeURL(ctx context.Context) (string, string, error) {
+	if c.issuer == "" {
+		return "", "", ErrNotConfigured
+	}
+	provider, err := c.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now().UTC()
+	c.mutex.Lock()
+	for key, login := range c.pending {
+		if now.After(login.laeuftAbAm) {
+			delete(c.pending, key)
+		}
+	}
+	c.pending[state] = pendingLogin{nonce: nonce, verifier: verifier, laeuftAbAm: now.Add(pendingLoginExpire)}
+	c.mutex.Unlock()
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.clientID},
+		"redirect_uri":          {c.redirectURL},
+		"scope":                 {strings.Join(c.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return provider.AuthorizationEndpoint + separator + query.Encode(), state, nil
+}
+
+// Exchange redeems the code of the callback and verifies the ID token. Every state
+// can be used once.
+func (c *Client) Exchange(ctx context.Context, state, code string) (*Identity, error) {
+	if c.issuer == "" {
+		return nil, ErrNotConfigured
+	}
+	c.mutex.Lock()
+	login, ok := c.pending[state]
+	delete(c.pending, state)
+	c.mutex.Unlock()
+	if !ok || time.Now().UTC().After(login.laeuftAbAm) {
+		return nil, ErrInvalidState
+	}
+
+	provider, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.redirectURL},
+		"code_verifier": {login.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := c.do(req, &token); err != nil {
+		return nil, err
+	}
+	return c.verify(ctx, token.IDToken, login.nonce)
+}
+
+// verify checks signature, issuer, audience, expiry and nonce of the ID token.
+func (c *Client) verify(ctx context.Context, idToken, nonce string) (*Identity, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(c.issuer),
+		jwt.WithAudience(c.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	token, err := parser.Parse(idToken, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%w: subject missing", ErrInvalidIDToken)
+	}
+
+	identity := &Identity{Issuer: c.issuer, Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.GivenName, _ = claims["given_name"].(string)
+	identity.FamilyName, _ = claims["family_name"].(string)
+	return identity, nil
+}
+
+// key returns the verification key with the kid. Unknown kids refetch the JWKS
+// once, so a key rotation of the provider is picked up.
+func (c *Client) key(ctx context.Context, kid string) (any, error) {
+	c.mutex.Lock()
+	key, ok := c.keys[kid]
+	c.mutex.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	provider, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jwks
+	if err := c.do(req, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		publicKey, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.KeyID] = publicKey
+	}
+	c.mutex.Lock()
+	c.keys = keys
+	c.mutex.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// discover loads the provider metadata and caches it after the first success.
+func (c *Client) discover(ctx context.Context) (*discovery, error) {
+	c.mutex.Lock()
+	provider := c.provider
+	c.mutex.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	provider = &discovery{}
+	if err := c.do(req, provider); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != c.issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrProvider, provider.Issuer, c.issuer)
+	}
+
+	c.mutex.Lock()
+	c.provider = provider
+	c.mutex.Unlock()
+	return provider, nil
+}
+
+func (c *Client) do(req *http.Request, target any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s %s: %d %s", ErrProvider, req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/presenter"
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+type usecase interface {
+	Messages(context.Context, Status) ([]*Message, error)
+	RetryMessage(context.Context, string) error
+}
+
+// Controller is the controller for the outbox admin endpoints.
+type Controller struct {
+	log     logger.Logger
+	usecase usecase
+}
+
+// NewController creates a new controller for the outbox usecase.
+func NewController(log logger.Logger, usecase usecase) *Controller {
+	return &Controller{
+		log:     log,
+		usecase: usecase,
+	}
+}
+
+// MessageResponse is a serializable struct for an outbox message.
+type MessageResponse struct {
+	ID          string    `json:"id"`
+	To          string    `json:"to"`
+	Subject     string    `json:"subject"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ListMessages handles the request to inspect the outbox. The optional query
+// parameter status filters by delivery status.
+func (c *Controller) ListMessages(w http.ResponseWriter, r *http.Request) {
+	messages, err := c.usecase.Messages(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		switch err {
+		case ErrInvalidStatus:
+			c.log.Error(fmt.Sprintf("invalid status filter. %v", err))
+			http.Error(w, "invalid status", http.StatusBadRequest)
+		default:
+			c.log.Error(fmt.Sprintf("failed to list outbox messages. %v", err))
+			http.Error(w, "failed to list outbox messages", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := make([]MessageResponse, 0, len(messages))
+	for _, message := range messages {
+		response = append(response, MessageResponse{
+			ID:          message.ID(),
+			To:          message.Empfaenger(),
+			Subject:     message.Betreff(),
+			Status:      message.Status(),
+			Attempts:    message.Versuche(),
+			LastError:   message.LetzterFehler(),
+			NextAttempt: message.NaechsterVersuch(),
+			CreatedAt:   message.ErstelltAm(),
+			UpdatedAt:   message.AktualisiertAm(),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// RetryMessage handles the request to redeliver a failed or dead message.
+func (c *Controller) RetryMessage(w http.ResponseWriter, r *http.Request) {
+	if err := c.usecase.RetryMessage(r.Context(), r.PathValue("id")); err != nil {
+		switch err {
+		case ErrMessageNotFound:
+			c.log.Error("outbox message not found")
+			http.Error(w, "message not found", http.StatusNotFound)
+		case ErrMessageAlreadySent:
+			c.log.Error("outbox message already sent")
+			http.Error(w, "message already sent", http.StatusConflict)
+		default:
+			c.log.Error(fmt.Sprintf("failed to retry outbox message. %v", err))
+			http.Error(w, "failed to retry message", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
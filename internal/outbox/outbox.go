@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"time"
+)
+
+// Status repräsentiert den Zustellstatus einer Nachricht.
+type Status = string
+
+const (
+	// StatusPending markiert eine Nachricht, die noch zugestellt werden muss.
+	StatusPending Status = "pending"
+	// StatusSent markiert eine erfolgreich zugestellte Nachricht.
+	StatusSent Status = "sent"
+	// StatusDead markiert eine Nachricht, deren Zustellung endgültig fehlgeschlagen ist.
+	StatusDead Status = "dead"
+)
+
+// Message repräsentiert eine E-Mail in der Outbox.
+type Message struct {
+	iD               string
+	empfaenger       string
+	betreff          string
+	inhalt           string
+	status           Status
+	versuche         int
+	letzterFehler    string
+	naechsterVersuch time.Time
+	erstelltAm       time.Time
+	aktualisiertAm   time.Time
+}
+
+// NewMessage erzeugt eine neue, sofort zustellbare Nachricht.
+func NewMessage(id, empfaenger, betreff, inhalt string, erstelltAm time.Time) *Message {
+	return &Message{
+		iD:               id,
+		empfaenger:       empfaenger,
+		betreff:          betreff,
+		inhalt:           inhalt,
+		status:           StatusPending,
+		naechsterVersuch: erstelltAm,
+		erstelltAm:       erstelltAm,
+		aktualisiertAm:   erstelltAm,
+	}
+}
+
+// ID gibt die ID der Nachricht zurück.
+func (m *Message) ID() string {
+	return m.iD
+}
+
+// Empfaenger gibt die Empfängeradresse zurück.
+func (m *Message) Empfaenger() string {
+	return m.empfaenger
+}
+
+// Betreff gibt den Betreff der Nachricht zurück.
+func (m *Message) Betreff() string {
+	return m.betreff
+}
+
+// Inhalt gibt den Inhalt der Nachricht zurück.
+func (m *Message) Inhalt() string {
+	return m.inhalt
+}
+
+// Status gibt den Zustellstatus der Nachricht zurück.
+func (m *Message) Status() Status {
+	return m.status
+}
+
+// Versuche gibt die Anzahl der bisherigen Zustellversuche zurück.
+func (m *Message) Versuche() int {
+	return m.versuche
+}
+
+// LetzterFehler gibt den Fehler des letzten Zustellversuchs zurück.
+func (m *Message) LetzterFehler() string {
+	return m.letzterFehler
+}
+
+// NaechsterVersuch gibt den frühesten Zeitpunkt des nächsten Zustellversuchs zurück.
+func (m *Message) NaechsterVersuch() time.Time {
+	return m.naechsterVersuch
+}
+
+// ErstelltAm gibt den Erstellungszeitpunkt der Nachricht zurück.
+func (m *Message) ErstelltAm() time.Time {
+	return m.erstelltAm
+}
+
+// AktualisiertAm gibt den Aktualisierungszeitpunkt der Nachricht zurück.
+func (m *Message) AktualisiertAm() time.Time {
+	return m.aktualisiertAm
+}
+
+// IstFaellig gibt zurück, ob die Nachricht zum Zeitpunkt now zugestellt werden soll.
+func (m *Message) IstFaellig(now time.Time) bool {
+	return m.status == StatusPending && !m.naechsterVersuch.After(now)
+}
+
+// Zugestellt markiert die Nachricht als zugestellt.
+func (m *Message) Zugestellt(now time.Time) {
+	m.versuche++
+	m.status = StatusSent
+	m.letzterFehler = ""
+	m.aktualisiertAm = now
+}
+
+// Fehlgeschlagen vermerkt einen fehlgeschlagenen Zustellversuch. Der nächste Versuch
+// wird um delay verschoben, nach maxVersuche landet die Nachricht im Dead-Letter-Status.
+func (m *Message) Fehlgeschlagen(err error, now time.Time, delay time.Duration, maxVersuche int) {
+	m.versuche++
+	m.letzterFehler = err.Error()
+	m.aktualisiertAm = now
+	if m.versuche >= maxVersuche {
+		m.status = StatusDead
+		return
+	}
+	m.naechsterVersuch = now.Add(delay)
+}
+
+// Wiederholen setzt eine Nachricht zurück, damit sie erneut zugestellt wird.
+func (m *Message) Wiederholen(now time.Time) {
+	m.status = StatusPending
+	m.versuche = 0
+	m.naechsterVersuch = now
+	m.aktualisiertAm = now
+}
@@ -0,0 +1,143 @@
+// Package outboxtest provides the contract every outbox.Store backend has to fulfil.
+package outboxtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/outbox"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+// TestStore runs the contract against the stores of newStore. Every call has to
+// return a new, empty store.
+func TestStore(t *testing.T, newStore func(t *testing.T) outbox.Store) {
+	storetest.Run(t, newStore,
+		storetest.Case[outbox.Store]{Name: "Lebenszyklus", Test: testLifecycle},
+		storetest.Case[outbox.Store]{Name: "Eindeutigkeit", Test: testUniqueness},
+		storetest.Case[outbox.Store]{Name: "Nicht gefunden", Test: testNotFound},
+		storetest.Case[outbox.Store]{Name: "Abgebrochener Kontext", Test: testCancelledContext},
+		storetest.Case[outbox.Store]{Name: "Gleichzeitige Änderungen", Test: testConcurrentUpdates},
+	)
+}
+
+func testLifecycle(t *testing.T, repo outbox.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+	first := outbox.NewMessage("m1", "max@gmail.de", "Willkommen", "Hallo Max", now)
+	second := outbox.NewMessage("m2", "erika@gmail.de", "Willkommen", "Hallo Erika", now.Add(time.Second))
+	later := outbox.NewMessage("m3", "max@gmail.de", "Erinnerung", "Hallo", now.Add(2*time.Second))
+	for _, message := range []*outbox.Message{later, second, first} {
+		require.NoError(t, repo.SaveMessage(ctx, message))
+	}
+
+	found, err := repo.FindMessageByID(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, "max@gmail.de", found.Empfaenger())
+	assert.Equal(t, "Willkommen", found.Betreff())
+	assert.Equal(t, "Hallo Max", found.Inhalt())
+	assert.Equal(t, outbox.StatusPending, found.Status())
+	assert.Equal(t, now, found.ErstelltAm())
+
+	due, err := repo.FindDueMessages(ctx, now.Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "m1", due[0].ID(), "oldest first")
+	due, err = repo.FindDueMessages(ctx, now.Add(time.Hour), 1)
+	require.NoError(t, err)
+	assert.Len(t, due, 1, "limited")
+
+	found.Fehlgeschlagen(errors.New("timeout"), now, time.Minute, 5)
+	require.NoError(t, repo.UpdateMessage(ctx, found))
+	second.Zugestellt(now)
+	require.NoError(t, repo.UpdateMessage(ctx, second))
+	found, err = repo.FindMessageByID(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, found.Versuche())
+	assert.Equal(t, "timeout", found.LetzterFehler())
+	assert.Equal(t, now.Add(time.Minute), found.NaechsterVersuch())
+	due, err = repo.FindDueMessages(ctx, now.Add(30*time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1, "neither the postponed nor the sent message is due")
+	assert.Equal(t, "m3", due[0].ID())
+
+	sent, err := repo.FindMessagesByStatus(ctx, outbox.StatusSent)
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "m2", sent[0].ID())
+	all, err := repo.FindMessagesByStatus(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
+
+func testUniqueness(t *testing.T, repo outbox.Store) {
+	ctx := context.Background()
+	require.NoError(t, repo.SaveMessage(ctx, outbox.NewMessage("m1", "max@gmail.de", "Betreff", "Inhalt", storetest.Now())))
+
+	assert.ErrorIs(t, repo.SaveMessage(ctx, outbox.NewMessage("m1", "erika@gmail.de", "Betreff", "Inhalt", storetest.Now())), outbox.ErrMessageAlreadyExists)
+	found, err := repo.FindMessageByID(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, "max@gmail.de", found.Empfaenger(), "the stored message is kept")
+}
+
+func testNotFound(t *testing.T, repo outbox.Store) {
+	ctx := context.Background()
+
+	_, err := repo.FindMessageByID(ctx, "unbekannt")
+	assert.ErrorIs(t, err, outbox.ErrMessageNotFound)
+	assert.ErrorIs(t, repo.UpdateMessage(ctx, outbox.NewMessage("unbekannt", "", "", "", storetest.Now())), outbox.ErrMessageNotFound)
+	due, err := repo.FindDueMessages(ctx, storetest.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+	messages, err := repo.FindMessagesByStatus(ctx, outbox.StatusDead)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+}
+
+func testCancelledContext(t *testing.T, repo outbox.Store) {
+	message := outbox.NewMessage("m1", "max@gmail.de", "Betreff", "Inhalt", storetest.Now())
+	require.NoError(t, repo.SaveMessage(context.Background(), message))
+
+	storetest.Cancelled(t,
+		storetest.Call{Name: "SaveMessage", Run: func(ctx context.Context) error {
+			return repo.SaveMessage(ctx, outbox.NewMessage("m2", "", "", "", storetest.Now()))
+		}},
+		storetest.Call{Name: "UpdateMessage", Run: func(ctx context.Context) error {
+			message.Zugestellt(storetest.Now())
+			return repo.UpdateMessage(ctx, message)
+		}},
+		storetest.Call{Name: "FindMessageByID", Run: func(ctx context.Context) error { _, err := repo.FindMessageByID(ctx, "m1"); return err }},
+		storetest.Call{Name: "FindDueMessages", Run: func(ctx context.Context) error { _, err := repo.FindDueMessages(ctx, storetest.Now(), 10); return err }},
+		storetest.Call{Name: "FindMessagesByStatus", Run: func(ctx context.Context) error { _, err := repo.FindMessagesByStatus(ctx, ""); return err }},
+	)
+
+	messages, err := repo.FindMessagesByStatus(context.Background(), outbox.StatusPending)
+	require.NoError(t, err, "a cancelled call must not change the store")
+	assert.Len(t, messages, 1)
+}
+
+func testConcurrentUpdates(t *testing.T, repo outbox.Store) {
+	ctx := context.Background()
+	for i := range storetest.Concurrency {
+		require.NoError(t, repo.SaveMessage(ctx, outbox.NewMessage(fmt.Sprint(i), "max@gmail.de", "Betreff", "Inhalt", storetest.Now())))
+	}
+
+	errs := storetest.Race(func(i int) error {
+		message, err := repo.FindMessageByID(ctx, fmt.Sprint(i))
+		if err != nil {
+			return err
+		}
+		message.Zugestellt(storetest.Now())
+		return repo.UpdateMessage(ctx, message)
+	})
+
+	assert.Equal(t, storetest.Concurrency, storetest.Count(errs, nil))
+	sent, err := repo.FindMessagesByStatus(ctx, outbox.StatusSent)
+	require.NoError(t, err)
+	assert.Len(t, sent, storetest.Concurrency, "no update is lost")
+}
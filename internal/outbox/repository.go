@@ -0,0 +1,153 @@
+package outbox
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+// Store is the outbox storage. Every backend, e.g. InMemoryRepository or
+// SQLiteRepository, implements it.
+type Store interface {
+	repository
+}
+
+// InMemoryRepository implements the outbox repository with an in-memory store.
+type InMemoryRepository struct {
+	messages map[string]Message
+	gate     transaction.Gate
+	mutex    sync.RWMutex
+}
+
+// NewInMemoryRepository creates a new InMemoryRepository.
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		messages: make(map[string]Message),
+	}
+}
+
+// SaveMessage adds a new message to the outbox.
+func (r *InMemoryRepository) SaveMessage(ctx context.Context, message *Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, exists := r.messages[message.ID()]; exists {
+			return ErrMessageAlreadyExists
+		}
+		r.messages[message.ID()] = *message
+		return nil
+	}
+}
+
+// UpdateMessage replaces the stored state of an existing message.
+func (r *InMemoryRepository) UpdateMessage(ctx context.Context, message *Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, exists := r.messages[message.ID()]; !exists {
+			return ErrMessageNotFound
+		}
+		r.messages[message.ID()] = *message
+		return nil
+	}
+}
+
+// FindMessageByID retrieves a message by its ID.
+func (r *InMemoryRepository) FindMessageByID(ctx context.Context, id string) (*Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		message, exists := r.messages[id]
+		if !exists {
+			return nil, ErrMessageNotFound
+		}
+		return &message, nil
+	}
+}
+
+// FindDueMessages returns up to limit pending messages that are due at now, oldest first.
+func (r *InMemoryRepository) FindDueMessages(ctx context.Context, now time.Time, limit int) ([]*Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		due := make([]*Message, 0)
+		for _, message := range r.messages {
+			if message.IstFaellig(now) {
+				due = append(due, &message)
+			}
+		}
+		sortByCreation(due)
+		if len(due) > limit {
+			due = due[:limit]
+		}
+		return due, nil
+	}
+}
+
+// FindMessagesByStatus returns all messages with the given status, oldest first.
+// An empty status returns every message.
+func (r *InMemoryRepository) FindMessagesByStatus(ctx context.Context, status Status) ([]*Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		messages := make([]*Message, 0)
+		for _, message := range r.messages {
+			if status == "" || message.Status() == status {
+				messages = append(messages, &message)
+			}
+		}
+		sortByCreation(messages)
+		return messages, nil
+	}
+}
+
+func sortByCreation(messages []*Message) {
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ErstelltAm().Before(messages[j].ErstelltAm())
+	})
+}
+
+// Snapshot copies the stored messages and returns a function that restores the copy.
+func (r *InMemoryRepository) Snapshot() func() {
+	r.mutex.RLock()
+	messages := maps.Clone(r.messages)
+	r.mutex.RUnlock()
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.messages = messages
+	}
+}
+
+// Gate returns the gate the writes of the repository pass.
+func (r *InMemoryRepository) Gate() *transaction.Gate {
+	return &r.gate
+}
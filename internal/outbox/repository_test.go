@@ -0,0 +1,17 @@
+package outbox_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/outbox"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/outbox/outboxtest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+)
+
+func TestRepository(t *testing.T) {
+	storetest.Backends(t, outboxtest.TestStore,
+		func() outbox.Store { return outbox.NewInMemoryRepository() },
+		func(db *sql.DB) outbox.Store { return outbox.NewSQLiteRepository(db) },
+	)
+}
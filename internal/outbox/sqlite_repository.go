@@ -0,0 +1,104 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+const messageColumns = `id, recipient, subject, body, status, attempts, last_error, next_attempt_at, created_at, updated_at`
+
+// SQLiteRepository implements the outbox repository with a SQLite database.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteRepository creates a new SQLiteRepository.
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db}
+}
+
+// conn returns the transaction of the context or the database.
+func (r *SQLiteRepository) conn(ctx context.Context) transaction.Querier {
+	return transaction.Conn(ctx, r.db)
+}
+
+// SaveMessage adds a new message to the outbox.
+func (r *SQLiteRepository) SaveMessage(ctx context.Context, message *Message) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO outbox_messages (`+messageColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		message.ID(), message.Empfaenger(), message.Betreff(), message.Inhalt(), message.Status(), message.Versuche(),
+		message.LetzterFehler(), message.NaechsterVersuch().UTC(), message.ErstelltAm().UTC(), message.AktualisiertAm().UTC())
+	if sqlite.IsUniqueViolation(err) {
+		return ErrMessageAlreadyExists
+	}
+	return err
+}
+
+// UpdateMessage replaces the stored state of an existing message.
+func (r *SQLiteRepository) UpdateMessage(ctx context.Context, message *Message) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `UPDATE outbox_messages SET status = $2, attempts = $3, last_error = $4,
+		next_attempt_at = $5, updated_at = $6 WHERE id = $1`,
+		message.ID(), message.Status(), message.Versuche(), message.LetzterFehler(),
+		message.NaechsterVersuch().UTC(), message.AktualisiertAm().UTC())
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// FindMessageByID retrieves a message by its ID.
+func (r *SQLiteRepository) FindMessageByID(ctx context.Context, id string) (*Message, error) {
+	messages, err := r.queryMessages(ctx, `SELECT `+messageColumns+` FROM outbox_messages WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	return messages[0], nil
+}
+
+// FindDueMessages returns up to limit pending messages that are due at now, oldest first.
+func (r *SQLiteRepository) FindDueMessages(ctx context.Context, now time.Time, limit int) ([]*Message, error) {
+	return r.queryMessages(ctx, `SELECT `+messageColumns+` FROM outbox_messages
+		WHERE status = $1 AND next_attempt_at <= $2 ORDER BY created_at LIMIT $3`, StatusPending, now.UTC(), limit)
+}
+
+// FindMessagesByStatus returns all messages with the given status, oldest first.
+// An empty status returns every message.
+func (r *SQLiteRepository) FindMessagesByStatus(ctx context.Context, status Status) ([]*Message, error) {
+	return r.queryMessages(ctx, `SELECT `+messageColumns+` FROM outbox_messages
+		WHERE $1 = '' OR status = $1 ORDER BY created_at`, status)
+}
+
+func (r *SQLiteRepository) queryMessages(ctx context.Context, query string, args ...any) ([]*Message, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]*Message, 0)
+	for rows.Next() {
+		var message Message
+		if err := rows.Scan(&message.iD, &message.empfaenger, &message.betreff, &message.inhalt, &message.status, &message.versuche,
+			&message.letzterFehler, &message.naechsterVersuch, &message.erstelltAm, &message.aktualisiertAm); err != nil {
+			return nil, err
+		}
+		message.naechsterVersuch = message.naechsterVersuch.UTC()
+		message.erstelltAm = message.erstelltAm.UTC()
+		message.aktualisiertAm = message.aktualisiertAm.UTC()
+		messages = append(messages, &message)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrMessageNotFound is returned when a message is not found
+	ErrMessageNotFound = errors.New("Message not found")
+	// ErrMessageAlreadyExists is returned when a message ID is already taken
+	ErrMessageAlreadyExists = errors.New("Message already exists")
+	// ErrMessageAlreadySent is returned when a sent message should be retried
+	ErrMessageAlreadySent = errors.New("Message already sent")
+	// ErrInvalidStatus is returned when a status filter is unknown
+	ErrInvalidStatus = errors.New("Invalid status")
+)
+
+type repository interface {
+	SaveMessage(ctx context.Context, message *Message) error
+	UpdateMessage(ctx context.Context, message *Message) error
+	FindMessageByID(ctx context.Context, id string) (*Message, error)
+	FindDueMessages(ctx context.Context, now time.Time, limit int) ([]*Message, error)
+	FindMessagesByStatus(ctx context.Context, status Status) ([]*Message, error)
+}
+
+type uuidGenerator interface {
+	GenerateUUID() (string, error)
+}
+
+// UseCase is the use case for queueing and inspecting outgoing mails
+type UseCase struct {
+	repo    repository
+	uuidGen uuidGenerator
+}
+
+// NewUseCase creates a new outbox UseCase
+func NewUseCase(repo repository, uuidGen uuidGenerator) *UseCase {
+	return &UseCase{
+		repo:    repo,
+		uuidGen: uuidGen,
+	}
+}
+
+// Enqueue stores a mail in the outbox. The worker delivers it asynchronously.
+func (c *UseCase) Enqueue(ctx context.Context, to, subject, body string) error {
+	id, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	return c.repo.SaveMessage(ctx, NewMessage(id, to, subject, body, time.Now().UTC()))
+}
+
+// Messages returns all messages with the given status. An empty status returns all messages.
+func (c *UseCase) Messages(ctx context.Context, status Status) ([]*Message, error) {
+	switch status {
+	case "", StatusPending, StatusSent, StatusDead:
+	default:
+		return nil, ErrInvalidStatus
+	}
+	return c.repo.FindMessagesByStatus(ctx, status)
+}
+
+// RetryMessage puts a failed or dead message back into the delivery queue.
+func (c *UseCase) RetryMessage(ctx context.Context, id string) error {
+	message, err := c.repo.FindMessageByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if message.Status() == StatusSent {
+		return ErrMessageAlreadySent
+	}
+	message.Wiederholen(time.Now().UTC())
+	return c.repo.UpdateMessage(ctx, message)
+}
@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+const (
+	batchSize = 50
+	maxDelay  = 6 * time.Hour
+)
+
+type sender interface {
+	Send(to, subject, body string) error
+}
+
+// Worker delivers due outbox messages in the background.
+type Worker struct {
+	repo        repository
+	sender      sender
+	log         logger.Logger
+	interval    time.Duration
+	baseDelay   time.Duration
+	maxAttempts int
+}
+
+// NewWorker creates a new Worker. Failed deliveries are retried with exponential
+// backoff starting at baseDelay until maxAttempts is reached.
+func NewWorker(repo repository, sender sender, log logger.Logger, interval, baseDelay time.Duration, maxAttempts int) *Worker {
+	return &Worker{
+		repo:        repo,
+		sender:      sender,
+		log:         log,
+		interval:    interval,
+		baseDelay:   baseDelay,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Run polls the outbox until the context is cancelled.
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.DeliverDue(ctx); err != nil {
+				w.log.Error(fmt.Sprintf("failed to deliver outbox messages. %v", err))
+			}
+		}
+	}
+}
+
+// DeliverDue sends every message that is due and records the outcome.
+func (w *Worker) DeliverDue(ctx context.Context) error {
+	messages, err := w.repo.FindDueMessages(ctx, time.Now().UTC(), batchSize)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		w.deliver(message)
+		if err := w.repo.UpdateMessage(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Worker) deliver(message *Message) {
+	err := w.sender.Send(message.Empfaenger(), message.Betreff(), message.Inhalt())
+	if err == nil {
+		message.Zugestellt(time.Now().UTC())
+		return
+	}
+	message.Fehlgeschlagen(err, time.Now().UTC(), w.Backoff(message.Versuche()+1), w.maxAttempts)
+	if message.Status() == StatusDead {
+		w.log.Error(fmt.Sprintf("outbox message %s moved to dead letter after %d attempts. %v", message.ID(), message.Versuche(), err))
+		return
+	}
+	w.log.Warning(fmt.Sprintf("outbox message %s failed, retry at %s. %v", message.ID(), message.NaechsterVersuch().Format(time.RFC3339), err))
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts.
+func (w *Worker) Backoff(attempts int) time.Duration {
+	delay := w.baseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return delay
+}
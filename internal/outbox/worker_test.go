@@ -0,0 +1,127 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/outbox"
+)
+
+type stubSender struct {
+	err   error
+	calls int
+}
+
+func (s *stubSender) Send(to, subject, body string) error {
+	s.calls++
+	return s.err
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Error(string)   {}
+func (nopLogger) Warning(string) {}
+func (nopLogger) Info(string)    {}
+func (nopLogger) Debug(string)   {}
+func (nopLogger) Fatal(string)   {}
+
+func TestBackoff(t *testing.T) {
+	w := outbox.NewWorker(outbox.NewInMemoryRepository(), &stubSender{}, nopLogger{}, time.Second, time.Minute, 5)
+	tests := []struct {
+		name     string
+		attempts int
+		expect   time.Duration
+	}{
+		{name: "Erster Fehlversuch", attempts: 1, expect: time.Minute},
+		{name: "Zweiter Fehlversuch", attempts: 2, expect: 2 * time.Minute},
+		{name: "Fünfter Fehlversuch", attempts: 5, expect: 16 * time.Minute},
+		{name: "Obergrenze", attempts: 30, expect: 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, w.Backoff(tt.attempts))
+		})
+	}
+}
+
+func TestDeliverDue(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name           string
+		sendErr        error
+		runs           int
+		expectStatus   outbox.Status
+		expectAttempts int
+	}{
+		{
+			name:           "Zustellung erfolgreich",
+			runs:           1,
+			expectStatus:   outbox.StatusSent,
+			expectAttempts: 1,
+		},
+		{
+			name:           "Fehlversuch wird wiederholt",
+			sendErr:        errors.New("smtp unavailable"),
+			runs:           2,
+			expectStatus:   outbox.StatusPending,
+			expectAttempts: 2,
+		},
+		{
+			name:           "Dead Letter nach maximalen Versuchen",
+			sendErr:        errors.New("smtp unavailable"),
+			runs:           5,
+			expectStatus:   outbox.StatusDead,
+			expectAttempts: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := outbox.NewInMemoryRepository()
+			sender := &stubSender{err: tt.sendErr}
+			// zero base delay makes failed messages due again immediately
+			w := outbox.NewWorker(repo, sender, nopLogger{}, time.Second, 0, 3)
+			uc := outbox.NewUseCase(repo, id.UUIDGeneratorFunc(id.GenerateUUID))
+
+			assert.NoError(t, uc.Enqueue(ctx, "max.mustermann@gmail.de", "Account Verification", "token"))
+			for range tt.runs {
+				assert.NoError(t, w.DeliverDue(ctx))
+			}
+
+			messages, err := uc.Messages(ctx, "")
+			assert.NoError(t, err)
+			assert.Len(t, messages, 1)
+			assert.Equal(t, tt.expectStatus, messages[0].Status())
+			assert.Equal(t, tt.expectAttempts, messages[0].Versuche())
+			assert.Equal(t, tt.expectAttempts, sender.calls)
+		})
+	}
+}
+
+func TestRetryMessage(t *testing.T) {
+	ctx := context.Background()
+	repo := outbox.NewInMemoryRepository()
+	sender := &stubSender{err: errors.New("smtp unavailable")}
+	w := outbox.NewWorker(repo, sender, nopLogger{}, time.Second, 0, 1)
+	uc := outbox.NewUseCase(repo, id.UUIDGeneratorFunc(id.GenerateUUID))
+
+	assert.NoError(t, uc.Enqueue(ctx, "max.mustermann@gmail.de", "Account Verification", "token"))
+	assert.NoError(t, w.DeliverDue(ctx))
+
+	dead, err := uc.Messages(ctx, outbox.StatusDead)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+
+	assert.NoError(t, uc.RetryMessage(ctx, dead[0].ID()))
+	sender.err = nil
+	assert.NoError(t, w.DeliverDue(ctx))
+
+	sent, err := uc.Messages(ctx, outbox.StatusSent)
+	assert.NoError(t, err)
+	assert.Len(t, sent, 1)
+	assert.ErrorIs(t, uc.RetryMessage(ctx, dead[0].ID()), outbox.ErrMessageAlreadySent)
+	assert.ErrorIs(t, uc.RetryMessage(ctx, "unknown"), outbox.ErrMessageNotFound)
+}
@@ -0,0 +1,58 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixLength = 5
+
+// HIBPDirectory checks passwords against a local copy of the Have I Been Pwned
+// range files. The directory holds one file per SHA-1 prefix, named <PREFIX>.txt,
+// with lines of the form <SUFFIX>:<COUNT>, exactly as served by the k-anonymity
+// range API. Only the prefix file of the password hash is read.
+type HIBPDirectory struct {
+	dir string
+}
+
+// NewHIBPDirectory creates a new HIBPDirectory. An empty dir disables the check.
+func NewHIBPDirectory(dir string) *HIBPDirectory {
+	return &HIBPDirectory{dir: dir}
+}
+
+// IsBreached reports whether the password hash is listed with a count above zero.
+// A missing prefix file means the password is unknown.
+func (h *HIBPDirectory) IsBreached(password string) (bool, error) {
+	if h.dir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	file, err := os.Open(filepath.Join(h.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			// padded responses list fake suffixes with a count of 0
+			return count != "0", nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,148 @@
+package passwordpolicy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPolicyViolation is returned when a password does not satisfy the policy
+var ErrPolicyViolation = errors.New("Password violates the password policy")
+
+const (
+	// CodeTooShort is the violation code for passwords below the minimum length
+	CodeTooShort = "too_short"
+	// CodeTooLong is the violation code for passwords above the maximum length
+	CodeTooLong = "too_long"
+	// CodeContainsPersonalInfo is the violation code for passwords containing the email or name
+	CodeContainsPersonalInfo = "contains_personal_info"
+	// CodeTooWeak is the violation code for passwords below the minimum strength score
+	CodeTooWeak = "too_weak"
+	// CodeBreached is the violation code for passwords found in a data breach
+	CodeBreached = "breached"
+
+	// minPersonalInfoLength ignores short name parts like "Li" that would reject too much
+	minPersonalInfoLength = 3
+)
+
+// Violation describes a single broken rule of the policy.
+type Violation struct {
+	Code    string
+	Message string
+}
+
+// ViolationError lists every rule a password breaks.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrPolicyViolation, strings.Join(messages, "; "))
+}
+
+// Is reports whether target is ErrPolicyViolation.
+func (e *ViolationError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+type breachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// Policy checks passwords against length, personal information, strength and
+// known breaches.
+type Policy struct {
+	minLength int
+	maxLength int
+	minScore  int
+	breached  breachChecker
+}
+
+// NewPolicy creates a new Policy. maxLength counts bytes, since bcrypt ignores
+// everything after 72 bytes. minScore ranges from 0 to 4, see Score.
+func NewPolicy(minLength, maxLength, minScore int, breached breachChecker) *Policy {
+	return &Policy{
+		minLength: minLength,
+		maxLength: maxLength,
+		minScore:  minScore,
+		breached:  breached,
+	}
+}
+
+// Check validates the password. personalInfo holds values the password must not
+// contain, like the email address and the names of the user. It returns a
+// *ViolationError with all broken rules.
+func (p *Policy) Check(password string, personalInfo ...string) error {
+	var violations []Violation
+
+	if length := len([]rune(password)); length < p.minLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("Password too short. At least %d characters", p.minLength),
+		})
+	}
+	if len(password) > p.maxLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("Password too long. Maximum %d bytes", p.maxLength),
+		})
+	}
+	if containsPersonalInfo(password, personalInfo) {
+		violations = append(violations, Violation{
+			Code:    CodeContainsPersonalInfo,
+			Message: "Password must not contain your email or name",
+		})
+	}
+	if score := Score(password, personalInfo...); score < p.minScore {
+		violations = append(violations, Violation{
+			Code:    CodeTooWeak,
+			Message: fmt.Sprintf("Password too weak. Strength %d of 4, at least %d required", score, p.minScore),
+		})
+	}
+
+	breached, err := p.breached.IsBreached(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		violations = append(violations, Violation{
+			Code:    CodeBreached,
+			Message: "Password appeared in a data breach",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// containsPersonalInfo checks the password for the given values and the local
+// part of email addresses, ignoring case.
+func containsPersonalInfo(password string, personalInfo []string) bool {
+	lower := strings.ToLower(password)
+	for _, info := range personalParts(personalInfo) {
+		if strings.Contains(lower, info) {
+			return true
+		}
+	}
+	return false
+}
+
+func personalParts(personalInfo []string) []string {
+	parts := make([]string, 0, len(personalInfo))
+	for _, info := range personalInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if local, _, ok := strings.Cut(info, "@"); ok {
+			info = local
+		}
+		if len([]rune(info)) >= minPersonalInfoLength {
+			parts = append(parts, info)
+		}
+	}
+	return parts
+}
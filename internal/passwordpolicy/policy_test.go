@@ -0,0 +1,92 @@
+package passwordpolicy_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/passwordpolicy"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		maxScore int
+		minScore int
+	}{
+		{name: "Häufiges Passwort", password: "password", maxScore: 0, minScore: 0},
+		{name: "Wiederholung", password: "aaaaaaaaaaaa", maxScore: 1, minScore: 0},
+		{name: "Folge", password: "abcdefghijk", maxScore: 1, minScore: 0},
+		{name: "Wort mit Jahr", password: "Sommer2024", maxScore: 2, minScore: 0},
+		{name: "Passphrase", password: "kaffee tisch regen lampe", maxScore: 4, minScore: 4},
+		{name: "Zufällig", password: "x7#Rq!2vLp9@", maxScore: 4, minScore: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := passwordpolicy.Score(tt.password)
+			assert.GreaterOrEqual(t, score, tt.minScore)
+			assert.LessOrEqual(t, score, tt.maxScore)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	policy := passwordpolicy.NewPolicy(8, 72, 3, passwordpolicy.NewHIBPDirectory(""))
+	tests := []struct {
+		name        string
+		password    string
+		expectCodes []string
+	}{
+		{name: "Gültiges Passwort", password: "kaffee tisch regen lampe", expectCodes: nil},
+		{name: "Zu kurz", password: "x7#Rq!", expectCodes: []string{passwordpolicy.CodeTooShort}},
+		{name: "Zu lang", password: strings.Repeat("x7#Rq!2vLp9@", 7), expectCodes: []string{passwordpolicy.CodeTooLong}},
+		{name: "Enthält Email", password: "max.mustermann-x7#Rq!", expectCodes: []string{passwordpolicy.CodeContainsPersonalInfo}},
+		{name: "Enthält Namen", password: "MUSTERMANN x7#Rq!", expectCodes: []string{passwordpolicy.CodeContainsPersonalInfo}},
+		{name: "Zu schwach", password: "password1", expectCodes: []string{passwordpolicy.CodeTooWeak}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, "max.mustermann@gmail.de", "Max", "Mustermann")
+			if tt.expectCodes == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, passwordpolicy.ErrPolicyViolation)
+			violationErr := err.(*passwordpolicy.ViolationError)
+			codes := make([]string, 0, len(violationErr.Violations))
+			for _, violation := range violationErr.Violations {
+				codes = append(codes, violation.Code)
+			}
+			for _, code := range tt.expectCodes {
+				assert.Contains(t, codes, code)
+			}
+		})
+	}
+}
+
+func TestHIBPDirectory(t *testing.T) {
+	dir := t.TempDir()
+	sum := sha1.Sum([]byte("kaffee tisch regen lampe"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	content := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + hash[5:] + ":42\r\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(content), 0o600))
+
+	hibp := passwordpolicy.NewHIBPDirectory(dir)
+	breached, err := hibp.IsBreached("kaffee tisch regen lampe")
+	assert.NoError(t, err)
+	assert.True(t, breached)
+
+	breached, err = hibp.IsBreached("x7#Rq!2vLp9@")
+	assert.NoError(t, err)
+	assert.False(t, breached, "missing prefix file means unknown password")
+
+	policy := passwordpolicy.NewPolicy(8, 72, 0, hibp)
+	err = policy.Check("kaffee tisch regen lampe")
+	assert.ErrorIs(t, err, passwordpolicy.ErrPolicyViolation)
+	assert.Equal(t, passwordpolicy.CodeBreached, err.(*passwordpolicy.ViolationError).Violations[0].Code)
+}
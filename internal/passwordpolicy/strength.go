@@ -0,0 +1,145 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonWords are frequent passwords and password parts, most common first.
+// The rank approximates how early an attacker tries them.
+var commonWords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234", "111111",
+	"1234567", "dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein",
+	"696969", "shadow", "master", "666666", "qwertyuiop", "123321", "mustang", "1234567890",
+	"michael", "654321", "superman", "1qaz2wsx", "7777777", "121212", "000000", "qazwsx",
+	"123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"welcome", "admin", "login", "passwort", "hallo", "qwertz", "schatz", "sommer",
+	"winter", "fussball", "schalke", "bayern", "dortmund", "berlin", "deutschland", "geheim",
+	"asdf", "asdfghjkl", "zxcv", "secret", "summer", "princess", "starwars", "computer",
+	"internet", "freedom", "whatever", "haushalt", "haushaltsbuch", "familie", "liebe", "blume",
+}
+
+var commonRank = func() map[string]int {
+	ranks := make(map[string]int, len(commonWords))
+	for i, word := range commonWords {
+		ranks[word] = i + 1
+	}
+	return ranks
+}()
+
+const minWordLength = 4
+
+// Score estimates the strength of the password like zxcvbn from 0 (too guessable)
+// to 4 (very unguessable). It sums the estimated guesses of the password parts:
+// common words and personal information are cheap, repeated and sequential
+// characters nearly free and everything else costs the full character set.
+func Score(password string, personalInfo ...string) int {
+	guesses := guessesLog10(password, personalParts(personalInfo))
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// guessesLog10 returns the decimal logarithm of the estimated number of guesses.
+func guessesLog10(password string, personal []string) float64 {
+	lower := []rune(strings.ToLower(password))
+	if rank, ok := commonRank[string(lower)]; ok {
+		return math.Log10(float64(rank))
+	}
+
+	charset := math.Log10(cardinality(password))
+	var guesses float64
+	for i := 0; i < len(lower); {
+		if length, rank := matchWord(lower[i:], personal); length > 0 {
+			// a dictionary word, doubled for capitalisation variants
+			guesses += math.Log10(float64(rank) * 2)
+			i += length
+			continue
+		}
+		if isYear(lower[i:]) {
+			guesses += math.Log10(150)
+			i += 4
+			continue
+		}
+		if i > 0 && continuesPattern(lower[i-1], lower[i]) {
+			guesses += math.Log10(2)
+			i++
+			continue
+		}
+		guesses += charset
+		i++
+	}
+	return guesses
+}
+
+// matchWord returns the length and rank of the longest common word or personal
+// information at the start of s.
+func matchWord(s []rune, personal []string) (int, int) {
+	var length, rank int
+	for _, info := range personal {
+		if n := len([]rune(info)); n > length && strings.HasPrefix(string(s), info) {
+			length, rank = n, 1
+		}
+	}
+	for word, wordRank := range commonRank {
+		n := len([]rune(word))
+		if n >= minWordLength && n > length && strings.HasPrefix(string(s), word) {
+			length, rank = n, wordRank
+		}
+	}
+	return length, rank
+}
+
+// isYear reports whether s starts with a year between 1900 and 2099.
+func isYear(s []rune) bool {
+	if len(s) < 4 || !(string(s[:2]) == "19" || string(s[:2]) == "20") {
+		return false
+	}
+	return unicode.IsDigit(s[2]) && unicode.IsDigit(s[3])
+}
+
+// continuesPattern reports whether current repeats or continues a sequence like abc or 321.
+func continuesPattern(previous, current rune) bool {
+	delta := current - previous
+	return delta == 0 || delta == 1 || delta == -1
+}
+
+// cardinality returns the size of the character set the password is drawn from.
+func cardinality(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	var size float64
+	for _, set := range []struct {
+		used bool
+		size float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if set.used {
+			size += set.size
+		}
+	}
+	return max(size, 1)
+}
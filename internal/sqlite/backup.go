@@ -0,0 +1,89 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+const backupPrefix = "haushaltsbuch-"
+
+// BackupWorker copies the database into a directory in the background and keeps
+// the newest backups.
+type BackupWorker struct {
+	db       *sql.DB
+	dir      string
+	keep     int
+	log      logger.Logger
+	interval time.Duration
+}
+
+// NewBackupWorker creates a new BackupWorker that keeps the newest keep backups in dir.
+func NewBackupWorker(db *sql.DB, dir string, keep int, log logger.Logger, interval time.Duration) *BackupWorker {
+	return &BackupWorker{
+		db:       db,
+		dir:      dir,
+		keep:     keep,
+		log:      log,
+		interval: interval,
+	}
+}
+
+// Run backs up the database until the context is cancelled.
+func (w *BackupWorker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := w.BackupNow(ctx); err != nil {
+				w.log.Error(fmt.Sprintf("failed to back up database. %v", err))
+			}
+		}
+	}
+}
+
+// BackupNow writes a new backup, removes the backups beyond keep and returns the
+// path of the new file.
+func (w *BackupWorker) BackupNow(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(w.dir, 0o700); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(w.dir, backupPrefix+time.Now().UTC().Format("20060102T150405.000000000Z")+".db")
+	if err := Backup(ctx, w.db, dest); err != nil {
+		return "", err
+	}
+	return dest, w.prune()
+}
+
+// prune removes the oldest backups. The timestamp in the file name sorts them.
+func (w *BackupWorker) prune() error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	backups := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), backupPrefix) && strings.HasSuffix(entry.Name(), ".db") {
+			backups = append(backups, entry.Name())
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > w.keep {
+		if err := os.Remove(filepath.Join(w.dir, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
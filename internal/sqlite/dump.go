@@ -0,0 +1,191 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+// ErrCorrupt is returned when a restored database is damaged or its script fails
+var ErrCorrupt = errors.New("Database is corrupt")
+
+// schemaObject is a table, index, trigger or view of the database.
+type schemaObject struct {
+	typ  string
+	name string
+	sql  string
+}
+
+// Dump returns an SQL script that recreates the database: the tables with their
+// rows, then the indexes, triggers and views. quote() writes every value as a
+// literal of its storage class, so integers, reals, texts and blobs come back
+// unchanged. Run it in a transaction or on a single connection to get a
+// consistent copy.
+func Dump(ctx context.Context, conn transaction.Querier) ([]byte, error) {
+	objects, err := schemaObjects(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var script bytes.Buffer
+	script.WriteString("PRAGMA defer_foreign_keys = ON;\n")
+	for _, object := range objects {
+		if object.typ == "table" {
+			script.WriteString(object.sql + ";\n")
+		}
+	}
+	for _, object := range objects {
+		if object.typ != "table" {
+			continue
+		}
+		if err := dumpRows(ctx, conn, &script, object.name); err != nil {
+			return nil, err
+		}
+	}
+	var sequences int
+	if err := conn.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_schema WHERE name = 'sqlite_sequence'`).Scan(&sequences); err != nil {
+		return nil, err
+	}
+	if sequences > 0 {
+		script.WriteString("DELETE FROM sqlite_sequence;\n")
+		if err := dumpRows(ctx, conn, &script, "sqlite_sequence"); err != nil {
+			return nil, err
+		}
+	}
+	for _, object := range objects {
+		if object.typ != "table" {
+			script.WriteString(object.sql + ";\n")
+		}
+	}
+	return script.Bytes(), nil
+}
+
+// schemaObjects returns the objects of the schema in the order they were
+// created, without the internal tables and the automatic indexes.
+func schemaObjects(ctx context.Context, conn transaction.Querier) ([]schemaObject, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT type, name, sql FROM sqlite_schema
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := make([]schemaObject, 0)
+	for rows.Next() {
+		var object schemaObject
+		if err := rows.Scan(&object.typ, &object.name, &object.sql); err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
+
+// dumpRows appends an INSERT statement for every row of the table.
+func dumpRows(ctx context.Context, conn transaction.Querier, script *bytes.Buffer, table string) error {
+	columns, err := tableColumns(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+	literals := make([]string, len(columns))
+	for i, column := range columns {
+		literals[i] = "quote(" + quoteIdentifier(column) + ")"
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT `+strings.Join(literals, ", ")+` FROM `+quoteIdentifier(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]string, len(columns))
+	targets := make([]any, len(columns))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+		fmt.Fprintf(script, "INSERT INTO %s VALUES(%s);\n", quoteIdentifier(table), strings.Join(values, ","))
+	}
+	return rows.Err()
+}
+
+func tableColumns(ctx context.Context, conn transaction.Querier, table string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT name FROM pragma_table_info($1) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]string, 0)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Restore runs the script of Dump in one transaction and verifies the result.
+// A script that fails or leaves a damaged database fails with ErrCorrupt.
+func Restore(ctx context.Context, db *sql.DB, script []byte) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return CheckIntegrity(ctx, db)
+}
+
+// CheckIntegrity verifies the structure of the whole database and every foreign key.
+func CheckIntegrity(ctx context.Context, db *sql.DB) error {
+	problems := make([]string, 0)
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	var violations int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM pragma_foreign_key_check`).Scan(&violations); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if violations > 0 {
+		problems = append(problems, fmt.Sprintf("%d foreign key violations", violations))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrCorrupt, strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	password BLOB,
+	role TEXT NOT NULL,
+	active BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	delete_at TIMESTAMP,
+	two_factor_secret TEXT NOT NULL DEFAULT '',
+	two_factor_active BOOLEAN NOT NULL DEFAULT FALSE,
+	two_factor_codes TEXT NOT NULL DEFAULT '[]',
+	two_factor_last_step INTEGER NOT NULL DEFAULT 0,
+	email_change_id TEXT NOT NULL DEFAULT '',
+	email_change_new TEXT NOT NULL DEFAULT '',
+	email_change_old TEXT NOT NULL DEFAULT '',
+	email_change_confirmed BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX users_delete_at_idx ON users (delete_at) WHERE delete_at IS NOT NULL;
@@ -0,0 +1,6 @@
+CREATE TABLE external_identities (
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	PRIMARY KEY (issuer, subject)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE access_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP
+);
+
+CREATE INDEX access_tokens_user_id_idx ON access_tokens (user_id);
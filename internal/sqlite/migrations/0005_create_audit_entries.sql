@@ -0,0 +1,23 @@
+CREATE TABLE audit_entries (
+	sequence INTEGER PRIMARY KEY,
+	id TEXT NOT NULL UNIQUE,
+	time TIMESTAMP NOT NULL,
+	action TEXT NOT NULL,
+	actor_id TEXT NOT NULL,
+	household_id TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	before BLOB,
+	after BLOB,
+	previous_hash TEXT NOT NULL,
+	hash TEXT NOT NULL
+);
+
+CREATE INDEX audit_entries_actor_id_idx ON audit_entries (actor_id);
+CREATE INDEX audit_entries_target_idx ON audit_entries (target_type, target_id);
+
+CREATE TRIGGER audit_entries_no_update BEFORE UPDATE ON audit_entries
+BEGIN
+	SELECT RAISE(ABORT, 'audit entries are append-only');
+END;
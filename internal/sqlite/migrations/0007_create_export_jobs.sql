@@ -0,0 +1,12 @@
+CREATE TABLE export_jobs (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	archive BLOB,
+	error TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX export_jobs_user_id_idx ON export_jobs (user_id);
@@ -0,0 +1,45 @@
+CREATE TABLE ledger_events (
+	sequence INTEGER PRIMARY KEY,
+	stream_id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	time TIMESTAMP NOT NULL,
+	data BLOB NOT NULL,
+	UNIQUE (stream_id, version)
+);
+
+CREATE INDEX ledger_events_user_id_idx ON ledger_events (user_id, time);
+
+CREATE TRIGGER ledger_events_no_update BEFORE UPDATE ON ledger_events
+BEGIN
+	SELECT RAISE(ABORT, 'ledger events are append-only');
+END;
+
+CREATE TABLE ledger_accounts (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	balance TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	opened_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ledger_accounts_user_id_idx ON ledger_accounts (user_id);
+
+CREATE TABLE ledger_bookings (
+	id TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	amount TEXT NOT NULL,
+	text TEXT NOT NULL,
+	booked_on TIMESTAMP NOT NULL,
+	voided BOOLEAN NOT NULL,
+	void_reason TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	changed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ledger_bookings_account_id_idx ON ledger_bookings (account_id, booked_on);
@@ -0,0 +1,7 @@
+ALTER TABLE ledger_accounts ADD COLUMN deleted_at TIMESTAMP;
+
+ALTER TABLE ledger_bookings ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX ledger_accounts_deleted_at_idx ON ledger_accounts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX ledger_bookings_deleted_at_idx ON ledger_bookings (deleted_at) WHERE deleted_at IS NOT NULL;
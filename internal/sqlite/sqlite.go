@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/migrate"
+	driver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Migrations holds the versioned schema of every store. All stores share one
+// database file, so the file alone is a complete deployment.
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
+
+// MigrationsDir is the directory of the migrations in Migrations.
+const MigrationsDir = "migrations"
+
+// ErrBackupExists is returned when the target file of a backup already exists
+var ErrBackupExists = errors.New("Backup file already exists")
+
+// Open opens the database file in WAL mode, so readers do not block the writer.
+// Foreign keys are enforced and transactions take the write lock when they
+// begin, concurrent writers wait up to five seconds instead of failing.
+func Open(path string) (*sql.DB, error) {
+	query := url.Values{}
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "synchronous(NORMAL)")
+	query.Set("_txlock", "immediate")
+	query.Set("_time_format", "sqlite")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewMigrator creates the migrator for the schema in Migrations.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, Migrations, MigrationsDir)
+}
+
+// Backup writes a consistent copy of the database to dest while the service keeps
+// running. The copy is compacted and contains the WAL, so it can be opened alone.
+func Backup(ctx context.Context, db *sql.DB, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%w: %s", ErrBackupExists, dest)
+	}
+	_, err := db.ExecContext(ctx, `VACUUM INTO $1`, dest)
+	return err
+}
+
+// IsUniqueViolation reports whether err was caused by a UNIQUE or PRIMARY KEY constraint.
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *driver.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
+
+// IsForeignKeyViolation reports whether err was caused by a FOREIGN KEY constraint.
+func IsForeignKeyViolation(err error) bool {
+	var sqliteErr *driver.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+// NullTime stores a zero time as NULL.
+func NullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// Time returns the UTC time of a nullable column, the zero time for NULL.
+func Time(t sql.NullTime) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return t.Time.UTC()
+}
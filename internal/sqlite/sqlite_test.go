@@ -0,0 +1,84 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Error(string)   {}
+func (nopLogger) Warning(string) {}
+func (nopLogger) Info(string)    {}
+func (nopLogger) Debug(string)   {}
+func (nopLogger) Fatal(string)   {}
+
+func openMigrated(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := sqlite.NewMigrator(db)
+	require.NoError(t, err)
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, migrator.Latest(), applied)
+	return db
+}
+
+func TestOpen(t *testing.T) {
+	db := openMigrated(t)
+
+	var journalMode string
+	require.NoError(t, db.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+	var foreignKeys int
+	require.NoError(t, db.QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys))
+	assert.Equal(t, 1, foreignKeys)
+
+	_, err := db.Exec(`INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_used_at) VALUES ('s1', 'unbekannt', '', '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	assert.True(t, sqlite.IsForeignKeyViolation(err))
+	_, err = db.Exec(`INSERT INTO outbox_messages (id, recipient, subject, body, status, attempts, last_error, next_attempt_at, created_at, updated_at)
+		VALUES ('m1', '', '', '', 'pending', 0, '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO outbox_messages (id, recipient, subject, body, status, attempts, last_error, next_attempt_at, created_at, updated_at)
+		VALUES ('m1', '', '', '', 'pending', 0, '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	assert.True(t, sqlite.IsUniqueViolation(err))
+}
+
+func TestBackup(t *testing.T) {
+	db := openMigrated(t)
+	ctx := context.Background()
+	_, err := db.Exec(`INSERT INTO outbox_messages (id, recipient, subject, body, status, attempts, last_error, next_attempt_at, created_at, updated_at)
+		VALUES ('m1', 'max@gmail.de', '', '', 'pending', 0, '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	worker := sqlite.NewBackupWorker(db, dir, 2, nopLogger{}, 0)
+	paths := make([]string, 0, 3)
+	for range 3 {
+		path, err := worker.BackupNow(ctx)
+		require.NoError(t, err)
+		paths = append(paths, path)
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "only the newest backups are kept")
+	assert.NoFileExists(t, paths[0])
+
+	backup, err := sqlite.Open(paths[2])
+	require.NoError(t, err)
+	defer backup.Close()
+	var recipient string
+	require.NoError(t, backup.QueryRow(`SELECT recipient FROM outbox_messages WHERE id = 'm1'`).Scan(&recipient))
+	assert.Equal(t, "max@gmail.de", recipient)
+
+	assert.ErrorIs(t, sqlite.Backup(ctx, db, paths[2]), sqlite.ErrBackupExists)
+}
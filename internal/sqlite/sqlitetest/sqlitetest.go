@@ -0,0 +1,26 @@
+// Package sqlitetest opens migrated SQLite databases for the tests of the stores.
+package sqlitetest
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+)
+
+// Open creates a database file in a temporary directory of the test, applies
+// every migration and closes it when the test ends.
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := sqlite.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	return db
+}
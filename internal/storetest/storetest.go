@@ -0,0 +1,101 @@
+// Package storetest holds the scaffold the contract suites of the stores share,
+// e.g. usertest or ledgertest, so a suite only keeps the assertions of its store.
+// A package runs its suite against every backend from its own tests:
+//
+//	func TestRepository(t *testing.T) {
+//		storetest.Backends(t, usertest.TestStore, ...)
+//	}
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite/sqlitetest"
+)
+
+// Concurrency is the number of goroutines racing for the same change.
+const Concurrency = 10
+
+// Case is one part of the contract of the store S.
+type Case[S any] struct {
+	Name string
+	Test func(t *testing.T, store S)
+}
+
+// Run runs every case against its own store of newStore. Every call has to
+// return a new, empty store.
+func Run[S any](t *testing.T, newStore func(t *testing.T) S, cases ...Case[S]) {
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) { c.Test(t, newStore(t)) })
+	}
+}
+
+// Backends runs the suite against the in-memory store and the SQLite store on a
+// migrated database of the test.
+func Backends[S any](t *testing.T, suite func(t *testing.T, newStore func(t *testing.T) S), inMemory func() S, onSQLite func(db *sql.DB) S) {
+	t.Run("Im Speicher", func(t *testing.T) {
+		suite(t, func(t *testing.T) S { return inMemory() })
+	})
+	t.Run("SQLite", func(t *testing.T) {
+		suite(t, func(t *testing.T) S { return onSQLite(sqlitetest.Open(t)) })
+	})
+}
+
+// Now returns the current time truncated to the precision every backend stores.
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// Call is a call of a store method for Cancelled.
+type Call struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Cancelled runs every call with a cancelled context, which has to fail with
+// context.Canceled.
+func Cancelled(t *testing.T, calls ...Call) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, call := range calls {
+		t.Run(call.Name, func(t *testing.T) {
+			assert.ErrorIs(t, call.Run(ctx), context.Canceled)
+		})
+	}
+}
+
+// Race runs fn with the numbers 0 to Concurrency-1 at the same time and returns
+// the errors.
+func Race(fn func(i int) error) []error {
+	errs := make([]error, Concurrency)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+// Count returns how many of errs match target, a nil target counts the nil errors.
+func Count(errs []error, target error) int {
+	n := 0
+	for _, err := range errs {
+		if (target == nil && err == nil) || (target != nil && errors.Is(err, target)) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcKey is the SHA-1 test key of RFC 6238, Appendix B.
+var rfcKey = []byte("12345678901234567890")
+
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		// the RFC lists 8 digit codes, the last 6 digits are the 6 digit codes
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		if got := Code(rfcKey, tt.unix/period); got != tt.want {
+			t.Errorf("code is incorrect for %d, got: %s, want: %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	totp := &TOTP{issuer: "Haushaltsbuch", now: func() time.Time { return now }}
+	secret := encoding.EncodeToString(rfcKey)
+	step := now.Unix() / period
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{name: "current step", code: Code(rfcKey, step), want: true},
+		{name: "previous step", code: Code(rfcKey, step-1), want: true},
+		{name: "next step", code: Code(rfcKey, step+1), want: true},
+		{name: "outside window", code: Code(rfcKey, step-2), want: false},
+		{name: "wrong length", code: "12345", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := totp.Validate(secret, tt.code); ok != tt.want {
+				t.Errorf("validate is incorrect, got: %v, want: %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := NewTOTP("Haushaltsbuch").URI("max@example.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Haushaltsbuch:max@example.com?") {
+		t.Errorf("uri has wrong label, got: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("uri misses secret, got: %s", uri)
+	}
+}
@@ -0,0 +1,170 @@
+// Package transaction runs operations that span several repositories as one unit
+// of work. The transaction travels in the context: every repository called with
+// the context passed to WithinTx takes part in it.
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Querier is the part of *sql.DB and *sql.Tx the SQL repositories query with.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Snapshotter is a store that keeps its state in memory. Snapshot copies the
+// state and returns a function that restores the copy. Every write of the store
+// passes its Gate, so no change made outside of a transaction is lost when the
+// copy is restored.
+type Snapshotter interface {
+	Snapshot() (restore func())
+	Gate() *Gate
+}
+
+// Gate lets the writes of an in-memory store outside of a transaction wait for
+// the running transaction of the Transactor the store belongs to. The zero value
+// lets every write pass.
+type Gate struct {
+	transactor *Transactor
+}
+
+// Enter waits until no transaction of the Transactor runs and holds it off until
+// leave is called. Writes within a transaction of the Transactor pass at once.
+func (g *Gate) Enter(ctx context.Context) (leave func()) {
+	if g.transactor == nil {
+		return func() {}
+	}
+	if running, ok := ctx.Value(contextKey{}).(*state); ok && running.transactor == g.transactor {
+		return func() {}
+	}
+	g.transactor.mutex.Lock()
+	return g.transactor.mutex.Unlock
+}
+
+type contextKey struct{}
+
+// state is the running transaction in the context.
+type state struct {
+	transactor *Transactor
+	txs        map[*sql.DB]*sql.Tx
+}
+
+// Transactor commits or rolls back the changes of a unit of work in the SQL
+// databases and the in-memory stores together.
+type Transactor struct {
+	dbs    []*sql.DB
+	stores []Snapshotter
+	mutex  sync.Mutex
+}
+
+// New creates a new Transactor for the database and the in-memory stores. The
+// database may be nil if every store is kept in memory; without database and
+// stores WithinTx just runs fn.
+func New(db *sql.DB, stores ...Snapshotter) *Transactor {
+	if db == nil {
+		return NewAcross(nil, stores...)
+	}
+	return NewAcross([]*sql.DB{db}, stores...)
+}
+
+// NewAcross creates a new Transactor whose units of work span several databases.
+// The databases commit in the given order and a failed commit rolls back the
+// databases after it, but not the ones that committed before. Pass the database
+// whose commit is most likely to fail first, e.g. the one behind the network.
+func NewAcross(dbs []*sql.DB, stores ...Snapshotter) *Transactor {
+	t := &Transactor{
+		dbs:    dbs,
+		stores: stores,
+	}
+	for _, store := range stores {
+		store.Gate().transactor = t
+	}
+	return t
+}
+
+// WithinTx runs fn in a transaction. It commits if fn succeeds and rolls every
+// change back if fn fails or panics. A WithinTx inside fn joins the running
+// transaction.
+//
+// In-memory stores are restored from a snapshot on rollback. Their transactions
+// are serialized and their writes outside of a transaction wait until the
+// running one has ended, so a rollback only discards the changes of fn.
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if running, ok := ctx.Value(contextKey{}).(*state); (ok && running.transactor == t) || (len(t.dbs) == 0 && len(t.stores) == 0) {
+		return fn(ctx)
+	}
+
+	running := &state{transactor: t, txs: make(map[*sql.DB]*sql.Tx, len(t.dbs))}
+	if len(t.stores) > 0 {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+
+		restores := make([]func(), 0, len(t.stores))
+		for _, store := range t.stores {
+			restores = append(restores, store.Snapshot())
+		}
+		rollback := func() {
+			for _, restore := range restores {
+				restore()
+			}
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				rollback()
+				panic(p)
+			}
+			if err != nil {
+				rollback()
+			}
+		}()
+	}
+	for _, db := range t.dbs {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		running.txs[db] = tx
+	}
+
+	if err = fn(context.WithValue(ctx, contextKey{}, running)); err != nil {
+		return err
+	}
+	for _, db := range t.dbs {
+		if err = running.txs[db].Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Conn returns the transaction of the context if it spans db, otherwise db.
+func Conn(ctx context.Context, db *sql.DB) Querier {
+	if running, ok := ctx.Value(contextKey{}).(*state); ok && running.txs[db] != nil {
+		return running.txs[db]
+	}
+	return db
+}
+
+// InTx runs fn in the transaction of the context. Outside of a transaction it
+// runs fn in a new transaction on db, so a repository method stays atomic on its own.
+func InTx(ctx context.Context, db *sql.DB, fn func(q Querier) error) error {
+	if q := Conn(ctx, db); q != Querier(db) {
+		return fn(q)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,192 @@
+package transaction_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite/sqlitetest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+)
+
+var errAbgebrochen = errors.New("aborted")
+
+func newUser(id string) *user.User {
+	return user.NewUser(id, "Max", "Mustermann", id+"@gmail.de", []byte("hash"), time.Now(), time.Now())
+}
+
+func TestWithinTx(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) (user.Store, *transaction.Transactor)
+	}{
+		{name: "Im Speicher", open: func(t *testing.T) (user.Store, *transaction.Transactor) {
+			repo := user.NewInMemoryUserRepository()
+			return repo, transaction.New(nil, repo)
+		}},
+		{name: "SQLite", open: func(t *testing.T) (user.Store, *transaction.Transactor) {
+			db := sqlitetest.Open(t)
+			return user.NewSQLiteUserRepository(db), transaction.New(db)
+		}},
+	}
+	tests := []struct {
+		name        string
+		fn          func(ctx context.Context, repo user.Store, tx *transaction.Transactor) error
+		expectErr   error
+		expectPanic bool
+		expectFound bool
+	}{
+		{name: "Bestätigt", expectFound: true, fn: func(ctx context.Context, repo user.Store, tx *transaction.Transactor) error {
+			if _, err := repo.CreateUser(ctx, newUser("1")); err != nil {
+				return err
+			}
+			_, err := repo.CreateUser(ctx, newUser("2"))
+			return err
+		}},
+		{name: "Fehler", expectErr: errAbgebrochen, fn: func(ctx context.Context, repo user.Store, tx *transaction.Transactor) error {
+			if _, err := repo.CreateUser(ctx, newUser("1")); err != nil {
+				return err
+			}
+			if _, err := repo.CreateUser(ctx, newUser("2")); err != nil {
+				return err
+			}
+			return errAbgebrochen
+		}},
+		{name: "Panik", expectPanic: true, fn: func(ctx context.Context, repo user.Store, tx *transaction.Transactor) error {
+			if _, err := repo.CreateUser(ctx, newUser("1")); err != nil {
+				return err
+			}
+			if _, err := repo.CreateUser(ctx, newUser("2")); err != nil {
+				return err
+			}
+			panic(errAbgebrochen)
+		}},
+		{name: "Verschachtelt bestätigt", expectFound: true, fn: func(ctx context.Context, repo user.Store, tx *transaction.Transactor) error {
+			if _, err := repo.CreateUser(ctx, newUser("1")); err != nil {
+				return err
+			}
+			return tx.WithinTx(ctx, func(ctx context.Context) error {
+				_, err := repo.CreateUser(ctx, newUser("2"))
+				return err
+			})
+		}},
+		{name: "Verschachtelt fehlgeschlagen", expectErr: errAbgebrochen, fn: func(ctx context.Context, repo user.Store, tx *transaction.Transactor) error {
+			if _, err := repo.CreateUser(ctx, newUser("1")); err != nil {
+				return err
+			}
+			return tx.WithinTx(ctx, func(ctx context.Context) error {
+				if _, err := repo.CreateUser(ctx, newUser("2")); err != nil {
+					return err
+				}
+				return errAbgebrochen
+			})
+		}},
+	}
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				repo, tx := backend.open(t)
+
+				run := func() error {
+					return tx.WithinTx(ctx, func(ctx context.Context) error { return tt.fn(ctx, repo, tx) })
+				}
+				if tt.expectPanic {
+					assert.Panics(t, func() { _ = run() })
+				} else if tt.expectErr != nil {
+					assert.ErrorIs(t, run(), tt.expectErr)
+				} else {
+					require.NoError(t, run())
+				}
+
+				for _, id := range []string{"1", "2"} {
+					_, err := repo.FindUserByID(ctx, id)
+					if tt.expectFound {
+						assert.NoError(t, err)
+					} else {
+						assert.ErrorIs(t, err, user.ErrUserNotFound)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWithinTxKeepsWritesOutside(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	tx := transaction.New(nil, repo)
+
+	done := make(chan error, 1)
+	err := tx.WithinTx(ctx, func(inner context.Context) error {
+		if _, err := repo.CreateUser(inner, newUser("1")); err != nil {
+			return err
+		}
+		go func() {
+			_, err := repo.CreateUser(ctx, newUser("2"))
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		_, err := repo.FindUserByID(inner, "2")
+		assert.ErrorIs(t, err, user.ErrUserNotFound, "a write outside waits for the transaction")
+		return errAbgebrochen
+	})
+	assert.ErrorIs(t, err, errAbgebrochen)
+	require.NoError(t, <-done)
+
+	_, err = repo.FindUserByID(ctx, "1")
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+	_, err = repo.FindUserByID(ctx, "2")
+	assert.NoError(t, err, "the rollback must not discard a write outside of the transaction")
+}
+
+func TestWithinTxWithoutStores(t *testing.T) {
+	ctx := context.Background()
+	err := transaction.New(nil).WithinTx(ctx, func(inner context.Context) error {
+		assert.Equal(t, ctx, inner)
+		return errAbgebrochen
+	})
+	assert.ErrorIs(t, err, errAbgebrochen)
+}
+
+func TestWithinTxAcrossDatabases(t *testing.T) {
+	tests := []struct {
+		name        string
+		expectErr   error
+		expectFound bool
+	}{
+		{name: "Bestätigt", expectFound: true},
+		{name: "Fehler", expectErr: errAbgebrochen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			first, second := sqlitetest.Open(t), sqlitetest.Open(t)
+			repos := []user.Store{user.NewSQLiteUserRepository(first), user.NewSQLiteUserRepository(second)}
+
+			err := transaction.NewAcross([]*sql.DB{first, second}).WithinTx(ctx, func(ctx context.Context) error {
+				for _, repo := range repos {
+					if _, err := repo.CreateUser(ctx, newUser("1")); err != nil {
+						return err
+					}
+				}
+				return tt.expectErr
+			})
+			assert.ErrorIs(t, err, tt.expectErr)
+
+			for _, repo := range repos {
+				_, err := repo.FindUserByID(ctx, "1")
+				if tt.expectFound {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, user.ErrUserNotFound)
+				}
+			}
+		})
+	}
+}
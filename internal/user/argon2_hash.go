@@ -0,0 +1,111 @@
+package user
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	// ErrUnknownHashFormat is returned when a stored hash is neither argon2id nor bcrypt
+	ErrUnknownHashFormat = errors.New("Unknown password hash format")
+	// ErrPasswordMismatch is returned when a password does not match its hash
+	ErrPasswordMismatch = errors.New("Password does not match")
+)
+
+// Argon2Params are the cost parameters of argon2id.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// Argon2Hasher hashes passwords with argon2id in the PHC string format
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+// It still validates bcrypt hashes, so existing passwords keep working until
+// they are rehashed.
+type Argon2Hasher struct {
+	params Argon2Params
+}
+
+// NewArgon2Hasher creates a new Argon2Hasher with the given policy.
+func NewArgon2Hasher(params Argon2Params) *Argon2Hasher {
+	return &Argon2Hasher{params: params}
+}
+
+// GeneratePassword hashes the password with the current parameters.
+func (h *Argon2Hasher) GeneratePassword(clearword string) ([]byte, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(clearword), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, argon2KeyLength)
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+// ValidatePassword checks the password against an argon2id or bcrypt hash.
+func (h *Argon2Hasher) ValidatePassword(hash []byte, clearword string) error {
+	if isBcrypt(hash) {
+		return ValidatePassword(hash, clearword)
+	}
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(clearword), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// NeedsRehash reports whether the hash was created with another algorithm or
+// other parameters than the current policy.
+func (h *Argon2Hasher) NeedsRehash(hash []byte) bool {
+	params, _, _, err := decodeArgon2(hash)
+	return err != nil || params != h.params
+}
+
+func isBcrypt(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2"))
+}
+
+// decodeArgon2 parses a hash in the PHC string format.
+func decodeArgon2(hash []byte) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,51 @@
+package user_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testParams = user.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestArgon2Hasher(t *testing.T) {
+	hasher := user.NewArgon2Hasher(testParams)
+
+	hash, err := hasher.GeneratePassword("password")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	other, err := hasher.GeneratePassword("password")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, other, "every hash has its own salt")
+
+	assert.NoError(t, hasher.ValidatePassword(hash, "password"))
+	assert.ErrorIs(t, hasher.ValidatePassword(hash, "passwort"), user.ErrPasswordMismatch)
+	assert.ErrorIs(t, hasher.ValidatePassword([]byte("$argon2id$broken"), "password"), user.ErrUnknownHashFormat)
+}
+
+func TestArgon2HasherNeedsRehash(t *testing.T) {
+	hasher := user.NewArgon2Hasher(testParams)
+	current, _ := hasher.GeneratePassword("password")
+	weaker, _ := user.NewArgon2Hasher(user.Argon2Params{Memory: 512, Iterations: 1, Parallelism: 1}).GeneratePassword("password")
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	tests := []struct {
+		name   string
+		hash   []byte
+		expect bool
+	}{
+		{name: "Aktuelle Parameter", hash: current, expect: false},
+		{name: "Schwächere Parameter", hash: weaker, expect: true},
+		{name: "Bcrypt", hash: legacy, expect: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, hasher.NeedsRehash(tt.hash))
+			assert.NoError(t, hasher.ValidatePassword(tt.hash, "password"))
+		})
+	}
+}
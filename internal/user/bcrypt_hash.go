@@ -8,6 +8,7 @@ import (
 type PasswordHasherFunc struct {
 	Generate func(string) ([]byte, error)
 	Validate func([]byte, string) error
+	Rehash   func([]byte) bool
 }
 
 // GeneratePassword is a function type that generates a password.
@@ -20,6 +21,14 @@ func (f PasswordHasherFunc) ValidatePassword(hash []byte, clearword string) erro
 	return f.Validate(hash, clearword)
 }
 
+// NeedsRehash checks if the hash should be upgraded. Without Rehash hashes are never upgraded.
+func (f PasswordHasherFunc) NeedsRehash(hash []byte) bool {
+	if f.Rehash == nil {
+		return false
+	}
+	return f.Rehash(hash)
+}
+
 // GeneratePassword Signatur.
 func GeneratePassword(clearword string) ([]byte, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(clearword), bcrypt.DefaultCost)
@@ -34,3 +43,9 @@ func ValidatePassword(hash []byte, clearword string) error {
 	err := bcrypt.CompareHashAndPassword(hash, []byte(clearword))
 	return err
 }
+
+// NeedsRehash checks if a bcrypt hash is below the default cost.
+func NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost < bcrypt.DefaultCost
+}
@@ -3,26 +3,53 @@ package user
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"gitlab.com/shingeki-no-kyojin/ymir/config"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
 	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/etag"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/lockout"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/oidc"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/passwordpolicy"
 	"gitlab.com/shingeki-no-kyojin/ymir/internal/presenter"
 	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
 )
 
 type usecase interface {
 	CreateUser(context.Context, *CreateInput) error
+	VerifyEmail(context.Context, string) error
 	LoginUser(context.Context, *LoginInput) (*LoginOutput, error)
+	RefreshToken(context.Context, *RefreshInput) (*LoginOutput, error)
 	LogoutUser(context.Context, *LogoutInput) error
-	DeleteUser(context.Context, *DeleteInput) error
+	DeleteUser(context.Context, *DeleteInput) (*DeleteOutput, error)
 	UpdateUser(context.Context, *UpdateInput) (*UpdateOutput, error)
+	Profile(context.Context, string) (*ProfileOutput, error)
 	ResetPassword(context.Context, string) error
+	ConfirmPasswordReset(context.Context, *ResetConfirmInput) error
 	ChangeEmail(context.Context, *ChangeEmailInput) error
+	ConfirmEmailChange(context.Context, string) error
+	UndoEmailChange(context.Context, string) error
 	ChangePassword(context.Context, *ChangePasswordInput) error
+	Sessions(context.Context, *SessionInput) ([]*SessionOutput, error)
+	RevokeSession(context.Context, *SessionInput) error
+	RevokeOtherSessions(context.Context, *SessionInput) error
+	EnrollTwoFactor(context.Context, string) (*TwoFactorEnrollOutput, error)
+	ConfirmTwoFactor(context.Context, *TwoFactorConfirmInput) (*TwoFactorConfirmOutput, error)
+	VerifyTwoFactor(context.Context, *TwoFactorVerifyInput) (*LoginOutput, error)
+	UnlockUser(context.Context, string) error
+	StartOIDCLogin(context.Context) (*OIDCStartOutput, error)
+	LoginWithOIDC(context.Context, *OIDCLoginInput) (*LoginOutput, error)
 }
 
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateMaxAge = 600
+)
+
 // Controller is the controller for the user usecase.
 type Controller struct {
 	log     logger.Logger
@@ -62,6 +89,9 @@ func (c *Controller) CreateUser(w http.ResponseWriter, r *http.Request) {
 		Password:  body.Password,
 	}
 	if err := c.usecase.CreateUser(r.Context(), input); err != nil {
+		if c.rejectPolicyViolation(w, err, http.StatusBadRequest) {
+			return
+		}
 		switch err {
 		case ErrEmailAlreadyExists:
 			c.log.Error("email already exists")
@@ -102,6 +132,12 @@ type LoginUserResponse struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// TwoFactorChallengeResponse is a serializable struct for the login response body
+// of users with two-factor authentication.
+type TwoFactorChallengeResponse struct {
+	ChallengeToken string `json:"challenge_token"`
+}
+
 // LoginUser handles the user login request.
 func (c *Controller) LoginUser(w http.ResponseWriter, r *http.Request) {
 	var body LoginUserRequest
@@ -111,13 +147,160 @@ func (c *Controller) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	input := &LoginInput{
-		Email:    body.Email,
-		Password: body.Password,
+		Email:     body.Email,
+		Password:  body.Password,
+		UserAgent: r.UserAgent(),
+		IP:        audit.ClientIP(r),
 	}
 	tokens, err := c.usecase.LoginUser(r.Context(), input)
 	if err != nil {
-		c.log.Error(fmt.Sprintf("failed to login user. %v", err))
-		http.Error(w, "failed to login user", http.StatusInternalServerError)
+		if c.rejectLocked(w, err) {
+			return
+		}
+		switch err {
+		case ErrUserNotFound, ErrInvalidPassword:
+			c.log.Error(fmt.Sprintf("invalid credentials. %v", err))
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		case ErrUserNotActive:
+			c.log.Error("user not verified")
+			http.Error(w, "user not verified", http.StatusForbidden)
+		default:
+			c.log.Error(fmt.Sprintf("failed to login user. %v", err))
+			http.Error(w, "failed to login user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if tokens.ChallengeToken != "" {
+		w.WriteHeader(http.StatusAccepted)
+		presenter.NewJSONPresenter(w).Successful(&TwoFactorChallengeResponse{ChallengeToken: tokens.ChallengeToken})
+		return
+	}
+
+	response := &LoginUserResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// StartOIDCLogin handles the request to sign in with the identity provider. The
+// browser is redirected to the provider, the state is bound to it with a cookie.
+func (c *Controller) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	output, err := c.usecase.StartOIDCLogin(r.Context())
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrNotConfigured):
+			c.log.Error("oidc login is not configured")
+			http.Error(w, "oidc login is not configured", http.StatusNotFound)
+		default:
+			c.log.Error(fmt.Sprintf("failed to start oidc login. %v", err))
+			http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		}
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    output.State,
+		Path:     "/user/anmelden/oidc",
+		MaxAge:   oidcStateMaxAge,
+		HttpOnly: true,
+		Secure:   c.config.Env != "dev",
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, output.URL, http.StatusFound)
+}
+
+// OIDCCallback handles the redirect of the identity provider after the login.
+func (c *Controller) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/user/anmelden/oidc", MaxAge: -1})
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		c.log.Error(fmt.Sprintf("identity provider rejected login. %s", providerErr))
+		http.Error(w, "login rejected by identity provider", http.StatusUnauthorized)
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || cookie.Value == "" || cookie.Value != query.Get("state") {
+		c.log.Error("oidc state does not match the cookie")
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+
+	input := &OIDCLoginInput{
+		State:     query.Get("state"),
+		Code:      query.Get("code"),
+		UserAgent: r.UserAgent(),
+		IP:        audit.ClientIP(r),
+	}
+	tokens, err := c.usecase.LoginWithOIDC(r.Context(), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidState):
+			c.log.Error(fmt.Sprintf("invalid oidc state. %v", err))
+			http.Error(w, "invalid state", http.StatusBadRequest)
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, ErrExternalEmailNotVerified), errors.Is(err, ErrUserNotActive):
+			c.log.Error(fmt.Sprintf("oidc login rejected. %v", err))
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		case errors.Is(err, ErrExternalIDAlreadyLinked):
+			c.log.Error(fmt.Sprintf("oidc login rejected. %v", err))
+			http.Error(w, "external identity already linked", http.StatusConflict)
+		case errors.Is(err, oidc.ErrProvider):
+			c.log.Error(fmt.Sprintf("identity provider failed. %v", err))
+			http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		default:
+			c.log.Error(fmt.Sprintf("failed to login user with oidc. %v", err))
+			http.Error(w, "failed to login user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if tokens.ChallengeToken != "" {
+		w.WriteHeader(http.StatusAccepted)
+		presenter.NewJSONPresenter(w).Successful(&TwoFactorChallengeResponse{ChallengeToken: tokens.ChallengeToken})
+		return
+	}
+
+	response := &LoginUserResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// RefreshTokenRequest is a serializable struct for the refresh and logout request body.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken handles the request to exchange a refresh token against a new token pair.
+func (c *Controller) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var body RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	input := &RefreshInput{
+		RefreshToken: body.RefreshToken,
+	}
+	tokens, err := c.usecase.RefreshToken(r.Context(), input)
+	if err != nil {
+		switch err {
+		case ErrInvalidRefreshToken, ErrUserNotActive:
+			c.log.Error(fmt.Sprintf("refresh token rejected. %v", err))
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		case ErrRefreshTokenReused:
+			c.log.Warning("refresh token reused, token family revoked")
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		default:
+			c.log.Error(fmt.Sprintf("failed to refresh token. %v", err))
+			http.Error(w, "failed to refresh token", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -137,24 +320,30 @@ func (c *Controller) LogoutUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User ID not found", http.StatusUnauthorized)
 		return
 	}
-	refreshToken, ok := r.Context().Value(auth.Token).(string)
-	if !ok {
-		c.log.Error("Context token not found")
-		http.Error(w, "Context token not found", http.StatusInternalServerError)
+	var body RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
-	if refreshToken == "" {
+	if body.RefreshToken == "" {
 		c.log.Error("refresh token not found")
 		http.Error(w, "refresh token not found", http.StatusUnauthorized)
 		return
 	}
 	input := &LogoutInput{
 		UserID:       userID,
-		RefreshToken: refreshToken,
+		RefreshToken: body.RefreshToken,
 	}
 	if err := c.usecase.LogoutUser(r.Context(), input); err != nil {
-		c.log.Error(fmt.Sprintf("failed to logout user. %v", err))
-		http.Error(w, "failed to logout user", http.StatusInternalServerError)
+		switch err {
+		case ErrInvalidRefreshToken:
+			c.log.Error("invalid refresh token")
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		default:
+			c.log.Error(fmt.Sprintf("failed to logout user. %v", err))
+			http.Error(w, "failed to logout user", http.StatusInternalServerError)
+		}
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -173,6 +362,10 @@ func (c *Controller) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User ID not found", http.StatusUnauthorized)
 		return
 	}
+	version, ok := etag.Require(w, r, c.log)
+	if !ok {
+		return
+	}
 	var body DeleteUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
@@ -182,22 +375,49 @@ func (c *Controller) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	input := &DeleteInput{
 		UserID:   userID,
 		Password: body.Password,
+		Version:  version,
 	}
-	if err := c.usecase.DeleteUser(r.Context(), input); err != nil {
-		c.log.Error(fmt.Sprintf("failed to delete user. %v", err))
-		http.Error(w, "failed to delete user", http.StatusInternalServerError)
+	output, err := c.usecase.DeleteUser(r.Context(), input)
+	if err != nil {
+		switch err {
+		case ErrUserNotFound:
+			c.log.Error("user not found")
+			http.Error(w, "user not found", http.StatusNotFound)
+		case ErrInvalidPassword:
+			c.log.Error("invalid password")
+			http.Error(w, "invalid password", http.StatusUnauthorized)
+		case ErrDeletionAlreadyScheduled:
+			c.log.Error("deletion already scheduled")
+			http.Error(w, "deletion already scheduled", http.StatusConflict)
+		case ErrConflict:
+			c.log.Error("user was changed in the meantime")
+			http.Error(w, "user was changed in the meantime", http.StatusPreconditionFailed)
+		default:
+			c.log.Error(fmt.Sprintf("failed to delete user. %v", err))
+			http.Error(w, "failed to delete user", http.StatusInternalServerError)
+		}
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag.Format(output.Version))
+	w.WriteHeader(http.StatusAccepted)
+	presenter.NewJSONPresenter(w).Successful(DeleteUserResponse{DeleteAt: output.DeleteAt})
+}
+
+// DeleteUserResponse is a serializable struct for the delete user response body.
+type DeleteUserResponse struct {
+	DeleteAt time.Time `json:"delete_at"`
 }
 
 // UpdateUserRequest is a serializable struct for the user update request body.
 type UpdateUserRequest struct {
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	ID              string `json:"id"`
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	FirstName       string `json:"first_name"`
+	LastName        string `json:"last_name"`
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 // UpdateUserResponse is a serializable struct for the user update response body.
@@ -216,6 +436,10 @@ func (c *Controller) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User ID not found", http.StatusUnauthorized)
 		return
 	}
+	version, ok := etag.Require(w, r, c.log)
+	if !ok {
+		return
+	}
 	var body UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
@@ -224,16 +448,37 @@ func (c *Controller) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	input := &UpdateInput{
 		UserID:    userID,
-		Email:     &body.Email,
+		Version:   version,
 		FirstName: &body.FirstName,
 		LastName:  &body.LastName,
 	}
+	if body.Email != "" {
+		input.Email = &body.Email
+	}
+	if body.NewPassword != "" {
+		input.CurrentPassword, input.NewPassword = &body.CurrentPassword, &body.NewPassword
+	}
 	output, err := c.usecase.UpdateUser(r.Context(), input)
 	if err != nil {
+		if c.rejectPolicyViolation(w, err, http.StatusUnprocessableEntity) {
+			return
+		}
 		switch err {
 		case ErrUserNotFound:
 			c.log.Error("user not found")
 			http.Error(w, "user not found", http.StatusNotFound)
+		case ErrInvalidEmail, ErrEmailTooLong:
+			c.log.Error(fmt.Sprintf("email is invalid. %v", err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case ErrEmailAlreadyExists:
+			c.log.Error("email already exists")
+			http.Error(w, "email already exists", http.StatusConflict)
+		case ErrInvalidPassword:
+			c.log.Error("invalid password")
+			http.Error(w, "invalid password", http.StatusUnauthorized)
+		case ErrConflict:
+			c.log.Error("user was changed in the meantime")
+			http.Error(w, "user was changed in the meantime", http.StatusPreconditionFailed)
 		// case
 		// 	ErrInvalideEmail:
 		// 	// ErrInvalideEmail,
@@ -255,8 +500,67 @@ func (c *Controller) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		FirstName: output.FirstName,
 		LastName:  output.LastName,
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag.Format(output.Version))
 	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// ProfileResponse is a serializable struct for the profile response body.
+type ProfileResponse struct {
+	ID               string     `json:"id"`
+	FirstName        string     `json:"first_name"`
+	LastName         string     `json:"last_name"`
+	Email            string     `json:"email"`
+	PendingEmail     string     `json:"pending_email,omitempty"`
+	Role             string     `json:"role"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeleteAt         *time.Time `json:"delete_at,omitempty"`
+}
+
+// GetProfile handles the request for the profile of the user. The ETag header
+// carries the version that PUT /user/bearbeiten and DELETE /user/entfernen
+// expect in If-Match.
+func (c *Controller) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	output, err := c.usecase.Profile(r.Context(), userID)
+	if err != nil {
+		switch err {
+		case ErrUserNotFound:
+			c.log.Error("user not found")
+			http.Error(w, "user not found", http.StatusNotFound)
+		default:
+			c.log.Error(fmt.Sprintf("failed to read profile. %v", err))
+			http.Error(w, "failed to read profile", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("ETag", etag.Format(output.Version))
+	if etag.NoneMatch(r, output.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response := &ProfileResponse{
+		ID:               output.ID,
+		FirstName:        output.FirstName,
+		LastName:         output.LastName,
+		Email:            output.Email,
+		PendingEmail:     output.PendingEmail,
+		Role:             output.Role,
+		TwoFactorEnabled: output.TwoFactorEnabled,
+		CreatedAt:        output.CreatedAt,
+		UpdatedAt:        output.UpdatedAt,
+		DeleteAt:         output.DeleteAt,
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	presenter.NewJSONPresenter(w).Successful(response)
 }
 
@@ -290,6 +594,41 @@ func (c *Controller) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// ResetConfirmRequest is a serializable struct for the confirm password reset request body.
+type ResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ConfirmPasswordReset handles the request to set a new password with a reset token.
+func (c *Controller) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var body ResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	input := &ResetConfirmInput{
+		Token:    body.Token,
+		Password: body.Password,
+	}
+	if err := c.usecase.ConfirmPasswordReset(r.Context(), input); err != nil {
+		if c.rejectPolicyViolation(w, err, http.StatusBadRequest) {
+			return
+		}
+		switch err {
+		case ErrInvalidResetToken:
+			c.log.Error("invalid reset token")
+			http.Error(w, "invalid reset token", http.StatusUnauthorized)
+		default:
+			c.log.Error(fmt.Sprintf("failed to confirm password reset. %v", err))
+			http.Error(w, "failed to reset password", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 // ChangeEmailRequest is a serializable struct for the change email request body.
 type ChangeEmailRequest struct {
 	Email string `json:"email"`
@@ -317,17 +656,85 @@ func (c *Controller) ChangeEmail(w http.ResponseWriter, r *http.Request) {
 
 	if err := c.usecase.ChangeEmail(r.Context(), input); err != nil {
 		switch err {
+		case ErrUserNotFound:
+			c.log.Error("user not found")
+			http.Error(w, "user not found", http.StatusNotFound)
 		case ErrEmailAlreadyExists:
 			c.log.Error("email already exists")
 			http.Error(w, "email already exists", http.StatusConflict)
-		// case ErrInvalideEmail:
-		// 	c.log.Error(fmt.Sprintf("email is invalid. %v", err))
-		// 	http.Error(w, "email is invalid", http.StatusInternalServerError)
+		case ErrInvalidEmail, ErrEmailTooLong:
+			c.log.Error(fmt.Sprintf("email is invalid. %v", err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		default:
 			c.log.Error(fmt.Sprintf("failed to change email. %v", err))
 			http.Error(w, "failed to change email", http.StatusInternalServerError)
-			return
 		}
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// EmailTokenRequest is a serializable struct for the verify email, confirm and undo email change request body.
+type EmailTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail handles the request to verify a new user with the token of the verification mail.
+func (c *Controller) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body EmailTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := c.usecase.VerifyEmail(r.Context(), body.Token); err != nil {
+		switch err {
+		case ErrInvalidVerificationToken, ErrUserNotFound:
+			c.log.Error("invalid verification token")
+			http.Error(w, "invalid verification token", http.StatusUnauthorized)
+		case ErrUserAlreadyActivated:
+			c.log.Error("user already verified")
+			http.Error(w, "user already verified", http.StatusConflict)
+		default:
+			c.log.Error(fmt.Sprintf("failed to verify user. %v", err))
+			http.Error(w, "failed to verify user", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ConfirmEmailChange handles the request to confirm a new email with the token sent to it.
+func (c *Controller) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	c.handleEmailToken(w, r, c.usecase.ConfirmEmailChange)
+}
+
+// UndoEmailChange handles the request to revert an email change with the token
+// sent to the old email.
+func (c *Controller) UndoEmailChange(w http.ResponseWriter, r *http.Request) {
+	c.handleEmailToken(w, r, c.usecase.UndoEmailChange)
+}
+
+func (c *Controller) handleEmailToken(w http.ResponseWriter, r *http.Request, apply func(context.Context, string) error) {
+	var body EmailTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := apply(r.Context(), body.Token); err != nil {
+		switch err {
+		case ErrInvalidEmailChangeToken:
+			c.log.Error("invalid email change token")
+			http.Error(w, "invalid email change token", http.StatusUnauthorized)
+		case ErrEmailAlreadyExists:
+			c.log.Error("email already exists")
+			http.Error(w, "email already exists", http.StatusConflict)
+		default:
+			c.log.Error(fmt.Sprintf("failed to apply email change. %v", err))
+			http.Error(w, "failed to change email", http.StatusInternalServerError)
+		}
+		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
@@ -357,9 +764,292 @@ func (c *Controller) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := c.usecase.ChangePassword(r.Context(), input); err != nil {
+		if c.rejectPolicyViolation(w, err, http.StatusBadRequest) {
+			return
+		}
 		c.log.Error(fmt.Sprintf("failed to change password. %v", err))
 		http.Error(w, "failed to change password", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+// SessionResponse is a serializable struct for an active session.
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// ListSessions handles the request to list the active sessions of the user.
+func (c *Controller) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	sessionID, _ := r.Context().Value(auth.SessionID).(string)
+	input := &SessionInput{
+		UserID:    userID,
+		SessionID: sessionID,
+	}
+	sessions, err := c.usecase.Sessions(r.Context(), input)
+	if err != nil {
+		c.log.Error(fmt.Sprintf("failed to list sessions. %v", err))
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			Current:    session.Current,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// RevokeSession handles the request to sign out a single session.
+func (c *Controller) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	input := &SessionInput{
+		UserID:    userID,
+		SessionID: r.PathValue("id"),
+	}
+	if err := c.usecase.RevokeSession(r.Context(), input); err != nil {
+		switch err {
+		case ErrSessionNotFound:
+			c.log.Error("session not found")
+			http.Error(w, "session not found", http.StatusNotFound)
+		default:
+			c.log.Error(fmt.Sprintf("failed to revoke session. %v", err))
+			http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessions handles the request to sign out every session except the current one.
+func (c *Controller) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	sessionID, ok := r.Context().Value(auth.SessionID).(string)
+	if !ok {
+		c.log.Error("Session ID not found in context")
+		http.Error(w, "Session ID not found", http.StatusUnauthorized)
+		return
+	}
+	input := &SessionInput{
+		UserID:    userID,
+		SessionID: sessionID,
+	}
+	if err := c.usecase.RevokeOtherSessions(r.Context(), input); err != nil {
+		c.log.Error(fmt.Sprintf("failed to revoke sessions. %v", err))
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TwoFactorEnrollResponse is a serializable struct for the 2FA enrollment response body.
+type TwoFactorEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollTwoFactor handles the request to start the TOTP enrollment.
+func (c *Controller) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	output, err := c.usecase.EnrollTwoFactor(r.Context(), userID)
+	if err != nil {
+		switch err {
+		case ErrTwoFactorAlreadyEnabled:
+			c.log.Error("two-factor authentication already enabled")
+			http.Error(w, "two-factor authentication already enabled", http.StatusConflict)
+		default:
+			c.log.Error(fmt.Sprintf("failed to enroll two-factor authentication. %v", err))
+			http.Error(w, "failed to enroll two-factor authentication", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(&TwoFactorEnrollResponse{Secret: output.Secret, URI: output.URI})
+}
+
+// TwoFactorCodeRequest is a serializable struct for the 2FA confirmation request body.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorConfirmResponse is a serializable struct for the 2FA confirmation response body.
+type TwoFactorConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ConfirmTwoFactor handles the request to activate TOTP with a first valid code.
+func (c *Controller) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserID).(string)
+	if !ok {
+		c.log.Error("User ID not found in context")
+		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		return
+	}
+	var body TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	input := &TwoFactorConfirmInput{
+		UserID: userID,
+		Code:   body.Code,
+	}
+	output, err := c.usecase.ConfirmTwoFactor(r.Context(), input)
+	if err != nil {
+		switch err {
+		case ErrTwoFactorAlreadyEnabled:
+			c.log.Error("two-factor authentication already enabled")
+			http.Error(w, "two-factor authentication already enabled", http.StatusConflict)
+		case ErrTwoFactorNotEnrolled:
+			c.log.Error("two-factor authentication not enrolled")
+			http.Error(w, "two-factor authentication not enrolled", http.StatusBadRequest)
+		case ErrInvalidTwoFactorCode:
+			c.log.Error("invalid two-factor code")
+			http.Error(w, "invalid code", http.StatusBadRequest)
+		default:
+			c.log.Error(fmt.Sprintf("failed to confirm two-factor authentication. %v", err))
+			http.Error(w, "failed to confirm two-factor authentication", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(&TwoFactorConfirmResponse{RecoveryCodes: output.RecoveryCodes})
+}
+
+// TwoFactorVerifyRequest is a serializable struct for the second login step request body.
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// VerifyTwoFactor handles the second login step of users with two-factor authentication.
+func (c *Controller) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var body TwoFactorVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		c.log.Error(fmt.Sprintf("failed to decode request body. %v", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	input := &TwoFactorVerifyInput{
+		ChallengeToken: body.ChallengeToken,
+		Code:           body.Code,
+		UserAgent:      r.UserAgent(),
+		IP:             audit.ClientIP(r),
+	}
+	tokens, err := c.usecase.VerifyTwoFactor(r.Context(), input)
+	if err != nil {
+		if c.rejectLocked(w, err) {
+			return
+		}
+		switch err {
+		case ErrInvalidChallengeToken, ErrInvalidTwoFactorCode:
+			c.log.Error(fmt.Sprintf("two-factor login rejected. %v", err))
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+		default:
+			c.log.Error(fmt.Sprintf("failed to verify two-factor code. %v", err))
+			http.Error(w, "failed to login user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := &LoginUserResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}
+	w.WriteHeader(http.StatusOK)
+	presenter.NewJSONPresenter(w).Successful(response)
+}
+
+// UnlockUser handles the admin request to lift the login lockout of a user.
+func (c *Controller) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if err := c.usecase.UnlockUser(r.Context(), r.PathValue("id")); err != nil {
+		switch err {
+		case ErrUserNotFound:
+			c.log.Error("user not found")
+			http.Error(w, "user not found", http.StatusNotFound)
+		default:
+			c.log.Error(fmt.Sprintf("failed to unlock user. %v", err))
+			http.Error(w, "failed to unlock user", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rejectLocked answers throttled login attempts with 429 and a Retry-After header.
+func (c *Controller) rejectLocked(w http.ResponseWriter, err error) bool {
+	var locked *lockout.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	c.log.Warning(fmt.Sprintf("login throttled. %v", err))
+	seconds := int(locked.RetryAfter.Seconds())
+	w.Header().Set("Retry-After", fmt.Sprint(max(seconds, 1)))
+	http.Error(w, "too many login attempts", http.StatusTooManyRequests)
+	return true
+}
+
+// PolicyViolationResponse is a serializable struct for a broken password rule.
+type PolicyViolationResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// rejectPolicyViolation answers passwords that break the password policy with the
+// status and the list of broken rules.
+func (c *Controller) rejectPolicyViolation(w http.ResponseWriter, err error, status int) bool {
+	var violation *passwordpolicy.ViolationError
+	if !errors.As(err, &violation) {
+		return false
+	}
+	c.log.Error(fmt.Sprintf("password rejected. %v", err))
+	response := make([]PolicyViolationResponse, 0, len(violation.Violations))
+	for _, v := range violation.Violations {
+		response = append(response, PolicyViolationResponse{Code: v.Code, Message: v.Message})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":      passwordpolicy.ErrPolicyViolation.Error(),
+		"violations": response,
+	})
+	return true
+}
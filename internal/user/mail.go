@@ -20,6 +20,11 @@ func NewMailer(smtpServer string, smtpPort int, username, password string) *Mail
 
 // SendVerificationEmail sends an email to the specified recipient with the given subject and body.
 func (m *Mailer) SendVerificationEmail(to, subject, token string) error {
+	return m.Send(to, subject, token)
+}
+
+// Send sends an email with the given subject and body to the specified recipient.
+func (m *Mailer) Send(to, subject, body string) error {
 	// Here you would implement the actual email sending logic.
 	// For example, using an SMTP server or a third-party service.
 	// This is just a placeholder implementation.
@@ -0,0 +1,23 @@
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	password BYTEA,
+	role TEXT NOT NULL,
+	active BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	delete_at TIMESTAMPTZ,
+	two_factor_secret TEXT NOT NULL DEFAULT '',
+	two_factor_active BOOLEAN NOT NULL DEFAULT FALSE,
+	two_factor_codes BYTEA[] NOT NULL DEFAULT '{}',
+	two_factor_last_step BIGINT NOT NULL DEFAULT 0,
+	email_change_id TEXT NOT NULL DEFAULT '',
+	email_change_new TEXT NOT NULL DEFAULT '',
+	email_change_old TEXT NOT NULL DEFAULT '',
+	email_change_confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+	CONSTRAINT users_email_key UNIQUE (email)
+);
+
+CREATE INDEX users_delete_at_idx ON users (delete_at) WHERE delete_at IS NOT NULL;
@@ -0,0 +1,78 @@
+package user
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// PostgresMigrations holds the versioned schema of the PostgreSQL user store.
+//
+//go:embed migrations/postgres/*.sql
+var PostgresMigrations embed.FS
+
+// PostgresMigrationsDir is the directory of the migrations in PostgresMigrations.
+const PostgresMigrationsDir = "migrations/postgres"
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// PostgresUserRepository implements UserRepository with a PostgreSQL database.
+// The schema is created by the migrations in PostgresMigrations.
+type PostgresUserRepository struct {
+	*sqlRepository
+}
+
+// NewPostgresUserRepository creates a new PostgresUserRepository.
+func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{&sqlRepository{db: db, dialect: postgres{}}}
+}
+
+// postgres stores the recovery codes as BYTEA[] and names the violated
+// constraints in its errors.
+type postgres struct{}
+
+func (postgres) codesValue(codes [][]byte) any {
+	if codes == nil {
+		return pq.ByteaArray{}
+	}
+	return pq.ByteaArray(codes)
+}
+
+func (postgres) codesTarget() (any, func() ([][]byte, error)) {
+	var codes pq.ByteaArray
+	return &codes, func() ([][]byte, error) {
+		if len(codes) == 0 {
+			return nil, nil
+		}
+		return codes, nil
+	}
+}
+
+func (postgres) uniqueViolation(err error) string {
+	switch constraintViolated(err, pgUniqueViolation) {
+	case "users_email_key":
+		return "email"
+	case "users_pkey":
+		return "id"
+	}
+	return ""
+}
+
+func (postgres) foreignKeyViolation(err error) bool {
+	return constraintViolated(err, pgForeignKeyViolation) != ""
+}
+
+// constraintViolated returns the name of the constraint if err is a PostgreSQL
+// error with the code.
+func constraintViolated(err error, code string) string {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) && string(pgErr.Code) == code {
+		return pgErr.Constraint
+	}
+	return ""
+}
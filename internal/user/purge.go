@@ -0,0 +1,107 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+type purgeRepository interface {
+	FindUsersDueForDeletion(ctx context.Context, now time.Time) ([]*User, error)
+	FindUserByID(ctx context.Context, id string) (*User, error)
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// dataEraser deletes the data another module stores for a user, e.g. access
+// tokens, bank accounts or bookings. It has to be idempotent, a failed purge is
+// repeated on the next run.
+type dataEraser interface {
+	DeleteUserData(ctx context.Context, userID string) error
+}
+
+// Purger removes users whose deletion grace period has ended in the background.
+type Purger struct {
+	repo     purgeRepository
+	tx       transactor
+	erasers  []dataEraser
+	log      logger.Logger
+	interval time.Duration
+}
+
+// NewPurger creates a new Purger. The erasers are called for every user before
+// the user itself is removed, all in one unit of work of tx.
+func NewPurger(repo purgeRepository, tx transactor, log logger.Logger, interval time.Duration, erasers ...dataEraser) *Purger {
+	return &Purger{
+		repo:     repo,
+		tx:       tx,
+		erasers:  erasers,
+		log:      log,
+		interval: interval,
+	}
+}
+
+// Run purges due users until the context is cancelled.
+func (p *Purger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := p.PurgeDue(ctx); err != nil {
+				p.log.Error(fmt.Sprintf("failed to purge deleted users. %v", err))
+			}
+		}
+	}
+}
+
+// PurgeDue deletes every user whose grace period has ended together with their data.
+func (p *Purger) PurgeDue(ctx context.Context) error {
+	now := time.Now().UTC()
+	users, err := p.repo.FindUsersDueForDeletion(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// a failing eraser rolls back the data already erased, so the user is
+		// either purged completely or stays due for the next run
+		purged := false
+		err := p.tx.WithinTx(ctx, func(ctx context.Context) error {
+			// a login may have restored the user since the search, so the
+			// deletion is checked again within the unit of work
+			current, err := p.repo.FindUserByID(ctx, user.ID())
+			if errors.Is(err, ErrUserNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !current.IstZurLoeschungVorgemerkt() || current.LoeschenAm().After(now) {
+				return nil
+			}
+			purged = true
+			for _, eraser := range p.erasers {
+				if err := eraser.DeleteUserData(ctx, user.ID()); err != nil {
+					return err
+				}
+			}
+			return p.repo.DeleteUser(ctx, user.ID())
+		})
+		if err != nil {
+			return fmt.Errorf("user %s: %w", user.ID(), err)
+		}
+		if !purged {
+			continue
+		}
+		p.log.Info(fmt.Sprintf("purged user %s", user.ID()))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+)
+
+type stubEraser struct {
+	err   error
+	users []string
+	gate  transaction.Gate
+}
+
+func (s *stubEraser) DeleteUserData(ctx context.Context, userID string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.users = append(s.users, userID)
+	return nil
+}
+
+func (s *stubEraser) Snapshot() func() {
+	users := slices.Clone(s.users)
+	return func() { s.users = users }
+}
+
+func (s *stubEraser) Gate() *transaction.Gate {
+	return &s.gate
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Error(string)   {}
+func (nopLogger) Warning(string) {}
+func (nopLogger) Info(string)    {}
+func (nopLogger) Debug(string)   {}
+func (nopLogger) Fatal(string)   {}
+
+func TestPurgeDue(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		loeschenAm  time.Time
+		eraserErr   error
+		expectErr   bool
+		expectFound bool
+	}{
+		{name: "Frist abgelaufen", loeschenAm: time.Now().Add(-time.Minute), expectFound: false},
+		{name: "Frist läuft noch", loeschenAm: time.Now().Add(time.Hour), expectFound: true},
+		{name: "Nicht vorgemerkt", expectFound: true},
+		{name: "Fehler beim Löschen der Daten", loeschenAm: time.Now().Add(-time.Minute), eraserErr: errors.New("store unavailable"), expectErr: true, expectFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := user.NewInMemoryUserRepository()
+			u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+			if !tt.loeschenAm.IsZero() {
+				u.LoeschungVorgemerkt(tt.loeschenAm)
+			}
+			_, err := repo.CreateUser(ctx, u)
+			require.NoError(t, err)
+			// the data erased before the failing eraser is rolled back
+			eraser, failing := &stubEraser{}, &stubEraser{err: tt.eraserErr}
+
+			err = user.NewPurger(repo, transaction.New(nil, repo, eraser), nopLogger{}, time.Minute, eraser, failing).PurgeDue(ctx)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			_, err = repo.FindUserByID(ctx, "123")
+			if tt.expectFound {
+				assert.NoError(t, err)
+				assert.Empty(t, eraser.users)
+				return
+			}
+			assert.ErrorIs(t, err, user.ErrUserNotFound)
+			assert.Equal(t, []string{"123"}, eraser.users)
+		})
+	}
+}
+
+// restoringRepository restores every user it finds due for deletion, like a
+// login that happens between the search and the purge.
+type restoringRepository struct {
+	*user.InMemoryUserRepository
+}
+
+func (r restoringRepository) FindUsersDueForDeletion(ctx context.Context, now time.Time) ([]*user.User, error) {
+	users, err := r.InMemoryUserRepository.FindUsersDueForDeletion(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, due := range users {
+		restored, err := r.FindUserByID(ctx, due.ID())
+		if err != nil {
+			return nil, err
+		}
+		restored.LoeschungAufgehoben()
+		if _, err := r.UpdateUser(ctx, restored); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+func TestPurgeDueSkipsRestoredUser(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.LoeschungVorgemerkt(time.Now().Add(-time.Minute))
+	_, err := repo.CreateUser(ctx, u)
+	require.NoError(t, err)
+	eraser := &stubEraser{}
+
+	err = user.NewPurger(restoringRepository{repo}, transaction.New(nil, repo, eraser), nopLogger{}, time.Minute, eraser).PurgeDue(ctx)
+	require.NoError(t, err)
+
+	found, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.False(t, found.IstZurLoeschungVorgemerkt())
+	assert.Empty(t, eraser.users)
+}
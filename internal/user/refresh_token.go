@@ -0,0 +1,62 @@
+package user
+
+import (
+	"time"
+)
+
+// RefreshToken repräsentiert einen ausgegebenen Refresh-Token. Alle Tokens, die
+// durch Rotation aus demselben Login hervorgehen, gehören zu einer Familie.
+type RefreshToken struct {
+	iD         string
+	userID     ID
+	familie    string
+	ersetzt    bool
+	laeuftAbAm time.Time
+	erstelltAm time.Time
+}
+
+// NewRefreshToken erzeugt einen neuen Refresh-Token mit expliziten Parametern.
+func NewRefreshToken(id string, userID ID, familie string, erstelltAm, laeuftAbAm time.Time) *RefreshToken {
+	return &RefreshToken{
+		iD:         id,
+		userID:     userID,
+		familie:    familie,
+		erstelltAm: erstelltAm,
+		laeuftAbAm: laeuftAbAm,
+	}
+}
+
+// ID gibt die ID (jti) des Tokens zurück.
+func (t *RefreshToken) ID() string {
+	return t.iD
+}
+
+// UserID gibt die ID des Users zurück, dem der Token gehört.
+func (t *RefreshToken) UserID() ID {
+	return t.userID
+}
+
+// Familie gibt die Token-Familie zurück.
+func (t *RefreshToken) Familie() string {
+	return t.familie
+}
+
+// IstErsetzt gibt zurück, ob der Token bereits gegen einen neuen getauscht wurde.
+func (t *RefreshToken) IstErsetzt() bool {
+	return t.ersetzt
+}
+
+// Ersetzt markiert den Token als rotiert.
+func (t *RefreshToken) Ersetzt() {
+	t.ersetzt = true
+}
+
+// ErstelltAm gibt den Ausstellungszeitpunkt des Tokens zurück.
+func (t *RefreshToken) ErstelltAm() time.Time {
+	return t.erstelltAm
+}
+
+// LaeuftAbAm gibt den Ablaufzeitpunkt des Tokens zurück.
+func (t *RefreshToken) LaeuftAbAm() time.Time {
+	return t.laeuftAbAm
+}
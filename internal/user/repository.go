@@ -2,24 +2,42 @@ package user
 
 import (
 	"context"
-	"errors"
+	"maps"
+	"sort"
 	"sync"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
 )
 
-// InMemoryUserRepository implements UserRepository with an in-memory store.
+// Store is the user storage the use case and the Purger depend on. Every
+// backend, e.g. InMemoryUserRepository, PostgresUserRepository or
+// SQLiteUserRepository, implements it.
+type Store interface {
+	repository
+	purgeRepository
+}
+
+// InMemoryUserRepository implements UserRepository with an in-memory store. It
+// keeps copies of the users, so a change only takes effect through the repository.
 type InMemoryUserRepository struct {
-	users         map[string]*User
+	users         map[string]User
 	emailToID     map[string]string
-	refreshTokens map[string][]string
+	refreshTokens map[string]RefreshToken
+	sessions      map[string]Session
+	externalIDs   map[string]string
+	gate          transaction.Gate
 	mutex         sync.RWMutex
 }
 
 // NewInMemoryUserRepository creates a new InMemoryUserRepository.
 func NewInMemoryUserRepository() *InMemoryUserRepository {
 	return &InMemoryUserRepository{
-		users:         make(map[string]*User),
+		users:         make(map[string]User),
 		emailToID:     make(map[string]string),
-		refreshTokens: make(map[string][]string),
+		refreshTokens: make(map[string]RefreshToken),
+		sessions:      make(map[string]Session),
+		externalIDs:   make(map[string]string),
 	}
 }
 
@@ -29,21 +47,22 @@ func (r *InMemoryUserRepository) CreateUser(ctx context.Context, user *User) (*U
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
+		defer r.gate.Enter(ctx)()
 		r.mutex.Lock()
 		defer r.mutex.Unlock()
 
 		if _, exists := r.emailToID[user.Email()]; exists {
-			return nil, errors.New("email already exists")
+			return nil, ErrEmailAlreadyExists
 		}
 
 		if _, exists := r.users[user.ID()]; exists {
-			return nil, errors.New("user ID already exists")
+			return nil, ErrUserAlreadyExists
 		}
 
 		user.Aktualisert()
-		user.ErstelltAm()
+		user.version = 1
 
-		r.users[user.ID()] = user
+		r.users[user.ID()] = *user
 		r.emailToID[user.Email()] = user.ID()
 		return user, nil
 	}
@@ -60,14 +79,14 @@ func (r *InMemoryUserRepository) FindUserByEmail(ctx context.Context, email stri
 
 		userID, exists := r.emailToID[email]
 		if !exists {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 
 		user, exists := r.users[userID]
 		if !exists {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
-		return user, nil
+		return &user, nil
 	}
 }
 
@@ -82,92 +101,352 @@ func (r *InMemoryUserRepository) FindUserByID(ctx context.Context, id string) (*
 
 		user, exists := r.users[id]
 		if !exists {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
-		return user, nil
+		return &user, nil
 	}
 }
 
-// LogoutUser removes a specific refresh token for a user.
-func (r *InMemoryUserRepository) LogoutUser(ctx context.Context, userID, refreshToken string) error {
+// LogoutUser revokes the token family of the refresh token with the given ID.
+func (r *InMemoryUserRepository) LogoutUser(ctx context.Context, userID, tokenID string) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
+		defer r.gate.Enter(ctx)()
 		r.mutex.Lock()
 		defer r.mutex.Unlock()
 
 		if _, exists := r.users[userID]; !exists {
-			return errors.New("user not found")
+			return ErrUserNotFound
 		}
 
-		tokens, exists := r.refreshTokens[userID]
-		if !exists {
+		token, exists := r.refreshTokens[tokenID]
+		if !exists || token.UserID() != userID {
 			return nil
 		}
+		r.revokeTokenFamily(token.Familie())
+		return nil
+	}
+}
+
+// SaveRefreshToken stores a newly issued refresh token.
+func (r *InMemoryUserRepository) SaveRefreshToken(ctx context.Context, token *RefreshToken) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, exists := r.users[token.UserID()]; !exists {
+			return ErrUserNotFound
+		}
+		r.refreshTokens[token.ID()] = *token
+		return nil
+	}
+}
+
+// FindRefreshToken retrieves a refresh token by its ID.
+func (r *InMemoryUserRepository) FindRefreshToken(ctx context.Context, tokenID string) (*RefreshToken, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		token, exists := r.refreshTokens[tokenID]
+		if !exists {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return &token, nil
+	}
+}
+
+// RotateRefreshToken marks the old token as replaced and stores its successor.
+// It fails with ErrRefreshTokenReused if the old token was already replaced.
+func (r *InMemoryUserRepository) RotateRefreshToken(ctx context.Context, oldTokenID string, next *RefreshToken) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		old, exists := r.refreshTokens[oldTokenID]
+		if !exists {
+			return ErrRefreshTokenNotFound
+		}
+		if old.IstErsetzt() {
+			return ErrRefreshTokenReused
+		}
+		old.Ersetzt()
+		r.refreshTokens[oldTokenID] = old
+		r.refreshTokens[next.ID()] = *next
+		return nil
+	}
+}
 
-		for i, token := range tokens {
-			if token == refreshToken {
-				// r.refreshTokens[userID] = slices.Delete(tokens, i, i+1)
-				r.refreshTokens[userID] = append(tokens[:i], tokens[i+1:]...)
-				if len(r.refreshTokens[userID]) == 0 {
-					delete(r.refreshTokens, userID)
-				}
-				return nil
+// RevokeTokenFamily removes every refresh token of the given family.
+func (r *InMemoryUserRepository) RevokeTokenFamily(ctx context.Context, family string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.revokeTokenFamily(family)
+		return nil
+	}
+}
+
+// revokeTokenFamily removes the refresh tokens of a family together with its session.
+func (r *InMemoryUserRepository) revokeTokenFamily(family string) {
+	for id, token := range r.refreshTokens {
+		if token.Familie() == family {
+			delete(r.refreshTokens, id)
+		}
+	}
+	delete(r.sessions, family)
+}
+
+// SaveSession stores a new session.
+func (r *InMemoryUserRepository) SaveSession(ctx context.Context, session *Session) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, exists := r.users[session.UserID()]; !exists {
+			return ErrUserNotFound
+		}
+		r.sessions[session.ID()] = *session
+		return nil
+	}
+}
+
+// FindSessionsByUserID returns all active sessions of a user, most recently used first.
+func (r *InMemoryUserRepository) FindSessionsByUserID(ctx context.Context, userID string) ([]*Session, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		sessions := make([]*Session, 0)
+		for _, session := range r.sessions {
+			if session.UserID() == userID {
+				sessions = append(sessions, &session)
 			}
 		}
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].ZuletztGenutztAm().After(sessions[j].ZuletztGenutztAm())
+		})
+		return sessions, nil
+	}
+}
+
+// TouchSession records a use of the session. It fails with ErrSessionNotFound
+// if the session was revoked.
+func (r *InMemoryUserRepository) TouchSession(ctx context.Context, sessionID string, at time.Time) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		session, exists := r.sessions[sessionID]
+		if !exists {
+			return ErrSessionNotFound
+		}
+		session.Genutzt(at)
+		r.sessions[sessionID] = session
 		return nil
 	}
 }
 
-// DeleteUser removes a user if the provided password matches.
-func (r *InMemoryUserRepository) DeleteUser(ctx context.Context, userID string, password []byte) error {
+// RevokeSession removes a session of the user together with its refresh tokens.
+func (r *InMemoryUserRepository) RevokeSession(ctx context.Context, userID, sessionID string) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
+		defer r.gate.Enter(ctx)()
 		r.mutex.Lock()
 		defer r.mutex.Unlock()
 
-		user, exists := r.users[userID]
+		session, exists := r.sessions[sessionID]
+		if !exists || session.UserID() != userID {
+			return ErrSessionNotFound
+		}
+		r.revokeTokenFamily(sessionID)
+		return nil
+	}
+}
+
+// RevokeOtherSessions removes every session of the user except keepSessionID.
+func (r *InMemoryUserRepository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		for id, session := range r.sessions {
+			if session.UserID() == userID && id != keepSessionID {
+				r.revokeTokenFamily(id)
+			}
+		}
+		return nil
+	}
+}
+
+// FindUserByExternalID retrieves the user linked to the subject of an external
+// identity provider.
+func (r *InMemoryUserRepository) FindUserByExternalID(ctx context.Context, issuer, subject string) (*User, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		id, exists := r.externalIDs[externalKey(issuer, subject)]
 		if !exists {
-			return errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
+		user, exists := r.users[id]
+		if !exists {
+			return nil, ErrUserNotFound
+		}
+		return &user, nil
+	}
+}
 
-		if !bytesEqual(user.Passwort(), password) {
-			return errors.New("invalid password")
+// LinkExternalID links the subject of an external identity provider to the user.
+func (r *InMemoryUserRepository) LinkExternalID(ctx context.Context, userID, issuer, subject string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, exists := r.users[userID]; !exists {
+			return ErrUserNotFound
+		}
+		key := externalKey(issuer, subject)
+		if id, exists := r.externalIDs[key]; exists && id != userID {
+			return ErrExternalIDAlreadyLinked
+		}
+		r.externalIDs[key] = userID
+		return nil
+	}
+}
+
+func externalKey(issuer, subject string) string {
+	return issuer + " " + subject
+}
+
+// DeleteUser removes a user together with its sessions, refresh tokens and
+// external identities.
+func (r *InMemoryUserRepository) DeleteUser(ctx context.Context, userID string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		user, exists := r.users[userID]
+		if !exists {
+			return ErrUserNotFound
 		}
 
 		delete(r.users, userID)
 		delete(r.emailToID, user.Email())
-		delete(r.refreshTokens, userID)
+		for id, session := range r.sessions {
+			if session.UserID() == userID {
+				r.revokeTokenFamily(id)
+			}
+		}
+		for id, token := range r.refreshTokens {
+			if token.UserID() == userID {
+				delete(r.refreshTokens, id)
+			}
+		}
+		for key, id := range r.externalIDs {
+			if id == userID {
+				delete(r.externalIDs, key)
+			}
+		}
 		return nil
 	}
 }
 
-// UpdateUser updates an existing user's information.
+// FindUsersDueForDeletion returns the users whose deletion grace period ended before now.
+func (r *InMemoryUserRepository) FindUsersDueForDeletion(ctx context.Context, now time.Time) ([]*User, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		users := make([]*User, 0)
+		for _, user := range r.users {
+			if user.IstZurLoeschungVorgemerkt() && !user.LoeschenAm().After(now) {
+				users = append(users, &user)
+			}
+		}
+		return users, nil
+	}
+}
+
+// UpdateUser updates an existing user's information. It fails with ErrConflict
+// if the user was changed since it was read and increments the version otherwise.
 func (r *InMemoryUserRepository) UpdateUser(ctx context.Context, user *User) (*User, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
+		defer r.gate.Enter(ctx)()
 		r.mutex.Lock()
 		defer r.mutex.Unlock()
 
 		existingUser, exists := r.users[user.ID()]
 		if !exists {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
+		}
+		if existingUser.version != user.version {
+			return nil, ErrConflict
 		}
 
 		if user.Email() != existingUser.Email() {
 			if otherID, exists := r.emailToID[user.Email()]; exists && otherID != user.ID() {
-				return nil, errors.New("email already exists")
+				return nil, ErrEmailAlreadyExists
 			}
 		}
 
 		user.Aktualisert()
+		user.version++
 
-		r.users[user.ID()] = user
+		r.users[user.ID()] = *user
 		if user.Email() != existingUser.Email() {
 			delete(r.emailToID, existingUser.Email())
 			r.emailToID[user.Email()] = user.ID()
@@ -178,23 +457,73 @@ func (r *InMemoryUserRepository) UpdateUser(ctx context.Context, user *User) (*U
 
 // ChangePassword updates the user's password.
 func (r *InMemoryUserRepository) ChangePassword(ctx context.Context, userID string, password []byte) error {
-	return errors.New("not implemented")
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		user, exists := r.users[userID]
+		if !exists {
+			return ErrUserNotFound
+		}
+		user.NeuesPasswort(password)
+		user.Aktualisert()
+		user.version++
+		r.users[userID] = user
+		return nil
+	}
 }
 
-// ChangeEmail changes the email of a user.
+// ChangeEmail swaps the email of a user and the email index under one lock, so
+// two users can never end up with the same email.
 func (r *InMemoryUserRepository) ChangeEmail(ctx context.Context, userID, email string) error {
-	return errors.New("not implemented")
-}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		defer r.gate.Enter(ctx)()
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
 
-// bytesEqual compares two byte slices for equality.
-func bytesEqual(a, b []byte) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
+		user, exists := r.users[userID]
+		if !exists {
+			return ErrUserNotFound
+		}
+		if otherID, exists := r.emailToID[email]; exists && otherID != userID {
+			return ErrEmailAlreadyExists
 		}
+
+		delete(r.emailToID, user.Email())
+		user.NeueEmail(email)
+		user.Aktualisert()
+		user.version++
+		r.users[userID] = user
+		r.emailToID[email] = userID
+		return nil
+	}
+}
+
+// Snapshot copies the stored users, sessions, refresh tokens and external
+// identities and returns a function that restores the copy.
+func (r *InMemoryUserRepository) Snapshot() func() {
+	r.mutex.RLock()
+	users, emailToID, refreshTokens := maps.Clone(r.users), maps.Clone(r.emailToID), maps.Clone(r.refreshTokens)
+	sessions, externalIDs := maps.Clone(r.sessions), maps.Clone(r.externalIDs)
+	r.mutex.RUnlock()
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.users, r.emailToID, r.refreshTokens = users, emailToID, refreshTokens
+		r.sessions, r.externalIDs = sessions, externalIDs
 	}
-	return true
+}
+
+// Gate returns the gate the writes of the repository pass.
+func (r *InMemoryUserRepository) Gate() *transaction.Gate {
+	return &r.gate
 }
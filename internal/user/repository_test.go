@@ -0,0 +1,17 @@
+package user_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user/usertest"
+)
+
+func TestUserRepository(t *testing.T) {
+	storetest.Backends(t, usertest.TestStore,
+		func() user.Store { return user.NewInMemoryUserRepository() },
+		func(db *sql.DB) user.Store { return user.NewSQLiteUserRepository(db) },
+	)
+}
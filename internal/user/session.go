@@ -0,0 +1,63 @@
+package user
+
+import (
+	"time"
+)
+
+// Session repräsentiert ein angemeldetes Gerät eines Users. Die ID der Sitzung
+// ist zugleich die Familie ihrer Refresh-Tokens.
+type Session struct {
+	iD               string
+	userID           ID
+	userAgent        string
+	ip               string
+	erstelltAm       time.Time
+	zuletztGenutztAm time.Time
+}
+
+// NewSession erzeugt eine neue Sitzung mit expliziten Parametern.
+func NewSession(id string, userID ID, userAgent, ip string, erstelltAm time.Time) *Session {
+	return &Session{
+		iD:               id,
+		userID:           userID,
+		userAgent:        userAgent,
+		ip:               ip,
+		erstelltAm:       erstelltAm,
+		zuletztGenutztAm: erstelltAm,
+	}
+}
+
+// ID gibt die ID der Sitzung zurück.
+func (s *Session) ID() string {
+	return s.iD
+}
+
+// UserID gibt die ID des Users zurück, dem die Sitzung gehört.
+func (s *Session) UserID() ID {
+	return s.userID
+}
+
+// UserAgent gibt den User-Agent des Geräts zurück.
+func (s *Session) UserAgent() string {
+	return s.userAgent
+}
+
+// IP gibt die IP-Adresse zurück, von der aus die Anmeldung erfolgte.
+func (s *Session) IP() string {
+	return s.ip
+}
+
+// ErstelltAm gibt den Anmeldezeitpunkt zurück.
+func (s *Session) ErstelltAm() time.Time {
+	return s.erstelltAm
+}
+
+// ZuletztGenutztAm gibt den Zeitpunkt der letzten Nutzung zurück.
+func (s *Session) ZuletztGenutztAm() time.Time {
+	return s.zuletztGenutztAm
+}
+
+// Genutzt vermerkt eine Nutzung der Sitzung.
+func (s *Session) Genutzt(at time.Time) {
+	s.zuletztGenutztAm = at
+}
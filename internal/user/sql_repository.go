@@ -0,0 +1,377 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
+)
+
+const userColumns = `id, first_name, last_name, email, password, role, active, created_at, updated_at, delete_at,
+	two_factor_secret, two_factor_active, two_factor_codes, two_factor_last_step,
+	email_change_id, email_change_new, email_change_old, email_change_confirmed, version`
+
+// dialect covers the differences of the SQL databases the user store runs on.
+type dialect interface {
+	// codesValue converts the hashed recovery codes into a column value.
+	codesValue(codes [][]byte) any
+	// codesTarget returns the scan destination of the recovery codes and a
+	// function that reads the codes after the scan.
+	codesTarget() (any, func() ([][]byte, error))
+	// uniqueViolation returns the column of the users table whose unique
+	// constraint err violated, e.g. email, or an empty string.
+	uniqueViolation(err error) string
+	// foreignKeyViolation reports whether err violated a foreign key.
+	foreignKeyViolation(err error) bool
+}
+
+// sqlRepository implements the user store with database/sql. The queries only
+// use standard SQL, so PostgreSQL and SQLite share them. Inside a unit of work
+// of the transaction package the queries run in its transaction.
+type sqlRepository struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// CreateUser adds a new user to the repository.
+func (r *sqlRepository) CreateUser(ctx context.Context, user *User) (*User, error) {
+	user.Aktualisert()
+	user.version = 1
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`, r.userValues(user)...)
+	if err != nil {
+		switch r.dialect.uniqueViolation(err) {
+		case "email":
+			return nil, ErrEmailAlreadyExists
+		case "id":
+			return nil, ErrUserAlreadyExists
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// FindUserByEmail retrieves a user by their email.
+func (r *sqlRepository) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	return r.scanUser(r.conn(ctx).QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email))
+}
+
+// FindUserByID retrieves a user by their ID.
+func (r *sqlRepository) FindUserByID(ctx context.Context, id string) (*User, error) {
+	return r.scanUser(r.conn(ctx).QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+// LogoutUser revokes the token family of the refresh token with the given ID.
+func (r *sqlRepository) LogoutUser(ctx context.Context, userID, tokenID string) error {
+	if _, err := r.FindUserByID(ctx, userID); err != nil {
+		return err
+	}
+	var family string
+	err := r.conn(ctx).QueryRowContext(ctx, `SELECT family FROM refresh_tokens WHERE id = $1 AND user_id = $2`, tokenID, userID).Scan(&family)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.RevokeTokenFamily(ctx, family)
+}
+
+// UpdateUser updates an existing user's information. It fails with ErrConflict
+// if the user was changed since it was read and increments the version otherwise.
+func (r *sqlRepository) UpdateUser(ctx context.Context, user *User) (*User, error) {
+	user.Aktualisert()
+	result, err := r.conn(ctx).ExecContext(ctx, `UPDATE users SET first_name = $2, last_name = $3, email = $4, password = $5, role = $6,
+		active = $7, created_at = $8, updated_at = $9, delete_at = $10, two_factor_secret = $11, two_factor_active = $12,
+		two_factor_codes = $13, two_factor_last_step = $14, email_change_id = $15, email_change_new = $16,
+		email_change_old = $17, email_change_confirmed = $18, version = version + 1
+		WHERE id = $1 AND version = $19`, r.userValues(user)...)
+	if err != nil {
+		if r.dialect.uniqueViolation(err) == "email" {
+			return nil, ErrEmailAlreadyExists
+		}
+		return nil, err
+	}
+	if err := expectRow(result, ErrConflict); err != nil {
+		// no row matched: the user is either gone or has a newer version
+		if _, findErr := r.FindUserByID(ctx, user.ID()); findErr != nil {
+			return nil, findErr
+		}
+		return nil, err
+	}
+	user.version++
+	return user, nil
+}
+
+// ChangePassword updates the user's password.
+func (r *sqlRepository) ChangePassword(ctx context.Context, userID string, password []byte) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `UPDATE users SET password = $2, updated_at = $3, version = version + 1 WHERE id = $1`, userID, password, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return expectRow(result, ErrUserNotFound)
+}
+
+// ChangeEmail swaps the email of a user. The unique constraint rejects an email
+// another user took in the meantime.
+func (r *sqlRepository) ChangeEmail(ctx context.Context, userID, email string) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `UPDATE users SET email = $2, updated_at = $3, version = version + 1 WHERE id = $1`, userID, email, time.Now().UTC())
+	if err != nil {
+		if r.dialect.uniqueViolation(err) == "email" {
+			return ErrEmailAlreadyExists
+		}
+		return err
+	}
+	return expectRow(result, ErrUserNotFound)
+}
+
+// SaveRefreshToken stores a newly issued refresh token.
+func (r *sqlRepository) SaveRefreshToken(ctx context.Context, token *RefreshToken) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO refresh_tokens (id, user_id, family, replaced, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		token.ID(), token.UserID(), token.Familie(), token.IstErsetzt(), token.ErstelltAm().UTC(), token.LaeuftAbAm().UTC())
+	if r.dialect.foreignKeyViolation(err) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// FindRefreshToken retrieves a refresh token by its ID.
+func (r *sqlRepository) FindRefreshToken(ctx context.Context, tokenID string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := r.conn(ctx).QueryRowContext(ctx, `SELECT id, user_id, family, replaced, created_at, expires_at FROM refresh_tokens WHERE id = $1`, tokenID).
+		Scan(&token.iD, &token.userID, &token.familie, &token.ersetzt, &token.erstelltAm, &token.laeuftAbAm)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.erstelltAm, token.laeuftAbAm = token.erstelltAm.UTC(), token.laeuftAbAm.UTC()
+	return &token, nil
+}
+
+// RotateRefreshToken marks the old token as replaced and stores its successor.
+// It fails with ErrRefreshTokenReused if the old token was already replaced.
+func (r *sqlRepository) RotateRefreshToken(ctx context.Context, oldTokenID string, next *RefreshToken) error {
+	return transaction.InTx(ctx, r.db, func(tx transaction.Querier) error {
+		result, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET replaced = TRUE WHERE id = $1 AND NOT replaced`, oldTokenID)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			var exists bool
+			if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE id = $1)`, oldTokenID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return ErrRefreshTokenNotFound
+			}
+			return ErrRefreshTokenReused
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO refresh_tokens (id, user_id, family, replaced, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			next.ID(), next.UserID(), next.Familie(), next.IstErsetzt(), next.ErstelltAm().UTC(), next.LaeuftAbAm().UTC())
+		return err
+	})
+}
+
+// RevokeTokenFamily removes every refresh token of the given family together with its session.
+func (r *sqlRepository) RevokeTokenFamily(ctx context.Context, family string) error {
+	return transaction.InTx(ctx, r.db, func(tx transaction.Querier) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE family = $1`, family); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, family)
+		return err
+	})
+}
+
+// SaveSession stores a new session.
+func (r *sqlRepository) SaveSession(ctx context.Context, session *Session) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_used_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET user_agent = EXCLUDED.user_agent, ip = EXCLUDED.ip, last_used_at = EXCLUDED.last_used_at`,
+		session.ID(), session.UserID(), session.UserAgent(), session.IP(), session.ErstelltAm().UTC(), session.ZuletztGenutztAm().UTC())
+	if r.dialect.foreignKeyViolation(err) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// FindSessionsByUserID returns all active sessions of a user, most recently used first.
+func (r *sqlRepository) FindSessionsByUserID(ctx context.Context, userID string) ([]*Session, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT id, user_id, user_agent, ip, created_at, last_used_at FROM sessions
+		WHERE user_id = $1 ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]*Session, 0)
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.iD, &session.userID, &session.userAgent, &session.ip, &session.erstelltAm, &session.zuletztGenutztAm); err != nil {
+			return nil, err
+		}
+		session.erstelltAm, session.zuletztGenutztAm = session.erstelltAm.UTC(), session.zuletztGenutztAm.UTC()
+		sessions = append(sessions, &session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records a use of the session. It fails with ErrSessionNotFound
+// if the session was revoked.
+func (r *sqlRepository) TouchSession(ctx context.Context, sessionID string, at time.Time) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `UPDATE sessions SET last_used_at = $2 WHERE id = $1`, sessionID, at.UTC())
+	if err != nil {
+		return err
+	}
+	return expectRow(result, ErrSessionNotFound)
+}
+
+// RevokeSession removes a session of the user together with its refresh tokens.
+func (r *sqlRepository) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	return transaction.InTx(ctx, r.db, func(tx transaction.Querier) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, sessionID, userID)
+		if err != nil {
+			return err
+		}
+		if err := expectRow(result, ErrSessionNotFound); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE family = $1`, sessionID)
+		return err
+	})
+}
+
+// RevokeOtherSessions removes every session of the user except keepSessionID.
+func (r *sqlRepository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	return transaction.InTx(ctx, r.db, func(tx transaction.Querier) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE family IN (
+			SELECT id FROM sessions WHERE user_id = $1 AND id <> $2)`, userID, keepSessionID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1 AND id <> $2`, userID, keepSessionID)
+		return err
+	})
+}
+
+// FindUserByExternalID retrieves the user linked to the subject of an external
+// identity provider.
+func (r *sqlRepository) FindUserByExternalID(ctx context.Context, issuer, subject string) (*User, error) {
+	return r.scanUser(r.conn(ctx).QueryRowContext(ctx, `SELECT `+userColumns+` FROM users
+		WHERE id = (SELECT user_id FROM external_identities WHERE issuer = $1 AND subject = $2)`, issuer, subject))
+}
+
+// LinkExternalID links the subject of an external identity provider to the user.
+func (r *sqlRepository) LinkExternalID(ctx context.Context, userID, issuer, subject string) error {
+	var linkedID string
+	err := r.conn(ctx).QueryRowContext(ctx, `INSERT INTO external_identities (issuer, subject, user_id) VALUES ($1, $2, $3)
+		ON CONFLICT (issuer, subject) DO UPDATE SET user_id = external_identities.user_id
+		RETURNING user_id`, issuer, subject, userID).Scan(&linkedID)
+	if r.dialect.foreignKeyViolation(err) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if linkedID != userID {
+		return ErrExternalIDAlreadyLinked
+	}
+	return nil
+}
+
+// DeleteUser removes a user. Sessions, refresh tokens and external identities
+// are removed by the foreign keys.
+func (r *sqlRepository) DeleteUser(ctx context.Context, userID string) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result, ErrUserNotFound)
+}
+
+// FindUsersDueForDeletion returns the users whose deletion grace period ended before now.
+func (r *sqlRepository) FindUsersDueForDeletion(ctx context.Context, now time.Time) ([]*User, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT `+userColumns+` FROM users WHERE delete_at IS NOT NULL AND delete_at <= $1`, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*User, 0)
+	for rows.Next() {
+		user, err := r.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// conn returns the transaction of the context or the database.
+func (r *sqlRepository) conn(ctx context.Context) transaction.Querier {
+	return transaction.Conn(ctx, r.db)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (r *sqlRepository) scanUser(row rowScanner) (*User, error) {
+	var (
+		user     User
+		deleteAt sql.NullTime
+	)
+	codes, readCodes := r.dialect.codesTarget()
+	err := row.Scan(&user.iD, &user.vorname, &user.nachname, &user.email, &user.passwort, &user.rolle, &user.Aktiv,
+		&user.erstelltAm, &user.aktuallisiertAm, &deleteAt,
+		&user.zweiFaktor.secret, &user.zweiFaktor.aktiv, codes, &user.zweiFaktor.letzterSchritt,
+		&user.emailAenderung.iD, &user.emailAenderung.neueEmail, &user.emailAenderung.alteEmail, &user.emailAenderung.bestaetigt,
+		&user.version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.zweiFaktor.codes, err = readCodes(); err != nil {
+		return nil, err
+	}
+	user.erstelltAm, user.aktuallisiertAm = user.erstelltAm.UTC(), user.aktuallisiertAm.UTC()
+	if deleteAt.Valid {
+		user.loeschenAm = deleteAt.Time.UTC()
+	}
+	return &user, nil
+}
+
+func (r *sqlRepository) userValues(user *User) []any {
+	var deleteAt sql.NullTime
+	if user.IstZurLoeschungVorgemerkt() {
+		deleteAt = sql.NullTime{Time: user.LoeschenAm().UTC(), Valid: true}
+	}
+	return []any{
+		user.ID(), user.Vorname(), user.Nachname(), user.Email(), user.Passwort(), user.Rolle(), user.IstAktiv(),
+		user.ErstelltAm().UTC(), user.AktualisiertAm().UTC(), deleteAt,
+		user.ZweiFaktorSecret(), user.IstZweiFaktorAktiv(), r.dialect.codesValue(user.WiederherstellungsCodes()), user.LetzterTOTPSchritt(),
+		user.emailAenderung.iD, user.emailAenderung.neueEmail, user.emailAenderung.alteEmail, user.emailAenderung.bestaetigt,
+		user.version,
+	}
+}
+
+func expectRow(result sql.Result, notFound error) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return notFound
+	}
+	return nil
+}
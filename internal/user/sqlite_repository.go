@@ -0,0 +1,62 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	driver "modernc.org/sqlite"
+)
+
+// SQLiteUserRepository implements UserRepository with a SQLite database. The
+// schema is part of the migrations in sqlite.Migrations.
+type SQLiteUserRepository struct {
+	*sqlRepository
+}
+
+// NewSQLiteUserRepository creates a new SQLiteUserRepository.
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{&sqlRepository{db: db, dialect: sqliteDialect{}}}
+}
+
+// sqliteDialect stores the recovery codes as JSON array and names the violated
+// column in the error message, e.g. "UNIQUE constraint failed: users.email".
+type sqliteDialect struct{}
+
+func (sqliteDialect) codesValue(codes [][]byte) any {
+	if codes == nil {
+		codes = [][]byte{}
+	}
+	value, _ := json.Marshal(codes)
+	return string(value)
+}
+
+func (sqliteDialect) codesTarget() (any, func() ([][]byte, error)) {
+	var value string
+	return &value, func() ([][]byte, error) {
+		var codes [][]byte
+		if err := json.Unmarshal([]byte(value), &codes); err != nil {
+			return nil, err
+		}
+		if len(codes) == 0 {
+			return nil, nil
+		}
+		return codes, nil
+	}
+}
+
+func (sqliteDialect) uniqueViolation(err error) string {
+	var sqliteErr *driver.Error
+	if !sqlite.IsUniqueViolation(err) || !errors.As(err, &sqliteErr) {
+		return ""
+	}
+	_, column, _ := strings.Cut(sqliteErr.Error(), "users.")
+	column, _, _ = strings.Cut(column, " ")
+	return column
+}
+
+func (sqliteDialect) foreignKeyViolation(err error) bool {
+	return sqlite.IsForeignKeyViolation(err)
+}
@@ -2,9 +2,22 @@ package user
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/mail"
+	"slices"
+	"strings"
 	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/export"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/oidc"
 )
 
 var (
@@ -16,36 +29,85 @@ var (
 	ErrEmailTooLong = errors.New("Email too long. Maximum 256 characters")
 	// ErrUserNotFound is returned when a user is not found
 	ErrUserNotFound = errors.New("User not found")
+	// ErrUserAlreadyExists is returned when a user with the same ID already exists
+	ErrUserAlreadyExists = errors.New("User already exists")
+	// ErrConflict is returned when a user was changed since the given version was read
+	ErrConflict = errors.New("User was changed in the meantime")
 	// ErrUserNotActive is returned when a user is not active
 	ErrUserNotActive = errors.New("User not active")
 	// ErrUserAlreadyActivated is returned when a user is already verified
 	ErrUserAlreadyActivated = errors.New("User already verified")
 	// ErrInvalidPassword is returned when the password is invalid
 	ErrInvalidPassword = errors.New("Invalid password")
-	// ErrPasswordTooShort is returned when the password is too short
-	ErrPasswordTooShort = errors.New("Password too short. At least 8 characters")
 	// ErrFirstNameTooLong is returned when the first name is too long
 	ErrFirstNameTooLong = errors.New("First name too long. Maximum 50 characters")
 	// ErrLastNameTooLong is returned when the last name is too long
 	ErrLastNameTooLong = errors.New("Last name too long. Maximum 50 characters")
+	// ErrInvalidRefreshToken is returned when a refresh token is invalid, expired or revoked
+	ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+	// ErrRefreshTokenNotFound is returned when a refresh token is not stored
+	ErrRefreshTokenNotFound = errors.New("Refresh token not found")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is used again
+	ErrRefreshTokenReused = errors.New("Refresh token reused")
+	// ErrSessionNotFound is returned when a session does not exist or was revoked
+	ErrSessionNotFound = errors.New("Session not found")
+	// ErrTwoFactorAlreadyEnabled is returned when 2FA is enrolled a second time
+	ErrTwoFactorAlreadyEnabled = errors.New("Two-factor authentication already enabled")
+	// ErrTwoFactorNotEnrolled is returned when 2FA is confirmed without enrollment
+	ErrTwoFactorNotEnrolled = errors.New("Two-factor authentication not enrolled")
+	// ErrInvalidTwoFactorCode is returned when a TOTP or recovery code is wrong
+	ErrInvalidTwoFactorCode = errors.New("Invalid two-factor code")
+	// ErrInvalidChallengeToken is returned when a 2FA challenge token is invalid or expired
+	ErrInvalidChallengeToken = errors.New("Invalid challenge token")
+	// ErrInvalidResetToken is returned when a password reset token is invalid, expired or used
+	ErrInvalidResetToken = errors.New("Invalid reset token")
+	// ErrExternalIDAlreadyLinked is returned when an external identity belongs to another user
+	ErrExternalIDAlreadyLinked = errors.New("External identity already linked")
+	// ErrExternalEmailNotVerified is returned when the identity provider did not verify the email
+	ErrExternalEmailNotVerified = errors.New("Email not verified by identity provider")
+	// ErrDeletionAlreadyScheduled is returned when a user requests the deletion a second time
+	ErrDeletionAlreadyScheduled = errors.New("Deletion already scheduled")
+	// ErrInvalidEmailChangeToken is returned when an email change token is invalid, expired or superseded
+	ErrInvalidEmailChangeToken = errors.New("Invalid email change token")
+	// ErrInvalidVerificationToken is returned when an email verification token is invalid or expired
+	ErrInvalidVerificationToken = errors.New("Invalid verification token")
 )
 
 const (
 	maxFirstNameLength = 128
 	maxLastNameLength  = 128
 	maxEmailLength     = 256
-	minPasswordLength  = 8
+
+	twoFactorChallengeExpire = 5 * time.Minute
+	emailUndoExpire          = 7 * 24 * time.Hour
+	recoveryCodeCount        = 10
 )
 
 type repository interface {
 	CreateUser(ctx context.Context, user *User) (*User, error)
 	FindUserByEmail(ctx context.Context, email string) (*User, error)
 	FindUserByID(ctx context.Context, id string) (*User, error)
-	LogoutUser(ctx context.Context, userID, refreshToken string) error
-	DeleteUser(ctx context.Context, userID string, password []byte) error
+	LogoutUser(ctx context.Context, userID, tokenID string) error
 	UpdateUser(ctx context.Context, user *User) (*User, error)
 	ChangePassword(ctx context.Context, userID string, password []byte) error
 	ChangeEmail(ctx context.Context, userID, email string) error
+	SaveRefreshToken(ctx context.Context, token *RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenID string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldTokenID string, next *RefreshToken) error
+	RevokeTokenFamily(ctx context.Context, family string) error
+	SaveSession(ctx context.Context, session *Session) error
+	FindSessionsByUserID(ctx context.Context, userID string) ([]*Session, error)
+	TouchSession(ctx context.Context, sessionID string, at time.Time) error
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error
+	FindUserByExternalID(ctx context.Context, issuer, subject string) (*User, error)
+	LinkExternalID(ctx context.Context, userID, issuer, subject string) error
+}
+
+// transactor runs a unit of work that spans several stores, e.g. the user and
+// the outbox. Every store called with the context passed to fn takes part in it.
+type transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type uuidGenerator interface {
@@ -55,40 +117,100 @@ type uuidGenerator interface {
 type passwordHasher interface {
 	GeneratePassword(password string) ([]byte, error)
 	ValidatePassword(hash []byte, clearword string) error
+	NeedsRehash(hash []byte) bool
+}
+
+type passwordPolicy interface {
+	Check(password string, personalInfo ...string) error
 }
 
 type tokenGenerator interface {
-	GenerateAccessToken(userID string, ttl time.Duration) (string, error)
-	GenerateRefreshToken(userID string, ttl time.Duration) (string, error)
+	GenerateAccessToken(userID, role, sessionID string, ttl time.Duration) (string, error)
+	GenerateRefreshToken(userID, tokenID string, ttl time.Duration) (string, error)
+	GenerateVerificationToken(userID string, ttl time.Duration) (string, error)
+	GenerateChallengeToken(userID string, ttl time.Duration) (string, error)
+	GenerateResetToken(userID, fingerprint string, ttl time.Duration) (string, error)
+	GenerateEmailChangeToken(userID, changeID string, ttl time.Duration) (string, error)
+	GenerateEmailUndoToken(userID, changeID string, ttl time.Duration) (string, error)
+}
+
+type tokenManager interface {
+	tokenGenerator
+	ParseRefreshToken(tokenString string) (*auth.Claims, error)
+	ParseVerificationToken(tokenString string) (*auth.Claims, error)
+	ParseChallengeToken(tokenString string) (*auth.Claims, error)
+	ParseResetToken(tokenString string) (*auth.Claims, error)
+	ParseEmailChangeToken(tokenString string) (*auth.Claims, error)
+	ParseEmailUndoToken(tokenString string) (*auth.Claims, error)
+}
+
+type loginGuard interface {
+	Check(ctx context.Context, account, ip string) error
+	RecordFailure(ctx context.Context, account, ip string) (bool, error)
+	RecordSuccess(ctx context.Context, account string) error
+	Unlock(ctx context.Context, account string) error
+}
+
+type otpGenerator interface {
+	GenerateSecret() (string, error)
+	URI(account, secret string) string
+	Validate(secret, code string) (int64, bool)
+}
+
+type oidcClient interface {
+	AuthCodeURL(ctx context.Context) (string, string, error)
+	Exchange(ctx context.Context, state, code string) (*oidc.Identity, error)
+}
+
+type auditLog interface {
+	Record(ctx context.Context, event *audit.Event) error
 }
 
-type emailSender interface {
-	SendVerificationEmail(to, subject, token string) error
+type mailQueue interface {
+	Enqueue(ctx context.Context, to, subject, body string) error
 }
 
 // UseCase is the use case for creating a user
 type UseCase struct {
 	repo                    repository
+	tx                      transactor
 	uuidGen                 uuidGenerator
 	hash                    passwordHasher
-	mailer                  emailSender
-	tokenGen                tokenGenerator
+	policy                  passwordPolicy
+	mailer                  mailQueue
+	tokenGen                tokenManager
+	otp                     otpGenerator
+	oidc                    oidcClient
+	guard                   loginGuard
+	audit                   auditLog
 	accessTokenExpire       time.Duration
 	refreshTokenExpire      time.Duration
 	verificationTokenExpire time.Duration
+	deletionGracePeriod     time.Duration
+	adminEmails             []string
 }
 
-// NewUseCase creates a new CreateUserUseCase
-func NewUseCase(repo repository, uuidGen uuidGenerator, hash passwordHasher, mailer emailSender, tokenGen tokenGenerator, accessTokenExpire, refreshTokenExpire, verificationTokenExpire time.Duration) *UseCase {
+// NewUseCase creates a new CreateUserUseCase. Users get the admin role once one
+// of the adminEmails is verified as theirs. Deleted accounts are kept for the
+// deletionGracePeriod and restored by a login.
+func NewUseCase(repo repository, tx transactor, uuidGen uuidGenerator, hash passwordHasher, policy passwordPolicy, mailer mailQueue, tokenGen tokenManager, otp otpGenerator, provider oidcClient, guard loginGuard, auditor auditLog, accessTokenExpire, refreshTokenExpire, verificationTokenExpire, deletionGracePeriod time.Duration, adminEmails []string) *UseCase {
 	return &UseCase{
 		repo:                    repo,
+		tx:                      tx,
 		uuidGen:                 uuidGen,
 		hash:                    hash,
+		policy:                  policy,
 		mailer:                  mailer,
 		tokenGen:                tokenGen,
+		otp:                     otp,
+		oidc:                    provider,
+		guard:                   guard,
+		audit:                   auditor,
 		accessTokenExpire:       accessTokenExpire,
 		refreshTokenExpire:      refreshTokenExpire,
 		verificationTokenExpire: verificationTokenExpire,
+		deletionGracePeriod:     deletionGracePeriod,
+		adminEmails:             adminEmails,
 	}
 }
 
@@ -113,9 +235,6 @@ func (i *CreateInput) validate() error {
 	if _, err := mail.ParseAddress(i.Email); err != nil {
 		return ErrInvalidEmail
 	}
-	if len(i.Password) < minPasswordLength {
-		return ErrPasswordTooShort
-	}
 	return nil
 }
 
@@ -128,6 +247,9 @@ func (c *UseCase) CreateUser(ctx context.Context, input *CreateInput) error {
 	if err := input.validate(); err != nil {
 		return err
 	}
+	if err := c.policy.Check(input.Password, input.Email, input.FirstName, input.LastName); err != nil {
+		return err
+	}
 
 	pwdHash, err := c.hash.GeneratePassword(input.Password)
 	if err != nil {
@@ -141,20 +263,19 @@ func (c *UseCase) CreateUser(ctx context.Context, input *CreateInput) error {
 
 	now := time.Now()
 	user := NewUser(id, input.FirstName, input.LastName, input.Email, pwdHash, now, now)
-	if _, err = c.repo.CreateUser(ctx, user); err != nil {
-		return err
-	}
-
-	verificationToken, err := c.tokenGen.GenerateAccessToken(user.ID(), time.Second*c.verificationTokenExpire)
+	verificationToken, err := c.tokenGen.GenerateVerificationToken(user.ID(), time.Second*c.verificationTokenExpire)
 	if err != nil {
 		return err
 	}
 
-	if err := c.mailer.SendVerificationEmail(user.Email(), "Account Verification", verificationToken); err != nil {
-		return err
-	}
-
-	return nil
+	// the mail is delivered by the outbox worker, so an unreachable mail server
+	// does not fail the registration
+	return c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := c.repo.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		return c.mailer.Enqueue(ctx, user.Email(), "Account Verification", verificationToken)
+	})
 }
 
 type userActivator interface {
@@ -170,33 +291,64 @@ func (c *UseCase) ActivateUser(ctx context.Context, userID string) error {
 	if user.IstAktiv() {
 		return ErrUserAlreadyActivated
 	}
-	user.Aktiviert()
+	c.activate(user)
 	if _, err := c.repo.UpdateUser(ctx, user); err != nil {
 		return err
 	}
 	return nil
 }
 
+type emailVerifier interface {
+	VerifyEmail(ctx context.Context, token string) error
+}
+
+// VerifyEmail is the interactor for verifying a user with the token of the
+// verification mail sent on registration.
+func (c *UseCase) VerifyEmail(ctx context.Context, token string) error {
+	claims, err := c.tokenGen.ParseVerificationToken(token)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	return c.ActivateUser(ctx, claims.Sub)
+}
+
 // LoginInput is the input for the login use case
 type LoginInput struct {
-	Email    string
-	Password string
+	Email     string
+	Password  string
+	UserAgent string
+	IP        string
 }
 
-// LoginOutput is the output for the login use case
+// LoginOutput is the output for the login use case. If the user has two-factor
+// authentication enabled, only ChallengeToken is set.
 type LoginOutput struct {
-	AccessToken  string
-	RefreshToken string
+	AccessToken    string
+	RefreshToken   string
+	ChallengeToken string
 }
 
 type userAuthenticator interface {
 	LoginUser(ctx context.Context, input *LoginInput) (*LoginOutput, error)
 }
 
-// LoginUser is the interactor for logging in a user
+// LoginUser is the interactor for logging in a user. Failed attempts are throttled
+// per account and IP, the account owner is notified when the account gets locked.
 func (c *UseCase) LoginUser(ctx context.Context, input *LoginInput) (*LoginOutput, error) {
+	if err := c.guard.Check(ctx, input.Email, input.IP); err != nil {
+		return nil, err
+	}
+
 	user, err := c.repo.FindUserByEmail(ctx, input.Email)
 	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			if _, err := c.guard.RecordFailure(ctx, input.Email, input.IP); err != nil {
+				return nil, err
+			}
+			if err := c.audit.Record(ctx, &audit.Event{Action: audit.ActionLoginFailed, TargetType: audit.TargetUser, IP: input.IP}); err != nil {
+				return nil, err
+			}
+		}
 		return nil, err
 	}
 
@@ -205,15 +357,258 @@ func (c *UseCase) LoginUser(ctx context.Context, input *LoginInput) (*LoginOutpu
 	}
 
 	if err := c.hash.ValidatePassword(user.Passwort(), input.Password); err != nil {
+		if err := c.recordLoginFailure(ctx, user, input.IP); err != nil {
+			return nil, err
+		}
 		return nil, ErrInvalidPassword
 	}
 
-	accessToken, err := c.tokenGen.GenerateAccessToken(user.ID(), time.Second*c.accessTokenExpire)
+	if err := c.rehashPassword(ctx, user, input.Password); err != nil {
+		return nil, err
+	}
+
+	// with 2FA the counter is only reset after the second factor, otherwise
+	// every correct password would allow further guesses of the TOTP code
+	if user.IstZweiFaktorAktiv() {
+		challengeToken, err := c.tokenGen.GenerateChallengeToken(user.ID(), twoFactorChallengeExpire)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginOutput{ChallengeToken: challengeToken}, nil
+	}
+
+	if err := c.guard.RecordSuccess(ctx, user.Email()); err != nil {
+		return nil, err
+	}
+
+	return c.startSession(ctx, user, input.UserAgent, input.IP)
+}
+
+// recordLoginFailure counts a failed attempt and notifies the user if the account got locked.
+func (c *UseCase) recordLoginFailure(ctx context.Context, user *User, ip string) error {
+	locked, err := c.guard.RecordFailure(ctx, user.Email(), ip)
+	if err != nil {
+		return err
+	}
+	if err := c.audit.Record(ctx, &audit.Event{Action: audit.ActionLoginFailed, TargetType: audit.TargetUser, TargetID: user.ID(), IP: ip, After: map[string]any{"locked": locked}}); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	body := "Your account was temporarily locked after too many failed login attempts. " +
+		"If this was not you, please change your password after the lock has expired."
+	return c.mailer.Enqueue(ctx, user.Email(), "Account Locked", body)
+}
+
+// OIDCStartOutput is the output for the start OIDC login use case. State has to be
+// bound to the browser, e.g. in a cookie, and compared on the callback.
+type OIDCStartOutput struct {
+	URL   string
+	State string
+}
+
+// OIDCLoginInput is the input for the OIDC login use case
+type OIDCLoginInput struct {
+	State     string
+	Code      string
+	UserAgent string
+	IP        string
+}
+
+type oidcAuthenticator interface {
+	StartOIDCLogin(ctx context.Context) (*OIDCStartOutput, error)
+	LoginWithOIDC(ctx context.Context, input *OIDCLoginInput) (*LoginOutput, error)
+}
+
+// StartOIDCLogin is the interactor for redirecting to the identity provider
+func (c *UseCase) StartOIDCLogin(ctx context.Context) (*OIDCStartOutput, error) {
+	url, state, err := c.oidc.AuthCodeURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCStartOutput{URL: url, State: state}, nil
+}
+
+// LoginWithOIDC is the interactor for the callback of the identity provider. A
+// known external subject signs in its user. Otherwise a user with the verified
+// email gets linked or, if none exists, a new active user without password is
+// created. Users with 2FA still have to pass the second factor.
+func (c *UseCase) LoginWithOIDC(ctx context.Context, input *OIDCLoginInput) (*LoginOutput, error) {
+	identity, err := c.oidc.Exchange(ctx, input.State, input.Code)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := c.tokenGen.GenerateRefreshToken(user.ID(), time.Second*c.refreshTokenExpire)
+	user, err := c.repo.FindUserByExternalID(ctx, identity.Issuer, identity.Subject)
+	if errors.Is(err, ErrUserNotFound) {
+		user, err = c.linkExternalUser(ctx, identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.IstAktiv() {
+		return nil, ErrUserNotActive
+	}
+
+	if user.IstZweiFaktorAktiv() {
+		challengeToken, err := c.tokenGen.GenerateChallengeToken(user.ID(), twoFactorChallengeExpire)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginOutput{ChallengeToken: challengeToken}, nil
+	}
+	return c.startSession(ctx, user, input.UserAgent, input.IP)
+}
+
+// linkExternalUser links the identity to the user with the same email or creates
+// one. Only verified emails are trusted, otherwise anyone could take over an
+// account by registering its email at the provider.
+func (c *UseCase) linkExternalUser(ctx context.Context, identity *oidc.Identity) (*User, error) {
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrExternalEmailNotVerified
+	}
+
+	user, err := c.repo.FindUserByEmail(ctx, identity.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		user, err = c.createExternalUser(ctx, identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.repo.LinkExternalID(ctx, user.ID(), identity.Issuer, identity.Subject); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (c *UseCase) createExternalUser(ctx context.Context, identity *oidc.Identity) (*User, error) {
+	id, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	firstName := identity.GivenName
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(identity.Email, "@")
+	}
+	now := time.Now()
+	// without password hash the password login always fails, until the user
+	// sets a password with a reset
+	user := NewUser(id, firstName, identity.FamilyName, identity.Email, nil, now, now)
+	if identity.EmailVerified {
+		c.activate(user)
+	}
+	return c.repo.CreateUser(ctx, user)
+}
+
+// activate marks the email of the user as verified. The admin role of the
+// adminEmails is granted only here, registering an address alone grants nothing.
+func (c *UseCase) activate(user *User) {
+	user.Aktiviert()
+	if slices.Contains(c.adminEmails, user.Email()) {
+		user.NeueRolle(RolleAdmin)
+	}
+}
+
+type userUnlocker interface {
+	UnlockUser(ctx context.Context, userID string) error
+}
+
+// UnlockUser is the interactor for lifting a login lockout
+func (c *UseCase) UnlockUser(ctx context.Context, userID string) error {
+	user, err := c.repo.FindUserByID(ctx, userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	return c.guard.Unlock(ctx, user.Email())
+}
+
+// rehashPassword upgrades the stored hash to the current hashing policy. The clear
+// text password is only known during login, so this is the place to do it. If the
+// user was changed concurrently the other write wins and the upgrade is retried on
+// the next login, every other failure fails the login.
+func (c *UseCase) rehashPassword(ctx context.Context, user *User, password string) error {
+	if !c.hash.NeedsRehash(user.Passwort()) {
+		return nil
+	}
+	pwdHash, err := c.hash.GeneratePassword(password)
+	if err != nil {
+		return err
+	}
+	user.NeuesPasswort(pwdHash)
+	if _, err := c.repo.UpdateUser(ctx, user); err != nil && !errors.Is(err, ErrConflict) {
+		return err
+	}
+	return nil
+}
+
+// startSession creates a new session for the user and issues its first token pair.
+func (c *UseCase) startSession(ctx context.Context, user *User, userAgent, ip string) (*LoginOutput, error) {
+	if user.IstZurLoeschungVorgemerkt() {
+		if err := c.restoreUser(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	sessionID, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	session := NewSession(sessionID, user.ID(), userAgent, ip, time.Now().UTC())
+	if err := c.repo.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+	if err := c.audit.Record(ctx, &audit.Event{Action: audit.ActionLoginSucceeded, ActorID: user.ID(), TargetType: audit.TargetSession, TargetID: session.ID(), IP: ip}); err != nil {
+		return nil, err
+	}
+
+	return c.issueTokens(ctx, user, session.ID(), "")
+}
+
+// restoreUser cancels a scheduled deletion, a login within the grace period
+// means the user changed their mind.
+func (c *UseCase) restoreUser(ctx context.Context, user *User) error {
+	user.LoeschungAufgehoben()
+	if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	if err := c.audit.Record(ctx, &audit.Event{Action: audit.ActionUserRestored, ActorID: user.ID(), TargetType: audit.TargetUser, TargetID: user.ID()}); err != nil {
+		return err
+	}
+	body := "You signed in to your account, so the scheduled deletion was cancelled. " +
+		"If you still want to delete your account, please request the deletion again."
+	return c.mailer.Enqueue(ctx, user.Email(), "Account Deletion Cancelled", body)
+}
+
+// issueTokens creates an access and a refresh token for the session, which is also
+// the refresh token family. If previousTokenID is set, the stored refresh token
+// with that ID is rotated.
+func (c *UseCase) issueTokens(ctx context.Context, user *User, family, previousTokenID string) (*LoginOutput, error) {
+	accessToken, err := c.tokenGen.GenerateAccessToken(user.ID(), user.Rolle(), family, time.Second*c.accessTokenExpire)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := c.tokenGen.GenerateRefreshToken(user.ID(), tokenID, time.Second*c.refreshTokenExpire)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	stored := NewRefreshToken(tokenID, user.ID(), family, now, now.Add(time.Second*c.refreshTokenExpire))
+	if previousTokenID == "" {
+		err = c.repo.SaveRefreshToken(ctx, stored)
+	} else {
+		err = c.repo.RotateRefreshToken(ctx, previousTokenID, stored)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -221,6 +616,234 @@ func (c *UseCase) LoginUser(ctx context.Context, input *LoginInput) (*LoginOutpu
 	return &LoginOutput{AccessToken: accessToken, RefreshToken: refreshToken}, nil
 }
 
+// RefreshInput is the input for the refresh token use case
+type RefreshInput struct {
+	RefreshToken string
+}
+
+type tokenRefresher interface {
+	RefreshToken(ctx context.Context, input *RefreshInput) (*LoginOutput, error)
+}
+
+// RefreshToken is the interactor for exchanging a refresh token against a new token pair.
+// Every refresh token can be used once. Presenting an already rotated token revokes
+// the whole token family, since either the client or an attacker holds a stolen copy.
+func (c *UseCase) RefreshToken(ctx context.Context, input *RefreshInput) (*LoginOutput, error) {
+	claims, err := c.tokenGen.ParseRefreshToken(input.RefreshToken)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	stored, err := c.repo.FindRefreshToken(ctx, claims.Jit)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if stored.UserID() != claims.Sub {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.IstErsetzt() {
+		return nil, c.revokeReusedFamily(ctx, stored)
+	}
+
+	user, err := c.repo.FindUserByID(ctx, stored.UserID())
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !user.IstAktiv() {
+		return nil, ErrUserNotActive
+	}
+
+	var output *LoginOutput
+	err = c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		// a revoked session gets no new tokens, so it is checked before the rotation
+		if err := c.repo.TouchSession(ctx, stored.Familie(), time.Now().UTC()); err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		output, err = c.issueTokens(ctx, user, stored.Familie(), stored.ID())
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		// a concurrent request rotated the token first
+		return nil, c.revokeReusedFamily(ctx, stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (c *UseCase) revokeReusedFamily(ctx context.Context, token *RefreshToken) error {
+	if err := c.repo.RevokeTokenFamily(ctx, token.Familie()); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// TwoFactorEnrollOutput is the output for the 2FA enrollment use case
+type TwoFactorEnrollOutput struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactorConfirmInput is the input for the 2FA confirmation use case
+type TwoFactorConfirmInput struct {
+	UserID string
+	Code   string
+}
+
+// TwoFactorConfirmOutput is the output for the 2FA confirmation use case
+type TwoFactorConfirmOutput struct {
+	RecoveryCodes []string
+}
+
+// TwoFactorVerifyInput is the input for the second login step. Code is either a
+// TOTP code or one of the recovery codes.
+type TwoFactorVerifyInput struct {
+	ChallengeToken string
+	Code           string
+	UserAgent      string
+	IP             string
+}
+
+type twoFactorAuthenticator interface {
+	EnrollTwoFactor(ctx context.Context, userID string) (*TwoFactorEnrollOutput, error)
+	ConfirmTwoFactor(ctx context.Context, input *TwoFactorConfirmInput) (*TwoFactorConfirmOutput, error)
+	VerifyTwoFactor(ctx context.Context, input *TwoFactorVerifyInput) (*LoginOutput, error)
+}
+
+// EnrollTwoFactor is the interactor for starting the TOTP enrollment. The secret
+// stays inactive until it is confirmed with a valid code.
+func (c *UseCase) EnrollTwoFactor(ctx context.Context, userID string) (*TwoFactorEnrollOutput, error) {
+	user, err := c.repo.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.IstZweiFaktorAktiv() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := c.otp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.NeuesZweiFaktorSecret(secret)
+	if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollOutput{Secret: secret, URI: c.otp.URI(user.Email(), secret)}, nil
+}
+
+// ConfirmTwoFactor is the interactor for activating TOTP. It returns the recovery
+// codes in clear text once, only their hashes are stored.
+func (c *UseCase) ConfirmTwoFactor(ctx context.Context, input *TwoFactorConfirmInput) (*TwoFactorConfirmOutput, error) {
+	user, err := c.repo.FindUserByID(ctx, input.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.IstZweiFaktorAktiv() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.ZweiFaktorSecret() == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := c.otp.Validate(user.ZweiFaktorSecret(), input.Code)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	user.ZweiFaktorAktiviert(hashes)
+	user.TOTPSchrittVerwendet(step)
+	if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorConfirmOutput{RecoveryCodes: codes}, nil
+}
+
+// VerifyTwoFactor is the interactor for completing a login with the second factor
+func (c *UseCase) VerifyTwoFactor(ctx context.Context, input *TwoFactorVerifyInput) (*LoginOutput, error) {
+	claims, err := c.tokenGen.ParseChallengeToken(input.ChallengeToken)
+	if err != nil {
+		return nil, ErrInvalidChallengeToken
+	}
+
+	user, err := c.repo.FindUserByID(ctx, claims.Sub)
+	if err != nil {
+		return nil, ErrInvalidChallengeToken
+	}
+	if !user.IstZweiFaktorAktiv() {
+		return nil, ErrInvalidChallengeToken
+	}
+	if err := c.guard.Check(ctx, user.Email(), input.IP); err != nil {
+		return nil, err
+	}
+
+	if step, ok := c.otp.Validate(user.ZweiFaktorSecret(), input.Code); ok && step > user.LetzterTOTPSchritt() {
+		user.TOTPSchrittVerwendet(step)
+	} else if !useRecoveryCode(user, input.Code) {
+		if err := c.recordLoginFailure(ctx, user, input.IP); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidTwoFactorCode
+	}
+	if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := c.guard.RecordSuccess(ctx, user.Email()); err != nil {
+		return nil, err
+	}
+
+	return c.startSession(ctx, user, input.UserAgent, input.IP)
+}
+
+// useRecoveryCode consumes the matching recovery code of the user.
+func useRecoveryCode(user *User, code string) bool {
+	hash := hashRecoveryCode(code)
+	for i, stored := range user.WiederherstellungsCodes() {
+		if subtle.ConstantTimeCompare(stored, hash) == 1 {
+			user.WiederherstellungsCodeVerbraucht(i)
+			return true
+		}
+	}
+	return false
+}
+
+// generateRecoveryCode creates a random code in the form xxxxx-xxxxx.
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 7)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode hashes a recovery code. The codes carry 50 bits of randomness,
+// so a fast hash is sufficient.
+func hashRecoveryCode(code string) []byte {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return sum[:]
+}
+
 // LogoutInput is the input for the logout use case
 type LogoutInput struct {
 	UserID       string
@@ -231,29 +854,281 @@ type userSessionCloser interface {
 	LogoutUser(ctx context.Context, input *LogoutInput) error
 }
 
-// LogoutUser is the interactor for logging out a user
+// LogoutUser is the interactor for logging out a user. It revokes the token family
+// of the given refresh token.
 func (c *UseCase) LogoutUser(ctx context.Context, input *LogoutInput) error {
-	return c.repo.LogoutUser(ctx, input.UserID, input.RefreshToken)
+	claims, err := c.tokenGen.ParseRefreshToken(input.RefreshToken)
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+	if claims.Sub != input.UserID {
+		return ErrInvalidRefreshToken
+	}
+	token, err := c.repo.FindRefreshToken(ctx, claims.Jit)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := c.repo.LogoutUser(ctx, input.UserID, claims.Jit); err != nil {
+		return err
+	}
+	return c.audit.Record(ctx, &audit.Event{Action: audit.ActionSessionRevoked, ActorID: input.UserID, TargetType: audit.TargetSession, TargetID: token.Familie()})
+}
+
+// SessionInput is the input for the session use cases. SessionID is the session
+// to revoke or, when listing and revoking all other sessions, the current one.
+type SessionInput struct {
+	UserID    string
+	SessionID string
+}
+
+// SessionOutput is the output for the list sessions use case
+type SessionOutput struct {
+	ID         string
+	UserAgent  string
+	IP         string
+	Current    bool
+	CreatedAt  time.Time
+	LastUsedAt time.Time
 }
 
-// DeleteInput is the input for the delete user use case
+type sessionManager interface {
+	Sessions(ctx context.Context, input *SessionInput) ([]*SessionOutput, error)
+	RevokeSession(ctx context.Context, input *SessionInput) error
+	RevokeOtherSessions(ctx context.Context, input *SessionInput) error
+}
+
+// Sessions is the interactor for listing the active sessions of a user
+func (c *UseCase) Sessions(ctx context.Context, input *SessionInput) ([]*SessionOutput, error) {
+	sessions, err := c.repo.FindSessionsByUserID(ctx, input.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]*SessionOutput, 0, len(sessions))
+	for _, session := range sessions {
+		output = append(output, &SessionOutput{
+			ID:         session.ID(),
+			UserAgent:  session.UserAgent(),
+			IP:         session.IP(),
+			Current:    session.ID() == input.SessionID,
+			CreatedAt:  session.ErstelltAm(),
+			LastUsedAt: session.ZuletztGenutztAm(),
+		})
+	}
+	return output, nil
+}
+
+// RevokeSession is the interactor for signing out a single device
+func (c *UseCase) RevokeSession(ctx context.Context, input *SessionInput) error {
+	if err := c.repo.RevokeSession(ctx, input.UserID, input.SessionID); err != nil {
+		return err
+	}
+	return c.audit.Record(ctx, &audit.Event{Action: audit.ActionSessionRevoked, ActorID: input.UserID, TargetType: audit.TargetSession, TargetID: input.SessionID})
+}
+
+// RevokeOtherSessions is the interactor for signing out every device except the current one
+func (c *UseCase) RevokeOtherSessions(ctx context.Context, input *SessionInput) error {
+	if err := c.repo.RevokeOtherSessions(ctx, input.UserID, input.SessionID); err != nil {
+		return err
+	}
+	return c.audit.Record(ctx, &audit.Event{Action: audit.ActionSessionRevoked, ActorID: input.UserID, TargetType: audit.TargetUser, TargetID: input.UserID, After: map[string]any{"kept_session": input.SessionID}})
+}
+
+// DeleteInput is the input for the delete user use case. Version is the version
+// of the user the client read, zero skips the check.
 type DeleteInput struct {
 	UserID   string
 	Password string
+	Version  int64
+}
+
+// DeleteOutput is the output for the delete user use case
+type DeleteOutput struct {
+	DeleteAt time.Time
+	Version  int64
 }
 
 type userRemover interface {
-	DeleteUser(ctx context.Context, input *DeleteInput) error
+	DeleteUser(ctx context.Context, input *DeleteInput) (*DeleteOutput, error)
+}
+
+// DeleteUser is the interactor for deleting a user. The account is only scheduled
+// for deletion and signed out everywhere, the Purger removes it after the grace
+// period. Users without password, e.g. from OIDC, have to set one with a reset first.
+func (c *UseCase) DeleteUser(ctx context.Context, input *DeleteInput) (*DeleteOutput, error) {
+	var output *DeleteOutput
+	err := c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := c.repo.FindUserByID(ctx, input.UserID)
+		if err != nil {
+			return ErrUserNotFound
+		}
+		if input.Version != 0 && input.Version != user.Version() {
+			return ErrConflict
+		}
+		if user.IstZurLoeschungVorgemerkt() {
+			return ErrDeletionAlreadyScheduled
+		}
+		if err := c.hash.ValidatePassword(user.Passwort(), input.Password); err != nil {
+			return ErrInvalidPassword
+		}
+
+		deleteAt := time.Now().UTC().Add(time.Second * c.deletionGracePeriod)
+		user.LoeschungVorgemerkt(deleteAt)
+		if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		if err := c.repo.RevokeOtherSessions(ctx, user.ID(), ""); err != nil {
+			return err
+		}
+		if err := c.audit.Record(ctx, &audit.Event{Action: audit.ActionUserDeletionScheduled, ActorID: user.ID(), TargetType: audit.TargetUser, TargetID: user.ID(), After: map[string]any{"delete_at": deleteAt}}); err != nil {
+			return err
+		}
+
+		body := fmt.Sprintf("Your account and all of its data will be deleted on %s. "+
+			"Until then you can download your data with POST /user/export. "+
+			"Sign in before that date to keep your account.", deleteAt.Format(time.RFC1123))
+		if err := c.mailer.Enqueue(ctx, user.Email(), "Account Deletion Scheduled", body); err != nil {
+			return err
+		}
+		output = &DeleteOutput{DeleteAt: deleteAt, Version: user.Version()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// ProfileOutput is the output for the profile use case
+type ProfileOutput struct {
+	ID               string
+	FirstName        string
+	LastName         string
+	Email            string
+	PendingEmail     string
+	Role             string
+	TwoFactorEnabled bool
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeleteAt         *time.Time
+	Version          int64
+}
+
+type profileReader interface {
+	Profile(ctx context.Context, userID string) (*ProfileOutput, error)
+}
+
+// Profile is the interactor for reading the profile of a user. The version is
+// the one UpdateUser and DeleteUser expect to prevent lost updates.
+func (c *UseCase) Profile(ctx context.Context, userID string) (*ProfileOutput, error) {
+	user, err := c.repo.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	output := &ProfileOutput{
+		ID:               user.ID(),
+		FirstName:        user.Vorname(),
+		LastName:         user.Nachname(),
+		Email:            user.Email(),
+		PendingEmail:     user.AusstehendeEmail(),
+		Role:             user.Rolle(),
+		TwoFactorEnabled: user.IstZweiFaktorAktiv(),
+		CreatedAt:        user.ErstelltAm(),
+		UpdatedAt:        user.AktualisiertAm(),
+		Version:          user.Version(),
+	}
+	if user.IstZurLoeschungVorgemerkt() {
+		deleteAt := user.LoeschenAm()
+		output.DeleteAt = &deleteAt
+	}
+	return output, nil
+}
+
+// ExportOutput is the output for the export use case. It contains everything
+// stored about the user except credentials like the password hash or the 2FA secret.
+type ExportOutput struct {
+	ID               string
+	FirstName        string
+	LastName         string
+	Email            string
+	Role             string
+	Active           bool
+	TwoFactorEnabled bool
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeleteAt         *time.Time
+	Sessions         []*SessionOutput
+}
+
+type userExporter interface {
+	ExportUser(ctx context.Context, userID string) (*ExportOutput, error)
 }
 
-// DeleteUser is the interactor for deleting a user
-func (c *UseCase) DeleteUser(ctx context.Context, input *DeleteInput) error {
-	return c.repo.DeleteUser(ctx, input.UserID, []byte(input.Password))
+// ExportUser is the interactor for exporting the data of a user
+func (c *UseCase) ExportUser(ctx context.Context, userID string) (*ExportOutput, error) {
+	user, err := c.repo.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	sessions, err := c.Sessions(ctx, &SessionInput{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ExportOutput{
+		ID:               user.ID(),
+		FirstName:        user.Vorname(),
+		LastName:         user.Nachname(),
+		Email:            user.Email(),
+		Role:             user.Rolle(),
+		Active:           user.IstAktiv(),
+		TwoFactorEnabled: user.IstZweiFaktorAktiv(),
+		CreatedAt:        user.ErstelltAm(),
+		UpdatedAt:        user.AktualisiertAm(),
+		Sessions:         sessions,
+	}
+	if user.IstZurLoeschungVorgemerkt() {
+		deleteAt := user.LoeschenAm()
+		output.DeleteAt = &deleteAt
+	}
+	return output, nil
+}
+
+// ExportTables is the export source for the profile and the sessions of the user.
+func (c *UseCase) ExportTables(ctx context.Context, userID string) ([]export.Table, error) {
+	user, err := c.ExportUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := export.Table{
+		Name:    "profile",
+		Columns: []string{"id", "first_name", "last_name", "email", "role", "active", "two_factor_enabled", "created_at", "updated_at", "delete_at"},
+		Rows: [][]any{{
+			user.ID, user.FirstName, user.LastName, user.Email, user.Role, user.Active,
+			user.TwoFactorEnabled, user.CreatedAt, user.UpdatedAt, user.DeleteAt,
+		}},
+	}
+	sessions := export.Table{
+		Name:    "sessions",
+		Columns: []string{"id", "user_agent", "ip", "created_at", "last_used_at"},
+		Rows:    make([][]any, 0, len(user.Sessions)),
+	}
+	for _, session := range user.Sessions {
+		sessions.Rows = append(sessions.Rows, []any{session.ID, session.UserAgent, session.IP, session.CreatedAt, session.LastUsedAt})
+	}
+	return []export.Table{profile, sessions}, nil
 }
 
-// UpdateInput is the input for the update user use case
+// UpdateInput is the input for the update user use case. Version is the version
+// of the user the client read, zero skips the check.
 type UpdateInput struct {
 	UserID          string
+	Version         int64
 	Email           *string
 	FirstName       *string
 	LastName        *string
@@ -269,13 +1144,16 @@ type UpdateOutput struct {
 	LastName  string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Version   int64
 }
 
 type userUpdater interface {
 	UpdateUser(context.Context, *UpdateInput) (*UpdateOutput, error)
 }
 
-// UpdateUser is the interactor for updating a user
+// UpdateUser is the interactor for updating a user. A new email is not applied
+// directly but has to be confirmed like with ChangeEmail. Every field is validated
+// before anything is stored, the changes are stored in one transaction.
 func (c *UseCase) UpdateUser(ctx context.Context, input *UpdateInput) (*UpdateOutput, error) {
 	user, err := c.repo.FindUserByID(ctx, input.UserID)
 	if err != nil {
@@ -284,10 +1162,16 @@ func (c *UseCase) UpdateUser(ctx context.Context, input *UpdateInput) (*UpdateOu
 		}
 		return nil, err
 	}
+	if input.Version != 0 && input.Version != user.Version() {
+		return nil, ErrConflict
+	}
 
-	// TODO: own usecase for email
-	if input.Email != nil {
-		user.NeueEmail(*input.Email)
+	before := profileState(user)
+	emailChanged := input.Email != nil && *input.Email != user.Email()
+	if emailChanged {
+		if err := c.checkNewEmail(ctx, *input.Email); err != nil {
+			return nil, err
+		}
 	}
 
 	if input.FirstName != nil {
@@ -300,9 +1184,15 @@ func (c *UseCase) UpdateUser(ctx context.Context, input *UpdateInput) (*UpdateOu
 
 	// TODO: own usecase for password
 	if input.NewPassword != nil {
+		if input.CurrentPassword == nil {
+			return nil, ErrInvalidPassword
+		}
 		if err := c.hash.ValidatePassword(user.Passwort(), *input.CurrentPassword); err != nil {
 			return nil, ErrInvalidPassword
 		}
+		if err := c.checkPassword(user, *input.NewPassword); err != nil {
+			return nil, err
+		}
 		pwdHash, err := c.hash.GeneratePassword(*input.NewPassword)
 		if err != nil {
 			return nil, err
@@ -310,7 +1200,18 @@ func (c *UseCase) UpdateUser(ctx context.Context, input *UpdateInput) (*UpdateOu
 		user.NeuesPasswort(pwdHash)
 	}
 
-	if _, err = c.repo.UpdateUser(ctx, user); err != nil {
+	err = c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if emailChanged {
+			if err := c.beginEmailChange(ctx, user, *input.Email); err != nil {
+				return err
+			}
+		}
+		if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		return c.auditProfileChange(ctx, user, before, input.NewPassword != nil)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -320,10 +1221,43 @@ func (c *UseCase) UpdateUser(ctx context.Context, input *UpdateInput) (*UpdateOu
 		LastName:  user.Nachname(),
 		CreatedAt: user.ErstelltAm(),
 		UpdatedAt: user.AktualisiertAm(),
+		Version:   user.Version(),
 	}
 	return userOuput, nil
 }
 
+// profileState returns the audited profile fields of the user.
+func profileState(user *User) map[string]any {
+	return map[string]any{"first_name": user.Vorname(), "last_name": user.Nachname()}
+}
+
+// auditProfileChange records the changed profile fields and a password change as
+// separate events. Email changes are recorded once they are confirmed.
+func (c *UseCase) auditProfileChange(ctx context.Context, user *User, before map[string]any, passwordChanged bool) error {
+	after := profileState(user)
+	changedBefore, changedAfter := map[string]any{}, map[string]any{}
+	for field, value := range after {
+		if before[field] != value {
+			changedBefore[field], changedAfter[field] = before[field], value
+		}
+	}
+
+	events := make([]*audit.Event, 0, 2)
+	if len(changedAfter) > 0 {
+		events = append(events, &audit.Event{Action: audit.ActionUserUpdated, Before: changedBefore, After: changedAfter})
+	}
+	if passwordChanged {
+		events = append(events, &audit.Event{Action: audit.ActionPasswordChanged})
+	}
+	for _, event := range events {
+		event.ActorID, event.TargetType, event.TargetID = user.ID(), audit.TargetUser, user.ID()
+		if err := c.audit.Record(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ChangePasswordInput is the input for the change password use case
 type ChangePasswordInput struct {
 	UserID   string
@@ -336,8 +1270,12 @@ type passwordChanger interface {
 
 // ChangePassword is the interactor for changing a user's password
 func (c *UseCase) ChangePassword(ctx context.Context, input *ChangePasswordInput) error {
-	if len(input.Password) < 8 {
-		return ErrPasswordTooShort
+	user, err := c.repo.FindUserByID(ctx, input.UserID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if err := c.checkPassword(user, string(input.Password)); err != nil {
+		return err
 	}
 
 	pwdHash, err := c.hash.GeneratePassword(string(input.Password))
@@ -345,7 +1283,12 @@ func (c *UseCase) ChangePassword(ctx context.Context, input *ChangePasswordInput
 		return err
 	}
 
-	return c.repo.ChangePassword(ctx, input.UserID, pwdHash)
+	return c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := c.repo.ChangePassword(ctx, input.UserID, pwdHash); err != nil {
+			return err
+		}
+		return c.audit.Record(ctx, &audit.Event{Action: audit.ActionPasswordChanged, ActorID: user.ID(), TargetType: audit.TargetUser, TargetID: user.ID()})
+	})
 }
 
 // ChangeEmailInput is the input for the change email use case
@@ -356,23 +1299,224 @@ type ChangeEmailInput struct {
 
 type emailChanger interface {
 	ChangeEmail(context.Context, *ChangeEmailInput) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	UndoEmailChange(ctx context.Context, token string) error
 }
 
-// ChangeEmail is the interactor for changing a user's email
+// ChangeEmail is the interactor for changing a user's email. The email is only
+// swapped after the new address confirmed the change, the old address gets a
+// notice with a link to undo it.
 func (c *UseCase) ChangeEmail(ctx context.Context, input *ChangeEmailInput) error {
-	return c.repo.ChangeEmail(ctx, input.UserID, input.Email)
+	user, err := c.repo.FindUserByID(ctx, input.UserID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	return c.requestEmailChange(ctx, user, input.Email)
+}
+
+// requestEmailChange validates the new email and stores the request. A new
+// request supersedes the tokens of the previous one.
+func (c *UseCase) requestEmailChange(ctx context.Context, user *User, email string) error {
+	if err := c.checkNewEmail(ctx, email); err != nil {
+		return err
+	}
+	return c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := c.beginEmailChange(ctx, user, email); err != nil {
+			return err
+		}
+		_, err := c.repo.UpdateUser(ctx, user)
+		return err
+	})
+}
+
+// checkNewEmail returns an error if the email is invalid or taken.
+func (c *UseCase) checkNewEmail(ctx context.Context, email string) error {
+	if len(email) > maxEmailLength {
+		return ErrEmailTooLong
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return ErrInvalidEmail
+	}
+	if _, err := c.repo.FindUserByEmail(ctx, email); err == nil {
+		return ErrEmailAlreadyExists
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	return nil
+}
+
+// beginEmailChange marks the email change on the user and mails the confirmation
+// and the undo token. The caller stores the user in the same transaction.
+func (c *UseCase) beginEmailChange(ctx context.Context, user *User, email string) error {
+	changeID, err := c.uuidGen.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	confirmToken, err := c.tokenGen.GenerateEmailChangeToken(user.ID(), changeID, time.Second*c.verificationTokenExpire)
+	if err != nil {
+		return err
+	}
+	undoToken, err := c.tokenGen.GenerateEmailUndoToken(user.ID(), changeID, emailUndoExpire)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("A change of your email to %s was requested. "+
+		"If this was not you, undo the change with PUT /user/email/rueckgaengig and this token: %s", email, undoToken)
+	user.EmailAenderungBeantragt(changeID, email)
+	if err := c.mailer.Enqueue(ctx, email, "Confirm Email Change", confirmToken); err != nil {
+		return err
+	}
+	return c.mailer.Enqueue(ctx, user.Email(), "Email Change Requested", body)
+}
+
+// ConfirmEmailChange is the interactor for confirming a new email with the token
+// sent to it. The repository swaps the email atomically and rejects it, if
+// another user took the email in the meantime.
+func (c *UseCase) ConfirmEmailChange(ctx context.Context, token string) error {
+	claims, err := c.tokenGen.ParseEmailChangeToken(token)
+	if err != nil {
+		return ErrInvalidEmailChangeToken
+	}
+	user, err := c.repo.FindUserByID(ctx, claims.Sub)
+	if err != nil {
+		return ErrInvalidEmailChangeToken
+	}
+	if user.AusstehendeEmail() == "" || subtle.ConstantTimeCompare([]byte(claims.Jit), []byte(user.EmailAenderungID())) != 1 {
+		return ErrInvalidEmailChangeToken
+	}
+
+	oldEmail, newEmail := user.Email(), user.AusstehendeEmail()
+	return c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		// UpdateUser swaps the email and rejects it if another user took it in
+		// the meantime
+		user.EmailAenderungBestaetigt()
+		if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		return c.audit.Record(ctx, &audit.Event{
+			Action:     audit.ActionEmailChanged,
+			ActorID:    user.ID(),
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID(),
+			Before:     map[string]any{"email": oldEmail},
+			After:      map[string]any{"email": newEmail},
+		})
+	})
+}
+
+// UndoEmailChange is the interactor for reverting an email change with the token
+// sent to the old address. A pending change is discarded, a confirmed one is
+// switched back. All sessions are signed out, because the change may come from
+// a stolen session.
+func (c *UseCase) UndoEmailChange(ctx context.Context, token string) error {
+	claims, err := c.tokenGen.ParseEmailUndoToken(token)
+	if err != nil {
+		return ErrInvalidEmailChangeToken
+	}
+	user, err := c.repo.FindUserByID(ctx, claims.Sub)
+	if err != nil {
+		return ErrInvalidEmailChangeToken
+	}
+	if user.EmailAenderungID() == "" || subtle.ConstantTimeCompare([]byte(claims.Jit), []byte(user.EmailAenderungID())) != 1 {
+		return ErrInvalidEmailChangeToken
+	}
+
+	confirmed, changedEmail, oldEmail := user.IstEmailAenderungBestaetigt(), user.Email(), user.VorherigeEmail()
+	return c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user.EmailAenderungZurueckgenommen()
+		if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		if err := c.repo.RevokeOtherSessions(ctx, user.ID(), ""); err != nil {
+			return err
+		}
+		if !confirmed {
+			return nil
+		}
+		return c.audit.Record(ctx, &audit.Event{
+			Action:     audit.ActionEmailChanged,
+			ActorID:    user.ID(),
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID(),
+			Before:     map[string]any{"email": changedEmail},
+			After:      map[string]any{"email": oldEmail},
+		})
+	})
 }
 
 type passwordResetter interface {
 	ResetPassword(ctx context.Context, email string) error
 }
 
-// ResetPassword is the interactor for resetting a user's password
+// ResetPassword is the interactor for resetting a user's password. It mails a reset
+// token that is bound to the current password hash, so it can be used only once.
 func (c *UseCase) ResetPassword(ctx context.Context, email string) error {
-	if _, err := c.repo.FindUserByEmail(ctx, email); err != nil {
+	user, err := c.repo.FindUserByEmail(ctx, email)
+	if err != nil {
 		return ErrUserNotFound
 	}
 
-	// TODO: Implement password reset logic, e.g., sending a reset link via email
-	return nil
+	resetToken, err := c.tokenGen.GenerateResetToken(user.ID(), passwordFingerprint(user), time.Second*c.verificationTokenExpire)
+	if err != nil {
+		return err
+	}
+
+	return c.mailer.Enqueue(ctx, user.Email(), "Password Reset", resetToken)
+}
+
+// ResetConfirmInput is the input for the confirm password reset use case
+type ResetConfirmInput struct {
+	Token    string
+	Password string
+}
+
+type passwordResetConfirmer interface {
+	ConfirmPasswordReset(ctx context.Context, input *ResetConfirmInput) error
+}
+
+// ConfirmPasswordReset is the interactor for setting a new password with a reset token.
+// All sessions are signed out afterwards.
+func (c *UseCase) ConfirmPasswordReset(ctx context.Context, input *ResetConfirmInput) error {
+	claims, err := c.tokenGen.ParseResetToken(input.Token)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	user, err := c.repo.FindUserByID(ctx, claims.Sub)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Jit), []byte(passwordFingerprint(user))) != 1 {
+		return ErrInvalidResetToken
+	}
+
+	if err := c.checkPassword(user, input.Password); err != nil {
+		return err
+	}
+	pwdHash, err := c.hash.GeneratePassword(input.Password)
+	if err != nil {
+		return err
+	}
+	user.NeuesPasswort(pwdHash)
+	return c.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := c.repo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		if err := c.repo.RevokeOtherSessions(ctx, user.ID(), ""); err != nil {
+			return err
+		}
+		return c.audit.Record(ctx, &audit.Event{Action: audit.ActionPasswordReset, ActorID: user.ID(), TargetType: audit.TargetUser, TargetID: user.ID()})
+	})
+}
+
+// checkPassword applies the password policy with the personal information of the user.
+func (c *UseCase) checkPassword(user *User, password string) error {
+	return c.policy.Check(password, user.Email(), user.Vorname(), user.Nachname())
+}
+
+// passwordFingerprint identifies the current password hash without revealing it.
+func passwordFingerprint(user *User) string {
+	sum := sha256.Sum256(user.Passwort())
+	return hex.EncodeToString(sum[:8])
 }
@@ -2,12 +2,25 @@ package user_test
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/audit"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/auth"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/id"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/lockout"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/oidc"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/oidc/oidctest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/passwordpolicy"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/totp"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/transaction"
 	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type mockUserRepository struct {
@@ -29,16 +42,11 @@ func (m *mockUserRepository) FindUserByID(ctx context.Context, id string) (*user
 	return args.Get(0).(*user.User), args.Error(1)
 }
 
-func (m *mockUserRepository) LogoutUser(ctx context.Context, userID, refreshToken string) error {
-	args := m.Called(ctx, userID, refreshToken)
+func (m *mockUserRepository) LogoutUser(ctx context.Context, userID, tokenID string) error {
+	args := m.Called(ctx, userID, tokenID)
 	return args.Error(0)
 }
 
-func (m *mockUserRepository) DeleteUser(ctx context.Context, userID string, password []byte) error {
-	args := m.Called(ctx, userID, password)
-	return args.Error(1)
-}
-
 func (m *mockUserRepository) UpdateUser(ctx context.Context, u *user.User) (*user.User, error) {
 	args := m.Called(ctx, u)
 	return args.Get(0).(*user.User), args.Error(1)
@@ -54,6 +62,61 @@ func (m *mockUserRepository) ChangeEmail(ctx context.Context, userID, email stri
 	return args.Error(0)
 }
 
+func (m *mockUserRepository) SaveRefreshToken(ctx context.Context, token *user.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) FindRefreshToken(ctx context.Context, tokenID string) (*user.RefreshToken, error) {
+	args := m.Called(ctx, tokenID)
+	return args.Get(0).(*user.RefreshToken), args.Error(1)
+}
+
+func (m *mockUserRepository) RotateRefreshToken(ctx context.Context, oldTokenID string, next *user.RefreshToken) error {
+	args := m.Called(ctx, oldTokenID, next)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) RevokeTokenFamily(ctx context.Context, family string) error {
+	args := m.Called(ctx, family)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) SaveSession(ctx context.Context, session *user.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) FindSessionsByUserID(ctx context.Context, userID string) ([]*user.Session, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]*user.Session), args.Error(1)
+}
+
+func (m *mockUserRepository) TouchSession(ctx context.Context, sessionID string, at time.Time) error {
+	args := m.Called(ctx, sessionID, at)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	args := m.Called(ctx, userID, keepSessionID)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) FindUserByExternalID(ctx context.Context, issuer, subject string) (*user.User, error) {
+	args := m.Called(ctx, issuer, subject)
+	return args.Get(0).(*user.User), args.Error(1)
+}
+
+func (m *mockUserRepository) LinkExternalID(ctx context.Context, userID, issuer, subject string) error {
+	args := m.Called(ctx, userID, issuer, subject)
+	return args.Error(0)
+}
+
 type mockUUIDGenerator struct {
 	mock.Mock
 }
@@ -77,12 +140,17 @@ func (m *mockPasswordHasher) ValidatePassword(hash []byte, clearword string) err
 	return args.Error(0)
 }
 
+func (m *mockPasswordHasher) NeedsRehash(hash []byte) bool {
+	args := m.Called(hash)
+	return args.Bool(0)
+}
+
 type mockMailer struct {
 	mock.Mock
 }
 
-func (m *mockMailer) SendVerificationEmail(to, subject, body string) error {
-	args := m.Called(to, subject, body)
+func (m *mockMailer) Enqueue(ctx context.Context, to, subject, body string) error {
+	args := m.Called(ctx, to, subject, body)
 	return args.Error(0)
 }
 
@@ -90,16 +158,102 @@ type mockTokenGenerator struct {
 	mock.Mock
 }
 
-func (m *mockTokenGenerator) GenerateAccessToken(userID string, ttl time.Duration) (string, error) {
+func (m *mockTokenGenerator) GenerateAccessToken(userID, role, sessionID string, ttl time.Duration) (string, error) {
+	args := m.Called(userID, role, sessionID, ttl)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockTokenGenerator) GenerateRefreshToken(userID, tokenID string, ttl time.Duration) (string, error) {
+	args := m.Called(userID, tokenID, ttl)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockTokenGenerator) GenerateVerificationToken(userID string, ttl time.Duration) (string, error) {
 	args := m.Called(userID, ttl)
 	return args.String(0), args.Error(1)
 }
 
-func (m *mockTokenGenerator) GenerateRefreshToken(userID string, ttl time.Duration) (string, error) {
+func (m *mockTokenGenerator) GenerateChallengeToken(userID string, ttl time.Duration) (string, error) {
 	args := m.Called(userID, ttl)
 	return args.String(0), args.Error(1)
 }
 
+func (m *mockTokenGenerator) ParseChallengeToken(tokenString string) (*auth.Claims, error) {
+	args := m.Called(tokenString)
+	return args.Get(0).(*auth.Claims), args.Error(1)
+}
+
+func (m *mockTokenGenerator) GenerateResetToken(userID, fingerprint string, ttl time.Duration) (string, error) {
+	args := m.Called(userID, fingerprint, ttl)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockTokenGenerator) ParseResetToken(tokenString string) (*auth.Claims, error) {
+	args := m.Called(tokenString)
+	return args.Get(0).(*auth.Claims), args.Error(1)
+}
+
+func (m *mockTokenGenerator) ParseVerificationToken(tokenString string) (*auth.Claims, error) {
+	args := m.Called(tokenString)
+	return args.Get(0).(*auth.Claims), args.Error(1)
+}
+
+func (m *mockTokenGenerator) ParseRefreshToken(tokenString string) (*auth.Claims, error) {
+	args := m.Called(tokenString)
+	return args.Get(0).(*auth.Claims), args.Error(1)
+}
+
+func (m *mockTokenGenerator) GenerateEmailChangeToken(userID, changeID string, ttl time.Duration) (string, error) {
+	args := m.Called(userID, changeID, ttl)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockTokenGenerator) GenerateEmailUndoToken(userID, changeID string, ttl time.Duration) (string, error) {
+	args := m.Called(userID, changeID, ttl)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockTokenGenerator) ParseEmailChangeToken(tokenString string) (*auth.Claims, error) {
+	args := m.Called(tokenString)
+	return args.Get(0).(*auth.Claims), args.Error(1)
+}
+
+func (m *mockTokenGenerator) ParseEmailUndoToken(tokenString string) (*auth.Claims, error) {
+	args := m.Called(tokenString)
+	return args.Get(0).(*auth.Claims), args.Error(1)
+}
+
+type mockOTP struct {
+	mock.Mock
+}
+
+func (m *mockOTP) GenerateSecret() (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockOTP) URI(account, secret string) string {
+	args := m.Called(account, secret)
+	return args.String(0)
+}
+
+func (m *mockOTP) Validate(secret, code string) (int64, bool) {
+	args := m.Called(secret, code)
+	return args.Get(0).(int64), args.Bool(1)
+}
+
+func newGuard() *lockout.Guard {
+	return lockout.NewGuard(lockout.NewInMemoryStore(), 5, 0, time.Minute)
+}
+
+func newAudit() *audit.UseCase {
+	return audit.NewUseCase(audit.NewInMemoryRepository(), id.UUIDGeneratorFunc(id.GenerateUUID))
+}
+
+func newPolicy() *passwordpolicy.Policy {
+	return passwordpolicy.NewPolicy(8, 72, 0, passwordpolicy.NewHIBPDirectory(""))
+}
+
 func TestCreateUser(t *testing.T) {
 	ctx := context.Background()
 	tests := []struct {
@@ -122,8 +276,9 @@ func TestCreateUser(t *testing.T) {
 				u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmx.de", []byte("password"), time.Now(), time.Now())
 				u.Aktiviert()
 				repo.On("CreateUser", ctx, mock.AnythingOfType("*user.User")).Return(u, nil)
-				tokenGen.On("GenerateAccessToken", "12345", mock.Anything).Return("accesstokensecret12345", nil)
-				tokenGen.On("GenerateRefreshToken", "12345", mock.Anything).Return("refreshtokensecret12345", nil)
+				tokenGen.On("GenerateVerificationToken", "12345", mock.Anything).Return("accesstokensecret12345", nil)
+				tokenGen.On("GenerateRefreshToken", "12345", mock.Anything, mock.Anything).Return("refreshtokensecret12345", nil)
+				mailer.On("Enqueue", ctx, "max.mustermann@gmail.de", "Account Verification", "accesstokensecret12345").Return(nil)
 			},
 			expectErr: nil,
 		},
@@ -141,11 +296,24 @@ func TestCreateUser(t *testing.T) {
 				u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmx.de", []byte("password"), time.Now(), time.Now())
 				u.Aktiviert()
 				repo.On("CreateUser", ctx, mock.AnythingOfType("*user.User")).Return(u, nil)
-				tokenGen.On("GenerateAccessToken", "12345", mock.Anything).Return("accesstokensecret12345", nil)
-				tokenGen.On("GenerateRefreshToken", "12345", mock.Anything).Return("refreshtokensecret12345", nil)
+				tokenGen.On("GenerateVerificationToken", "12345", mock.Anything).Return("accesstokensecret12345", nil)
+				tokenGen.On("GenerateRefreshToken", "12345", mock.Anything, mock.Anything).Return("refreshtokensecret12345", nil)
+				mailer.On("Enqueue", ctx, "max.mustermann@gmail.de", "Account Verification", "accesstokensecret12345").Return(nil)
 			},
 			expectErr: nil,
 		},
+		{
+			name: "Invalid User Input - Password too short",
+			input: &user.CreateInput{
+				FirstName: "Max",
+				LastName:  "Mustermann",
+				Email:     "max.mustermann@gmail.de",
+				Password:  "kurz",
+			},
+			setupMocks: func(repo *mockUserRepository, uuidGen *mockUUIDGenerator, hasher *mockPasswordHasher, mailer *mockMailer, tokenGen *mockTokenGenerator) {
+			},
+			expectErr: passwordpolicy.ErrPolicyViolation,
+		},
 	}
 
 	for _, tt := range tests {
@@ -155,7 +323,7 @@ func TestCreateUser(t *testing.T) {
 			hasher := new(mockPasswordHasher)
 			tokenGen := new(mockTokenGenerator)
 			mailer := new(mockMailer)
-			uc := user.NewUseCase(repo, uuidGen, hasher, mailer, tokenGen, time.Millisecond*99999, time.Millisecond*99999, time.Millisecond*99999) // Mock dependencies as needed
+			uc := user.NewUseCase(repo, transaction.New(nil), uuidGen, hasher, newPolicy(), mailer, tokenGen, totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), time.Millisecond*99999, time.Millisecond*99999, time.Millisecond*99999, time.Millisecond*99999, nil) // Mock dependencies as needed
 
 			tt.setupMocks(repo, uuidGen, hasher, mailer, tokenGen)
 
@@ -171,3 +339,645 @@ func TestCreateUser(t *testing.T) {
 		})
 	}
 }
+
+func TestRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	uuidGen := id.UUIDGeneratorFunc(id.GenerateUUID)
+	uc := user.NewUseCase(repo, transaction.New(nil), uuidGen, hasher, newPolicy(), new(mockMailer), auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	login, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	assert.NoError(t, err)
+
+	_, err = uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: login.AccessToken})
+	assert.ErrorIs(t, err, user.ErrInvalidRefreshToken, "access token must not be accepted as refresh token")
+
+	rotated, err := uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: login.RefreshToken})
+	assert.NoError(t, err)
+	assert.NotEqual(t, login.RefreshToken, rotated.RefreshToken)
+
+	_, err = uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: login.RefreshToken})
+	assert.ErrorIs(t, err, user.ErrRefreshTokenReused)
+
+	_, err = uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: rotated.RefreshToken})
+	assert.ErrorIs(t, err, user.ErrInvalidRefreshToken, "reuse must revoke the whole token family")
+}
+
+// revokingRepository loses every session, like a revocation that happens after
+// the refresh token was found.
+type revokingRepository struct {
+	*user.InMemoryUserRepository
+}
+
+func (revokingRepository) TouchSession(ctx context.Context, sessionID string, at time.Time) error {
+	return user.ErrSessionNotFound
+}
+
+func TestRefreshTokenOfRevokedSession(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	jwt := auth.NewJWT("access", "refresh")
+	uc := user.NewUseCase(repo, transaction.New(nil, repo), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), new(mockMailer), jwt, totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	require.NoError(t, err)
+	login, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	require.NoError(t, err)
+
+	revoked := user.NewUseCase(revokingRepository{repo}, transaction.New(nil, repo), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), new(mockMailer), jwt, totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+	_, err = revoked.RefreshToken(ctx, &user.RefreshInput{RefreshToken: login.RefreshToken})
+	assert.ErrorIs(t, err, user.ErrInvalidRefreshToken)
+
+	claims, err := jwt.ParseRefreshToken(login.RefreshToken)
+	require.NoError(t, err)
+	stored, err := repo.FindRefreshToken(ctx, claims.Jit)
+	require.NoError(t, err)
+	assert.False(t, stored.IstErsetzt(), "the refresh token of a revoked session must not be rotated")
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	jwt := auth.NewJWT("access", "refresh")
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), new(mockMailer), jwt, totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	laptop, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password", UserAgent: "Firefox", IP: "10.0.0.1"})
+	assert.NoError(t, err)
+	phone, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password", UserAgent: "Android", IP: "10.0.0.2"})
+	assert.NoError(t, err)
+
+	claims, err := jwt.Parse(laptop.AccessToken)
+	assert.NoError(t, err)
+	current := claims.Jit
+
+	sessions, err := uc.Sessions(ctx, &user.SessionInput{UserID: "123", SessionID: current})
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	for _, session := range sessions {
+		assert.Equal(t, session.ID == current, session.Current)
+	}
+
+	assert.NoError(t, uc.RevokeOtherSessions(ctx, &user.SessionInput{UserID: "123", SessionID: current}))
+
+	sessions, err = uc.Sessions(ctx, &user.SessionInput{UserID: "123", SessionID: current})
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "Firefox", sessions[0].UserAgent)
+
+	_, err = uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: phone.RefreshToken})
+	assert.ErrorIs(t, err, user.ErrInvalidRefreshToken, "refresh token of a revoked session must be rejected")
+	assert.NoError(t, repo.TouchSession(ctx, sessions[0].ID, time.Now()))
+	assert.ErrorIs(t, uc.RevokeSession(ctx, &user.SessionInput{UserID: "456", SessionID: current}), user.ErrSessionNotFound)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	otp := new(mockOTP)
+	otp.On("GenerateSecret").Return("SECRET", nil)
+	otp.On("URI", "max.mustermann@gmail.de", "SECRET").Return("otpauth://totp/test")
+	otp.On("Validate", "SECRET", "111111").Return(int64(1), true)
+	otp.On("Validate", "SECRET", "222222").Return(int64(2), true)
+	otp.On("Validate", "SECRET", mock.Anything).Return(int64(0), false)
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), new(mockMailer), auth.NewJWT("access", "refresh"), otp, nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	enrollment, err := uc.EnrollTwoFactor(ctx, "123")
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth://totp/test", enrollment.URI)
+
+	_, err = uc.ConfirmTwoFactor(ctx, &user.TwoFactorConfirmInput{UserID: "123", Code: "999999"})
+	assert.ErrorIs(t, err, user.ErrInvalidTwoFactorCode)
+	confirmation, err := uc.ConfirmTwoFactor(ctx, &user.TwoFactorConfirmInput{UserID: "123", Code: "111111"})
+	assert.NoError(t, err)
+	assert.Len(t, confirmation.RecoveryCodes, 10)
+
+	login, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, login.ChallengeToken)
+	assert.Empty(t, login.AccessToken)
+	assert.Empty(t, login.RefreshToken)
+
+	tests := []struct {
+		name      string
+		code      string
+		expectErr error
+	}{
+		{name: "Bereits verwendeter TOTP-Code", code: "111111", expectErr: user.ErrInvalidTwoFactorCode},
+		{name: "Gültiger TOTP-Code", code: "222222", expectErr: nil},
+		{name: "Wiederherstellungscode", code: confirmation.RecoveryCodes[0], expectErr: nil},
+		{name: "Verbrauchter Wiederherstellungscode", code: confirmation.RecoveryCodes[0], expectErr: user.ErrInvalidTwoFactorCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := uc.VerifyTwoFactor(ctx, &user.TwoFactorVerifyInput{ChallengeToken: login.ChallengeToken, Code: tt.code})
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, tokens.AccessToken)
+			assert.NotEmpty(t, tokens.RefreshToken)
+		})
+	}
+
+	_, err = uc.VerifyTwoFactor(ctx, &user.TwoFactorVerifyInput{ChallengeToken: "invalid", Code: "222222"})
+	assert.ErrorIs(t, err, user.ErrInvalidChallengeToken)
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	hasher.On("ValidatePassword", []byte("hash"), mock.Anything).Return(errors.New("mismatch"))
+	mailer := new(mockMailer)
+	mailer.On("Enqueue", ctx, "max.mustermann@gmail.de", "Account Locked", mock.Anything).Return(nil).Once()
+	guard := lockout.NewGuard(lockout.NewInMemoryStore(), 3, 0, time.Hour)
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), mailer, auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, guard, newAudit(), 60, 60, 60, 60, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	for range 3 {
+		_, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "wrong", IP: "10.0.0.1"})
+		assert.ErrorIs(t, err, user.ErrInvalidPassword)
+	}
+	mailer.AssertExpectations(t)
+
+	_, err = uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password", IP: "10.0.0.2"})
+	assert.ErrorIs(t, err, lockout.ErrLocked, "correct password is rejected while locked")
+
+	assert.NoError(t, uc.UnlockUser(ctx, "123"))
+	_, err = uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password", IP: "10.0.0.2"})
+	assert.NoError(t, err)
+}
+
+func TestLoginRehash(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := user.NewArgon2Hasher(testParams)
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), new(mockMailer), auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", legacy, time.Now(), time.Now())
+	u.Aktiviert()
+	_, err = repo.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	_, err = uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	assert.NoError(t, err)
+
+	stored, err := repo.FindUserByID(ctx, "123")
+	assert.NoError(t, err)
+	assert.False(t, hasher.NeedsRehash(stored.Passwort()), "bcrypt hash is upgraded to argon2id")
+
+	_, err = uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	assert.NoError(t, err, "upgraded hash still validates")
+}
+
+// updateFailingRepository fails every UpdateUser with err.
+type updateFailingRepository struct {
+	*user.InMemoryUserRepository
+	err error
+}
+
+func (r *updateFailingRepository) UpdateUser(ctx context.Context, u *user.User) (*user.User, error) {
+	return nil, r.err
+}
+
+func TestLoginRehashFails(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		expectErr error
+	}{
+		{name: "Gleichzeitige Änderung", err: user.ErrConflict},
+		{name: "Speicher nicht erreichbar", err: context.DeadlineExceeded, expectErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := &updateFailingRepository{InMemoryUserRepository: user.NewInMemoryUserRepository(), err: tt.err}
+			uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), user.NewArgon2Hasher(testParams), newPolicy(), new(mockMailer), auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+			legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+			assert.NoError(t, err)
+			u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", legacy, time.Now(), time.Now())
+			u.Aktiviert()
+			_, err = repo.CreateUser(ctx, u)
+			assert.NoError(t, err)
+
+			_, err = uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err, "the login goes on, the hash is upgraded next time")
+		})
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	hasher.On("GeneratePassword", "kaffee tisch regen lampe").Return([]byte("newhash"), nil)
+	var resetToken string
+	mailer := new(mockMailer)
+	mailer.On("Enqueue", ctx, "max.mustermann@gmail.de", "Password Reset", mock.Anything).Run(func(args mock.Arguments) {
+		resetToken = args.String(3)
+	}).Return(nil)
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), mailer, auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	assert.NoError(t, err)
+	login, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, uc.ResetPassword(ctx, "max.mustermann@gmail.de"))
+	assert.NotEmpty(t, resetToken)
+
+	err = uc.ConfirmPasswordReset(ctx, &user.ResetConfirmInput{Token: login.AccessToken, Password: "kaffee tisch regen lampe"})
+	assert.ErrorIs(t, err, user.ErrInvalidResetToken, "access token must not be accepted as reset token")
+
+	err = uc.ConfirmPasswordReset(ctx, &user.ResetConfirmInput{Token: resetToken, Password: "Mustermann1"})
+	assert.ErrorIs(t, err, passwordpolicy.ErrPolicyViolation)
+
+	err = uc.ConfirmPasswordReset(ctx, &user.ResetConfirmInput{Token: resetToken, Password: "kaffee tisch regen lampe"})
+	assert.NoError(t, err)
+	found, err := repo.FindUserByID(ctx, "123")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("newhash"), found.Passwort())
+
+	err = uc.ConfirmPasswordReset(ctx, &user.ResetConfirmInput{Token: resetToken, Password: "kaffee tisch regen lampe"})
+	assert.ErrorIs(t, err, user.ErrInvalidResetToken, "reset token must be single-use")
+
+	_, err = uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: login.RefreshToken})
+	assert.Error(t, err, "reset must sign out all sessions")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	provider, err := oidctest.NewProvider("haushaltsbuch", "geheim")
+	require.NoError(t, err)
+	defer provider.Close()
+
+	repo := user.NewInMemoryUserRepository()
+	client := oidc.NewClient(provider.URL(), "haushaltsbuch", "geheim", "http://localhost:4000/user/anmelden/oidc/callback", []string{"openid", "email"})
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), new(mockPasswordHasher), newPolicy(), new(mockMailer), auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), client, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	existing := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	existing.Aktiviert()
+	_, err = repo.CreateUser(ctx, existing)
+	require.NoError(t, err)
+
+	login := func(u oidctest.User) (*user.LoginOutput, error) {
+		provider.SetUser(u)
+		start, err := uc.StartOIDCLogin(ctx)
+		require.NoError(t, err)
+		callback, err := provider.Login(start.URL)
+		require.NoError(t, err)
+		assert.Equal(t, start.State, callback.Query().Get("state"))
+		return uc.LoginWithOIDC(ctx, &user.OIDCLoginInput{State: callback.Query().Get("state"), Code: callback.Query().Get("code")})
+	}
+
+	tests := []struct {
+		name         string
+		user         oidctest.User
+		expectErr    error
+		expectUserID string
+	}{
+		{name: "Verknüpft bestehenden User", user: oidctest.User{Subject: "ext-1", Email: "max.mustermann@gmail.de", EmailVerified: true}, expectUserID: "123"},
+		{name: "Bekanntes Subjekt", user: oidctest.User{Subject: "ext-1", Email: "andere@gmail.de"}, expectUserID: "123"},
+		{name: "Email nicht bestätigt", user: oidctest.User{Subject: "ext-2", Email: "max.mustermann@gmail.de"}, expectErr: user.ErrExternalEmailNotVerified},
+		{name: "Legt neuen User an", user: oidctest.User{Subject: "ext-3", Email: "erika@gmail.de", EmailVerified: true, GivenName: "Erika", FamilyName: "Musterfrau"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := login(tt.user)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			claims, err := auth.NewJWT("access", "refresh").Parse(output.AccessToken)
+			require.NoError(t, err)
+			if tt.expectUserID != "" {
+				assert.Equal(t, tt.expectUserID, claims.Sub)
+				return
+			}
+			created, err := repo.FindUserByID(ctx, claims.Sub)
+			require.NoError(t, err)
+			assert.Equal(t, "Erika", created.Vorname())
+			assert.True(t, created.IstAktiv())
+		})
+	}
+
+	t.Run("State nur einmal gültig", func(t *testing.T) {
+		provider.SetUser(oidctest.User{Subject: "ext-1"})
+		start, err := uc.StartOIDCLogin(ctx)
+		require.NoError(t, err)
+		callback, err := provider.Login(start.URL)
+		require.NoError(t, err)
+		input := &user.OIDCLoginInput{State: callback.Query().Get("state"), Code: callback.Query().Get("code")}
+		_, err = uc.LoginWithOIDC(ctx, input)
+		require.NoError(t, err)
+		_, err = uc.LoginWithOIDC(ctx, input)
+		assert.ErrorIs(t, err, oidc.ErrInvalidState)
+	})
+
+	t.Run("Falsche Nonce", func(t *testing.T) {
+		provider.TamperNonce("fremd")
+		_, err := login(oidctest.User{Subject: "ext-1"})
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+}
+
+func TestAdminAfterVerification(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("GeneratePassword", mock.Anything).Return([]byte("hash"), nil)
+	mailer := new(mockMailer)
+	mailer.On("Enqueue", ctx, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), mailer, auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, []string{"admin@gmail.de"})
+
+	require.NoError(t, uc.CreateUser(ctx, &user.CreateInput{FirstName: "Max", LastName: "Mustermann", Email: "admin@gmail.de", Password: "kaffee tisch regen lampe"}))
+	found, err := repo.FindUserByEmail(ctx, "admin@gmail.de")
+	require.NoError(t, err)
+	assert.NotEqual(t, user.RolleAdmin, found.Rolle(), "an unverified address must not grant the admin role")
+
+	require.NoError(t, uc.ActivateUser(ctx, found.ID()))
+	found, err = repo.FindUserByEmail(ctx, "admin@gmail.de")
+	require.NoError(t, err)
+	assert.Equal(t, user.RolleAdmin, found.Rolle())
+}
+
+func TestDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("ValidatePassword", []byte("hash"), mock.Anything).Return(user.ErrInvalidPassword)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	mailer := new(mockMailer)
+	mailer.On("Enqueue", ctx, "max.mustermann@gmail.de", mock.Anything, mock.Anything).Return(nil)
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), mailer, auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 3600, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	require.NoError(t, err)
+	login, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	require.NoError(t, err)
+
+	_, err = uc.DeleteUser(ctx, &user.DeleteInput{UserID: "123", Password: "falsch"})
+	assert.ErrorIs(t, err, user.ErrInvalidPassword)
+
+	output, err := uc.DeleteUser(ctx, &user.DeleteInput{UserID: "123", Password: "password"})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), output.DeleteAt, time.Minute)
+	mailer.AssertCalled(t, "Enqueue", ctx, "max.mustermann@gmail.de", "Account Deletion Scheduled", mock.Anything)
+
+	_, err = uc.DeleteUser(ctx, &user.DeleteInput{UserID: "123", Password: "password"})
+	assert.ErrorIs(t, err, user.ErrDeletionAlreadyScheduled)
+	_, err = uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: login.RefreshToken})
+	assert.Error(t, err, "deletion must sign out all sessions")
+
+	export, err := uc.ExportUser(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, "max.mustermann@gmail.de", export.Email)
+	assert.NotNil(t, export.DeleteAt)
+	assert.Empty(t, export.Sessions)
+
+	_, err = uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	require.NoError(t, err)
+	found, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.False(t, found.IstZurLoeschungVorgemerkt(), "login within the grace period restores the account")
+	mailer.AssertCalled(t, "Enqueue", ctx, "max.mustermann@gmail.de", "Account Deletion Cancelled", mock.Anything)
+}
+
+func TestDeleteUserRollsBack(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	mailer := new(mockMailer)
+	mailer.On("Enqueue", mock.Anything, "max.mustermann@gmail.de", mock.Anything, mock.Anything).Return(errors.New("outbox unavailable"))
+	uc := user.NewUseCase(repo, transaction.New(nil, repo), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), mailer, auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 3600, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	require.NoError(t, err)
+	login, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max.mustermann@gmail.de", Password: "password"})
+	require.NoError(t, err)
+
+	_, err = uc.DeleteUser(ctx, &user.DeleteInput{UserID: "123", Password: "password"})
+	require.Error(t, err)
+
+	found, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.False(t, found.IstZurLoeschungVorgemerkt(), "without the notice the deletion must not be scheduled")
+	_, err = uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: login.RefreshToken})
+	assert.NoError(t, err, "the sessions must survive the rollback")
+}
+
+func TestUpdateUserVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), new(mockMailer), auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	_, err := repo.CreateUser(ctx, user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now()))
+	require.NoError(t, err)
+	profile, err := uc.Profile(ctx, "123")
+	require.NoError(t, err)
+	read := profile.Version
+
+	rename := func(version int64, firstName string) (*user.UpdateOutput, error) {
+		return uc.UpdateUser(ctx, &user.UpdateInput{UserID: "123", Version: version, FirstName: &firstName})
+	}
+	output, err := rename(read, "Moritz")
+	require.NoError(t, err)
+	assert.Greater(t, output.Version, read)
+
+	_, err = rename(read, "Erika")
+	assert.ErrorIs(t, err, user.ErrConflict, "a change based on an old version must not overwrite the newer one")
+	_, err = uc.DeleteUser(ctx, &user.DeleteInput{UserID: "123", Password: "password", Version: read})
+	assert.ErrorIs(t, err, user.ErrConflict)
+
+	profile, err = uc.Profile(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, "Moritz", profile.FirstName)
+	assert.Equal(t, output.Version, profile.Version)
+	assert.Nil(t, profile.DeleteAt)
+
+	_, err = rename(0, "Erika")
+	require.NoError(t, err, "without a version the check is skipped")
+}
+
+func TestUpdateUserValidatesFirst(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("ValidatePassword", []byte("hash"), mock.Anything).Return(user.ErrInvalidPassword)
+	hasher.On("GeneratePassword", mock.Anything).Return([]byte("neu"), nil)
+	mailer := new(mockMailer)
+	mailer.On("Enqueue", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	uc := user.NewUseCase(repo, transaction.New(nil, repo), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), mailer, auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	_, err := repo.CreateUser(ctx, user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now()))
+	require.NoError(t, err)
+	email, current, weak, strong := "max@gmail.de", "password", "kurz", "kaffee tisch regen lampe"
+	falsch := "falsch"
+
+	tests := []struct {
+		name      string
+		current   *string
+		password  *string
+		expectErr error
+	}{
+		{name: "Falsches Passwort", current: &falsch, password: &strong, expectErr: user.ErrInvalidPassword},
+		{name: "Schwaches Passwort", current: &current, password: &weak, expectErr: passwordpolicy.ErrPolicyViolation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uc.UpdateUser(ctx, &user.UpdateInput{UserID: "123", Email: &email, CurrentPassword: tt.current, NewPassword: tt.password})
+			assert.ErrorIs(t, err, tt.expectErr)
+
+			found, err := repo.FindUserByID(ctx, "123")
+			require.NoError(t, err)
+			assert.Empty(t, found.AusstehendeEmail(), "a rejected update must not request the email change")
+			mailer.AssertNotCalled(t, "Enqueue", mock.Anything, email, "Confirm Email Change", mock.Anything)
+		})
+	}
+
+	found, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	read := found.Version()
+	output, err := uc.UpdateUser(ctx, &user.UpdateInput{UserID: "123", Email: &email, CurrentPassword: &current, NewPassword: &strong})
+	require.NoError(t, err)
+	assert.Equal(t, read+1, output.Version, "email change and password are stored in one update")
+	found, err = repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, email, found.AusstehendeEmail())
+	assert.Equal(t, []byte("neu"), found.Passwort())
+	mailer.AssertCalled(t, "Enqueue", mock.Anything, email, "Confirm Email Change", mock.Anything)
+}
+
+func TestChangeEmail(t *testing.T) {
+	ctx := context.Background()
+	repo := user.NewInMemoryUserRepository()
+	hasher := new(mockPasswordHasher)
+	hasher.On("ValidatePassword", []byte("hash"), "password").Return(nil)
+	hasher.On("NeedsRehash", mock.Anything).Return(false)
+	mails := map[string]string{}
+	mailer := new(mockMailer)
+	mailer.On("Enqueue", ctx, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		fields := strings.Fields(args.String(3))
+		mails[args.String(2)] = fields[len(fields)-1]
+	}).Return(nil)
+	uc := user.NewUseCase(repo, transaction.New(nil), id.UUIDGeneratorFunc(id.GenerateUUID), hasher, newPolicy(), mailer, auth.NewJWT("access", "refresh"), totp.NewTOTP("Haushaltsbuch"), nil, newGuard(), newAudit(), 60, 60, 60, 60, nil)
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), time.Now(), time.Now())
+	u.Aktiviert()
+	_, err := repo.CreateUser(ctx, u)
+	require.NoError(t, err)
+	_, err = repo.CreateUser(ctx, user.NewUser("456", "Erika", "Musterfrau", "erika@gmail.de", []byte("hash"), time.Now(), time.Now()))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		email     string
+		expectErr error
+	}{
+		{name: "Ungültige Email", email: "max", expectErr: user.ErrInvalidEmail},
+		{name: "Email mit Anzeigename", email: "Max <max@gmail.de>", expectErr: user.ErrInvalidEmail},
+		{name: "Zu lange Email", email: strings.Repeat("m", 256) + "@gmail.de", expectErr: user.ErrEmailTooLong},
+		{name: "Email vergeben", email: "erika@gmail.de", expectErr: user.ErrEmailAlreadyExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := uc.ChangeEmail(ctx, &user.ChangeEmailInput{UserID: "123", Email: tt.email})
+			assert.ErrorIs(t, err, tt.expectErr)
+		})
+	}
+
+	require.NoError(t, uc.ChangeEmail(ctx, &user.ChangeEmailInput{UserID: "123", Email: "max@gmail.de"}))
+	mailer.AssertCalled(t, "Enqueue", ctx, "max@gmail.de", "Confirm Email Change", mock.Anything)
+	mailer.AssertCalled(t, "Enqueue", ctx, "max.mustermann@gmail.de", "Email Change Requested", mock.Anything)
+	found, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, "max.mustermann@gmail.de", found.Email(), "email must not change before the confirmation")
+
+	assert.ErrorIs(t, uc.ConfirmEmailChange(ctx, mails["Email Change Requested"]), user.ErrInvalidEmailChangeToken, "undo token must not confirm")
+	require.NoError(t, uc.ConfirmEmailChange(ctx, mails["Confirm Email Change"]))
+	assert.ErrorIs(t, uc.ConfirmEmailChange(ctx, mails["Confirm Email Change"]), user.ErrInvalidEmailChangeToken)
+	_, err = repo.FindUserByEmail(ctx, "max.mustermann@gmail.de")
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+	found, err = repo.FindUserByEmail(ctx, "max@gmail.de")
+	require.NoError(t, err)
+	assert.Equal(t, "123", found.ID())
+
+	login, err := uc.LoginUser(ctx, &user.LoginInput{Email: "max@gmail.de", Password: "password"})
+	require.NoError(t, err)
+	require.NoError(t, uc.UndoEmailChange(ctx, mails["Email Change Requested"]))
+	found, err = repo.FindUserByEmail(ctx, "max.mustermann@gmail.de")
+	require.NoError(t, err)
+	assert.Equal(t, "123", found.ID())
+	_, err = repo.FindUserByEmail(ctx, "max@gmail.de")
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+	_, err = uc.RefreshToken(ctx, &user.RefreshInput{RefreshToken: login.RefreshToken})
+	assert.Error(t, err, "undo must sign out all sessions")
+	assert.ErrorIs(t, uc.UndoEmailChange(ctx, mails["Email Change Requested"]), user.ErrInvalidEmailChangeToken)
+
+	require.NoError(t, uc.ChangeEmail(ctx, &user.ChangeEmailInput{UserID: "123", Email: "max@gmail.de"}))
+	superseded := mails["Confirm Email Change"]
+	require.NoError(t, uc.ChangeEmail(ctx, &user.ChangeEmailInput{UserID: "123", Email: "mustermann@gmail.de"}))
+	assert.ErrorIs(t, uc.ConfirmEmailChange(ctx, superseded), user.ErrInvalidEmailChangeToken, "a new request supersedes the old token")
+	_, err = repo.CreateUser(ctx, user.NewUser("789", "Moritz", "Mustermann", "mustermann@gmail.de", []byte("hash"), time.Now(), time.Now()))
+	require.NoError(t, err)
+	assert.ErrorIs(t, uc.ConfirmEmailChange(ctx, mails["Confirm Email Change"]), user.ErrEmailAlreadyExists, "email taken before the confirmation")
+}
@@ -7,16 +7,49 @@ import (
 // ID repräsentiert die ID des Users.
 type ID = string
 
+// Rolle repräsentiert die Berechtigungsstufe des Users.
+type Rolle = string
+
+const (
+	// RolleBenutzer ist die Standardrolle eines registrierten Users.
+	RolleBenutzer Rolle = "user"
+	// RolleAdmin erlaubt den Zugriff auf administrative Endpunkte.
+	RolleAdmin Rolle = "admin"
+)
+
 // User repäsentiert einen registrierten Benutzer im Haushaltsbuchsystem.
 type User struct {
 	iD              ID
 	vorname         string
 	nachname        string
 	Aktiv           bool
+	rolle           Rolle
 	email           string
 	passwort        []byte
 	erstelltAm      time.Time
 	aktuallisiertAm time.Time
+	zweiFaktor      zweiFaktor
+	loeschenAm      time.Time
+	emailAenderung  emailAenderung
+	version         int64
+}
+
+// zweiFaktor hält den TOTP-Zustand des Users.
+type zweiFaktor struct {
+	secret         string
+	aktiv          bool
+	codes          [][]byte
+	letzterSchritt int64
+}
+
+// emailAenderung hält eine beantragte Änderung der Email. Nach der Bestätigung
+// bleibt die alte Email erhalten, bis die Änderung rückgängig gemacht oder eine
+// neue beantragt wird.
+type emailAenderung struct {
+	iD         string
+	neueEmail  string
+	alteEmail  string
+	bestaetigt bool
 }
 
 // NewUser erzeugt einen neuen User mit expliziten Parametern.
@@ -25,6 +58,7 @@ func NewUser(id ID, vorname, nachname, email string, passwort []byte, erstelltAm
 		iD:              id,
 		vorname:         vorname,
 		nachname:        nachname,
+		rolle:           RolleBenutzer,
 		email:           email,
 		passwort:        passwort,
 		erstelltAm:      erstelltAm,
@@ -62,6 +96,21 @@ func (u *User) IstAktiv() bool {
 	return u.Aktiv
 }
 
+// Rolle gibt die Rolle des Users zurück.
+func (u *User) Rolle() Rolle {
+	return u.rolle
+}
+
+// NeueRolle setzt die Rolle des Users.
+func (u *User) NeueRolle(rolle Rolle) {
+	u.rolle = rolle
+}
+
+// IstAdmin gibt zurück, ob der User Administrator ist.
+func (u *User) IstAdmin() bool {
+	return u.rolle == RolleAdmin
+}
+
 // ErstelltAm gibt den Erstellungszeitpunkt des Users zurück.
 func (u *User) ErstelltAm() time.Time {
 	return u.erstelltAm
@@ -72,6 +121,12 @@ func (u *User) AktualisiertAm() time.Time {
 	return u.aktuallisiertAm
 }
 
+// Version gibt die gespeicherte Version des Users zurück. Das Repository erhöht
+// sie mit jeder Änderung und lehnt Änderungen an einer veralteten Version ab.
+func (u *User) Version() int64 {
+	return u.version
+}
+
 // Email gibt die Email des Users zurück.
 func (u *User) Email() string {
 	return u.email
@@ -82,6 +137,49 @@ func (u *User) NeueEmail(email string) {
 	u.email = email
 }
 
+// EmailAenderungID gibt die ID der beantragten Änderung der Email zurück.
+func (u *User) EmailAenderungID() string {
+	return u.emailAenderung.iD
+}
+
+// AusstehendeEmail gibt die neue, noch nicht bestätigte Email zurück.
+func (u *User) AusstehendeEmail() string {
+	if u.emailAenderung.bestaetigt {
+		return ""
+	}
+	return u.emailAenderung.neueEmail
+}
+
+// VorherigeEmail gibt die Email vor der beantragten Änderung zurück.
+func (u *User) VorherigeEmail() string {
+	return u.emailAenderung.alteEmail
+}
+
+// IstEmailAenderungBestaetigt gibt zurück, ob die neue Email bestätigt wurde.
+func (u *User) IstEmailAenderungBestaetigt() bool {
+	return u.emailAenderung.bestaetigt
+}
+
+// EmailAenderungBeantragt merkt die neue Email bis zur Bestätigung vor.
+func (u *User) EmailAenderungBeantragt(id, neueEmail string) {
+	u.emailAenderung = emailAenderung{iD: id, neueEmail: neueEmail, alteEmail: u.email}
+}
+
+// EmailAenderungBestaetigt übernimmt die vorgemerkte Email.
+func (u *User) EmailAenderungBestaetigt() {
+	u.email = u.emailAenderung.neueEmail
+	u.emailAenderung.bestaetigt = true
+}
+
+// EmailAenderungZurueckgenommen verwirft die beantragte Änderung und stellt eine
+// bereits bestätigte Änderung auf die alte Email zurück.
+func (u *User) EmailAenderungZurueckgenommen() {
+	if u.emailAenderung.bestaetigt {
+		u.email = u.emailAenderung.alteEmail
+	}
+	u.emailAenderung = emailAenderung{}
+}
+
 // Passwort gibt das Passwort des Users zurück.
 func (u *User) Passwort() []byte {
 	return u.passwort
@@ -106,3 +204,67 @@ func (u *User) Deaktiviert() {
 func (u *User) Aktualisert() {
 	u.aktuallisiertAm = time.Now().UTC()
 }
+
+// LoeschenAm gibt den Zeitpunkt zurück, ab dem der User endgültig gelöscht wird.
+func (u *User) LoeschenAm() time.Time {
+	return u.loeschenAm
+}
+
+// IstZurLoeschungVorgemerkt gibt zurück, ob der User die Löschung beantragt hat.
+func (u *User) IstZurLoeschungVorgemerkt() bool {
+	return !u.loeschenAm.IsZero()
+}
+
+// LoeschungVorgemerkt merkt den User zur Löschung zum angegebenen Zeitpunkt vor.
+func (u *User) LoeschungVorgemerkt(am time.Time) {
+	u.loeschenAm = am
+}
+
+// LoeschungAufgehoben nimmt die Löschung des Users zurück.
+func (u *User) LoeschungAufgehoben() {
+	u.loeschenAm = time.Time{}
+}
+
+// ZweiFaktorSecret gibt das TOTP-Secret des Users zurück.
+func (u *User) ZweiFaktorSecret() string {
+	return u.zweiFaktor.secret
+}
+
+// IstZweiFaktorAktiv gibt zurück, ob die Zwei-Faktor-Authentifizierung aktiv ist.
+func (u *User) IstZweiFaktorAktiv() bool {
+	return u.zweiFaktor.aktiv
+}
+
+// NeuesZweiFaktorSecret hinterlegt ein noch unbestätigtes TOTP-Secret.
+func (u *User) NeuesZweiFaktorSecret(secret string) {
+	u.zweiFaktor = zweiFaktor{secret: secret}
+}
+
+// ZweiFaktorAktiviert aktiviert die Zwei-Faktor-Authentifizierung mit den
+// gehashten Wiederherstellungscodes.
+func (u *User) ZweiFaktorAktiviert(codes [][]byte) {
+	u.zweiFaktor.aktiv = true
+	u.zweiFaktor.codes = codes
+}
+
+// WiederherstellungsCodes gibt die gehashten, noch unbenutzten Wiederherstellungscodes zurück.
+func (u *User) WiederherstellungsCodes() [][]byte {
+	return u.zweiFaktor.codes
+}
+
+// WiederherstellungsCodeVerbraucht entfernt den Wiederherstellungscode an Position i.
+func (u *User) WiederherstellungsCodeVerbraucht(i int) {
+	codes := make([][]byte, 0, len(u.zweiFaktor.codes))
+	codes = append(codes, u.zweiFaktor.codes[:i]...)
+	u.zweiFaktor.codes = append(codes, u.zweiFaktor.codes[i+1:]...)
+}
+
+// LetzterTOTPSchritt gibt den Zeitschritt des zuletzt akzeptierten TOTP-Codes zurück.
+func (u *User) LetzterTOTPSchritt() int64 {
+	return u.zweiFaktor.letzterSchritt
+}
+
+// TOTPSchrittVerwendet merkt sich den Zeitschritt eines akzeptierten TOTP-Codes.
+func (u *User) TOTPSchrittVerwendet(schritt int64) {
+	u.zweiFaktor.letzterSchritt = schritt
+}
@@ -0,0 +1,491 @@
+// Package usertest provides the contract every user.Store backend has to fulfil.
+// A backend runs it from its own tests, e.g. with storetest.Backends:
+//
+//	func TestPostgresUserRepository(t *testing.T) {
+//		usertest.TestStore(t, func(t *testing.T) user.Store { ... })
+//	}
+package usertest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/storetest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+)
+
+// TestStore runs the contract against the stores of newStore. Every call has to
+// return a new, empty store.
+func TestStore(t *testing.T, newStore func(t *testing.T) user.Store) {
+	storetest.Run(t, newStore,
+		storetest.Case[user.Store]{Name: "Lebenszyklus", Test: testLifecycle},
+		storetest.Case[user.Store]{Name: "Eindeutigkeit", Test: testUniqueness},
+		storetest.Case[user.Store]{Name: "Nicht gefunden", Test: testNotFound},
+		storetest.Case[user.Store]{Name: "Abgebrochener Kontext", Test: testCancelledContext},
+		storetest.Case[user.Store]{Name: "Gleichzeitige Änderungen", Test: testConcurrentUpdates},
+		storetest.Case[user.Store]{Name: "Kopien", Test: testCopies},
+		storetest.Case[user.Store]{Name: "Versionen", Test: testVersions},
+	)
+}
+
+func createUser(t *testing.T, repo user.Store, id, email string) *user.User {
+	t.Helper()
+	created := storetest.Now()
+	u := user.NewUser(id, "Max", "Mustermann", email, []byte("hash"), created, created)
+	_, err := repo.CreateUser(context.Background(), u)
+	require.NoError(t, err)
+	return u
+}
+
+func testLifecycle(t *testing.T, repo user.Store) {
+	ctx := context.Background()
+	now := storetest.Now()
+
+	u := user.NewUser("123", "Max", "Mustermann", "max.mustermann@gmail.de", []byte("hash"), now, now)
+	u.Aktiviert()
+	u.NeuesZweiFaktorSecret("secret")
+	u.ZweiFaktorAktiviert([][]byte{[]byte("code1"), []byte("code2")})
+	u.TOTPSchrittVerwendet(42)
+	_, err := repo.CreateUser(ctx, u)
+	require.NoError(t, err)
+	createUser(t, repo, "456", "erika@gmail.de")
+
+	found, err := repo.FindUserByEmail(ctx, "max.mustermann@gmail.de")
+	require.NoError(t, err)
+	assert.Equal(t, "123", found.ID())
+	assert.Equal(t, "Max", found.Vorname())
+	assert.True(t, found.IstAktiv())
+	assert.Equal(t, []byte("hash"), found.Passwort())
+	assert.True(t, found.IstZweiFaktorAktiv())
+	assert.Equal(t, [][]byte{[]byte("code1"), []byte("code2")}, found.WiederherstellungsCodes())
+	assert.Equal(t, int64(42), found.LetzterTOTPSchritt())
+	assert.Equal(t, now, found.ErstelltAm())
+
+	found.EmailAenderungBeantragt("change", "max@gmail.de")
+	found.LoeschungVorgemerkt(now.Add(-time.Minute))
+	_, err = repo.UpdateUser(ctx, found)
+	require.NoError(t, err)
+	found, err = repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, "max@gmail.de", found.AusstehendeEmail())
+	assert.Equal(t, now.Add(-time.Minute), found.LoeschenAm())
+	due, err := repo.FindUsersDueForDeletion(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "123", due[0].ID())
+
+	require.NoError(t, repo.ChangeEmail(ctx, "123", "max@gmail.de"))
+	_, err = repo.FindUserByEmail(ctx, "max.mustermann@gmail.de")
+	assert.ErrorIs(t, err, user.ErrUserNotFound, "the old email is released")
+	require.NoError(t, repo.ChangePassword(ctx, "123", []byte("neu")))
+	found, err = repo.FindUserByEmail(ctx, "max@gmail.de")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("neu"), found.Passwort())
+
+	laptop := user.NewSession("laptop", "123", "Firefox", "10.0.0.1", now)
+	phone := user.NewSession("phone", "123", "Android", "10.0.0.2", now)
+	require.NoError(t, repo.SaveSession(ctx, laptop))
+	require.NoError(t, repo.SaveSession(ctx, phone))
+	require.NoError(t, repo.TouchSession(ctx, "phone", now.Add(time.Minute)))
+	sessions, err := repo.FindSessionsByUserID(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "phone", sessions[0].ID(), "most recently used first")
+
+	first := user.NewRefreshToken("t1", "123", "laptop", now, now.Add(time.Hour))
+	second := user.NewRefreshToken("t2", "123", "laptop", now, now.Add(time.Hour))
+	require.NoError(t, repo.SaveRefreshToken(ctx, first))
+	require.NoError(t, repo.RotateRefreshToken(ctx, "t1", second))
+	assert.ErrorIs(t, repo.RotateRefreshToken(ctx, "t1", user.NewRefreshToken("t3", "123", "laptop", now, now)), user.ErrRefreshTokenReused)
+	token, err := repo.FindRefreshToken(ctx, "t1")
+	require.NoError(t, err)
+	assert.True(t, token.IstErsetzt())
+	assert.Equal(t, now.Add(time.Hour), token.LaeuftAbAm())
+
+	require.NoError(t, repo.RevokeOtherSessions(ctx, "123", "phone"))
+	_, err = repo.FindRefreshToken(ctx, "t2")
+	assert.ErrorIs(t, err, user.ErrRefreshTokenNotFound, "tokens of revoked sessions are removed")
+	assert.ErrorIs(t, repo.TouchSession(ctx, "laptop", now), user.ErrSessionNotFound)
+	assert.ErrorIs(t, repo.RevokeSession(ctx, "456", "phone"), user.ErrSessionNotFound, "session of another user")
+	require.NoError(t, repo.SaveRefreshToken(ctx, user.NewRefreshToken("t4", "123", "phone", now, now.Add(time.Hour))))
+	require.NoError(t, repo.LogoutUser(ctx, "123", "t4"))
+	_, err = repo.FindRefreshToken(ctx, "t4")
+	assert.ErrorIs(t, err, user.ErrRefreshTokenNotFound)
+	sessions, err = repo.FindSessionsByUserID(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "logout ends the session")
+
+	require.NoError(t, repo.LinkExternalID(ctx, "123", "https://idp", "ext-1"))
+	require.NoError(t, repo.LinkExternalID(ctx, "123", "https://idp", "ext-1"), "linking twice is idempotent")
+	linked, err := repo.FindUserByExternalID(ctx, "https://idp", "ext-1")
+	require.NoError(t, err)
+	assert.Equal(t, "123", linked.ID())
+
+	require.NoError(t, repo.SaveSession(ctx, laptop))
+	require.NoError(t, repo.DeleteUser(ctx, "123"))
+	_, err = repo.FindUserByID(ctx, "123")
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+	_, err = repo.FindUserByExternalID(ctx, "https://idp", "ext-1")
+	assert.ErrorIs(t, err, user.ErrUserNotFound, "external identities are removed with the user")
+	sessions, err = repo.FindSessionsByUserID(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "sessions are removed with the user")
+	createUser(t, repo, "789", "max@gmail.de")
+}
+
+func testUniqueness(t *testing.T, repo user.Store) {
+	ctx := context.Background()
+	max := createUser(t, repo, "123", "max@gmail.de")
+	erika := createUser(t, repo, "456", "erika@gmail.de")
+
+	tests := []struct {
+		name      string
+		run       func() error
+		expectErr error
+	}{
+		{
+			name: "Email bereits vergeben",
+			run: func() error {
+				_, err := repo.CreateUser(ctx, user.NewUser("789", "Max", "Mustermann", "max@gmail.de", nil, storetest.Now(), storetest.Now()))
+				return err
+			},
+			expectErr: user.ErrEmailAlreadyExists,
+		},
+		{
+			name: "ID bereits vergeben",
+			run: func() error {
+				_, err := repo.CreateUser(ctx, user.NewUser("123", "Max", "Mustermann", "neu@gmail.de", nil, storetest.Now(), storetest.Now()))
+				return err
+			},
+			expectErr: user.ErrUserAlreadyExists,
+		},
+		{
+			name: "Aktualisierung auf vergebene Email",
+			run: func() error {
+				erika.NeueEmail("max@gmail.de")
+				_, err := repo.UpdateUser(ctx, erika)
+				return err
+			},
+			expectErr: user.ErrEmailAlreadyExists,
+		},
+		{
+			name:      "Emailänderung auf vergebene Email",
+			run:       func() error { return repo.ChangeEmail(ctx, "456", "max@gmail.de") },
+			expectErr: user.ErrEmailAlreadyExists,
+		},
+		{
+			name: "Externe Identität eines anderen Users",
+			run: func() error {
+				if err := repo.LinkExternalID(ctx, "123", "https://idp", "ext-1"); err != nil {
+					return err
+				}
+				return repo.LinkExternalID(ctx, "456", "https://idp", "ext-1")
+			},
+			expectErr: user.ErrExternalIDAlreadyLinked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.run(), tt.expectErr)
+		})
+	}
+
+	found, err := repo.FindUserByEmail(ctx, "max@gmail.de")
+	require.NoError(t, err)
+	assert.Equal(t, max.ID(), found.ID(), "failed changes must not touch the stored user")
+	found, err = repo.FindUserByID(ctx, "456")
+	require.NoError(t, err)
+	assert.Equal(t, "erika@gmail.de", found.Email())
+}
+
+func testNotFound(t *testing.T, repo user.Store) {
+	ctx := context.Background()
+	createUser(t, repo, "123", "max@gmail.de")
+	unknown := user.NewUser("unbekannt", "Max", "Mustermann", "unbekannt@gmail.de", nil, storetest.Now(), storetest.Now())
+
+	tests := []struct {
+		name      string
+		run       func() error
+		expectErr error
+	}{
+		{
+			name: "User per ID",
+			run: func() error {
+				_, err := repo.FindUserByID(ctx, "unbekannt")
+				return err
+			},
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name: "User per Email",
+			run: func() error {
+				_, err := repo.FindUserByEmail(ctx, "unbekannt@gmail.de")
+				return err
+			},
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name: "User per externer Identität",
+			run: func() error {
+				_, err := repo.FindUserByExternalID(ctx, "https://idp", "unbekannt")
+				return err
+			},
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name: "User aktualisieren",
+			run: func() error {
+				_, err := repo.UpdateUser(ctx, unknown)
+				return err
+			},
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name:      "Passwort ändern",
+			run:       func() error { return repo.ChangePassword(ctx, "unbekannt", []byte("neu")) },
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name:      "Email ändern",
+			run:       func() error { return repo.ChangeEmail(ctx, "unbekannt", "neu@gmail.de") },
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name:      "User löschen",
+			run:       func() error { return repo.DeleteUser(ctx, "unbekannt") },
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name:      "Abmelden",
+			run:       func() error { return repo.LogoutUser(ctx, "unbekannt", "t1") },
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name: "Sitzung eines unbekannten Users",
+			run: func() error {
+				return repo.SaveSession(ctx, user.NewSession("s1", "unbekannt", "", "", storetest.Now()))
+			},
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name: "Refresh-Token eines unbekannten Users",
+			run: func() error {
+				return repo.SaveRefreshToken(ctx, user.NewRefreshToken("t1", "unbekannt", "s1", storetest.Now(), storetest.Now().Add(time.Hour)))
+			},
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name:      "Externe Identität eines unbekannten Users",
+			run:       func() error { return repo.LinkExternalID(ctx, "unbekannt", "https://idp", "ext-1") },
+			expectErr: user.ErrUserNotFound,
+		},
+		{
+			name: "Refresh-Token",
+			run: func() error {
+				_, err := repo.FindRefreshToken(ctx, "unbekannt")
+				return err
+			},
+			expectErr: user.ErrRefreshTokenNotFound,
+		},
+		{
+			name: "Refresh-Token rotieren",
+			run: func() error {
+				return repo.RotateRefreshToken(ctx, "unbekannt", user.NewRefreshToken("t2", "123", "s1", storetest.Now(), storetest.Now().Add(time.Hour)))
+			},
+			expectErr: user.ErrRefreshTokenNotFound,
+		},
+		{
+			name:      "Sitzung nutzen",
+			run:       func() error { return repo.TouchSession(ctx, "unbekannt", storetest.Now()) },
+			expectErr: user.ErrSessionNotFound,
+		},
+		{
+			name:      "Sitzung beenden",
+			run:       func() error { return repo.RevokeSession(ctx, "123", "unbekannt") },
+			expectErr: user.ErrSessionNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.run(), tt.expectErr)
+		})
+	}
+
+	sessions, err := repo.FindSessionsByUserID(ctx, "unbekannt")
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "no sessions is an empty list, not an error")
+	due, err := repo.FindUsersDueForDeletion(ctx, storetest.Now())
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+func testCancelledContext(t *testing.T, repo user.Store) {
+	u := createUser(t, repo, "123", "max@gmail.de")
+	require.NoError(t, repo.SaveSession(context.Background(), user.NewSession("s1", "123", "", "", storetest.Now())))
+	require.NoError(t, repo.SaveRefreshToken(context.Background(), user.NewRefreshToken("t1", "123", "s1", storetest.Now(), storetest.Now().Add(time.Hour))))
+
+	storetest.Cancelled(t,
+		storetest.Call{Name: "CreateUser", Run: func(ctx context.Context) error {
+			_, err := repo.CreateUser(ctx, user.NewUser("456", "Erika", "Musterfrau", "erika@gmail.de", nil, storetest.Now(), storetest.Now()))
+			return err
+		}},
+		storetest.Call{Name: "FindUserByEmail", Run: func(ctx context.Context) error { _, err := repo.FindUserByEmail(ctx, "max@gmail.de"); return err }},
+		storetest.Call{Name: "FindUserByID", Run: func(ctx context.Context) error { _, err := repo.FindUserByID(ctx, "123"); return err }},
+		storetest.Call{Name: "LogoutUser", Run: func(ctx context.Context) error { return repo.LogoutUser(ctx, "123", "t1") }},
+		storetest.Call{Name: "UpdateUser", Run: func(ctx context.Context) error { _, err := repo.UpdateUser(ctx, u); return err }},
+		storetest.Call{Name: "ChangePassword", Run: func(ctx context.Context) error { return repo.ChangePassword(ctx, "123", []byte("neu")) }},
+		storetest.Call{Name: "ChangeEmail", Run: func(ctx context.Context) error { return repo.ChangeEmail(ctx, "123", "neu@gmail.de") }},
+		storetest.Call{Name: "SaveRefreshToken", Run: func(ctx context.Context) error {
+			return repo.SaveRefreshToken(ctx, user.NewRefreshToken("t2", "123", "s1", storetest.Now(), storetest.Now().Add(time.Hour)))
+		}},
+		storetest.Call{Name: "FindRefreshToken", Run: func(ctx context.Context) error { _, err := repo.FindRefreshToken(ctx, "t1"); return err }},
+		storetest.Call{Name: "RotateRefreshToken", Run: func(ctx context.Context) error {
+			return repo.RotateRefreshToken(ctx, "t1", user.NewRefreshToken("t2", "123", "s1", storetest.Now(), storetest.Now().Add(time.Hour)))
+		}},
+		storetest.Call{Name: "RevokeTokenFamily", Run: func(ctx context.Context) error { return repo.RevokeTokenFamily(ctx, "s1") }},
+		storetest.Call{Name: "SaveSession", Run: func(ctx context.Context) error {
+			return repo.SaveSession(ctx, user.NewSession("s2", "123", "", "", storetest.Now()))
+		}},
+		storetest.Call{Name: "FindSessionsByUserID", Run: func(ctx context.Context) error { _, err := repo.FindSessionsByUserID(ctx, "123"); return err }},
+		storetest.Call{Name: "TouchSession", Run: func(ctx context.Context) error { return repo.TouchSession(ctx, "s1", storetest.Now()) }},
+		storetest.Call{Name: "RevokeSession", Run: func(ctx context.Context) error { return repo.RevokeSession(ctx, "123", "s1") }},
+		storetest.Call{Name: "RevokeOtherSessions", Run: func(ctx context.Context) error { return repo.RevokeOtherSessions(ctx, "123", "") }},
+		storetest.Call{Name: "FindUserByExternalID", Run: func(ctx context.Context) error {
+			_, err := repo.FindUserByExternalID(ctx, "https://idp", "ext-1")
+			return err
+		}},
+		storetest.Call{Name: "LinkExternalID", Run: func(ctx context.Context) error { return repo.LinkExternalID(ctx, "123", "https://idp", "ext-1") }},
+		storetest.Call{Name: "DeleteUser", Run: func(ctx context.Context) error { return repo.DeleteUser(ctx, "123") }},
+		storetest.Call{Name: "FindUsersDueForDeletion", Run: func(ctx context.Context) error {
+			_, err := repo.FindUsersDueForDeletion(ctx, storetest.Now())
+			return err
+		}},
+	)
+
+	found, err := repo.FindUserByID(context.Background(), "123")
+	require.NoError(t, err, "a cancelled call must not change the store")
+	assert.Equal(t, "max@gmail.de", found.Email())
+	assert.Equal(t, []byte("hash"), found.Passwort())
+	sessions, err := repo.FindSessionsByUserID(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func testConcurrentUpdates(t *testing.T, repo user.Store) {
+	ctx := context.Background()
+	for i := range storetest.Concurrency {
+		createUser(t, repo, fmt.Sprint(i), fmt.Sprintf("user%d@gmail.de", i))
+	}
+	require.NoError(t, repo.SaveRefreshToken(ctx, user.NewRefreshToken("t", "0", "s", storetest.Now(), storetest.Now().Add(time.Hour))))
+
+	t.Run("Gleiche Email", func(t *testing.T) {
+		errs := storetest.Race(func(i int) error { return repo.ChangeEmail(ctx, fmt.Sprint(i), "gleich@gmail.de") })
+		assert.Equal(t, 1, storetest.Count(errs, nil), "exactly one user gets the email")
+		assert.Equal(t, storetest.Concurrency-1, storetest.Count(errs, user.ErrEmailAlreadyExists))
+	})
+
+	t.Run("Gleicher Refresh-Token", func(t *testing.T) {
+		errs := storetest.Race(func(i int) error {
+			return repo.RotateRefreshToken(ctx, "t", user.NewRefreshToken(fmt.Sprintf("t%d", i), "0", "s", storetest.Now(), storetest.Now().Add(time.Hour)))
+		})
+		assert.Equal(t, 1, storetest.Count(errs, nil), "a refresh token is rotated exactly once")
+		assert.Equal(t, storetest.Concurrency-1, storetest.Count(errs, user.ErrRefreshTokenReused))
+	})
+
+	t.Run("Gleicher User", func(t *testing.T) {
+		read, err := repo.FindUserByID(ctx, "0")
+		require.NoError(t, err)
+		errs := storetest.Race(func(i int) error {
+			stale := *read
+			stale.NeuerNachname(fmt.Sprint(i))
+			_, err := repo.UpdateUser(ctx, &stale)
+			return err
+		})
+		assert.Equal(t, 1, storetest.Count(errs, nil), "only one change of the same version is stored")
+		assert.Equal(t, storetest.Concurrency-1, storetest.Count(errs, user.ErrConflict))
+	})
+
+	t.Run("Verschiedene User", func(t *testing.T) {
+		errs := storetest.Race(func(i int) error {
+			found, err := repo.FindUserByID(ctx, fmt.Sprint(i))
+			if err != nil {
+				return err
+			}
+			found.NeuerVorname(fmt.Sprintf("Max %d", i))
+			if _, err := repo.UpdateUser(ctx, found); err != nil {
+				return err
+			}
+			return repo.ChangePassword(ctx, fmt.Sprint(i), []byte(fmt.Sprint(i)))
+		})
+		assert.Equal(t, storetest.Concurrency, storetest.Count(errs, nil))
+		for i := range storetest.Concurrency {
+			found, err := repo.FindUserByID(ctx, fmt.Sprint(i))
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("Max %d", i), found.Vorname())
+			assert.Equal(t, []byte(fmt.Sprint(i)), found.Passwort())
+		}
+	})
+}
+
+func testCopies(t *testing.T, repo user.Store) {
+	ctx := context.Background()
+	created := createUser(t, repo, "123", "max@gmail.de")
+	created.NeuerVorname("Moritz")
+
+	found, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, "Max", found.Vorname(), "the created user is not shared with the store")
+
+	found.NeuerVorname("Moritz")
+	found.NeueEmail("moritz@gmail.de")
+	found, err = repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, "Max", found.Vorname(), "changes only take effect through UpdateUser")
+	assert.Equal(t, "max@gmail.de", found.Email())
+
+	found.NeueEmail("moritz@gmail.de")
+	_, err = repo.UpdateUser(ctx, found)
+	require.NoError(t, err)
+	_, err = repo.FindUserByEmail(ctx, "moritz@gmail.de")
+	require.NoError(t, err, "the email index follows the update")
+	_, err = repo.FindUserByEmail(ctx, "max@gmail.de")
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+}
+
+func testVersions(t *testing.T, repo user.Store) {
+	ctx := context.Background()
+	created := createUser(t, repo, "123", "max@gmail.de")
+	assert.Equal(t, int64(1), created.Version())
+
+	first, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	second, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+
+	first.NeuerVorname("Moritz")
+	_, err = repo.UpdateUser(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), first.Version(), "the saved user carries the new version")
+
+	second.NeuerVorname("Erika")
+	_, err = repo.UpdateUser(ctx, second)
+	assert.ErrorIs(t, err, user.ErrConflict)
+	found, err := repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, "Moritz", found.Vorname(), "a stale user must not overwrite the newer one")
+	assert.Equal(t, int64(2), found.Version())
+
+	require.NoError(t, repo.ChangePassword(ctx, "123", []byte("neu")))
+	require.NoError(t, repo.ChangeEmail(ctx, "123", "moritz@gmail.de"))
+	_, err = repo.UpdateUser(ctx, first)
+	assert.ErrorIs(t, err, user.ErrConflict, "password and email changes count as changes")
+	found, err = repo.FindUserByID(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), found.Version())
+	_, err = repo.UpdateUser(ctx, found)
+	require.NoError(t, err)
+}
@@ -0,0 +1,170 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// magic starts every vault file, followed by the format version.
+const (
+	magic         = "YMIRVAULT"
+	formatVersion = 1
+	saltLength    = 16
+	keyLength     = 32
+	headerLength  = len(magic) + 1 + 4 + 4 + 1 + saltLength + 12
+)
+
+// Limits for the key derivation parameters read from a file, so a crafted header
+// cannot make the derivation take all memory.
+const (
+	maxMemory     = 1 << 20
+	maxIterations = 100
+)
+
+// Params are the argon2id parameters the key is derived with. They are stored in
+// the file header, so a vault keeps opening after the defaults change.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultParams are the parameters of new vaults.
+var DefaultParams = Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 4}
+
+// header is the unencrypted start of a vault file. It is authenticated together
+// with the ciphertext, so changing a parameter makes the file unreadable.
+type header struct {
+	params Params
+	salt   []byte
+	nonce  []byte
+}
+
+func (h *header) marshal() []byte {
+	buf := make([]byte, 0, headerLength)
+	buf = append(buf, magic...)
+	buf = append(buf, formatVersion)
+	buf = binary.BigEndian.AppendUint32(buf, h.params.Iterations)
+	buf = binary.BigEndian.AppendUint32(buf, h.params.Memory)
+	buf = append(buf, h.params.Parallelism)
+	buf = append(buf, h.salt...)
+	return append(buf, h.nonce...)
+}
+
+func parseHeader(data []byte) (*header, error) {
+	if len(data) < headerLength || !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, ErrNotAVault
+	}
+	data = data[len(magic):]
+	if data[0] != formatVersion {
+		return nil, fmt.Errorf("%w: format version %d", ErrNotAVault, data[0])
+	}
+	h := &header{
+		params: Params{
+			Iterations:  binary.BigEndian.Uint32(data[1:5]),
+			Memory:      binary.BigEndian.Uint32(data[5:9]),
+			Parallelism: data[9],
+		},
+		salt:  data[10 : 10+saltLength],
+		nonce: data[10+saltLength : headerLength-len(magic)],
+	}
+	if h.params.Iterations == 0 || h.params.Iterations > maxIterations || h.params.Memory == 0 ||
+		h.params.Memory > maxMemory || h.params.Parallelism == 0 {
+		return nil, fmt.Errorf("%w: invalid key derivation parameters", ErrNotAVault)
+	}
+	return h, nil
+}
+
+// deriveKey derives the AES-256 key from the passphrase with argon2id.
+func deriveKey(passphrase string, salt []byte, params Params) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, params.Iterations, params.Memory, params.Parallelism, keyLength)
+}
+
+// seal encrypts the plaintext with AES-256-GCM under a new nonce and returns the
+// complete file content.
+func seal(key []byte, params Params, salt, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	h := &header{params: params, salt: salt, nonce: make([]byte, aead.NonceSize())}
+	if _, err := rand.Read(h.nonce); err != nil {
+		return nil, err
+	}
+	prefix := h.marshal()
+	return aead.Seal(prefix, h.nonce, plaintext, prefix), nil
+}
+
+// open decrypts the file content. A wrong key and a damaged file both fail the
+// authentication with ErrUnreadable.
+func open(key []byte, data []byte) ([]byte, error) {
+	h, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, h.nonce, data[headerLength:], data[:headerLength])
+	if err != nil {
+		return nil, ErrUnreadable
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeAtomic replaces the file at path with data. It writes a temporary file in
+// the same directory, syncs it and renames it over path, so a crash leaves either
+// the old or the new file but never a partial one.
+func writeAtomic(path string, data []byte) (err error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = tmp.Chmod(0o600); err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// the rename is only durable once the directory is synced
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,49 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+)
+
+func TestOpenCorruptDatabase(t *testing.T) {
+	params := Params{Memory: 64, Iterations: 1, Parallelism: 1}
+	salt := make([]byte, saltLength)
+	data, err := seal(deriveKey("geheim", salt, params), params, salt, []byte("kein SQLite"))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "test.vault")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	_, err = Open(path, "geheim", params, nil, time.Hour)
+	assert.ErrorIs(t, err, sqlite.ErrCorrupt, "a snapshot is verified after decryption")
+}
+
+func TestParseHeader(t *testing.T) {
+	salt, nonce := make([]byte, saltLength), make([]byte, 12)
+	tests := []struct {
+		name      string
+		params    Params
+		expectErr error
+	}{
+		{name: "Gültig", params: DefaultParams},
+		{name: "Ohne Iterationen", params: Params{Memory: 64, Parallelism: 1}, expectErr: ErrNotAVault},
+		{name: "Zu viel Speicher", params: Params{Memory: maxMemory + 1, Iterations: 1, Parallelism: 1}, expectErr: ErrNotAVault},
+		{name: "Ohne Parallelität", params: Params{Memory: 64, Iterations: 1}, expectErr: ErrNotAVault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := parseHeader((&header{params: tt.params, salt: salt, nonce: nonce}).marshal())
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.params, h.params)
+		})
+	}
+}
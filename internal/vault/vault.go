@@ -0,0 +1,187 @@
+// Package vault keeps the SQLite database of every store in memory and persists
+// it into a single file encrypted with AES-256-GCM. The key is derived from a
+// passphrase with argon2id, so the file can be synced with any tool without
+// exposing the household data.
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	"gitlab.com/shingeki-no-kyojin/ymir/pkg/logger"
+)
+
+var (
+	// ErrEmptyPassphrase is returned when a vault is opened without a passphrase
+	ErrEmptyPassphrase = errors.New("Vault passphrase is empty")
+	// ErrNotAVault is returned when a file is no vault of a supported format
+	ErrNotAVault = errors.New("File is no vault")
+	// ErrUnreadable is returned when a vault cannot be decrypted
+	ErrUnreadable = errors.New("Vault cannot be decrypted. Wrong passphrase or damaged file")
+)
+
+// Vault is an in-memory SQLite database that is saved to an encrypted file.
+// Every save replaces the file atomically with a complete snapshot, an SQL script
+// that recreates the database.
+type Vault struct {
+	db       *sql.DB
+	path     string
+	key      []byte
+	salt     []byte
+	params   Params
+	log      logger.Logger
+	interval time.Duration
+	mutex    sync.Mutex
+	// saved is the change counter of the database at the last save
+	saved int64
+}
+
+// Open loads the vault file at path, or starts an empty vault if the file does
+// not exist yet. The snapshot is decrypted and its integrity checked before the
+// database is used, a damaged database fails with sqlite.ErrCorrupt. Run saves
+// the changes every interval.
+func Open(path, passphrase string, params Params, log logger.Logger, interval time.Duration) (*Vault, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	v := &Vault{
+		path:     path,
+		params:   params,
+		log:      log,
+		interval: interval,
+	}
+	var plaintext []byte
+	if data == nil {
+		v.salt = make([]byte, saltLength)
+		if _, err := rand.Read(v.salt); err != nil {
+			return nil, err
+		}
+		v.key = deriveKey(passphrase, v.salt, v.params)
+	} else {
+		h, err := parseHeader(data)
+		if err != nil {
+			return nil, err
+		}
+		v.salt, v.params = h.salt, h.params
+		v.key = deriveKey(passphrase, v.salt, v.params)
+		if plaintext, err = open(v.key, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if v.db, err = openMemory(plaintext); err != nil {
+		return nil, err
+	}
+	if v.saved, err = v.changes(context.Background()); err != nil {
+		v.db.Close()
+		return nil, err
+	}
+	return v, nil
+}
+
+// openMemory opens an in-memory database with the content of a snapshot. An
+// in-memory database lives in its connection, so the pool holds exactly one
+// connection that is never closed.
+func openMemory(snapshot []byte) (*sql.DB, error) {
+	db, err := sqlite.Open(":memory:")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	if snapshot == nil {
+		return db, nil
+	}
+
+	if err := sqlite.Restore(context.Background(), db, snapshot); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// DB returns the database the stores work on.
+func (v *Vault) DB() *sql.DB {
+	return v.db
+}
+
+// Run saves the changes every interval until the context is cancelled and saves
+// a last time before it returns.
+func (v *Vault) Run(ctx context.Context) error {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return v.Save(context.Background())
+		case <-ticker.C:
+			if err := v.Save(ctx); err != nil {
+				v.log.Error(fmt.Sprintf("failed to save vault. %v", err))
+			}
+		}
+	}
+}
+
+// Save writes a snapshot of the database to the file if it changed since the
+// last save. The snapshot is taken between transactions, so it never contains
+// half of a unit of work.
+func (v *Vault) Save(ctx context.Context) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	conn, err := v.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var changes int64
+	if err := conn.QueryRowContext(ctx, `SELECT total_changes()`).Scan(&changes); err != nil {
+		return err
+	}
+	if changes == v.saved {
+		return nil
+	}
+	snapshot, err := sqlite.Dump(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	data, err := seal(v.key, v.params, v.salt, snapshot)
+	if err != nil {
+		return err
+	}
+	if err := writeAtomic(v.path, data); err != nil {
+		return err
+	}
+	v.saved = changes
+	return nil
+}
+
+// Close saves the pending changes and closes the database.
+func (v *Vault) Close() error {
+	err := v.Save(context.Background())
+	return errors.Join(err, v.db.Close())
+}
+
+// changes returns the number of rows changed since the database was opened.
+func (v *Vault) changes(ctx context.Context) (int64, error) {
+	var changes int64
+	err := v.db.QueryRowContext(ctx, `SELECT total_changes()`).Scan(&changes)
+	return changes, err
+}
@@ -0,0 +1,181 @@
+package vault_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/ledger"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/ledger/ledgertest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/sqlite"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/user/usertest"
+	"gitlab.com/shingeki-no-kyojin/ymir/internal/vault"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Error(string)   {}
+func (nopLogger) Warning(string) {}
+func (nopLogger) Info(string)    {}
+func (nopLogger) Debug(string)   {}
+func (nopLogger) Fatal(string)   {}
+
+// fastParams keep the key derivation of the tests cheap.
+var fastParams = vault.Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func openVault(t *testing.T, path, passphrase string) *vault.Vault {
+	t.Helper()
+	v, err := vault.Open(path, passphrase, fastParams, nopLogger{}, time.Hour)
+	require.NoError(t, err)
+	return v
+}
+
+// openMigrated opens a new vault with every migration applied.
+func openMigrated(t *testing.T) *vault.Vault {
+	t.Helper()
+	v := openVault(t, filepath.Join(t.TempDir(), "test.vault"), "geheim")
+	t.Cleanup(func() { v.Close() })
+	migrator, err := sqlite.NewMigrator(v.DB())
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	return v
+}
+
+func insertNote(t *testing.T, v *vault.Vault, text string) {
+	t.Helper()
+	ctx := context.Background()
+	_, err := v.DB().ExecContext(ctx, `CREATE TABLE IF NOT EXISTS notes (text TEXT NOT NULL)`)
+	require.NoError(t, err)
+	_, err = v.DB().ExecContext(ctx, `INSERT INTO notes (text) VALUES ($1)`, text)
+	require.NoError(t, err)
+}
+
+func notes(t *testing.T, v *vault.Vault) []string {
+	t.Helper()
+	rows, err := v.DB().Query(`SELECT text FROM notes ORDER BY rowid`)
+	require.NoError(t, err)
+	defer rows.Close()
+	texts := make([]string, 0)
+	for rows.Next() {
+		var text string
+		require.NoError(t, rows.Scan(&text))
+		texts = append(texts, text)
+	}
+	require.NoError(t, rows.Err())
+	return texts
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "haushaltsbuch.vault")
+	v := openVault(t, path, "geheim")
+	require.NoError(t, v.Save(context.Background()))
+	_, err := os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "an unchanged vault is not written")
+
+	insertNote(t, v, "Miete")
+	require.NoError(t, v.Close())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "Miete", "the file is encrypted")
+
+	v, err = vault.Open(path, "geheim", vault.DefaultParams, nopLogger{}, time.Hour)
+	require.NoError(t, err, "the parameters of the file are used")
+	assert.Equal(t, []string{"Miete"}, notes(t, v))
+	insertNote(t, v, "Strom")
+	require.NoError(t, v.Close())
+
+	v = openVault(t, path, "geheim")
+	defer v.Close()
+	assert.Equal(t, []string{"Miete", "Strom"}, notes(t, v))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+}
+
+func TestOpenFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "haushaltsbuch.vault")
+	v := openVault(t, path, "geheim")
+	insertNote(t, v, "Miete")
+	require.NoError(t, v.Close())
+	valid, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		content    func() []byte
+		passphrase string
+		expectErr  error
+	}{
+		{name: "Falsche Passphrase", content: func() []byte { return valid }, passphrase: "falsch", expectErr: vault.ErrUnreadable},
+		{name: "Leere Passphrase", content: func() []byte { return valid }, expectErr: vault.ErrEmptyPassphrase},
+		{name: "Veränderter Inhalt", content: func() []byte {
+			changed := append([]byte(nil), valid...)
+			changed[len(changed)-1] ^= 1
+			return changed
+		}, passphrase: "geheim", expectErr: vault.ErrUnreadable},
+		{name: "Veränderter Header", content: func() []byte {
+			changed := append([]byte(nil), valid...)
+			changed[20] ^= 1
+			return changed
+		}, passphrase: "geheim", expectErr: vault.ErrUnreadable},
+		{name: "Abgeschnitten", content: func() []byte { return valid[:len(valid)/2] }, passphrase: "geheim", expectErr: vault.ErrUnreadable},
+		{name: "Keine Vault-Datei", content: func() []byte { return []byte("SQLite format 3\x00") }, passphrase: "geheim", expectErr: vault.ErrNotAVault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.vault")
+			require.NoError(t, os.WriteFile(path, tt.content(), 0o600))
+			_, err := vault.Open(path, tt.passphrase, fastParams, nopLogger{}, time.Hour)
+			assert.ErrorIs(t, err, tt.expectErr)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "haushaltsbuch.vault")
+	v, err := vault.Open(path, "geheim", fastParams, nopLogger{}, 10*time.Millisecond)
+	require.NoError(t, err)
+	defer v.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- v.Run(ctx) }()
+
+	insertNote(t, v, "Miete")
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, time.Second, 10*time.Millisecond, "changes are saved in the background")
+
+	insertNote(t, v, "Strom")
+	cancel()
+	require.NoError(t, <-done)
+	saved := openVault(t, path, "geheim")
+	defer saved.Close()
+	assert.Equal(t, []string{"Miete", "Strom"}, notes(t, saved), "the last changes are saved on shutdown")
+}
+
+// The stores share the single connection of the vault, so their contracts also
+// prove that no store waits for a second connection.
+func TestStores(t *testing.T) {
+	t.Run("User", func(t *testing.T) {
+		usertest.TestStore(t, func(t *testing.T) user.Store {
+			return user.NewSQLiteUserRepository(openMigrated(t).DB())
+		})
+	})
+	t.Run("Ledger", func(t *testing.T) {
+		ledgertest.TestStore(t, func(t *testing.T) ledger.Store {
+			return ledger.NewSQLiteRepository(openMigrated(t).DB())
+		})
+	})
+}
@@ -2,7 +2,9 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
 )
 
 // Logger Interface for Logging system wide
@@ -17,11 +19,12 @@ type Logger interface {
 // SystemLogger ...
 type SystemLogger struct {
 	log *slog.Logger
+	out io.Writer
 }
 
-// New SystemLogger
+// New SystemLogger that writes to stderr
 func New() *SystemLogger {
-	return &SystemLogger{log: slog.New(slog.Default().Handler())}
+	return &SystemLogger{log: slog.New(slog.NewTextHandler(os.Stderr, nil)), out: os.Stderr}
 }
 
 // Info log
@@ -48,3 +51,11 @@ func (s *SystemLogger) Fatal(msg string) {
 func (s *SystemLogger) Debug(msg string) {
 	s.log.Debug(msg)
 }
+
+// Sync flushes the writer of the log handler, so no entry is lost when the process exits
+func (s *SystemLogger) Sync() error {
+	if syncer, ok := s.out.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}